@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apikeys"
+	"github.com/spf13/pflag"
+)
+
+// apiKeyCommand is the name of the subcommand which manages API keys
+const apiKeyCommand = "api-key"
+
+const apiKeyUsage = `Usage:
+  oauth2-proxy api-key generate --user USER [--email EMAIL] [--group GROUP]... [--route PATH_REGEX]... [--expires-in DURATION] [--output file|redis]
+  oauth2-proxy api-key hash [KEY]
+
+generate creates a new API key and prints the entry to add to the API keys
+file or to Redis. hash prints the hash of an existing key, read from stdin if
+it is not given.
+`
+
+// runAPIKeyCommand runs the api-key subcommand with its arguments
+func runAPIKeyCommand(args []string, in io.Reader, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(apiKeyUsage)
+	}
+
+	switch args[0] {
+	case "generate":
+		return generateAPIKey(args[1:], out, time.Now)
+	case "hash":
+		return hashAPIKey(args[1:], in, out)
+	default:
+		return fmt.Errorf("unknown api-key command %q\n%s", args[0], apiKeyUsage)
+	}
+}
+
+func generateAPIKey(args []string, out io.Writer, now func() time.Time) error {
+	flagSet := pflag.NewFlagSet("api-key generate", pflag.ContinueOnError)
+	flagSet.SetOutput(io.Discard)
+	user := flagSet.String("user", "", "user of the sessions created for the key")
+	email := flagSet.String("email", "", "email of the sessions created for the key")
+	groups := flagSet.StringSlice("group", nil, "groups of the sessions created for the key (may be given multiple times)")
+	routes := flagSet.StringArray("route", nil, "regular expression for the request paths the key may be used on (may be given multiple times)")
+	expiresIn := flagSet.Duration("expires-in", 0, "how long the key is valid for; the key does not expire if 0")
+	output := flagSet.String("output", "file", "format of the printed entry: file for the API keys file or redis for Redis")
+	if err := flagSet.Parse(args); err != nil {
+		return fmt.Errorf("%v\n%s", err, apiKeyUsage)
+	}
+
+	if *user == "" {
+		return errors.New("--user is required")
+	}
+	for _, route := range *routes {
+		if _, err := regexp.Compile(route); err != nil {
+			return fmt.Errorf("invalid route %q: %v", route, err)
+		}
+	}
+	if *expiresIn < 0 {
+		return errors.New("--expires-in must not be negative")
+	}
+	if *output != "file" && *output != "redis" {
+		return fmt.Errorf("unknown output %q: must be file or redis", *output)
+	}
+
+	key, err := apikeys.Generate()
+	if err != nil {
+		return err
+	}
+	entry := apikeys.Key{
+		Hash:   apikeys.Hash(key),
+		User:   *user,
+		Email:  *email,
+		Groups: *groups,
+		Routes: *routes,
+	}
+	if *expiresIn > 0 {
+		expiresOn := now().Add(*expiresIn).UTC().Truncate(time.Second)
+		entry.ExpiresOn = &expiresOn
+	}
+
+	fmt.Fprintf(out, "API key (it is not stored and cannot be shown again):\n%s\n\n", key)
+	if *output == "redis" {
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("could not encode api key entry: %v", err)
+		}
+		fmt.Fprintf(out, "Store the entry in Redis:\nSET %s '%s'\n", apikeys.StoreKey(entry.Hash), value)
+		return nil
+	}
+
+	value, err := yaml.Marshal([]apikeys.Key{entry})
+	if err != nil {
+		return fmt.Errorf("could not encode api key entry: %v", err)
+	}
+	fmt.Fprintf(out, "Add the entry to the keys list of the API keys file:\n%s", value)
+	return nil
+}
+
+func hashAPIKey(args []string, in io.Reader, out io.Writer) error {
+	var key string
+	switch len(args) {
+	case 0:
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("could not read api key: %v", err)
+		}
+		key = strings.TrimSpace(line)
+	case 1:
+		key = args[0]
+	default:
+		return errors.New(apiKeyUsage)
+	}
+
+	if key == "" {
+		return errors.New("api key must not be empty")
+	}
+	fmt.Fprintln(out, apikeys.Hash(key))
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apikeys"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("API Key Command Suite", func() {
+	It("generates a key and its keys file entry", func() {
+		now := func() time.Time { return time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC) }
+		out := &bytes.Buffer{}
+		err := generateAPIKey([]string{
+			"--user", "ci",
+			"--group", "deployers",
+			"--route", "^/api/(deploy|status)$",
+			"--expires-in", "24h",
+		}, out, now)
+		Expect(err).ToNot(HaveOccurred())
+
+		lines := strings.SplitN(out.String(), "\n", 5)
+		key := lines[1]
+		Expect(key).To(HavePrefix(apikeys.KeyPrefix))
+		Expect(lines[3]).To(Equal("Add the entry to the keys list of the API keys file:"))
+
+		var entries []apikeys.Key
+		Expect(yaml.Unmarshal([]byte(lines[4]), &entries)).To(Succeed())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Hash).To(Equal(apikeys.Hash(key)))
+		Expect(entries[0].User).To(Equal("ci"))
+		Expect(entries[0].Groups).To(ConsistOf("deployers"))
+		Expect(entries[0].Routes).To(ConsistOf("^/api/(deploy|status)$"))
+		Expect(entries[0].ExpiresOn.Equal(time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC))).To(BeTrue())
+	})
+
+	It("generates a key and its redis entry", func() {
+		out := &bytes.Buffer{}
+		Expect(runAPIKeyCommand([]string{"generate", "--user", "ci", "--output", "redis"}, nil, out)).To(Succeed())
+
+		lines := strings.Split(out.String(), "\n")
+		key := lines[1]
+		Expect(lines[4]).To(Equal("SET oauth2-proxy-apikey-" + apikeys.Hash(key) + ` '{"hash":"` + apikeys.Hash(key) + `","user":"ci"}'`))
+	})
+
+	DescribeTable("rejects invalid generate arguments",
+		func(args []string, expectedErr string) {
+			err := runAPIKeyCommand(append([]string{"generate"}, args...), nil, &bytes.Buffer{})
+			Expect(err).To(MatchError(expectedErr))
+		},
+		Entry("without a user", []string{}, "--user is required"),
+		Entry("with an invalid route", []string{"--user", "ci", "--route", "("}, "invalid route \"(\": error parsing regexp: missing closing ): `(`"),
+		Entry("with a negative expiry", []string{"--user", "ci", "--expires-in", "-1h"}, "--expires-in must not be negative"),
+		Entry("with an unknown output", []string{"--user", "ci", "--output", "json"}, "unknown output \"json\": must be file or redis"),
+	)
+
+	It("hashes a key given as an argument", func() {
+		out := &bytes.Buffer{}
+		Expect(runAPIKeyCommand([]string{"hash", "abc"}, nil, out)).To(Succeed())
+		Expect(out.String()).To(Equal(apikeys.Hash("abc") + "\n"))
+	})
+
+	It("hashes a key read from stdin", func() {
+		out := &bytes.Buffer{}
+		Expect(runAPIKeyCommand([]string{"hash"}, strings.NewReader("abc\n"), out)).To(Succeed())
+		Expect(out.String()).To(Equal(apikeys.Hash("abc") + "\n"))
+	})
+
+	It("rejects an unknown command", func() {
+		err := runAPIKeyCommand([]string{"revoke"}, nil, &bytes.Buffer{})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(HavePrefix("unknown api-key command \"revoke\""))
+	})
+})
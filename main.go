@@ -16,6 +16,14 @@ import (
 func main() {
 	logger.SetFlags(logger.Lshortfile)
 
+	if len(os.Args) > 1 && os.Args[1] == apiKeyCommand {
+		if err := runAPIKeyCommand(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	configFlagSet := pflag.NewFlagSet("oauth2-proxy", pflag.ContinueOnError)
 
 	// Because we parse early to determine alpha vs legacy config, we have to
@@ -13,12 +13,15 @@ import (
 	"os"
 	"os/signal"
 	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/justinas/alice"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/allowlist"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apikeys"
 	ipapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/ip"
 	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
@@ -27,7 +30,9 @@ import (
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/app/redirect"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/authentication/basic"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cookies"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/dpop"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/events"
 	proxyhttp "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/http"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/util"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/version"
@@ -35,10 +40,14 @@ import (
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/proxyjwt"
 	requestutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests/util"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/binding"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/upstream"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/providers"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
@@ -54,6 +63,13 @@ const (
 	authOnlyPath      = "/auth"
 	userInfoPath      = "/userinfo"
 	staticPathPrefix  = "/static/"
+
+	deviceAuthorizePath = "/device/authorize"
+	deviceTokenPath     = "/device/token"
+
+	proxyJWKSPath = "/jwks"
+
+	sessionLimitMessage = "You have too many active sessions. Sign out of another session and try again."
 )
 
 var (
@@ -67,15 +83,13 @@ var (
 	staticFiles embed.FS
 )
 
-// allowedRoute manages method + path based allowlists
-type allowedRoute struct {
-	method    string
-	negate    bool
-	pathRegex *regexp.Regexp
-}
-
+// apiRoute identifies API requests, which receive JSON errors instead of
+// redirects. Sessions must have been granted all of the scopes and, when
+// set, one of the audiences to access the route.
 type apiRoute struct {
 	pathRegex *regexp.Regexp
+	scopes    []string
+	audiences []string
 }
 
 // OAuthProxy is the main authentication proxy
@@ -85,7 +99,7 @@ type OAuthProxy struct {
 
 	SignInPath string
 
-	allowedRoutes        []allowedRoute
+	allowlist            *allowlist.Allowlist
 	apiRoutes            []apiRoute
 	redirectURL          *url.URL // the url to receive requests at
 	relativeRedirectURL  bool
@@ -113,30 +127,46 @@ type OAuthProxy struct {
 	redirectValidator redirect.Validator
 	appDirector       redirect.AppDirector
 
-	encodeState bool
+	encodeState      bool
+	enableDeviceFlow bool
+
+	sessionIdleTimeout time.Duration
+	sessionMaxAge      time.Duration
+	sessionEvents      *events.Dispatcher
+	sessionBinder      *binding.Binder
+	stepUpMatcher      *upstream.StepUpMatcher
+	proxyJWTSigner     *proxyjwt.Signer
+	sessionRefresher   *persistence.Refresher
 }
 
 // NewOAuthProxy creates a new instance of OAuthProxy from the options provided
 func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthProxy, error) {
+	if opts.Cookie.SecretKeysetFile != "" {
+		logger.Printf("using cookie secret keyset file: %s", opts.Cookie.SecretKeysetFile)
+		keyset, err := cookies.NewKeysetFromFile(opts.Cookie.SecretKeysetFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading cookie secret keyset: %v", err)
+		}
+		opts.Cookie.SetKeyset(keyset)
+	}
+
 	sessionStore, err := sessions.NewSessionStore(&opts.Session, &opts.Cookie)
 	if err != nil {
 		return nil, fmt.Errorf("error initialising session store: %v", err)
 	}
 
-	var basicAuthValidator basic.Validator
-	if opts.HtpasswdFile != "" {
-		logger.Printf("using htpasswd file: %s", opts.HtpasswdFile)
-		var err error
-		basicAuthValidator, err = basic.NewHTPasswdValidator(opts.HtpasswdFile)
-		if err != nil {
-			return nil, fmt.Errorf("could not validate htpasswd: %v", err)
-		}
+	basicAuthValidator, err := buildBasicAuthValidator(opts)
+	if err != nil {
+		return nil, err
 	}
 
 	provider, err := providers.NewProvider(opts.Providers[0])
 	if err != nil {
 		return nil, fmt.Errorf("error initialising provider: %v", err)
 	}
+	if opts.EnableDeviceFlow && !provider.Data().DeviceFlowEnabled() {
+		return nil, errors.New("device flow is enabled but the provider has no device authorization endpoint")
+	}
 
 	pageWriter, err := pagewriter.NewWriter(pagewriter.Opts{
 		TemplatesPath:    opts.Templates.Path,
@@ -153,17 +183,28 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 		return nil, fmt.Errorf("error initialising page writer: %v", err)
 	}
 
-	upstreamProxy, err := upstream.NewProxy(opts.UpstreamServers, opts.GetSignatureData(), pageWriter)
+	upstreamProxy, err := upstream.NewProxy(opts.UpstreamServers, opts.GetSignatureData(), pageWriter, provider.Data())
 	if err != nil {
 		return nil, fmt.Errorf("error initialising upstream proxy: %v", err)
 	}
 
+	stepUpMatcher, err := upstream.NewStepUpMatcher(opts.UpstreamServers)
+	if err != nil {
+		return nil, fmt.Errorf("error initialising step-up matcher: %v", err)
+	}
+
 	if opts.SkipJwtBearerTokens {
 		logger.Printf("Skipping JWT tokens from configured OIDC issuer: %q", opts.Providers[0].OIDCConfig.IssuerURL)
 		for _, issuer := range opts.ExtraJwtIssuers {
 			logger.Printf("Skipping JWT tokens from extra JWT issuer: %q", issuer)
 		}
 	}
+	if opts.IntrospectBearerTokens {
+		if !provider.Data().IntrospectionEnabled() {
+			return nil, errors.New("token introspection is enabled but the provider has no introspection endpoint")
+		}
+		logger.Printf("Skipping tokens reported as active by the introspection endpoint: %q", provider.Data().IntrospectionURL)
+	}
 	redirectURL := opts.GetRedirectURL()
 	if redirectURL.Path == "" {
 		redirectURL.Path = fmt.Sprintf("%s/callback", opts.ProxyPrefix)
@@ -186,9 +227,9 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 		}
 	}
 
-	allowedRoutes, err := buildRoutesAllowlist(opts)
+	routesAllowlist, err := allowlist.NewAllowlist(opts.AllowlistRules, opts.GetRealClientIPParser())
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error initialising allowlist: %v", err)
 	}
 
 	apiRoutes, err := buildAPIRoutes(opts)
@@ -196,12 +237,39 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 		return nil, err
 	}
 
+	sessionEventSinks, err := events.NewSinks(opts.SessionEvents)
+	if err != nil {
+		return nil, fmt.Errorf("error initialising session event sinks: %v", err)
+	}
+	sessionEvents := events.NewDispatcher(provider.Data().ProviderName, opts.GetRealClientIPParser(), sessionEventSinks...)
+
+	sessionBinder, err := binding.NewBinder(opts.Session.Binding, opts.GetRealClientIPParser())
+	if err != nil {
+		return nil, fmt.Errorf("error initialising session binding: %v", err)
+	}
+
 	preAuthChain, err := buildPreAuthChain(opts, sessionStore)
 	if err != nil {
 		return nil, fmt.Errorf("could not build pre-auth chain: %v", err)
 	}
-	sessionChain := buildSessionChain(opts, provider, sessionStore, basicAuthValidator)
-	headersChain, err := buildHeadersChain(opts)
+	apiKeyStores, err := apikeys.NewStores(opts.APIKeys, opts.Session.Redis)
+	if err != nil {
+		return nil, fmt.Errorf("error initialising api key stores: %v", err)
+	}
+
+	sessionChain := buildSessionChain(opts, provider, sessionStore, basicAuthValidator, apiKeyStores, sessionEvents, sessionBinder)
+	sessionRefresher, err := buildSessionRefresher(opts, provider, sessionStore, sessionEvents, sessionBinder)
+	if err != nil {
+		return nil, fmt.Errorf("error initialising background session refresh: %v", err)
+	}
+	var proxyJWTSigner *proxyjwt.Signer
+	if opts.ProxyJWT != nil {
+		proxyJWTSigner, err = proxyjwt.NewSigner(*opts.ProxyJWT)
+		if err != nil {
+			return nil, fmt.Errorf("could not build proxy JWT signer: %v", err)
+		}
+	}
+	headersChain, err := buildHeadersChain(opts, proxyJWTSigner)
 	if err != nil {
 		return nil, fmt.Errorf("could not build headers chain: %v", err)
 	}
@@ -224,7 +292,7 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 		redirectURL:          redirectURL,
 		relativeRedirectURL:  opts.RelativeRedirectURL,
 		apiRoutes:            apiRoutes,
-		allowedRoutes:        allowedRoutes,
+		allowlist:            routesAllowlist,
 		whitelistDomains:     opts.WhitelistDomains,
 		skipAuthPreflight:    opts.SkipAuthPreflight,
 		skipJwtBearerTokens:  opts.SkipJwtBearerTokens,
@@ -244,6 +312,14 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 		redirectValidator:  redirectValidator,
 		appDirector:        appDirector,
 		encodeState:        opts.EncodeState,
+		enableDeviceFlow:   opts.EnableDeviceFlow,
+		sessionIdleTimeout: opts.Session.IdleTimeout,
+		sessionMaxAge:      opts.Session.MaxAge,
+		sessionEvents:      sessionEvents,
+		sessionBinder:      sessionBinder,
+		stepUpMatcher:      stepUpMatcher,
+		proxyJWTSigner:     proxyJWTSigner,
+		sessionRefresher:   sessionRefresher,
 	}
 	p.buildServeMux(opts.ProxyPrefix)
 
@@ -271,7 +347,15 @@ func (p *OAuthProxy) Start() error {
 		cancel() // cancel the context
 	}()
 
-	return p.server.Start(ctx)
+	if p.sessionRefresher != nil {
+		go p.sessionRefresher.Run(ctx)
+	}
+
+	err := p.server.Start(ctx)
+	if closeErr := p.sessionEvents.Close(); closeErr != nil {
+		logger.Errorf("Error closing session event sinks: %v", closeErr)
+	}
+	return err
 }
 
 func (p *OAuthProxy) setupServer(opts *options.Options) error {
@@ -338,6 +422,15 @@ func (p *OAuthProxy) buildProxySubrouter(s *mux.Router) {
 	s.Path(oauthStartPath).HandlerFunc(p.OAuthStart)
 	s.Path(oauthCallbackPath).HandlerFunc(p.OAuthCallback)
 
+	if p.enableDeviceFlow {
+		s.Path(deviceAuthorizePath).Methods(http.MethodPost).HandlerFunc(p.DeviceAuthorize)
+		s.Path(deviceTokenPath).Methods(http.MethodPost).HandlerFunc(p.DeviceToken)
+	}
+
+	if p.proxyJWTSigner != nil {
+		s.Path(proxyJWKSPath).Methods(http.MethodGet).HandlerFunc(p.ProxyJWKS)
+	}
+
 	// Static file paths
 	s.PathPrefix(staticPathPrefix).Handler(http.StripPrefix(p.ProxyPrefix, http.FileServer(http.FS(staticFiles))))
 
@@ -350,7 +443,11 @@ func (p *OAuthProxy) buildProxySubrouter(s *mux.Router) {
 // the OAuth2 Proxy authentication logic kicks in.
 // For example forcing HTTPS or health checks.
 func buildPreAuthChain(opts *options.Options, sessionStore sessionsapi.SessionStore) (alice.Chain, error) {
-	chain := alice.New(middleware.NewScope(opts.ReverseProxy, opts.Logging.RequestIDHeader))
+	trustedProxies, err := ip.ParseNetSet(opts.TrustedProxies)
+	if err != nil {
+		return alice.Chain{}, err
+	}
+	chain := alice.New(middleware.NewScope(opts.ReverseProxy, opts.Logging.RequestIDHeader, trustedProxies, opts.RealClientIPHeader))
 
 	if opts.ForceHTTPS {
 		_, httpsPort, err := net.SplitHostPort(opts.Server.SecureBindAddress)
@@ -389,43 +486,114 @@ func buildPreAuthChain(opts *options.Options, sessionStore sessionsapi.SessionSt
 	return chain, nil
 }
 
-func buildSessionChain(opts *options.Options, provider providers.Provider, sessionStore sessionsapi.SessionStore, validator basic.Validator) alice.Chain {
+// buildBasicAuthValidator builds the validator for basic auth and sign in
+// form credentials. Credentials are checked against the htpasswd file first
+// and then against the LDAP directory.
+func buildBasicAuthValidator(opts *options.Options) (basic.Validator, error) {
+	var validators []basic.Validator
+	if opts.HtpasswdFile != "" {
+		logger.Printf("using htpasswd file: %s", opts.HtpasswdFile)
+		htpasswdValidator, err := basic.NewHTPasswdValidator(opts.HtpasswdFile, opts.HtpasswdGroupsFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not validate htpasswd: %v", err)
+		}
+		validators = append(validators, htpasswdValidator)
+	}
+	if opts.LDAP.URL != "" {
+		logger.Printf("using LDAP server: %s", opts.LDAP.URL)
+		ldapValidator, err := basic.NewLDAPValidator(opts.LDAP)
+		if err != nil {
+			return nil, fmt.Errorf("could not initialise LDAP validator: %v", err)
+		}
+		validators = append(validators, ldapValidator)
+	}
+	return basic.NewValidatorChain(validators...), nil
+}
+
+func buildSessionChain(opts *options.Options, provider providers.Provider, sessionStore sessionsapi.SessionStore, validator basic.Validator, apiKeyStores []apikeys.Store, sessionEvents *events.Dispatcher, sessionBinder *binding.Binder) alice.Chain {
 	chain := alice.New()
 
-	if opts.SkipJwtBearerTokens {
-		sessionLoaders := []middlewareapi.TokenToSessionFunc{
-			provider.CreateSessionFromToken,
+	if opts.SkipJwtBearerTokens || opts.IntrospectBearerTokens {
+		var sessionLoaders, opaqueSessionLoaders []middlewareapi.TokenToSessionFunc
+		if opts.SkipJwtBearerTokens {
+			sessionLoaders = append(sessionLoaders, provider.CreateSessionFromToken)
+			for _, verifier := range opts.GetJWTBearerVerifiers() {
+				sessionLoaders = append(sessionLoaders,
+					middlewareapi.CreateTokenToSessionFunc(verifier.Verify))
+			}
 		}
-
-		for _, verifier := range opts.GetJWTBearerVerifiers() {
-			sessionLoaders = append(sessionLoaders,
-				middlewareapi.CreateTokenToSessionFunc(verifier.Verify))
+		if opts.IntrospectBearerTokens {
+			opaqueSessionLoaders = append(opaqueSessionLoaders,
+				providers.NewIntrospectionSessionLoader(provider.Data(), opts.IntrospectionCacheSize))
 		}
 
-		chain = chain.Append(middleware.NewJwtSessionLoader(sessionLoaders))
+		chain = chain.Append(middleware.NewBearerTokenSessionLoader(sessionLoaders, opaqueSessionLoaders))
+	}
+
+	if len(apiKeyStores) > 0 {
+		chain = chain.Append(middleware.NewAPIKeySessionLoader(&middleware.APIKeySessionLoaderOptions{
+			Stores:       apiKeyStores,
+			Header:       opts.APIKeys.Header,
+			QueryParam:   opts.APIKeys.QueryParam,
+			AuthOnlyPath: opts.ProxyPrefix + authOnlyPath,
+		}))
 	}
 
 	if validator != nil {
 		chain = chain.Append(middleware.NewBasicAuthSessionLoader(validator, opts.HtpasswdUserGroups, opts.LegacyPreferEmailToUser))
 	}
 
-	chain = chain.Append(middleware.NewStoredSessionLoader(&middleware.StoredSessionLoaderOptions{
-		SessionStore:    sessionStore,
-		RefreshPeriod:   opts.Cookie.Refresh,
-		RefreshSession:  provider.RefreshSession,
-		ValidateSession: provider.ValidateSession,
-	}))
+	chain = chain.Append(middleware.NewStoredSessionLoader(buildStoredSessionLoaderOptions(opts, provider, sessionStore, sessionEvents, sessionBinder)))
 
 	return chain
 }
 
-func buildHeadersChain(opts *options.Options) (alice.Chain, error) {
-	requestInjector, err := middleware.NewRequestHeaderInjector(opts.InjectRequestHeaders)
+func buildStoredSessionLoaderOptions(opts *options.Options, provider providers.Provider, sessionStore sessionsapi.SessionStore, sessionEvents *events.Dispatcher, sessionBinder *binding.Binder) *middleware.StoredSessionLoaderOptions {
+	return &middleware.StoredSessionLoaderOptions{
+		SessionStore:          sessionStore,
+		RefreshPeriod:         opts.Cookie.Refresh,
+		IdleTimeout:           opts.Session.IdleTimeout,
+		ActivityWriteInterval: opts.Session.ActivityWriteInterval,
+		MaxAge:                opts.Session.MaxAge,
+		RefreshSkew:           opts.Session.RefreshSkew,
+		MigrateOnRead:         opts.Session.MigrateOnRead,
+		SessionWriteVersion:   uint8(opts.Session.WriteVersion),
+		SessionEvents:         sessionEvents,
+		SessionBinder:         sessionBinder,
+		RefreshSession:        provider.RefreshSession,
+		ValidateSession:       provider.ValidateSession,
+	}
+}
+
+// buildSessionRefresher sets up refreshing persisted sessions in the
+// background. It returns nil if background refresh is disabled.
+func buildSessionRefresher(opts *options.Options, provider providers.Provider, sessionStore sessionsapi.SessionStore, sessionEvents *events.Dispatcher, sessionBinder *binding.Binder) (*persistence.Refresher, error) {
+	if !opts.Session.BackgroundRefresh.Enabled {
+		return nil, nil
+	}
+
+	loaderOpts := buildStoredSessionLoaderOptions(opts, provider, sessionStore, sessionEvents, sessionBinder)
+	refresher := persistence.NewRefresher(persistence.RefresherOptions{
+		Refresh:     middleware.NewBackgroundSessionRefresher(loaderOpts),
+		Window:      opts.Session.BackgroundRefresh.Window,
+		Jitter:      opts.Session.BackgroundRefresh.Jitter,
+		Interval:    opts.Session.BackgroundRefresh.Interval,
+		Concurrency: opts.Session.BackgroundRefresh.Concurrency,
+		Registerer:  prometheus.DefaultRegisterer,
+	})
+	if err := sessions.SetRefresher(sessionStore, refresher); err != nil {
+		return nil, err
+	}
+	return refresher, nil
+}
+
+func buildHeadersChain(opts *options.Options, signer *proxyjwt.Signer) (alice.Chain, error) {
+	requestInjector, err := middleware.NewRequestHeaderInjector(opts.InjectRequestHeaders, signer)
 	if err != nil {
 		return alice.Chain{}, fmt.Errorf("error constructing request header injector: %v", err)
 	}
 
-	responseInjector, err := middleware.NewResponseHeaderInjector(opts.InjectResponseHeaders)
+	responseInjector, err := middleware.NewResponseHeaderInjector(opts.InjectResponseHeaders, signer)
 	if err != nil {
 		return alice.Chain{}, fmt.Errorf("error constructing request header injector: %v", err)
 	}
@@ -458,73 +626,62 @@ func buildProviderName(p providers.Provider, override string) string {
 	return p.Data().ProviderName
 }
 
-// buildRoutesAllowlist builds an []allowedRoute  list from either the legacy
-// SkipAuthRegex option (paths only support) or newer SkipAuthRoutes option
-// (method=path support)
-func buildRoutesAllowlist(opts *options.Options) ([]allowedRoute, error) {
-	routes := make([]allowedRoute, 0, len(opts.SkipAuthRegex)+len(opts.SkipAuthRoutes))
+// buildAPIRoutes builds an []apiRoute from the ApiRoutes option (paths only)
+// and the APIRouteScopes and APIRouteAudiences options (requirements=path)
+func buildAPIRoutes(opts *options.Options) ([]apiRoute, error) {
+	routes := make([]apiRoute, 0, len(opts.APIRoutes)+len(opts.APIRouteScopes)+len(opts.APIRouteAudiences))
 
-	for _, path := range opts.SkipAuthRegex {
+	for _, path := range opts.APIRoutes {
 		compiledRegex, err := regexp.Compile(path)
 		if err != nil {
 			return nil, err
 		}
-		logger.Printf("Skipping auth - Method: ALL | Path: %s", path)
-		routes = append(routes, allowedRoute{
-			method:    "",
+		logger.Printf("API route - Path: %s", path)
+		routes = append(routes, apiRoute{
 			pathRegex: compiledRegex,
 		})
 	}
 
-	for _, methodPath := range opts.SkipAuthRoutes {
-		var (
-			method string
-			path   string
-			negate = strings.Contains(methodPath, "!=")
-		)
-
-		parts := regexp.MustCompile("!?=").Split(methodPath, 2)
-		if len(parts) == 1 {
-			method = ""
-			path = parts[0]
-		} else {
-			method = strings.ToUpper(parts[0])
-			path = parts[1]
-		}
-
-		compiledRegex, err := regexp.Compile(path)
+	for _, scopesPath := range opts.APIRouteScopes {
+		scopes, compiledRegex, err := splitAPIRouteRequirement(scopesPath)
 		if err != nil {
 			return nil, err
 		}
-		logger.Printf("Skipping auth - Method: %s | Path: %s", method, path)
-		routes = append(routes, allowedRoute{
-			method:    method,
-			negate:    negate,
+		logger.Printf("API route - Scopes: %s | Path: %s", strings.Join(scopes, " "), compiledRegex)
+		routes = append(routes, apiRoute{
 			pathRegex: compiledRegex,
+			scopes:    scopes,
 		})
 	}
 
-	return routes, nil
-}
-
-// buildAPIRoutes builds an []apiRoute from ApiRoutes option
-func buildAPIRoutes(opts *options.Options) ([]apiRoute, error) {
-	routes := make([]apiRoute, 0, len(opts.APIRoutes))
-
-	for _, path := range opts.APIRoutes {
-		compiledRegex, err := regexp.Compile(path)
+	for _, audiencesPath := range opts.APIRouteAudiences {
+		audiences, compiledRegex, err := splitAPIRouteRequirement(audiencesPath)
 		if err != nil {
 			return nil, err
 		}
-		logger.Printf("API route - Path: %s", path)
+		logger.Printf("API route - Audiences: %s | Path: %s", strings.Join(audiences, " "), compiledRegex)
 		routes = append(routes, apiRoute{
 			pathRegex: compiledRegex,
+			audiences: audiences,
 		})
 	}
 
 	return routes, nil
 }
 
+// splitAPIRouteRequirement splits a `value[ value...]=path_regex` route
+func splitAPIRouteRequirement(route string) ([]string, *regexp.Regexp, error) {
+	parts := strings.SplitN(route, "=", 2)
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("invalid API route %q, expected value[ value...]=path_regex", route)
+	}
+	compiledRegex, err := regexp.Compile(parts[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return strings.Fields(parts[0]), compiledRegex, nil
+}
+
 // ClearSessionCookie creates a cookie to unset the user's authentication cookie
 // stored in the user's session
 func (p *OAuthProxy) ClearSessionCookie(rw http.ResponseWriter, req *http.Request) error {
@@ -536,8 +693,10 @@ func (p *OAuthProxy) LoadCookiedSession(req *http.Request) (*sessionsapi.Session
 	return p.sessionStore.Load(req)
 }
 
-// SaveSession creates a new session cookie value and sets this on the response
+// SaveSession binds the session to the client when session binding is enabled,
+// then creates a new session cookie value and sets this on the response
 func (p *OAuthProxy) SaveSession(rw http.ResponseWriter, req *http.Request, s *sessionsapi.SessionState) error {
+	p.sessionBinder.Bind(req, s)
 	return p.sessionStore.Save(rw, req, s)
 }
 
@@ -571,34 +730,86 @@ func (p *OAuthProxy) IsAllowedRequest(req *http.Request) bool {
 	return isPreflightRequestAllowed || p.isAllowedRoute(req) || p.isTrustedIP(req)
 }
 
-func isAllowedMethod(req *http.Request, route allowedRoute) bool {
-	return route.method == "" || req.Method == route.method
+// isAllowedRoute is used to check if the request is allowed without auth by
+// an allowlist rule with the skipAuth policy
+func (p *OAuthProxy) isAllowedRoute(req *http.Request) bool {
+	policy, ok := p.allowlist.Match(req)
+	return ok && policy == options.SkipAuthAllowlistPolicy
 }
 
-func isAllowedPath(req *http.Request, route allowedRoute) bool {
-	matches := route.pathRegex.MatchString(requestutil.GetRequestURI(req))
-
-	if route.negate {
-		return !matches
-	}
-
-	return matches
+// isAnonymousRoute is used to check if the request is allowed without a
+// session by an allowlist rule with the anonymous policy
+func (p *OAuthProxy) isAnonymousRoute(req *http.Request) bool {
+	policy, ok := p.allowlist.Match(req)
+	return ok && policy == options.AnonymousAllowlistPolicy
 }
 
-// IsAllowedRoute is used to check if the request method & path is allowed without auth
-func (p *OAuthProxy) isAllowedRoute(req *http.Request) bool {
-	for _, route := range p.allowedRoutes {
-		if isAllowedMethod(req, route) && isAllowedPath(req, route) {
+func (p *OAuthProxy) isAPIPath(req *http.Request) bool {
+	for _, route := range p.apiRoutes {
+		if route.pathRegex.MatchString(requestutil.GetRequestURI(req)) {
 			return true
 		}
 	}
 	return false
 }
 
-func (p *OAuthProxy) isAPIPath(req *http.Request) bool {
+// checkAPIRouteRequirements checks that the session was granted the scopes
+// and audiences required by every API route matching the request.
+// It returns an RFC 6750 error description when a requirement is not met.
+func (p *OAuthProxy) checkAPIRouteRequirements(req *http.Request, session *sessionsapi.SessionState) (string, bool) {
+	if session == nil {
+		// Requests allowed without authentication have no session to check
+		return "", true
+	}
+
+	granted := make(map[string]struct{}, len(session.Scopes))
+	for _, scope := range session.Scopes {
+		granted[scope] = struct{}{}
+	}
+
+	var missingScopes []string
+	audienceAllowed := true
 	for _, route := range p.apiRoutes {
-		if route.pathRegex.MatchString(requestutil.GetRequestURI(req)) {
-			return true
+		if !route.pathRegex.MatchString(requestutil.GetRequestURI(req)) {
+			continue
+		}
+		for _, scope := range route.scopes {
+			if _, ok := granted[scope]; !ok {
+				// Record the scope so that it is only reported once
+				granted[scope] = struct{}{}
+				missingScopes = append(missingScopes, scope)
+			}
+		}
+		if len(route.audiences) > 0 && !hasAllowedAudience(session.Audiences, route.audiences) {
+			audienceAllowed = false
+		}
+	}
+
+	switch {
+	case len(missingScopes) > 0:
+		return fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, strings.Join(missingScopes, " ")), false
+	case !audienceAllowed:
+		return `Bearer error="insufficient_scope", error_description="The access token audience is not allowed"`, false
+	default:
+		return "", true
+	}
+}
+
+// insufficientScope rejects a request whose session does not satisfy the
+// requirements of an API route
+func (p *OAuthProxy) insufficientScope(rw http.ResponseWriter, req *http.Request, session *sessionsapi.SessionState, challenge string) {
+	logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Session does not satisfy API route requirements: %s", challenge)
+	rw.Header().Set("WWW-Authenticate", challenge)
+	p.errorJSON(rw, http.StatusForbidden)
+}
+
+// hasAllowedAudience checks whether one of the token audiences is allowed
+func hasAllowedAudience(audiences, allowed []string) bool {
+	for _, aud := range audiences {
+		for _, a := range allowed {
+			if aud == a {
+				return true
+			}
 		}
 	}
 	return false
@@ -651,23 +862,24 @@ func (p *OAuthProxy) SignInPage(rw http.ResponseWriter, req *http.Request, code
 	p.pageWriter.WriteSignInPage(rw, req, redirectURL, code)
 }
 
-// ManualSignIn handles basic auth logins to the proxy
-func (p *OAuthProxy) ManualSignIn(req *http.Request) (string, bool, int) {
+// ManualSignIn handles sign in form logins to the proxy, returning the user
+// and their groups when the credentials are valid.
+func (p *OAuthProxy) ManualSignIn(req *http.Request) (string, []string, bool, int) {
 	if req.Method != "POST" || p.basicAuthValidator == nil {
-		return "", false, http.StatusOK
+		return "", nil, false, http.StatusOK
 	}
 	user := req.FormValue("username")
 	passwd := req.FormValue("password")
 	if user == "" {
-		return "", false, http.StatusBadRequest
+		return "", nil, false, http.StatusBadRequest
 	}
 	// check auth
-	if p.basicAuthValidator.Validate(user, passwd) {
-		logger.PrintAuthf(user, req, logger.AuthSuccess, "Authenticated via HtpasswdFile")
-		return user, true, http.StatusOK
+	if valid, groups := basic.Authenticate(p.basicAuthValidator, user, passwd); valid {
+		logger.PrintAuthf(user, req, logger.AuthSuccess, "Authenticated via sign in form")
+		return user, basic.MergeGroups(p.basicAuthGroups, groups), true, http.StatusOK
 	}
-	logger.PrintAuthf(user, req, logger.AuthFailure, "Invalid authentication via HtpasswdFile")
-	return "", false, http.StatusUnauthorized
+	logger.PrintAuthf(user, req, logger.AuthFailure, "Invalid authentication via sign in form")
+	return "", nil, false, http.StatusUnauthorized
 }
 
 // SignIn serves a page prompting users to sign in
@@ -679,10 +891,17 @@ func (p *OAuthProxy) SignIn(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	user, ok, statusCode := p.ManualSignIn(req)
+	user, groups, ok, statusCode := p.ManualSignIn(req)
 	if ok {
-		session := &sessionsapi.SessionState{User: user, Groups: p.basicAuthGroups}
+		session := &sessionsapi.SessionState{User: user, Groups: groups}
+		session.AuthenticatedAtNow()
 		err = p.SaveSession(rw, req, session)
+		if errors.Is(err, sessionsapi.ErrSessionLimitExceeded) {
+			logger.PrintAuthf(user, req, logger.AuthFailure, "Invalid authentication via sign in form: %v", err)
+			p.sessionEvents.Emit(req, events.AuthorizationDenied, session, "Concurrent session limit exceeded")
+			p.ErrorPage(rw, req, http.StatusForbidden, err.Error(), sessionLimitMessage)
+			return
+		}
 		if err != nil {
 			logger.Printf("Error saving session: %v", err)
 			p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
@@ -722,11 +941,15 @@ func (p *OAuthProxy) UserInfo(rw http.ResponseWriter, req *http.Request) {
 		Email             string   `json:"email"`
 		Groups            []string `json:"groups,omitempty"`
 		PreferredUsername string   `json:"preferredUsername,omitempty"`
+		IdleExpiresIn     *int64   `json:"idleExpiresIn,omitempty"`
+		MaxAgeExpiresIn   *int64   `json:"maxAgeExpiresIn,omitempty"`
 	}{
 		User:              session.User,
 		Email:             session.Email,
 		Groups:            session.Groups,
 		PreferredUsername: session.PreferredUsername,
+		IdleExpiresIn:     secondsUntil(session.IdleExpiresOn(p.sessionIdleTimeout)),
+		MaxAgeExpiresIn:   secondsUntil(session.MaxAgeExpiresOn(p.sessionMaxAge)),
 	}
 
 	if err := json.NewEncoder(rw).Encode(userInfo); err != nil {
@@ -735,6 +958,18 @@ func (p *OAuthProxy) UserInfo(rw http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// secondsUntil returns the number of whole seconds until t, or nil if t is nil
+func secondsUntil(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+	seconds := int64(time.Until(*t).Seconds())
+	if seconds < 0 {
+		seconds = 0
+	}
+	return &seconds
+}
+
 // SignOut sends a response to clear the authentication cookie
 func (p *OAuthProxy) SignOut(rw http.ResponseWriter, req *http.Request) {
 	redirect, err := p.appDirector.GetRedirect(req)
@@ -750,6 +985,10 @@ func (p *OAuthProxy) SignOut(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if session := middlewareapi.GetRequestScope(req).Session; session != nil {
+		p.sessionEvents.Emit(req, events.Logout, session, "Signed out")
+	}
+
 	p.backendLogout(rw, req)
 
 	http.Redirect(rw, req, redirect, http.StatusFound)
@@ -788,12 +1027,44 @@ func (p *OAuthProxy) backendLogout(rw http.ResponseWriter, req *http.Request) {
 
 // OAuthStart starts the OAuth2 authentication flow
 func (p *OAuthProxy) OAuthStart(rw http.ResponseWriter, req *http.Request) {
+	// When the redirect is served by an upstream requiring step-up
+	// authentication, such as after the auth endpoint rejected the session,
+	// request it from the provider straight away
+	var required url.Values
+	if stepUp := p.redirectStepUp(req); stepUp != nil {
+		p.setStepUpCookie(rw, req)
+		required = stepUpLoginParams(stepUp)
+	}
+
 	// start the flow permitting login URL query parameters to be overridden from the request URL
-	p.doOAuthStart(rw, req, req.URL.Query())
+	p.doOAuthStart(rw, req, req.URL.Query(), required)
 }
 
-func (p *OAuthProxy) doOAuthStart(rw http.ResponseWriter, req *http.Request, overrides url.Values) {
+// redirectStepUp returns the step-up requirements of the upstream serving
+// the redirect after login, or nil if it has none
+func (p *OAuthProxy) redirectStepUp(req *http.Request) *options.StepUp {
+	if p.stepUpMatcher == nil {
+		return nil
+	}
+	appRedirect, err := p.appDirector.GetRedirect(req)
+	if err != nil {
+		return nil
+	}
+	redirectReq, err := requestForURI(req, appRedirect)
+	if err != nil {
+		return nil
+	}
+	return p.stepUpMatcher.Match(redirectReq)
+}
+
+// doOAuthStart redirects the user to the provider's login URL. The overrides
+// are filtered by the provider's configured login URL parameters, whereas
+// the required parameters are always sent.
+func (p *OAuthProxy) doOAuthStart(rw http.ResponseWriter, req *http.Request, overrides url.Values, required url.Values) {
 	extraParams := p.provider.Data().LoginURLParams(overrides)
+	for param, values := range required {
+		extraParams[param] = values
+	}
 	prepareNoCache(rw)
 
 	var (
@@ -842,6 +1113,15 @@ func (p *OAuthProxy) doOAuthStart(rw http.ResponseWriter, req *http.Request, ove
 		extraParams,
 	)
 
+	// Move the login parameters out of the front channel if the provider
+	// supports pushed authorization requests or signed request objects
+	loginURL, err = p.provider.Data().PrepareLoginURL(req.Context(), loginURL)
+	if err != nil {
+		logger.Errorf("Error preparing login URL: %v", err)
+		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	if _, err := csrf.SetCookie(rw, req); err != nil {
 		logger.Errorf("Error setting CSRF cookie: %v", err)
 		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
@@ -892,6 +1172,13 @@ func (p *OAuthProxy) OAuthCallback(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	req, err = p.withDPoPKey(req)
+	if err != nil {
+		logger.Errorf("Error during OAuth2 callback: %v", err)
+		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	session, err := p.redeemCode(req, csrf.GetCodeVerifier())
 	if err != nil {
 		logger.Errorf("Error redeeming code during OAuth2 callback: %v", err)
@@ -932,19 +1219,167 @@ func (p *OAuthProxy) OAuthCallback(rw http.ResponseWriter, req *http.Request) {
 	}
 	if p.Validator(session.Email) && authorized {
 		logger.PrintAuthf(session.Email, req, logger.AuthSuccess, "Authenticated via OAuth2: %s", session)
+		session.AuthenticatedAtNow()
 		err := p.SaveSession(rw, req, session)
+		if errors.Is(err, sessionsapi.ErrSessionLimitExceeded) {
+			logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Invalid authentication via OAuth2: %v", err)
+			p.sessionEvents.Emit(req, events.AuthorizationDenied, session, "Concurrent session limit exceeded")
+			p.ErrorPage(rw, req, http.StatusForbidden, err.Error(), sessionLimitMessage)
+			return
+		}
 		if err != nil {
 			logger.Errorf("Error saving session state for %s: %v", remoteAddr, err)
 			p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
 			return
 		}
+		p.sessionEvents.Emit(req, events.Login, session, "Authenticated via OAuth2")
 		http.Redirect(rw, req, appRedirect, http.StatusFound)
 	} else {
 		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Invalid authentication via OAuth2: unauthorized")
+		p.sessionEvents.Emit(req, events.AuthorizationDenied, session, "Invalid authentication via OAuth2: unauthorized")
 		p.ErrorPage(rw, req, http.StatusForbidden, "Invalid session: unauthorized")
 	}
 }
 
+// ProxyJWKS serves the public key of the proxy JWT signer as a JSON Web Key
+// Set, so that upstreams can verify the tokens minted by the proxy.
+func (p *OAuthProxy) ProxyJWKS(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Content-Type", applicationJSON)
+	rw.WriteHeader(http.StatusOK)
+	if _, err := rw.Write(p.proxyJWTSigner.JWKS()); err != nil {
+		logger.Printf("Error writing JWKS: %v", err)
+	}
+}
+
+// DeviceAuthorize starts an OAuth 2.0 device authorization grant (RFC 8628)
+// with the provider and returns the device and user codes to the client
+func (p *OAuthProxy) DeviceAuthorize(rw http.ResponseWriter, req *http.Request) {
+	auth, err := p.provider.StartDeviceAuthorization(req.Context())
+	if err != nil {
+		logger.Errorf("Error starting device authorization: %v", err)
+		p.deviceErrorJSON(rw, http.StatusBadGateway, "server_error", "unable to start device authorization")
+		return
+	}
+
+	rw.Header().Set("Content-Type", applicationJSON)
+	rw.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(rw).Encode(auth); err != nil {
+		logger.Errorf("Error encoding device authorization: %v", err)
+	}
+}
+
+// DeviceToken polls the provider once for the given device code. Until the
+// user has completed the authorization the provider error is relayed to the
+// client. Once authorized, a session is created and the session cookie is set.
+func (p *OAuthProxy) DeviceToken(rw http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		p.deviceErrorJSON(rw, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if grantType := req.PostForm.Get("grant_type"); grantType != "" && grantType != providers.DeviceCodeGrantType {
+		p.deviceErrorJSON(rw, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+	deviceCode := req.PostForm.Get("device_code")
+	if deviceCode == "" {
+		p.deviceErrorJSON(rw, http.StatusBadRequest, "invalid_request", "missing device_code")
+		return
+	}
+
+	req, err := p.withDPoPKey(req)
+	if err != nil {
+		logger.Errorf("Error during device authorization: %v", err)
+		p.deviceErrorJSON(rw, http.StatusInternalServerError, "server_error", "unable to create session")
+		return
+	}
+
+	session, err := p.provider.RedeemDeviceCode(req.Context(), deviceCode)
+	if err == nil {
+		err = bindDPoPKey(req, session)
+	}
+	if err != nil {
+		var tokenErr *providers.TokenError
+		if errors.As(err, &tokenErr) {
+			p.deviceErrorJSON(rw, http.StatusBadRequest, tokenErr.Code, tokenErr.Description)
+			return
+		}
+		logger.Errorf("Error redeeming device code: %v", err)
+		p.deviceErrorJSON(rw, http.StatusBadGateway, "server_error", "unable to redeem device code")
+		return
+	}
+
+	// Force setting these in case the Provider didn't
+	if session.CreatedAt == nil {
+		session.CreatedAtNow()
+	}
+	if session.ExpiresOn == nil {
+		session.ExpiresIn(p.CookieOptions.Expire)
+	}
+
+	if err := p.enrichSessionState(req.Context(), session); err != nil {
+		logger.Errorf("Error creating session during device authorization: %v", err)
+		p.deviceErrorJSON(rw, http.StatusInternalServerError, "server_error", "unable to create session")
+		return
+	}
+
+	if !p.provider.ValidateSession(req.Context(), session) {
+		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Session validation failed: %s", session)
+		p.deviceErrorJSON(rw, http.StatusForbidden, "access_denied", "session validation failed")
+		return
+	}
+
+	authorized, err := p.provider.Authorize(req.Context(), session)
+	if err != nil {
+		logger.Errorf("Error with authorization: %v", err)
+	}
+	if !p.Validator(session.Email) || !authorized {
+		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Invalid authentication via device authorization: unauthorized")
+		p.sessionEvents.Emit(req, events.AuthorizationDenied, session, "Invalid authentication via device authorization: unauthorized")
+		p.deviceErrorJSON(rw, http.StatusForbidden, "access_denied", "unauthorized")
+		return
+	}
+
+	logger.PrintAuthf(session.Email, req, logger.AuthSuccess, "Authenticated via device authorization: %s", session)
+	session.AuthenticatedAtNow()
+	err = p.SaveSession(rw, req, session)
+	if errors.Is(err, sessionsapi.ErrSessionLimitExceeded) {
+		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Invalid authentication via device authorization: %v", err)
+		p.sessionEvents.Emit(req, events.AuthorizationDenied, session, "Concurrent session limit exceeded")
+		p.deviceErrorJSON(rw, http.StatusForbidden, "access_denied", "too many active sessions")
+		return
+	}
+	if err != nil {
+		logger.Errorf("Error saving session state for %s: %v", session.Email, err)
+		p.deviceErrorJSON(rw, http.StatusInternalServerError, "server_error", "unable to save session")
+		return
+	}
+	p.sessionEvents.Emit(req, events.Login, session, "Authenticated via device authorization")
+
+	response := struct {
+		User      string `json:"user"`
+		Email     string `json:"email"`
+		ExpiresIn int64  `json:"expires_in"`
+	}{
+		User:      session.User,
+		Email:     session.Email,
+		ExpiresIn: int64(session.ExpiresOn.Sub(session.Clock.Now()).Seconds()),
+	}
+	rw.Header().Set("Content-Type", applicationJSON)
+	rw.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(rw).Encode(response); err != nil {
+		logger.Errorf("Error encoding device token response: %v", err)
+	}
+}
+
+// deviceErrorJSON writes an OAuth 2.0 error response
+func (p *OAuthProxy) deviceErrorJSON(rw http.ResponseWriter, code int, errorCode, description string) {
+	rw.Header().Set("Content-Type", applicationJSON)
+	rw.WriteHeader(code)
+	if err := json.NewEncoder(rw).Encode(providers.TokenError{Code: errorCode, Description: description}); err != nil {
+		logger.Errorf("Error encoding device error response: %v", err)
+	}
+}
+
 func (p *OAuthProxy) redeemCode(req *http.Request, codeVerifier string) (*sessionsapi.SessionState, error) {
 	code := req.Form.Get("code")
 	if code == "" {
@@ -956,6 +1391,9 @@ func (p *OAuthProxy) redeemCode(req *http.Request, codeVerifier string) (*sessio
 	if err != nil {
 		return nil, err
 	}
+	if err := bindDPoPKey(req, s); err != nil {
+		return nil, err
+	}
 
 	// Force setting these in case the Provider didn't
 	if s.CreatedAt == nil {
@@ -968,6 +1406,37 @@ func (p *OAuthProxy) redeemCode(req *http.Request, codeVerifier string) (*sessio
 	return s, nil
 }
 
+// withDPoPKey adds a new DPoP key pair to the request context when the
+// provider binds tokens with DPoP. Requests made to the provider with this
+// context carry DPoP proofs, so the tokens redeemed are bound to the key.
+func (p *OAuthProxy) withDPoPKey(req *http.Request) (*http.Request, error) {
+	if !p.provider.Data().DPoP {
+		return req, nil
+	}
+
+	key, err := dpop.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("could not generate DPoP key: %v", err)
+	}
+	return req.WithContext(dpop.NewContext(req.Context(), key)), nil
+}
+
+// bindDPoPKey stores the DPoP key from the request context in the session so
+// that later refreshes and upstream requests can prove possession of it.
+func bindDPoPKey(req *http.Request, s *sessionsapi.SessionState) error {
+	key := dpop.KeyFromContext(req.Context())
+	if key == nil {
+		return nil
+	}
+
+	der, err := dpop.MarshalKey(key)
+	if err != nil {
+		return fmt.Errorf("could not marshal DPoP key: %v", err)
+	}
+	s.DPoPKey = der
+	return nil
+}
+
 func (p *OAuthProxy) enrichSessionState(ctx context.Context, s *sessionsapi.SessionState) error {
 	var err error
 	if s.Email == "" {
@@ -998,6 +1467,15 @@ func (p *OAuthProxy) AuthOnly(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if challenge, ok := p.checkAPIRouteRequirements(req, session); !ok {
+		p.insufficientScope(rw, req, session, challenge)
+		return
+	}
+
+	if !p.authOnlyStepUpSatisfied(rw, req, session) {
+		return
+	}
+
 	// we are authenticated
 	p.addHeadersForProxying(rw, session)
 	p.headersChain.Then(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
@@ -1005,6 +1483,37 @@ func (p *OAuthProxy) AuthOnly(rw http.ResponseWriter, req *http.Request) {
 	})).ServeHTTP(rw, req)
 }
 
+// authOnlyStepUpSatisfied checks the step-up requirements of the upstream
+// serving the URI forwarded to the auth endpoint. An unsatisfied session is
+// rejected with 401, so that the reverse proxy sends the user to the start
+// endpoint which requests step-up authentication for the redirect. Once the
+// provider failed to satisfy the requirements, 403 prevents a redirect loop.
+func (p *OAuthProxy) authOnlyStepUpSatisfied(rw http.ResponseWriter, req *http.Request, session *sessionsapi.SessionState) bool {
+	if p.stepUpMatcher == nil || session == nil {
+		return true
+	}
+
+	forwarded, err := requestForURI(req, requestutil.GetRequestURI(req))
+	if err != nil {
+		logger.Errorf("Error parsing the forwarded request URI: %v", err)
+		http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return false
+	}
+	stepUp := p.stepUpMatcher.Match(forwarded)
+	if stepUp == nil || stepUpSatisfied(session, stepUp, time.Now()) {
+		return true
+	}
+
+	if p.stepUpFailed(req, session) {
+		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Step-up authentication did not satisfy upstream requirements")
+		http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return false
+	}
+	logger.Printf("Session does not satisfy step-up requirements. Access Denied.")
+	http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	return false
+}
+
 // Proxy proxies the user request if the user is authenticated else it prompts
 // them to authenticate
 func (p *OAuthProxy) Proxy(rw http.ResponseWriter, req *http.Request) {
@@ -1012,6 +1521,17 @@ func (p *OAuthProxy) Proxy(rw http.ResponseWriter, req *http.Request) {
 	switch err {
 	case nil:
 		// we are authenticated
+		if challenge, ok := p.checkAPIRouteRequirements(req, session); !ok {
+			p.insufficientScope(rw, req, session, challenge)
+			return
+		}
+		if stepUp := p.stepUpMatcher.Match(req); stepUp != nil && session != nil {
+			if !stepUpSatisfied(session, stepUp, time.Now()) {
+				p.requireStepUp(rw, req, session, stepUp)
+				return
+			}
+			p.clearStepUpCookie(rw, req)
+		}
 		p.addHeadersForProxying(rw, session)
 		p.headersChain.Then(p.upstreamProxy).ServeHTTP(rw, req)
 	case ErrNeedsLogin:
@@ -1028,7 +1548,7 @@ func (p *OAuthProxy) Proxy(rw http.ResponseWriter, req *http.Request) {
 			// start OAuth flow, but only with the default login URL params - do not
 			// consider this request's query params as potential overrides, since
 			// the user did not explicitly start the login flow
-			p.doOAuthStart(rw, req, nil)
+			p.doOAuthStart(rw, req, nil, nil)
 		} else {
 			p.SignInPage(rw, req, http.StatusForbidden)
 		}
@@ -1047,6 +1567,133 @@ func (p *OAuthProxy) Proxy(rw http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// requireStepUp sends the user back to the provider to authenticate again
+// with the ACR and authentication age required by the upstream.
+// A cookie records when the step-up started so that a provider that ignores
+// the request cannot cause a redirect loop.
+func (p *OAuthProxy) requireStepUp(rw http.ResponseWriter, req *http.Request, session *sessionsapi.SessionState, stepUp *options.StepUp) {
+	if p.forceJSONErrors || isAjax(req) || p.isAPIPath(req) {
+		logger.Printf("Session does not satisfy step-up requirements. Access Denied.")
+		p.errorJSON(rw, http.StatusUnauthorized)
+		return
+	}
+
+	if p.stepUpFailed(req, session) {
+		// The user authenticated again but the provider did not satisfy
+		// the requirements, redirecting would loop
+		p.clearStepUpCookie(rw, req)
+		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Step-up authentication did not satisfy upstream requirements")
+		p.ErrorPage(rw, req, http.StatusForbidden, "The session does not satisfy the authentication requirements of this resource")
+		return
+	}
+
+	logger.Printf("Session does not satisfy step-up requirements. Initiating login.")
+	p.setStepUpCookie(rw, req)
+	p.doOAuthStart(rw, req, nil, stepUpLoginParams(stepUp))
+}
+
+// stepUpFailed checks whether the user already authenticated again for the
+// current step-up authentication, so that the provider did not satisfy the
+// requirements.
+func (p *OAuthProxy) stepUpFailed(req *http.Request, session *sessionsapi.SessionState) bool {
+	started := p.stepUpStartedAt(req)
+	if started == nil {
+		return false
+	}
+	last := session.LastAuthenticatedAt()
+	return last != nil && !last.Before(*started)
+}
+
+// requestForURI returns a copy of the request for the URI, so that the
+// upstream that would serve the URI can be matched.
+func requestForURI(req *http.Request, uri string) (*http.Request, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	r := req.WithContext(req.Context())
+	r.URL = &url.URL{Path: u.Path, RawPath: u.RawPath}
+	return r, nil
+}
+
+// stepUpSatisfied checks whether the session meets the upstream's ACR and
+// maximum authentication age requirements.
+func stepUpSatisfied(session *sessionsapi.SessionState, stepUp *options.StepUp, now time.Time) bool {
+	if len(stepUp.ACRValues) > 0 {
+		found := false
+		for _, acr := range stepUp.ACRValues {
+			if session.ACR == acr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if stepUp.MaxAuthAge != nil {
+		last := session.LastAuthenticatedAt()
+		if last == nil || now.Sub(*last) > stepUp.MaxAuthAge.Duration() {
+			return false
+		}
+	}
+	return true
+}
+
+// stepUpLoginParams builds the login URL parameters requesting the provider
+// to satisfy the step-up requirements.
+func stepUpLoginParams(stepUp *options.StepUp) url.Values {
+	params := url.Values{}
+	if len(stepUp.ACRValues) > 0 {
+		params.Set("acr_values", strings.Join(stepUp.ACRValues, " "))
+	}
+	if stepUp.MaxAuthAge != nil {
+		params.Set("max_age", strconv.FormatInt(int64(stepUp.MaxAuthAge.Duration().Seconds()), 10))
+	}
+	params.Set("prompt", "login")
+	return params
+}
+
+func (p *OAuthProxy) stepUpCookieName() string {
+	return p.CookieOptions.Name + "_stepup"
+}
+
+// stepUpStartedAt returns when the current step-up authentication started,
+// or nil if there is none.
+func (p *OAuthProxy) stepUpStartedAt(req *http.Request) *time.Time {
+	c, err := req.Cookie(p.stepUpCookieName())
+	if err != nil {
+		return nil
+	}
+	seconds, err := strconv.ParseInt(c.Value, 10, 64)
+	if err != nil {
+		return nil
+	}
+	started := time.Unix(seconds, 0)
+	return &started
+}
+
+// setStepUpCookie records that a step-up authentication started now
+func (p *OAuthProxy) setStepUpCookie(rw http.ResponseWriter, req *http.Request) {
+	now := time.Now()
+	http.SetCookie(rw, cookies.MakeCookieFromOptions(
+		req,
+		p.stepUpCookieName(),
+		strconv.FormatInt(now.Unix(), 10),
+		p.CookieOptions,
+		p.CookieOptions.CSRFExpire,
+		now,
+	))
+}
+
+func (p *OAuthProxy) clearStepUpCookie(rw http.ResponseWriter, req *http.Request) {
+	if _, err := req.Cookie(p.stepUpCookieName()); err != nil {
+		return
+	}
+	http.SetCookie(rw, cookies.MakeCookieFromOptions(req, p.stepUpCookieName(), "", p.CookieOptions, time.Hour*-1, time.Now()))
+}
+
 // See https://developers.google.com/web/fundamentals/performance/optimizing-content-efficiency/http-caching?hl=en
 var noCacheHeaders = map[string]string{
 	"Expires":         time.Unix(0, 0).Format(time.RFC1123),
@@ -1110,6 +1757,9 @@ func (p *OAuthProxy) getAuthenticatedSession(rw http.ResponseWriter, req *http.R
 	}
 
 	if session == nil {
+		if p.isAnonymousRoute(req) {
+			return nil, nil
+		}
 		return nil, ErrNeedsLogin
 	}
 
@@ -1126,6 +1776,7 @@ func (p *OAuthProxy) getAuthenticatedSession(rw http.ResponseWriter, req *http.R
 		}
 
 		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Invalid authorization via session (%s): removing session %s", cause, session)
+		p.sessionEvents.Emit(req, events.AuthorizationDenied, session, "Invalid authorization via session (%s)", cause)
 		// Invalid session, clear it
 		err := p.ClearSessionCookie(rw, req)
 		if err != nil {
@@ -3,25 +3,41 @@ package main
 import (
 	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/mbland/hmacauth"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apikeys"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/authentication/basic"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cookies"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/events"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	internaloidc "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/providers/oidc"
 	sessionscookie "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/cookie"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+	sessionstests "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/upstream"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/validation"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/providers"
@@ -499,6 +515,31 @@ func TestForwardAccessTokenUpstream(t *testing.T) {
 	assert.Equal(t, "my_auth_token", payload)
 }
 
+func TestOAuthCallbackRecordsAuthenticatedAt(t *testing.T) {
+	patTest, err := NewPassAccessTokenTest(PassAccessTokenTestOptions{
+		PassAccessToken: true,
+		ValidToken:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(patTest.Close)
+
+	code, cookie := patTest.getCallbackEndpoint()
+	if code != 302 {
+		t.Fatalf("expected 302; got %d", code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	resp := http.Response{Header: http.Header{"Set-Cookie": []string{cookie}}}
+	for _, c := range resp.Cookies() {
+		req.AddCookie(c)
+	}
+	session, err := patTest.proxy.sessionStore.Load(req)
+	assert.NoError(t, err)
+	assert.NotNil(t, session.AuthenticatedAt)
+}
+
 func TestStaticProxyUpstream(t *testing.T) {
 	patTest, err := NewPassAccessTokenTest(PassAccessTokenTestOptions{
 		PassAccessToken: true,
@@ -656,6 +697,101 @@ func TestManualSignInStoresUserGroupsInTheSession(t *testing.T) {
 		t.Fatal(err)
 	}
 	assert.Equal(t, userGroups, s.Groups)
+	assert.NotNil(t, s.AuthenticatedAt)
+}
+
+type groupsValidator struct {
+	groups []string
+}
+
+func (groupsValidator) Validate(_, _ string) bool {
+	return true
+}
+
+func (v groupsValidator) ValidateGroups(_, _ string) (bool, []string) {
+	return true, v.groups
+}
+
+func TestManualSignInStoresValidatorGroupsInTheSession(t *testing.T) {
+	opts := baseTestOptions()
+	opts.HtpasswdUserGroups = []string{"somegroup", "someothergroup"}
+	err := validation.Validate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy, err := NewOAuthProxy(opts, func(email string) bool {
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy.basicAuthValidator = basic.NewValidatorChain(
+		ManualSignInValidator{},
+		groupsValidator{groups: []string{"someothergroup", "ldapgroup"}},
+	)
+
+	rw := httptest.NewRecorder()
+	formData := url.Values{}
+	formData.Set("username", "someuser")
+	formData.Set("password", "somepass")
+	signInReq, _ := http.NewRequest(http.MethodPost, "/oauth2/sign_in", strings.NewReader(formData.Encode()))
+	signInReq.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	proxy.ServeHTTP(rw, signInReq)
+
+	assert.Equal(t, http.StatusFound, rw.Code)
+
+	req, _ := http.NewRequest(http.MethodGet, "/something", nil)
+	for _, c := range rw.Result().Cookies() {
+		req.AddCookie(c)
+	}
+
+	s, err := proxy.sessionStore.Load(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"somegroup", "someothergroup", "ldapgroup"}, s.Groups)
+}
+
+func TestManualSignInBindsSessionToClient(t *testing.T) {
+	opts := baseTestOptions()
+	opts.Session.Binding.Components = []string{options.UserAgentSessionBinding}
+	err := validation.Validate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy, err := NewOAuthProxy(opts, func(email string) bool {
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy.basicAuthValidator = AlwaysSuccessfulValidator{}
+
+	rw := httptest.NewRecorder()
+	formData := url.Values{}
+	formData.Set("username", "someuser")
+	formData.Set("password", "somepass")
+	signInReq, _ := http.NewRequest(http.MethodPost, "/oauth2/sign_in", strings.NewReader(formData.Encode()))
+	signInReq.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	signInReq.Header.Set("User-Agent", "Mozilla/5.0")
+	proxy.ServeHTTP(rw, signInReq)
+	assert.Equal(t, http.StatusFound, rw.Code)
+
+	userInfo := func(userAgent string) int {
+		userInfoRw := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/oauth2/userinfo", nil)
+		req.Header.Set("User-Agent", userAgent)
+		for _, c := range rw.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		proxy.ServeHTTP(userInfoRw, req)
+		return userInfoRw.Code
+	}
+
+	assert.Equal(t, http.StatusOK, userInfo("Mozilla/5.0"))
+	assert.Equal(t, http.StatusUnauthorized, userInfo("curl/8.0"))
 }
 
 type ManualSignInValidator struct{}
@@ -711,6 +847,44 @@ func TestManualSignInCorrectCredentials(t *testing.T) {
 	assert.Equal(t, http.StatusFound, statusCode)
 }
 
+func TestManualSignInSessionLimitExceeded(t *testing.T) {
+	opts := baseTestOptions()
+	err := validation.Validate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy, err := NewOAuthProxy(opts, func(email string) bool {
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy.basicAuthValidator = ManualSignInValidator{}
+
+	manager := persistence.NewManager(sessionstests.NewMockStore(), &opts.Cookie)
+	manager.SessionLimit = 1
+	manager.SessionLimitPolicy = options.RejectSessionLimitPolicy
+	proxy.sessionStore = manager
+
+	signIn := func() *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		formData := url.Values{}
+		formData.Set("username", "admin")
+		formData.Set("password", "adminPass")
+		signInReq, _ := http.NewRequest(http.MethodPost, "/oauth2/sign_in", strings.NewReader(formData.Encode()))
+		signInReq.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		proxy.ServeHTTP(rw, signInReq)
+		return rw
+	}
+
+	assert.Equal(t, http.StatusFound, signIn().Code)
+
+	rw := signIn()
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+	assert.Contains(t, rw.Body.String(), "You have too many active sessions.")
+}
+
 func TestSignInPageIncludesTargetRedirect(t *testing.T) {
 	sipTest, err := NewSignInPageTest(false)
 	if err != nil {
@@ -1050,6 +1224,61 @@ func TestUserInfoEndpointAccepted(t *testing.T) {
 	}
 }
 
+func TestUserInfoEndpointSessionLifetime(t *testing.T) {
+	withLifetime := func(opts *options.Options) {
+		opts.Session.IdleTimeout = time.Hour
+		opts.Session.MaxAge = 8 * time.Hour
+	}
+
+	t.Run("reports the remaining session lifetime", func(t *testing.T) {
+		test, err := NewProcessCookieTestWithOptionsModifiers(withLifetime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.req, _ = http.NewRequest("GET", test.opts.ProxyPrefix+"/userinfo", nil)
+
+		created := time.Now()
+		authenticated := created.Add(-2 * time.Hour)
+		err = test.SaveSession(&sessions.SessionState{
+			User:            "john.doe",
+			Email:           "john.doe@example.com",
+			CreatedAt:       &created,
+			AuthenticatedAt: &authenticated,
+		})
+		assert.NoError(t, err)
+
+		test.proxy.ServeHTTP(test.rw, test.req)
+		assert.Equal(t, http.StatusOK, test.rw.Code)
+
+		var userInfo struct {
+			IdleExpiresIn   int64 `json:"idleExpiresIn"`
+			MaxAgeExpiresIn int64 `json:"maxAgeExpiresIn"`
+		}
+		assert.NoError(t, json.NewDecoder(test.rw.Body).Decode(&userInfo))
+		assert.InDelta(t, time.Hour.Seconds(), userInfo.IdleExpiresIn, 5)
+		assert.InDelta(t, (6 * time.Hour).Seconds(), userInfo.MaxAgeExpiresIn, 5)
+	})
+
+	t.Run("rejects an idle session", func(t *testing.T) {
+		test, err := NewProcessCookieTestWithOptionsModifiers(withLifetime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.req, _ = http.NewRequest("GET", test.opts.ProxyPrefix+"/userinfo", nil)
+
+		created := time.Now().Add(-90 * time.Minute)
+		err = test.SaveSession(&sessions.SessionState{
+			User:      "john.doe",
+			Email:     "john.doe@example.com",
+			CreatedAt: &created,
+		})
+		assert.NoError(t, err)
+
+		test.proxy.ServeHTTP(test.rw, test.req)
+		assert.Equal(t, http.StatusUnauthorized, test.rw.Code)
+	})
+}
+
 func TestUserInfoEndpointUnauthorizedOnNoCookieSetError(t *testing.T) {
 	test, err := NewUserInfoEndpointTest()
 	if err != nil {
@@ -1955,7 +2184,7 @@ func Test_noCacheHeaders(t *testing.T) {
 			},
 		},
 	}
-	opts.SkipAuthRegex = []string{".*"}
+	opts.AllowlistRules = []options.AllowlistRule{{Path: ".*"}}
 	err := validation.Validate(opts)
 	assert.NoError(t, err)
 	proxy, err := NewOAuthProxy(opts, func(_ string) bool { return true })
@@ -2081,6 +2310,7 @@ func TestTrustedIPs(t *testing.T) {
 		trustedIPs         []string
 		reverseProxy       bool
 		realClientIPHeader string
+		trustedProxies     []string
 		req                *http.Request
 		expectTrusted      bool
 	}{
@@ -2200,6 +2430,66 @@ func TestTrustedIPs(t *testing.T) {
 			}(),
 			expectTrusted: false,
 		},
+		// Check trusts the client of a trusted proxy.
+		{
+			name:               "TrustsClientOfTrustedProxy",
+			trustedIPs:         []string{"127.0.0.0/8"},
+			reverseProxy:       true,
+			realClientIPHeader: "X-Forwarded-For",
+			trustedProxies:     []string{"10.0.0.0/8"},
+			req: func() *http.Request {
+				req, _ := http.NewRequest("GET", "/", nil)
+				req.RemoteAddr = "10.0.0.1:43670"
+				req.Header.Add("X-Forwarded-For", "127.0.0.1, 10.0.0.2")
+				return req
+			}(),
+			expectTrusted: true,
+		},
+		// Check does not trust a spoofed IP prepended to the proxy chain.
+		{
+			name:               "DoesNotTrustSpoofedIPWithTrustedProxies",
+			trustedIPs:         []string{"127.0.0.0/8"},
+			reverseProxy:       true,
+			realClientIPHeader: "X-Forwarded-For",
+			trustedProxies:     []string{"10.0.0.0/8"},
+			req: func() *http.Request {
+				req, _ := http.NewRequest("GET", "/", nil)
+				req.RemoteAddr = "10.0.0.1:43670"
+				req.Header.Add("X-Forwarded-For", "127.0.0.1, 12.34.56.78")
+				return req
+			}(),
+			expectTrusted: false,
+		},
+		// Check ignores headers of requests that were not sent by a trusted proxy.
+		{
+			name:               "IgnoresHeadersOfUntrustedProxies",
+			trustedIPs:         []string{"127.0.0.0/8"},
+			reverseProxy:       true,
+			realClientIPHeader: "X-Forwarded-For",
+			trustedProxies:     []string{"10.0.0.0/8"},
+			req: func() *http.Request {
+				req, _ := http.NewRequest("GET", "/", nil)
+				req.RemoteAddr = "12.34.56.78:43670"
+				req.Header.Add("X-Forwarded-For", "127.0.0.1")
+				return req
+			}(),
+			expectTrusted: false,
+		},
+		// Check trusts the client of a trusted proxy in the Forwarded header.
+		{
+			name:               "TrustsForwardedClientOfTrustedProxy",
+			trustedIPs:         []string{"127.0.0.0/8"},
+			reverseProxy:       true,
+			realClientIPHeader: "Forwarded",
+			trustedProxies:     []string{"10.0.0.0/8"},
+			req: func() *http.Request {
+				req, _ := http.NewRequest("GET", "/", nil)
+				req.RemoteAddr = "10.0.0.1:43670"
+				req.Header.Add("Forwarded", `for=12.34.56.78, for=127.0.0.1;proto=https, for="10.0.0.2:8080"`)
+				return req
+			}(),
+			expectTrusted: true,
+		},
 		// Check doesn't trust if garbage is provided (no reverse-proxy).
 		{
 			name:               "DoesNotTrustGarbage",
@@ -2230,6 +2520,7 @@ func TestTrustedIPs(t *testing.T) {
 			opts.TrustedIPs = tt.trustedIPs
 			opts.ReverseProxy = tt.reverseProxy
 			opts.RealClientIPHeader = tt.realClientIPHeader
+			opts.TrustedProxies = tt.trustedProxies
 			err := validation.Validate(opts)
 			assert.NoError(t, err)
 
@@ -2247,182 +2538,6 @@ func TestTrustedIPs(t *testing.T) {
 	}
 }
 
-func Test_buildRoutesAllowlist(t *testing.T) {
-	type expectedAllowedRoute struct {
-		method      string
-		negate      bool
-		regexString string
-	}
-
-	testCases := []struct {
-		name           string
-		skipAuthRegex  []string
-		skipAuthRoutes []string
-		expectedRoutes []expectedAllowedRoute
-		shouldError    bool
-	}{
-		{
-			name:           "No skip auth configured",
-			skipAuthRegex:  []string{},
-			skipAuthRoutes: []string{},
-			expectedRoutes: []expectedAllowedRoute{},
-			shouldError:    false,
-		},
-		{
-			name: "Only skipAuthRegex configured",
-			skipAuthRegex: []string{
-				"^/foo/bar",
-				"^/baz/[0-9]+/thing",
-			},
-			skipAuthRoutes: []string{},
-			expectedRoutes: []expectedAllowedRoute{
-				{
-					method:      "",
-					negate:      false,
-					regexString: "^/foo/bar",
-				},
-				{
-					method:      "",
-					negate:      false,
-					regexString: "^/baz/[0-9]+/thing",
-				},
-			},
-			shouldError: false,
-		},
-		{
-			name:          "Only skipAuthRoutes configured",
-			skipAuthRegex: []string{},
-			skipAuthRoutes: []string{
-				"GET=^/foo/bar",
-				"POST=^/baz/[0-9]+/thing",
-				"^/all/methods$",
-				"WEIRD=^/methods/are/allowed",
-				"PATCH=/second/equals?are=handled&just=fine",
-				"!=^/api",
-				"METHOD!=^/api",
-			},
-			expectedRoutes: []expectedAllowedRoute{
-				{
-					method:      "GET",
-					negate:      false,
-					regexString: "^/foo/bar",
-				},
-				{
-					method:      "POST",
-					negate:      false,
-					regexString: "^/baz/[0-9]+/thing",
-				},
-				{
-					method:      "",
-					negate:      false,
-					regexString: "^/all/methods$",
-				},
-				{
-					method:      "WEIRD",
-					negate:      false,
-					regexString: "^/methods/are/allowed",
-				},
-				{
-					method:      "PATCH",
-					negate:      false,
-					regexString: "/second/equals?are=handled&just=fine",
-				},
-				{
-					method:      "",
-					negate:      true,
-					regexString: "^/api",
-				},
-				{
-					method:      "METHOD",
-					negate:      true,
-					regexString: "^/api",
-				},
-			},
-			shouldError: false,
-		},
-		{
-			name: "Both skipAuthRegexes and skipAuthRoutes configured",
-			skipAuthRegex: []string{
-				"^/foo/bar/regex",
-				"^/baz/[0-9]+/thing/regex",
-			},
-			skipAuthRoutes: []string{
-				"GET=^/foo/bar",
-				"POST=^/baz/[0-9]+/thing",
-				"^/all/methods$",
-			},
-			expectedRoutes: []expectedAllowedRoute{
-				{
-					method:      "",
-					regexString: "^/foo/bar/regex",
-				},
-				{
-					method:      "",
-					regexString: "^/baz/[0-9]+/thing/regex",
-				},
-				{
-					method:      "GET",
-					regexString: "^/foo/bar",
-				},
-				{
-					method:      "POST",
-					regexString: "^/baz/[0-9]+/thing",
-				},
-				{
-					method:      "",
-					regexString: "^/all/methods$",
-				},
-			},
-			shouldError: false,
-		},
-		{
-			name: "Invalid skipAuthRegex entry",
-			skipAuthRegex: []string{
-				"^/foo/bar",
-				"^/baz/[0-9]+/thing",
-				"(bad[regex",
-			},
-			skipAuthRoutes: []string{},
-			expectedRoutes: []expectedAllowedRoute{},
-			shouldError:    true,
-		},
-		{
-			name:          "Invalid skipAuthRoutes entry",
-			skipAuthRegex: []string{},
-			skipAuthRoutes: []string{
-				"GET=^/foo/bar",
-				"POST=^/baz/[0-9]+/thing",
-				"^/all/methods$",
-				"PUT=(bad[regex",
-			},
-			expectedRoutes: []expectedAllowedRoute{},
-			shouldError:    true,
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			opts := &options.Options{
-				SkipAuthRegex:  tc.skipAuthRegex,
-				SkipAuthRoutes: tc.skipAuthRoutes,
-			}
-			routes, err := buildRoutesAllowlist(opts)
-			if tc.shouldError {
-				assert.Error(t, err)
-				return
-			}
-			assert.NoError(t, err)
-
-			for i, route := range routes {
-				assert.Greater(t, len(tc.expectedRoutes), i)
-				assert.Equal(t, route.method, tc.expectedRoutes[i].method)
-				assert.Equal(t, route.negate, tc.expectedRoutes[i].negate)
-				assert.Equal(t, route.pathRegex.String(), tc.expectedRoutes[i].regexString)
-			}
-		})
-	}
-}
-
 func TestApiRoutes(t *testing.T) {
 
 	ajaxAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -2553,11 +2668,9 @@ func TestAllowedRequest(t *testing.T) {
 			},
 		},
 	}
-	opts.SkipAuthRegex = []string{
-		"^/skip/auth/regex$",
-	}
-	opts.SkipAuthRoutes = []string{
-		"GET=^/skip/auth/routes/get",
+	opts.AllowlistRules = []options.AllowlistRule{
+		{Path: "^/skip/auth/regex$"},
+		{Methods: []string{"GET"}, Path: "^/skip/auth/routes/get"},
 	}
 	err := validation.Validate(opts)
 	assert.NoError(t, err)
@@ -2652,11 +2765,9 @@ func TestAllowedRequestWithForwardedUriHeader(t *testing.T) {
 			},
 		},
 	}
-	opts.SkipAuthRegex = []string{
-		"^/skip/auth/regex$",
-	}
-	opts.SkipAuthRoutes = []string{
-		"GET=^/skip/auth/routes/get",
+	opts.AllowlistRules = []options.AllowlistRule{
+		{Path: "^/skip/auth/regex$"},
+		{Methods: []string{"GET"}, Path: "^/skip/auth/routes/get"},
 	}
 	err := validation.Validate(opts)
 	assert.NoError(t, err)
@@ -2753,9 +2864,9 @@ func TestAllowedRequestNegateWithoutMethod(t *testing.T) {
 			},
 		},
 	}
-	opts.SkipAuthRoutes = []string{
-		"!=^/api", // any non-api routes
-		"POST=^/api/public-entity/?$",
+	opts.AllowlistRules = []options.AllowlistRule{
+		{Path: "^/api", NegatePath: true}, // any non-api routes
+		{Methods: []string{"POST"}, Path: "^/api/public-entity/?$"},
 	}
 	err := validation.Validate(opts)
 	assert.NoError(t, err)
@@ -2853,9 +2964,9 @@ func TestAllowedRequestNegateWithMethod(t *testing.T) {
 			},
 		},
 	}
-	opts.SkipAuthRoutes = []string{
-		"GET!=^/api", // any non-api routes
-		"POST=^/api/public-entity/?$",
+	opts.AllowlistRules = []options.AllowlistRule{
+		{Methods: []string{"GET"}, Path: "^/api", NegatePath: true}, // any non-api routes
+		{Methods: []string{"POST"}, Path: "^/api/public-entity/?$"},
 	}
 	err := validation.Validate(opts)
 	assert.NoError(t, err)
@@ -2933,38 +3044,99 @@ func TestAllowedRequestNegateWithMethod(t *testing.T) {
 	}
 }
 
-func TestProxyAllowedGroups(t *testing.T) {
+func TestAllowedRequestAnonymous(t *testing.T) {
 	tests := []struct {
-		name               string
-		allowedGroups      []string
-		groups             []string
-		expectUnauthorized bool
+		name         string
+		url          string
+		groups       []string
+		withSession  bool
+		expectedCode int
 	}{
-		{"NoAllowedGroups", []string{}, []string{}, false},
-		{"NoAllowedGroupsUserHasGroups", []string{}, []string{"a", "b"}, false},
-		{"UserInAllowedGroup", []string{"a"}, []string{"a", "b"}, false},
-		{"UserNotInAllowedGroup", []string{"a"}, []string{"c"}, true},
+		{"AnonymousRouteWithoutSession", "/public/page", nil, false, http.StatusOK},
+		{"AnonymousRouteWithAuthorizedSession", "/public/page", []string{"a"}, true, http.StatusOK},
+		{"AnonymousRouteWithUnauthorizedSession", "/public/page", []string{"c"}, true, http.StatusForbidden},
+		{"SkipAuthRouteWithUnauthorizedSession", "/public/assets/app.js", []string{"c"}, true, http.StatusOK},
+		{"OtherRouteWithoutSession", "/private", nil, false, http.StatusUnauthorized},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			emailAddress := "test"
-			created := time.Now()
-
-			session := &sessions.SessionState{
-				Groups:      tt.groups,
-				Email:       emailAddress,
-				AccessToken: "oauth_token",
-				CreatedAt:   &created,
-			}
-
 			upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(200)
 			}))
 			t.Cleanup(upstreamServer.Close)
 
 			test, err := NewProcessCookieTestWithOptionsModifiers(func(opts *options.Options) {
-				opts.Providers[0].AllowedGroups = tt.allowedGroups
+				opts.Providers[0].AllowedGroups = []string{"a"}
+				opts.UpstreamServers = options.UpstreamConfig{
+					Upstreams: []options.Upstream{
+						{
+							ID:   upstreamServer.URL,
+							Path: "/",
+							URI:  upstreamServer.URL,
+						},
+					},
+				}
+				opts.AllowlistRules = []options.AllowlistRule{
+					{Path: "^/public/assets/"},
+					{Path: "^/public/", Policy: options.AnonymousAllowlistPolicy},
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			test.req, _ = http.NewRequest("GET", tt.url, nil)
+			test.req.Header.Add("accept", applicationJSON)
+			if tt.withSession {
+				created := time.Now()
+				err = test.SaveSession(&sessions.SessionState{
+					Groups:      tt.groups,
+					Email:       "test",
+					AccessToken: "oauth_token",
+					CreatedAt:   &created,
+				})
+				assert.NoError(t, err)
+			}
+			test.proxy.ServeHTTP(test.rw, test.req)
+
+			assert.Equal(t, tt.expectedCode, test.rw.Code)
+		})
+	}
+}
+
+func TestProxyAllowedGroups(t *testing.T) {
+	tests := []struct {
+		name               string
+		allowedGroups      []string
+		groups             []string
+		expectUnauthorized bool
+	}{
+		{"NoAllowedGroups", []string{}, []string{}, false},
+		{"NoAllowedGroupsUserHasGroups", []string{}, []string{"a", "b"}, false},
+		{"UserInAllowedGroup", []string{"a"}, []string{"a", "b"}, false},
+		{"UserNotInAllowedGroup", []string{"a"}, []string{"c"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emailAddress := "test"
+			created := time.Now()
+
+			session := &sessions.SessionState{
+				Groups:      tt.groups,
+				Email:       emailAddress,
+				AccessToken: "oauth_token",
+				CreatedAt:   &created,
+			}
+
+			upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(200)
+			}))
+			t.Cleanup(upstreamServer.Close)
+
+			test, err := NewProcessCookieTestWithOptionsModifiers(func(opts *options.Options) {
+				opts.Providers[0].AllowedGroups = tt.allowedGroups
 				opts.UpstreamServers = options.UpstreamConfig{
 					Upstreams: []options.Upstream{
 						{
@@ -3467,3 +3639,781 @@ func TestGetOAuthRedirectURI(t *testing.T) {
 		})
 	}
 }
+
+func TestDeviceFlow(t *testing.T) {
+	const emailAddress = "john.doe@example.com"
+	approved := false
+	providerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/oauth/device":
+			_, _ = w.Write([]byte(`{"device_code":"device-code","user_code":"ABCD-EFGH","verification_uri":"https://idp.example.com/device","expires_in":600,"interval":5}`))
+		case "/oauth/token":
+			assert.Equal(t, providers.DeviceCodeGrantType, r.PostForm.Get("grant_type"))
+			assert.Equal(t, "device-code", r.PostForm.Get("device_code"))
+			if !approved {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":"authorization_pending"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"access_token":"my_access_token","token_type":"Bearer","expires_in":3600}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer providerServer.Close()
+	providerURL, _ := url.Parse(providerServer.URL)
+
+	opts := baseTestOptions()
+	opts.EnableDeviceFlow = true
+	opts.Providers[0].DeviceAuthURL = providerServer.URL + "/oauth/device"
+	assert.NoError(t, validation.Validate(opts))
+
+	proxy, err := NewOAuthProxy(opts, func(email string) bool {
+		return email == emailAddress
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testProvider := NewTestProvider(providerURL, emailAddress)
+	testProvider.ValidToken = true
+	testProvider.DeviceAuthURL = &url.URL{Scheme: "http", Host: providerURL.Host, Path: "/oauth/device"}
+	proxy.provider = testProvider
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/oauth2/device/authorize", nil)
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	auth := providers.DeviceAuthorization{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &auth))
+	assert.Equal(t, "device-code", auth.DeviceCode)
+	assert.Equal(t, "ABCD-EFGH", auth.UserCode)
+	assert.Equal(t, "https://idp.example.com/device", auth.VerificationURI)
+
+	pollBody := url.Values{
+		"grant_type":  []string{providers.DeviceCodeGrantType},
+		"device_code": []string{auth.DeviceCode},
+	}.Encode()
+
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/oauth2/device/token", strings.NewReader(pollBody))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.JSONEq(t, `{"error":"authorization_pending"}`, rw.Body.String())
+	assert.Empty(t, rw.Header().Values("Set-Cookie"))
+
+	approved = true
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/oauth2/device/token", strings.NewReader(pollBody))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), emailAddress)
+
+	cookies := rw.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, opts.Cookie.Name, cookies[0].Name)
+
+	// The issued cookie authenticates subsequent requests
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/oauth2/userinfo", nil)
+	req.AddCookie(cookies[0])
+	session, err := proxy.sessionStore.Load(req)
+	assert.NoError(t, err)
+	assert.NotNil(t, session.AuthenticatedAt)
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), emailAddress)
+}
+
+func TestDeviceFlowWithOIDCNonce(t *testing.T) {
+	const emailAddress = "john.doe@example.com"
+	// The device authorization grant has no authorization request, so the
+	// ID token has no nonce claim
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   "https://issuer.example.com",
+		"aud":   "https://test.myapp.com",
+		"sub":   "1234567890",
+		"email": emailAddress,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	idToken := "eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9." + base64.RawURLEncoding.EncodeToString(claims) + ".c2lnbmF0dXJl"
+
+	providerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/oauth/device":
+			_, _ = w.Write([]byte(`{"device_code":"device-code","user_code":"ABCD-EFGH","verification_uri":"https://idp.example.com/device","expires_in":600,"interval":5}`))
+		case "/oauth/token":
+			assert.Equal(t, providers.DeviceCodeGrantType, r.PostForm.Get("grant_type"))
+			_, _ = fmt.Fprintf(w, `{"access_token":"my_access_token","token_type":"Bearer","expires_in":3600,"id_token":%q}`, idToken)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer providerServer.Close()
+	providerURL, _ := url.Parse(providerServer.URL)
+
+	opts := baseTestOptions()
+	opts.EnableDeviceFlow = true
+	opts.Providers[0].DeviceAuthURL = providerServer.URL + "/oauth/device"
+	assert.NoError(t, validation.Validate(opts))
+
+	proxy, err := NewOAuthProxy(opts, func(email string) bool {
+		return email == emailAddress
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := oidc.NewVerifier("https://issuer.example.com", NoOpKeySet{},
+		&oidc.Config{ClientID: "https://test.myapp.com"})
+	verificationOptions := internaloidc.IDTokenVerificationOptions{
+		AudienceClaims: []string{"aud"},
+		ClientID:       "https://test.myapp.com",
+	}
+	provider := providers.NewOIDCProvider(&providers.ProviderData{
+		ClientID:      "https://test.myapp.com",
+		ClientSecret:  clientSecret,
+		RedeemURL:     &url.URL{Scheme: "http", Host: providerURL.Host, Path: "/oauth/token"},
+		DeviceAuthURL: &url.URL{Scheme: "http", Host: providerURL.Host, Path: "/oauth/device"},
+		EmailClaim:    "email",
+		UserClaim:     "sub",
+		Verifier:      internaloidc.NewVerifier(verifier, verificationOptions),
+	}, options.OIDCOptions{InsecureSkipNonce: false})
+	assert.False(t, provider.SkipNonce)
+	proxy.provider = provider
+
+	pollBody := url.Values{
+		"grant_type":  []string{providers.DeviceCodeGrantType},
+		"device_code": []string{"device-code"},
+	}.Encode()
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/oauth2/device/token", strings.NewReader(pollBody))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), emailAddress)
+
+	cookies := rw.Result().Cookies()
+	assert.Len(t, cookies, 1)
+
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/oauth2/userinfo", nil)
+	req.AddCookie(cookies[0])
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), emailAddress)
+}
+
+func TestDeviceFlowRequiresDeviceAuthURL(t *testing.T) {
+	opts := baseTestOptions()
+	opts.EnableDeviceFlow = true
+	assert.NoError(t, validation.Validate(opts))
+
+	_, err := NewOAuthProxy(opts, func(string) bool { return true })
+	assert.EqualError(t, err, "device flow is enabled but the provider has no device authorization endpoint")
+}
+
+func TestIntrospectBearerTokens(t *testing.T) {
+	opts := baseTestOptions()
+
+	introspections := 0
+	introspectionServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		introspections++
+		assert.NoError(t, r.ParseForm())
+		clientID := opts.Providers[0].ClientID
+		switch r.PostForm.Get("token") {
+		case "opaque-token":
+		case "other-client-token":
+			clientID = "other-client"
+		default:
+			_, _ = w.Write([]byte(`{"active":false}`))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"active":true,"sub":"1234","email":"jane@example.com","client_id":%q,"exp":%d}`, clientID, time.Now().Add(time.Hour).Unix())
+	}))
+	defer introspectionServer.Close()
+
+	opts.IntrospectBearerTokens = true
+	opts.Providers[0].IntrospectionURL = introspectionServer.URL
+	assert.NoError(t, validation.Validate(opts))
+
+	proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/oauth2/userinfo", nil)
+		req.Header.Set("Authorization", "Bearer opaque-token")
+		proxy.ServeHTTP(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Contains(t, rw.Body.String(), "jane@example.com")
+	}
+	// The active token was cached after the first request
+	assert.Equal(t, 1, introspections)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/oauth2/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer revoked-token")
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+
+	// Tokens issued for another client are rejected
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/oauth2/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer other-client-token")
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+}
+
+func TestIntrospectBearerTokensRequiresIntrospectionURL(t *testing.T) {
+	opts := baseTestOptions()
+	opts.IntrospectBearerTokens = true
+	assert.NoError(t, validation.Validate(opts))
+
+	_, err := NewOAuthProxy(opts, func(string) bool { return true })
+	assert.EqualError(t, err, "token introspection is enabled but the provider has no introspection endpoint")
+}
+
+func TestAPIRouteRequirements(t *testing.T) {
+	introspectionServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		_, _ = fmt.Fprintf(w, `{"active":true,"sub":"1234","scope":"read:users","aud":"https://api.example.com","exp":%d}`, time.Now().Add(time.Hour).Unix())
+	}))
+	defer introspectionServer.Close()
+
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstreamServer.Close()
+
+	opts := baseTestOptions()
+	opts.UpstreamServers = options.UpstreamConfig{
+		Upstreams: []options.Upstream{
+			{
+				ID:   upstreamServer.URL,
+				Path: "/",
+				URI:  upstreamServer.URL,
+			},
+		},
+	}
+	opts.IntrospectBearerTokens = true
+	opts.Providers[0].IntrospectionURL = introspectionServer.URL
+	opts.Providers[0].OIDCConfig.ExtraAudiences = []string{"https://api.example.com"}
+	opts.APIRouteScopes = []string{
+		"read:users=^/api/users",
+		"read:users write:users=^/api/users/admin",
+	}
+	opts.APIRouteAudiences = []string{
+		"https://api.example.com=^/api/",
+		"https://other.example.com=^/api/other",
+	}
+	assert.NoError(t, validation.Validate(opts))
+
+	proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name            string
+		path            string
+		expectedCode    int
+		expectedWWWAuth string
+	}{
+		{
+			name:         "scopes and audience are granted",
+			path:         "/api/users",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:            "scope is missing",
+			path:            "/api/users/admin",
+			expectedCode:    http.StatusForbidden,
+			expectedWWWAuth: `Bearer error="insufficient_scope", scope="write:users"`,
+		},
+		{
+			name:            "audience is not allowed",
+			path:            "/api/other",
+			expectedCode:    http.StatusForbidden,
+			expectedWWWAuth: `Bearer error="insufficient_scope", error_description="The access token audience is not allowed"`,
+		},
+		{
+			name:         "route without requirements",
+			path:         "/index.html",
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.Header.Set("Authorization", "Bearer opaque-token")
+			proxy.ServeHTTP(rw, req)
+
+			assert.Equal(t, tc.expectedCode, rw.Code)
+			assert.Equal(t, tc.expectedWWWAuth, rw.Header().Get("WWW-Authenticate"))
+			if tc.expectedCode == http.StatusForbidden {
+				assert.Equal(t, applicationJSON, rw.Header().Get("Content-Type"))
+			}
+		})
+	}
+
+	// Requests without a token are API requests and are not redirected
+	rw := httptest.NewRecorder()
+	proxy.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/api/users", nil))
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+}
+
+func TestProxyJWT(t *testing.T) {
+	introspectionServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"active":true,"sub":"1234","email":"jane@example.com","client_id":%q,"exp":%d}`, clientID, time.Now().Add(time.Hour).Unix())
+	}))
+	defer introspectionServer.Close()
+
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("X-Proxy-JWT")))
+	}))
+	defer upstreamServer.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	opts := baseTestOptions()
+	opts.UpstreamServers = options.UpstreamConfig{
+		Upstreams: []options.Upstream{
+			{
+				ID:   upstreamServer.URL,
+				Path: "/",
+				URI:  upstreamServer.URL,
+			},
+		},
+	}
+	opts.IntrospectBearerTokens = true
+	opts.Providers[0].IntrospectionURL = introspectionServer.URL
+	opts.ProxyJWT = &options.ProxyJWT{
+		SigningKey: &options.SecretSource{
+			Value: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}),
+		},
+		KeyID: "proxy-key",
+	}
+	opts.InjectRequestHeaders = append(opts.InjectRequestHeaders, options.Header{
+		Name: "X-Proxy-JWT",
+		Values: []options.HeaderValue{
+			{
+				ProxyJWT: &options.ProxyJWTSource{
+					Audience: "https://upstream.example.com",
+				},
+			},
+		},
+	})
+	assert.NoError(t, validation.Validate(opts))
+
+	proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer opaque-token")
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	token := rw.Body.String()
+
+	rw = httptest.NewRecorder()
+	proxy.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/oauth2/jwks", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, applicationJSON, rw.Header().Get("Content-Type"))
+
+	var jwks jose.JSONWebKeySet
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &jwks))
+	keys := jwks.Key("proxy-key")
+	if assert.Len(t, keys, 1) {
+		claims := jwt.MapClaims{}
+		_, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+			return keys[0].Key, nil
+		}, jwt.WithAudience("https://upstream.example.com"))
+		assert.NoError(t, err)
+		assert.Equal(t, "1234", claims["sub"])
+		assert.Equal(t, "jane@example.com", claims["email"])
+	}
+}
+
+func TestOAuthStartPushedAuthorizationRequest(t *testing.T) {
+	var pushed url.Values
+	parServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		pushed = r.PostForm
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"request_uri":"urn:ietf:params:oauth:request_uri:abc123","expires_in":60}`))
+	}))
+	defer parServer.Close()
+
+	opts := baseTestOptions()
+	opts.Providers[0].PushedAuthorizationRequestURL = parServer.URL
+	opts.Providers[0].PushedAuthorizationRequests = true
+	assert.NoError(t, validation.Validate(opts))
+
+	proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/oauth2/start", nil)
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusFound, rw.Code)
+
+	location, err := url.Parse(rw.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"client_id":   []string{clientID},
+		"request_uri": []string{"urn:ietf:params:oauth:request_uri:abc123"},
+	}, location.Query())
+
+	assert.Equal(t, clientID, pushed.Get("client_id"))
+	assert.Equal(t, clientSecret, pushed.Get("client_secret"))
+	assert.Equal(t, "code", pushed.Get("response_type"))
+	assert.NotEmpty(t, pushed.Get("state"))
+	assert.Equal(t, "https://example.com/oauth2/callback", pushed.Get("redirect_uri"))
+}
+
+func TestSignOutEmitsSessionEvent(t *testing.T) {
+	eventsFile := filepath.Join(t.TempDir(), "events.log")
+	test, err := NewProcessCookieTestWithOptionsModifiers(func(opts *options.Options) {
+		opts.SessionEvents.File = eventsFile
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.req, _ = http.NewRequest("GET", test.opts.ProxyPrefix+"/sign_out", nil)
+
+	created := time.Now()
+	err = test.SaveSession(&sessions.SessionState{
+		User:      "john.doe",
+		Email:     "john.doe@example.com",
+		CreatedAt: &created,
+	})
+	assert.NoError(t, err)
+
+	test.proxy.ServeHTTP(test.rw, test.req)
+	assert.Equal(t, http.StatusFound, test.rw.Code)
+	assert.NoError(t, test.proxy.sessionEvents.Close())
+
+	data, err := os.ReadFile(eventsFile)
+	assert.NoError(t, err)
+	var event events.Event
+	assert.NoError(t, json.Unmarshal(data, &event))
+	assert.Equal(t, events.Logout, event.Type)
+	assert.Equal(t, "john.doe", event.User)
+	assert.Equal(t, "john.doe@example.com", event.Email)
+}
+
+func TestProxyStepUp(t *testing.T) {
+	maxAuthAge := options.Duration(10 * time.Minute)
+	stepUpCookie := "_oauth2_proxy_stepup"
+	twoMinutes := 2 * time.Minute
+
+	tests := []struct {
+		name            string
+		acr             string
+		authAge         time.Duration
+		stepUpStarted   *time.Duration
+		accept          string
+		expectedCode    int
+		expectLoginURL  bool
+		expectClearStep bool
+	}{
+		{"Satisfied", "mfa", time.Minute, nil, "", http.StatusOK, false, false},
+		{"SatisfiedClearsStepUpCookie", "mfa", time.Minute, &twoMinutes, "", http.StatusOK, false, true},
+		{"MissingACR", "pwd", time.Minute, nil, "", http.StatusFound, true, false},
+		{"AuthenticationTooOld", "mfa", time.Hour, nil, "", http.StatusFound, true, false},
+		// A session that does not record when the user authenticated
+		{"UnknownAuthenticationTime", "mfa", 0, nil, "", http.StatusFound, true, false},
+		{"JSONRequest", "pwd", time.Minute, nil, applicationJSON, http.StatusUnauthorized, false, false},
+		{"ProviderIgnoredStepUp", "pwd", time.Minute, &twoMinutes, "", http.StatusForbidden, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(200)
+			}))
+			t.Cleanup(upstreamServer.Close)
+
+			test, err := NewProcessCookieTestWithOptionsModifiers(func(opts *options.Options) {
+				opts.UpstreamServers = options.UpstreamConfig{
+					Upstreams: []options.Upstream{
+						{
+							ID:   "admin",
+							Path: "/admin/",
+							URI:  upstreamServer.URL,
+							StepUp: &options.StepUp{
+								ACRValues:  []string{"mfa"},
+								MaxAuthAge: &maxAuthAge,
+							},
+						},
+					},
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.proxy.provider = NewTestProvider(&url.URL{Host: "localhost"}, "john.doe@example.com")
+
+			test.req, _ = http.NewRequest("GET", "/admin/users", nil)
+			if tt.accept != "" {
+				test.req.Header.Add("accept", tt.accept)
+			}
+			if tt.stepUpStarted != nil {
+				started := time.Now().Add(-*tt.stepUpStarted)
+				test.req.AddCookie(&http.Cookie{Name: stepUpCookie, Value: strconv.FormatInt(started.Unix(), 10)})
+			}
+
+			created := time.Now()
+			var authTime *time.Time
+			if tt.authAge != 0 {
+				authenticated := time.Now().Add(-tt.authAge)
+				authTime = &authenticated
+			}
+			err = test.SaveSession(&sessions.SessionState{
+				Email:       "john.doe@example.com",
+				AccessToken: "oauth_token",
+				CreatedAt:   &created,
+				ACR:         tt.acr,
+				AuthTime:    authTime,
+			})
+			assert.NoError(t, err)
+
+			test.proxy.ServeHTTP(test.rw, test.req)
+			assert.Equal(t, tt.expectedCode, test.rw.Code)
+
+			if tt.expectLoginURL {
+				location, err := url.Parse(test.rw.Header().Get("Location"))
+				assert.NoError(t, err)
+				assert.Equal(t, "mfa", location.Query().Get("acr_values"))
+				assert.Equal(t, "600", location.Query().Get("max_age"))
+				assert.Equal(t, "login", location.Query().Get("prompt"))
+				assert.True(t, strings.HasSuffix(location.Query().Get("state"), ":/admin/users"))
+			}
+
+			// Read the live headers, SaveSession has already snapshotted the result
+			var stepUpCookies []*http.Cookie
+			for _, c := range (&http.Response{Header: test.rw.Header()}).Cookies() {
+				if c.Name == stepUpCookie {
+					stepUpCookies = append(stepUpCookies, c)
+				}
+			}
+			switch {
+			case tt.expectLoginURL:
+				assert.Len(t, stepUpCookies, 1)
+				assert.NotEmpty(t, stepUpCookies[0].Value)
+			case tt.expectClearStep:
+				assert.Len(t, stepUpCookies, 1)
+				assert.Empty(t, stepUpCookies[0].Value)
+			default:
+				assert.Empty(t, stepUpCookies)
+			}
+		})
+	}
+}
+
+func TestAuthOnlyStepUp(t *testing.T) {
+	maxAuthAge := options.Duration(10 * time.Minute)
+	stepUpCookie := "_oauth2_proxy_stepup"
+	twoMinutes := 2 * time.Minute
+
+	stepUpOptions := func(opts *options.Options) {
+		opts.ReverseProxy = true
+		opts.UpstreamServers = options.UpstreamConfig{
+			Upstreams: []options.Upstream{
+				{
+					ID:   "admin",
+					Path: "/admin/",
+					URI:  "http://localhost:8080",
+					StepUp: &options.StepUp{
+						ACRValues:  []string{"mfa"},
+						MaxAuthAge: &maxAuthAge,
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		forwardedURI  string
+		acr           string
+		stepUpStarted *time.Duration
+		expectedCode  int
+	}{
+		{"Satisfied", "/admin/users", "mfa", nil, http.StatusAccepted},
+		{"MissingACR", "/admin/users?page=2", "pwd", nil, http.StatusUnauthorized},
+		{"ProviderIgnoredStepUp", "/admin/users", "pwd", &twoMinutes, http.StatusForbidden},
+		{"NoStepUpRequired", "/public", "pwd", nil, http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			test, err := NewAuthOnlyEndpointTest("", stepUpOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.req.Header.Set("X-Forwarded-Uri", tt.forwardedURI)
+			if tt.stepUpStarted != nil {
+				started := time.Now().Add(-*tt.stepUpStarted)
+				test.req.AddCookie(&http.Cookie{Name: stepUpCookie, Value: strconv.FormatInt(started.Unix(), 10)})
+			}
+
+			created := time.Now()
+			authenticated := time.Now().Add(-time.Minute)
+			err = test.SaveSession(&sessions.SessionState{
+				Email:       "john.doe@example.com",
+				AccessToken: "oauth_token",
+				CreatedAt:   &created,
+				ACR:         tt.acr,
+				AuthTime:    &authenticated,
+			})
+			assert.NoError(t, err)
+
+			test.proxy.ServeHTTP(test.rw, test.req)
+			assert.Equal(t, tt.expectedCode, test.rw.Code)
+		})
+	}
+
+	// The reverse proxy sends the rejected user to the start endpoint, which
+	// requests step-up authentication for the redirect
+	for _, tt := range []struct {
+		redirect     string
+		expectStepUp bool
+	}{
+		{"/admin/users", true},
+		{"/public", false},
+	} {
+		t.Run("Start"+tt.redirect, func(t *testing.T) {
+			test, err := NewProcessCookieTestWithOptionsModifiers(stepUpOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.proxy.provider = NewTestProvider(&url.URL{Host: "localhost"}, "john.doe@example.com")
+			test.req, _ = http.NewRequest("GET", "/oauth2/start?rd="+url.QueryEscape(tt.redirect), nil)
+
+			test.proxy.ServeHTTP(test.rw, test.req)
+			assert.Equal(t, http.StatusFound, test.rw.Code)
+
+			location, err := url.Parse(test.rw.Header().Get("Location"))
+			assert.NoError(t, err)
+			var stepUpCookies []*http.Cookie
+			for _, c := range test.rw.Result().Cookies() {
+				if c.Name == stepUpCookie {
+					stepUpCookies = append(stepUpCookies, c)
+				}
+			}
+			if tt.expectStepUp {
+				assert.Equal(t, "mfa", location.Query().Get("acr_values"))
+				assert.Equal(t, "600", location.Query().Get("max_age"))
+				assert.Len(t, stepUpCookies, 1)
+			} else {
+				assert.Empty(t, location.Query().Get("acr_values"))
+				assert.Empty(t, stepUpCookies)
+			}
+		})
+	}
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s|%s|%s", r.Header.Get("X-Forwarded-User"), r.Header.Get("X-API-Key"), r.URL.RawQuery)
+	}))
+	defer upstreamServer.Close()
+
+	keysFile := filepath.Join(t.TempDir(), "api-keys.yaml")
+	err := os.WriteFile(keysFile, []byte(fmt.Sprintf(`keys:
+- hash: %s
+  user: ci
+  groups: [deployers]
+  routes: ["^/api/"]
+`, apikeys.Hash("ci-key"))), 0600)
+	assert.NoError(t, err)
+
+	opts := baseTestOptions()
+	opts.UpstreamServers = options.UpstreamConfig{
+		Upstreams: []options.Upstream{
+			{
+				ID:   upstreamServer.URL,
+				Path: "/",
+				URI:  upstreamServer.URL,
+			},
+		},
+	}
+	opts.APIKeys.File = keysFile
+	opts.APIKeys.QueryParam = "api_key"
+	opts.APIRoutes = []string{"^/api/"}
+	assert.NoError(t, validation.Validate(opts))
+
+	proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name         string
+		path         string
+		key          string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "key in the header",
+			path:         "/api/deploy",
+			key:          "ci-key",
+			expectedCode: http.StatusOK,
+			expectedBody: "ci||",
+		},
+		{
+			name:         "key in the query",
+			path:         "/api/deploy?api_key=ci-key&env=prod",
+			expectedCode: http.StatusOK,
+			expectedBody: "ci||env=prod",
+		},
+		{
+			name:         "unknown key",
+			path:         "/api/deploy",
+			key:          "unknown-key",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "route not allowed for the key",
+			path:         "/admin",
+			key:          "ci-key",
+			expectedCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.key != "" {
+				req.Header.Set("X-API-Key", tc.key)
+			}
+			proxy.ServeHTTP(rw, req)
+			assert.Equal(t, tc.expectedCode, rw.Code)
+			if tc.expectedBody != "" {
+				assert.Equal(t, tc.expectedBody, rw.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+// Package allowlist matches requests against the allowlist rules that allow
+// them without authentication.
+package allowlist
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	ipapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/ip"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	requestutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests/util"
+)
+
+// Allowlist matches requests against a list of allowlist rules
+type Allowlist struct {
+	rules          []*rule
+	clientIPParser ipapi.RealClientIPParser
+}
+
+// rule is a compiled options.AllowlistRule
+type rule struct {
+	name       string
+	policy     options.AllowlistPolicy
+	hosts      []string
+	methods    []string
+	path       *regexp.Regexp
+	negatePath bool
+	sources    *ip.NetSet
+	headers    []header
+}
+
+// header is a compiled options.AllowlistHeader
+type header struct {
+	name  string
+	value *regexp.Regexp
+}
+
+// NewAllowlist compiles the allowlist rules. The client IP of requests
+// is determined with the clientIPParser when it is set.
+// If there are no rules, nil is returned.
+func NewAllowlist(rules []options.AllowlistRule, clientIPParser ipapi.RealClientIPParser) (*Allowlist, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	a := &Allowlist{
+		rules:          make([]*rule, 0, len(rules)),
+		clientIPParser: clientIPParser,
+	}
+	for i, r := range rules {
+		compiled, err := newRule(i, r)
+		if err != nil {
+			return nil, err
+		}
+		logger.Printf("Allowlist rule %s - %s", compiled.name, describeRule(r))
+		a.rules = append(a.rules, compiled)
+	}
+	return a, nil
+}
+
+// newRule compiles the i-th allowlist rule
+func newRule(i int, r options.AllowlistRule) (*rule, error) {
+	compiled := &rule{
+		name:       r.ID,
+		policy:     r.Policy,
+		negatePath: r.NegatePath,
+	}
+	if compiled.name == "" {
+		compiled.name = fmt.Sprintf("#%d", i)
+	}
+	if compiled.policy == "" {
+		compiled.policy = options.SkipAuthAllowlistPolicy
+	}
+
+	switch compiled.policy {
+	case options.SkipAuthAllowlistPolicy, options.AnonymousAllowlistPolicy:
+	default:
+		return nil, fmt.Errorf("allowlist rule %s has an unknown policy %q", compiled.name, r.Policy)
+	}
+
+	for _, host := range r.Hosts {
+		compiled.hosts = append(compiled.hosts, strings.ToLower(host))
+	}
+	for _, method := range r.Methods {
+		compiled.methods = append(compiled.methods, strings.ToUpper(method))
+	}
+
+	if r.Path != "" {
+		path, err := regexp.Compile(r.Path)
+		if err != nil {
+			return nil, fmt.Errorf("allowlist rule %s has an invalid path: %v", compiled.name, err)
+		}
+		compiled.path = path
+	}
+
+	if len(r.SourceCIDRs) > 0 {
+		compiled.sources = ip.NewNetSet()
+		for _, cidr := range r.SourceCIDRs {
+			ipNet := ip.ParseIPNet(cidr)
+			if ipNet == nil {
+				return nil, fmt.Errorf("allowlist rule %s has an invalid source CIDR %q", compiled.name, cidr)
+			}
+			compiled.sources.AddIPNet(*ipNet)
+		}
+	}
+
+	for _, h := range r.Headers {
+		if h.Name == "" {
+			return nil, fmt.Errorf("allowlist rule %s has a header without a name", compiled.name)
+		}
+		compiledHeader := header{name: http.CanonicalHeaderKey(h.Name)}
+		if h.Value != "" {
+			value, err := regexp.Compile(h.Value)
+			if err != nil {
+				return nil, fmt.Errorf("allowlist rule %s has an invalid value for header %q: %v", compiled.name, h.Name, err)
+			}
+			compiledHeader.value = value
+		}
+		compiled.headers = append(compiled.headers, compiledHeader)
+	}
+
+	return compiled, nil
+}
+
+// Match returns the policy of the first rule matching the request, or false
+// if no rule matches.
+func (a *Allowlist) Match(req *http.Request) (options.AllowlistPolicy, bool) {
+	if a == nil {
+		return "", false
+	}
+
+	for _, r := range a.rules {
+		if a.matches(r, req) {
+			return r.policy, true
+		}
+	}
+	return "", false
+}
+
+// matches checks every condition of the rule against the request
+func (a *Allowlist) matches(r *rule, req *http.Request) bool {
+	return r.matchesMethod(req) &&
+		r.matchesPath(req) &&
+		r.matchesHost(req) &&
+		r.matchesHeaders(req) &&
+		a.matchesSource(r, req)
+}
+
+func (r *rule) matchesMethod(req *http.Request) bool {
+	if len(r.methods) == 0 {
+		return true
+	}
+	for _, method := range r.methods {
+		if req.Method == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) matchesPath(req *http.Request) bool {
+	if r.path == nil {
+		return true
+	}
+	return r.path.MatchString(requestutil.GetRequestURI(req)) != r.negatePath
+}
+
+func (r *rule) matchesHost(req *http.Request) bool {
+	if len(r.hosts) == 0 {
+		return true
+	}
+
+	host := strings.ToLower(requestutil.GetRequestHost(req))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, allowed := range r.hosts {
+		if domain, ok := strings.CutPrefix(allowed, "*."); ok {
+			// A wildcard requires a subdomain and does not match the domain itself
+			if strings.HasSuffix(host, "."+domain) && len(host) > len(domain)+1 {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) matchesHeaders(req *http.Request) bool {
+	for _, h := range r.headers {
+		values, ok := req.Header[h.name]
+		if !ok {
+			return false
+		}
+		if h.value == nil {
+			continue
+		}
+		matched := false
+		for _, value := range values {
+			if h.value.MatchString(value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *Allowlist) matchesSource(r *rule, req *http.Request) bool {
+	if r.sources == nil {
+		return true
+	}
+
+	clientIP, err := ip.GetClientIP(a.clientIPParser, req)
+	if err != nil {
+		logger.Errorf("Error obtaining real IP for allowlist rule %s: %v", r.name, err)
+		return false
+	}
+	return clientIP != nil && r.sources.Has(clientIP)
+}
+
+// describeRule summarises the conditions of a rule for logging
+func describeRule(r options.AllowlistRule) string {
+	policy := r.Policy
+	if policy == "" {
+		policy = options.SkipAuthAllowlistPolicy
+	}
+	methods := "ALL"
+	if len(r.Methods) > 0 {
+		methods = strings.Join(r.Methods, ",")
+	}
+	path := r.Path
+	if r.NegatePath {
+		path = "!" + path
+	}
+
+	parts := []string{
+		fmt.Sprintf("Policy: %s", policy),
+		fmt.Sprintf("Method: %s", methods),
+		fmt.Sprintf("Path: %s", path),
+	}
+	if len(r.Hosts) > 0 {
+		parts = append(parts, fmt.Sprintf("Hosts: %s", strings.Join(r.Hosts, ",")))
+	}
+	if len(r.SourceCIDRs) > 0 {
+		parts = append(parts, fmt.Sprintf("Sources: %s", strings.Join(r.SourceCIDRs, ",")))
+	}
+	for _, h := range r.Headers {
+		parts = append(parts, fmt.Sprintf("Header: %s=%s", h.Name, h.Value))
+	}
+	return strings.Join(parts, " | ")
+}
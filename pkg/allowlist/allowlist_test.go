@@ -0,0 +1,250 @@
+package allowlist
+
+import (
+	"net/http/httptest"
+
+	ipapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/ip"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Allowlist", func() {
+	It("returns nil without rules", func() {
+		a, err := NewAllowlist(nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(a).To(BeNil())
+
+		_, ok := a.Match(httptest.NewRequest("GET", "/", nil))
+		Expect(ok).To(BeFalse())
+	})
+
+	DescribeTable("NewAllowlist errors",
+		func(rule options.AllowlistRule, expectedErr string) {
+			_, err := NewAllowlist([]options.AllowlistRule{rule}, nil)
+			Expect(err).To(MatchError(expectedErr))
+		},
+		Entry("with an unknown policy", options.AllowlistRule{ID: "deny", Policy: "deny"},
+			`allowlist rule deny has an unknown policy "deny"`),
+		Entry("with an invalid path", options.AllowlistRule{Path: "(bad[regex"},
+			"allowlist rule #0 has an invalid path: error parsing regexp: missing closing ]: `[regex`"),
+		Entry("with an invalid source CIDR", options.AllowlistRule{SourceCIDRs: []string{"alkwlkbn/32"}},
+			`allowlist rule #0 has an invalid source CIDR "alkwlkbn/32"`),
+		Entry("with a header without a name", options.AllowlistRule{Headers: []options.AllowlistHeader{{Value: "foo"}}},
+			"allowlist rule #0 has a header without a name"),
+	)
+
+	type matchTableInput struct {
+		rules          []options.AllowlistRule
+		method         string
+		url            string
+		headers        map[string]string
+		remoteAddr     string
+		realClientIP   bool
+		expectedPolicy options.AllowlistPolicy
+		expectedMatch  bool
+	}
+
+	DescribeTable("Match",
+		func(in matchTableInput) {
+			var parser ipapi.RealClientIPParser
+			if in.realClientIP {
+				var err error
+				parser, err = ip.GetRealClientIPParser("X-Real-IP", nil)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			a, err := NewAllowlist(in.rules, parser)
+			Expect(err).ToNot(HaveOccurred())
+
+			method := in.method
+			if method == "" {
+				method = "GET"
+			}
+			req := httptest.NewRequest(method, in.url, nil)
+			for name, value := range in.headers {
+				req.Header.Set(name, value)
+			}
+			if in.remoteAddr != "" {
+				req.RemoteAddr = in.remoteAddr
+			}
+
+			policy, ok := a.Match(req)
+			Expect(ok).To(Equal(in.expectedMatch))
+			Expect(policy).To(Equal(in.expectedPolicy))
+		},
+		Entry("with a rule without conditions", matchTableInput{
+			rules:          []options.AllowlistRule{{}},
+			url:            "http://example.com/foo",
+			expectedPolicy: options.SkipAuthAllowlistPolicy,
+			expectedMatch:  true,
+		}),
+		Entry("with a matching path", matchTableInput{
+			rules:          []options.AllowlistRule{{Path: "^/foo"}},
+			url:            "http://example.com/foo/bar",
+			expectedPolicy: options.SkipAuthAllowlistPolicy,
+			expectedMatch:  true,
+		}),
+		Entry("with a path matching the query", matchTableInput{
+			rules:          []options.AllowlistRule{{Path: `^/foo\?public=true$`}},
+			url:            "http://example.com/foo?public=true",
+			expectedPolicy: options.SkipAuthAllowlistPolicy,
+			expectedMatch:  true,
+		}),
+		Entry("with a non-matching path", matchTableInput{
+			rules: []options.AllowlistRule{{Path: "^/foo"}},
+			url:   "http://example.com/bar",
+		}),
+		Entry("with a negated path", matchTableInput{
+			rules:          []options.AllowlistRule{{Path: "^/api", NegatePath: true}},
+			url:            "http://example.com/static/app.js",
+			expectedPolicy: options.SkipAuthAllowlistPolicy,
+			expectedMatch:  true,
+		}),
+		Entry("with a negated path matching the path", matchTableInput{
+			rules: []options.AllowlistRule{{Path: "^/api", NegatePath: true}},
+			url:   "http://example.com/api/users",
+		}),
+		Entry("with a matching method", matchTableInput{
+			rules:          []options.AllowlistRule{{Methods: []string{"get", "HEAD"}}},
+			method:         "HEAD",
+			url:            "http://example.com/",
+			expectedPolicy: options.SkipAuthAllowlistPolicy,
+			expectedMatch:  true,
+		}),
+		// Methods are uppercased, as --skip-auth-route methods always were,
+		// and compared with the request method exactly
+		Entry("with a lowercase method", matchTableInput{
+			rules:          []options.AllowlistRule{{Methods: []string{"post"}}},
+			method:         "POST",
+			url:            "http://example.com/",
+			expectedPolicy: options.SkipAuthAllowlistPolicy,
+			expectedMatch:  true,
+		}),
+		Entry("with a lowercase request method", matchTableInput{
+			rules:  []options.AllowlistRule{{Methods: []string{"post"}}},
+			method: "post",
+			url:    "http://example.com/",
+		}),
+		Entry("with a non-matching method", matchTableInput{
+			rules:  []options.AllowlistRule{{Methods: []string{"GET"}}},
+			method: "POST",
+			url:    "http://example.com/",
+		}),
+		Entry("with a matching host", matchTableInput{
+			rules:          []options.AllowlistRule{{Hosts: []string{"Public.Example.com"}}},
+			url:            "http://public.example.com:8080/",
+			expectedPolicy: options.SkipAuthAllowlistPolicy,
+			expectedMatch:  true,
+		}),
+		Entry("with a matching wildcard host", matchTableInput{
+			rules:          []options.AllowlistRule{{Hosts: []string{"*.example.com"}}},
+			url:            "http://public.example.com/",
+			expectedPolicy: options.SkipAuthAllowlistPolicy,
+			expectedMatch:  true,
+		}),
+		Entry("with a wildcard host not matching the parent domain", matchTableInput{
+			rules: []options.AllowlistRule{{Hosts: []string{"*.example.com"}}},
+			url:   "http://example.com/",
+		}),
+		Entry("with a wildcard host not matching an empty subdomain", matchTableInput{
+			rules: []options.AllowlistRule{{Hosts: []string{"*.example.com"}}},
+			url:   "http://.example.com/",
+		}),
+		Entry("with a wildcard host matching a nested subdomain", matchTableInput{
+			rules:          []options.AllowlistRule{{Hosts: []string{"*.example.com"}}},
+			url:            "http://a.b.example.com/",
+			expectedPolicy: options.SkipAuthAllowlistPolicy,
+			expectedMatch:  true,
+		}),
+		Entry("with a wildcard host not matching a domain with the same suffix", matchTableInput{
+			rules: []options.AllowlistRule{{Hosts: []string{"*.example.com"}}},
+			url:   "http://badexample.com/",
+		}),
+		Entry("with a non-matching host", matchTableInput{
+			rules: []options.AllowlistRule{{Hosts: []string{"public.example.com"}}},
+			url:   "http://private.example.com/",
+		}),
+		Entry("with a matching source CIDR", matchTableInput{
+			rules:          []options.AllowlistRule{{SourceCIDRs: []string{"10.0.0.0/8"}}},
+			url:            "http://example.com/",
+			remoteAddr:     "10.1.2.3:4321",
+			expectedPolicy: options.SkipAuthAllowlistPolicy,
+			expectedMatch:  true,
+		}),
+		Entry("with a source CIDR matching the real client IP", matchTableInput{
+			rules:          []options.AllowlistRule{{SourceCIDRs: []string{"10.0.0.0/8"}}},
+			url:            "http://example.com/",
+			headers:        map[string]string{"X-Real-IP": "10.1.2.3"},
+			remoteAddr:     "192.0.2.1:4321",
+			realClientIP:   true,
+			expectedPolicy: options.SkipAuthAllowlistPolicy,
+			expectedMatch:  true,
+		}),
+		Entry("with a non-matching source CIDR", matchTableInput{
+			rules:      []options.AllowlistRule{{SourceCIDRs: []string{"10.0.0.0/8"}}},
+			url:        "http://example.com/",
+			remoteAddr: "192.0.2.1:4321",
+		}),
+		Entry("with a present header", matchTableInput{
+			rules:          []options.AllowlistRule{{Headers: []options.AllowlistHeader{{Name: "x-internal"}}}},
+			url:            "http://example.com/",
+			headers:        map[string]string{"X-Internal": ""},
+			expectedPolicy: options.SkipAuthAllowlistPolicy,
+			expectedMatch:  true,
+		}),
+		Entry("with a missing header", matchTableInput{
+			rules: []options.AllowlistRule{{Headers: []options.AllowlistHeader{{Name: "X-Internal"}}}},
+			url:   "http://example.com/",
+		}),
+		Entry("with a matching header value", matchTableInput{
+			rules:          []options.AllowlistRule{{Headers: []options.AllowlistHeader{{Name: "X-Client", Value: "^(cli|ci)$"}}}},
+			url:            "http://example.com/",
+			headers:        map[string]string{"X-Client": "ci"},
+			expectedPolicy: options.SkipAuthAllowlistPolicy,
+			expectedMatch:  true,
+		}),
+		Entry("with a non-matching header value", matchTableInput{
+			rules:   []options.AllowlistRule{{Headers: []options.AllowlistHeader{{Name: "X-Client", Value: "^(cli|ci)$"}}}},
+			url:     "http://example.com/",
+			headers: map[string]string{"X-Client": "browser"},
+		}),
+		Entry("with all conditions matching", matchTableInput{
+			rules: []options.AllowlistRule{{
+				Policy:      options.AnonymousAllowlistPolicy,
+				Hosts:       []string{"internal.example.com"},
+				Methods:     []string{"POST"},
+				Path:        "^/hooks/",
+				SourceCIDRs: []string{"10.0.0.0/8"},
+				Headers:     []options.AllowlistHeader{{Name: "X-Hook-Signature"}},
+			}},
+			method:         "POST",
+			url:            "http://internal.example.com/hooks/deploy",
+			headers:        map[string]string{"X-Hook-Signature": "abc"},
+			remoteAddr:     "10.1.2.3:4321",
+			expectedPolicy: options.AnonymousAllowlistPolicy,
+			expectedMatch:  true,
+		}),
+		Entry("with one condition not matching", matchTableInput{
+			rules: []options.AllowlistRule{{
+				Hosts:       []string{"internal.example.com"},
+				Methods:     []string{"POST"},
+				Path:        "^/hooks/",
+				SourceCIDRs: []string{"10.0.0.0/8"},
+			}},
+			method:     "POST",
+			url:        "http://internal.example.com/hooks/deploy",
+			remoteAddr: "192.0.2.1:4321",
+		}),
+		Entry("with the first matching rule applying", matchTableInput{
+			rules: []options.AllowlistRule{
+				{Path: "^/private", Policy: options.AnonymousAllowlistPolicy},
+				{Path: "^/public", Policy: options.AnonymousAllowlistPolicy},
+				{Path: "^/public/assets", Policy: options.SkipAuthAllowlistPolicy},
+			},
+			url:            "http://example.com/public/assets/app.js",
+			expectedPolicy: options.AnonymousAllowlistPolicy,
+			expectedMatch:  true,
+		}),
+	)
+})
@@ -0,0 +1,115 @@
+// Package apikeys authenticates service callers with API keys. Keys are
+// random secrets which are only ever stored as SHA-256 hashes, each with the
+// identity and the routes of the caller it was issued to.
+package apikeys
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+)
+
+// KeyPrefix identifies API keys generated by the proxy
+const KeyPrefix = "o2p_"
+
+// keyBytes is the number of random bytes in a generated key
+const keyBytes = 32
+
+// ErrKeyNotFound is returned by a Store when no key has the given hash
+var ErrKeyNotFound = errors.New("api key not found")
+
+// Key describes the caller an API key was issued to
+type Key struct {
+	// Hash is the hex encoded SHA-256 hash of the API key
+	Hash string `json:"hash"`
+
+	// User is the user of the sessions created for the key
+	User string `json:"user"`
+
+	// Email is the email of the sessions created for the key, if any
+	Email string `json:"email,omitempty"`
+
+	// Groups are the groups of the sessions created for the key
+	Groups []string `json:"groups,omitempty"`
+
+	// ExpiresOn is when the key stops being accepted. Keys without an
+	// expiry do not expire.
+	ExpiresOn *time.Time `json:"expiresOn,omitempty"`
+
+	// Routes are regular expressions for the request paths the key may be
+	// used on. A key without routes may be used on any path.
+	Routes []string `json:"routes,omitempty"`
+
+	routes []*regexp.Regexp
+}
+
+// Store looks up the keys by their hash
+type Store interface {
+	// Lookup returns the key with the given hash or ErrKeyNotFound
+	Lookup(ctx context.Context, hash string) (*Key, error)
+}
+
+// Generate creates a new random API key
+func Generate() (string, error) {
+	secret, err := encryption.Nonce(keyBytes)
+	if err != nil {
+		return "", fmt.Errorf("could not generate api key: %v", err)
+	}
+	return KeyPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// Hash returns the hex encoded SHA-256 hash of the API key.
+// API keys are high entropy random values, so a fast hash is sufficient
+// and allows keys to be looked up by their hash.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// compile validates the key and compiles its routes
+func (k *Key) compile() error {
+	if len(k.Hash) != sha256.Size*2 {
+		return fmt.Errorf("key for user %q has an invalid hash", k.User)
+	}
+	if _, err := hex.DecodeString(k.Hash); err != nil {
+		return fmt.Errorf("key for user %q has an invalid hash: %v", k.User, err)
+	}
+	if k.User == "" {
+		return fmt.Errorf("key %s... has no user", k.Hash[:8])
+	}
+
+	k.routes = make([]*regexp.Regexp, 0, len(k.Routes))
+	for _, route := range k.Routes {
+		re, err := regexp.Compile(route)
+		if err != nil {
+			return fmt.Errorf("key for user %q has an invalid route %q: %v", k.User, route, err)
+		}
+		k.routes = append(k.routes, re)
+	}
+	return nil
+}
+
+// Expired returns true if the key has expired at the given time
+func (k *Key) Expired(now time.Time) bool {
+	return k.ExpiresOn != nil && !k.ExpiresOn.IsZero() && now.After(*k.ExpiresOn)
+}
+
+// AllowsPath returns true if the key may be used on the request path
+func (k *Key) AllowsPath(path string) bool {
+	if len(k.routes) == 0 {
+		return true
+	}
+	for _, route := range k.routes {
+		if route.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
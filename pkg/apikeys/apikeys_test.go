@@ -0,0 +1,77 @@
+package apikeys
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("API Keys", func() {
+	It("generates unique prefixed keys", func() {
+		key1, err := Generate()
+		Expect(err).ToNot(HaveOccurred())
+		key2, err := Generate()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(key1).To(HavePrefix(KeyPrefix))
+		Expect(len(strings.TrimPrefix(key1, KeyPrefix))).To(Equal(43))
+		Expect(key1).ToNot(Equal(key2))
+	})
+
+	It("hashes keys with SHA-256", func() {
+		Expect(Hash("abc")).To(Equal("ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"))
+	})
+
+	Context("Key", func() {
+		var key *Key
+
+		BeforeEach(func() {
+			expiresOn := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+			key = &Key{
+				Hash:      Hash("abc"),
+				User:      "ci",
+				ExpiresOn: &expiresOn,
+				Routes:    []string{"^/api/", "^/metrics$"},
+			}
+			Expect(key.compile()).To(Succeed())
+		})
+
+		It("expires after its expiry", func() {
+			Expect(key.Expired(time.Date(2029, 12, 31, 0, 0, 0, 0, time.UTC))).To(BeFalse())
+			Expect(key.Expired(time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC))).To(BeTrue())
+		})
+
+		It("never expires without an expiry", func() {
+			key.ExpiresOn = nil
+			Expect(key.Expired(time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC))).To(BeFalse())
+		})
+
+		It("allows only its routes", func() {
+			Expect(key.AllowsPath("/api/users")).To(BeTrue())
+			Expect(key.AllowsPath("/metrics")).To(BeTrue())
+			Expect(key.AllowsPath("/metrics/extra")).To(BeFalse())
+			Expect(key.AllowsPath("/")).To(BeFalse())
+		})
+
+		It("allows any route without routes", func() {
+			key.Routes = nil
+			Expect(key.compile()).To(Succeed())
+			Expect(key.AllowsPath("/anything")).To(BeTrue())
+		})
+
+		DescribeTable("compile rejects invalid keys",
+			func(modify func(*Key), expectedErr string) {
+				modify(key)
+				Expect(key.compile()).To(MatchError(expectedErr))
+			},
+			Entry("with a short hash", func(k *Key) { k.Hash = "abcd" }, "key for user \"ci\" has an invalid hash"),
+			Entry("with a non hex hash", func(k *Key) { k.Hash = strings.Repeat("z", 64) },
+				"key for user \"ci\" has an invalid hash: encoding/hex: invalid byte: U+007A 'z'"),
+			Entry("without a user", func(k *Key) { k.User = "" }, "key ba7816bf... has no user"),
+			Entry("with an invalid route", func(k *Key) { k.Routes = []string{"("} },
+				"key for user \"ci\" has an invalid route \"(\": error parsing regexp: missing closing ): `(`"),
+		)
+	})
+})
@@ -0,0 +1,94 @@
+package apikeys
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/ghodss/yaml"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/watcher"
+)
+
+// KeysFile is the structure of an API keys file
+type KeysFile struct {
+	Keys []Key `json:"keys"`
+}
+
+// fileStore holds the keys of an API keys file, which is reloaded when it
+// changes.
+type fileStore struct {
+	keys map[string]*Key
+	rwm  sync.RWMutex
+}
+
+// NewFileStore loads the API keys from the YAML file at the path given and
+// watches it for updates.
+func NewFileStore(path string) (Store, error) {
+	s := &fileStore{}
+	if err := s.load(path); err != nil {
+		return nil, fmt.Errorf("could not load api keys file: %v", err)
+	}
+
+	if err := watcher.WatchFileForUpdates(path, nil, func() {
+		if err := s.load(path); err != nil {
+			logger.Errorf("%v: no changes were made to the current api keys", err)
+		}
+	}); err != nil {
+		return nil, fmt.Errorf("could not watch api keys file: %v", err)
+	}
+
+	return s, nil
+}
+
+func (s *fileStore) load(path string) error {
+	// We allow the api keys file location via config options
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("could not read api keys file: %v", err)
+	}
+
+	keys, err := parseKeysFile(data)
+	if err != nil {
+		return err
+	}
+
+	s.rwm.Lock()
+	s.keys = keys
+	s.rwm.Unlock()
+	return nil
+}
+
+// parseKeysFile indexes the keys in the file by their hash
+func parseKeysFile(data []byte) (map[string]*Key, error) {
+	var file KeysFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("could not parse api keys file: %v", err)
+	}
+
+	keys := make(map[string]*Key, len(file.Keys))
+	for i := range file.Keys {
+		key := &file.Keys[i]
+		if err := key.compile(); err != nil {
+			return nil, fmt.Errorf("invalid api key %d: %v", i, err)
+		}
+		if _, ok := keys[key.Hash]; ok {
+			return nil, fmt.Errorf("invalid api key %d: duplicate hash", i)
+		}
+		keys[key.Hash] = key
+	}
+	return keys, nil
+}
+
+// Lookup returns the key with the given hash
+func (s *fileStore) Lookup(_ context.Context, hash string) (*Key, error) {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+
+	key, ok := s.keys[hash]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
@@ -0,0 +1,84 @@
+package apikeys
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("File Store", func() {
+	var path string
+
+	writeKeys := func(content string) {
+		Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "api-keys.yaml")
+		writeKeys(fmt.Sprintf(`keys:
+- hash: %s
+  user: ci
+  groups: [deployers]
+  expiresOn: 2030-01-01T00:00:00Z
+  routes: ["^/api/"]
+- hash: %s
+  user: monitoring
+  email: monitoring@example.com
+`, Hash("ci-key"), Hash("monitoring-key")))
+	})
+
+	It("looks up keys by their hash", func() {
+		store, err := NewFileStore(path)
+		Expect(err).ToNot(HaveOccurred())
+
+		key, err := store.Lookup(context.Background(), Hash("ci-key"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(key.User).To(Equal("ci"))
+		Expect(key.Groups).To(ConsistOf("deployers"))
+		Expect(key.ExpiresOn.Year()).To(Equal(2030))
+		Expect(key.AllowsPath("/api/deploy")).To(BeTrue())
+		Expect(key.AllowsPath("/admin")).To(BeFalse())
+
+		key, err = store.Lookup(context.Background(), Hash("monitoring-key"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(key.Email).To(Equal("monitoring@example.com"))
+
+		_, err = store.Lookup(context.Background(), Hash("unknown-key"))
+		Expect(err).To(Equal(ErrKeyNotFound))
+	})
+
+	It("reloads the file when it changes", func() {
+		store, err := NewFileStore(path)
+		Expect(err).ToNot(HaveOccurred())
+
+		writeKeys(fmt.Sprintf("keys:\n- hash: %s\n  user: rotated\n", Hash("rotated-key")))
+
+		Eventually(func() error {
+			_, err := store.Lookup(context.Background(), Hash("rotated-key"))
+			return err
+		}).Should(Succeed())
+		_, err = store.Lookup(context.Background(), Hash("ci-key"))
+		Expect(err).To(Equal(ErrKeyNotFound))
+	})
+
+	It("rejects a file with duplicate hashes", func() {
+		writeKeys(fmt.Sprintf("keys:\n- hash: %[1]s\n  user: a\n- hash: %[1]s\n  user: b\n", Hash("key")))
+		_, err := NewFileStore(path)
+		Expect(err).To(MatchError("could not load api keys file: invalid api key 1: duplicate hash"))
+	})
+
+	It("rejects a file with invalid keys", func() {
+		writeKeys("keys:\n- hash: abc\n  user: a\n")
+		_, err := NewFileStore(path)
+		Expect(err).To(MatchError("could not load api keys file: invalid api key 0: key for user \"a\" has an invalid hash"))
+	})
+
+	It("returns an error for a missing file", func() {
+		_, err := NewFileStore(filepath.Join(GinkgoT().TempDir(), "missing.yaml"))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,60 @@
+package apikeys
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+)
+
+// StoreKeyPrefix prefixes the hash of an API key to form the key its entry is
+// stored under in a persistent store
+const StoreKeyPrefix = "oauth2-proxy-apikey-"
+
+// persistentStore looks up keys stored as JSON in a persistent session store,
+// which allows keys to be issued and revoked without restarting the proxy.
+type persistentStore struct {
+	store persistence.Store
+}
+
+// NewPersistentStore creates a Store for keys stored in the persistent store
+func NewPersistentStore(store persistence.Store) Store {
+	return &persistentStore{store: store}
+}
+
+// StoreKey returns the key the entry of the API key hash is stored under
+func StoreKey(hash string) string {
+	return StoreKeyPrefix + hash
+}
+
+// Lookup loads and decodes the key with the given hash
+func (s *persistentStore) Lookup(ctx context.Context, hash string) (*Key, error) {
+	value, err := s.store.Load(ctx, StoreKey(hash))
+	if errors.Is(err, sessionsapi.ErrSessionNotFound) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(value) == 0 {
+		return nil, ErrKeyNotFound
+	}
+
+	key := &Key{}
+	if err := json.Unmarshal(value, key); err != nil {
+		return nil, fmt.Errorf("could not decode api key: %v", err)
+	}
+	if key.Hash == "" {
+		key.Hash = hash
+	}
+	if key.Hash != hash {
+		return nil, fmt.Errorf("stored api key does not match its hash")
+	}
+	if err := key.compile(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
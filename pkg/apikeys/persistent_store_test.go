@@ -0,0 +1,53 @@
+package apikeys
+
+import (
+	"context"
+	"time"
+
+	sessionstests "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Persistent Store", func() {
+	var mockStore *sessionstests.MockStore
+	var store Store
+
+	BeforeEach(func() {
+		mockStore = sessionstests.NewMockStore()
+		store = NewPersistentStore(mockStore)
+	})
+
+	It("looks up stored keys by their hash", func() {
+		Expect(mockStore.Save(context.Background(), StoreKey(Hash("ci-key")),
+			[]byte(`{"user":"ci","groups":["deployers"],"routes":["^/api/"]}`), time.Hour)).To(Succeed())
+
+		key, err := store.Lookup(context.Background(), Hash("ci-key"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(key.Hash).To(Equal(Hash("ci-key")))
+		Expect(key.User).To(Equal("ci"))
+		Expect(key.Groups).To(ConsistOf("deployers"))
+		Expect(key.AllowsPath("/api/deploy")).To(BeTrue())
+		Expect(key.AllowsPath("/")).To(BeFalse())
+	})
+
+	It("reports unknown keys as not found", func() {
+		_, err := store.Lookup(context.Background(), Hash("unknown-key"))
+		Expect(err).To(Equal(ErrKeyNotFound))
+	})
+
+	It("rejects an entry stored under another hash", func() {
+		Expect(mockStore.Save(context.Background(), StoreKey(Hash("ci-key")),
+			[]byte(`{"hash":"`+Hash("other-key")+`","user":"ci"}`), time.Hour)).To(Succeed())
+
+		_, err := store.Lookup(context.Background(), Hash("ci-key"))
+		Expect(err).To(MatchError("stored api key does not match its hash"))
+	})
+
+	It("rejects an invalid entry", func() {
+		Expect(mockStore.Save(context.Background(), StoreKey(Hash("ci-key")), []byte(`{"user":""}`), time.Hour)).To(Succeed())
+
+		_, err := store.Lookup(context.Background(), Hash("ci-key"))
+		Expect(err).To(MatchError("key " + Hash("ci-key")[:8] + "... has no user"))
+	})
+})
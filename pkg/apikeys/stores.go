@@ -0,0 +1,29 @@
+package apikeys
+
+import (
+	"fmt"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/redis"
+)
+
+// NewStores creates the stores to look API keys up in from the configuration.
+// Keys are looked up in the keys file first and then in Redis.
+func NewStores(opts options.APIKeys, redisOpts options.RedisStoreOptions) ([]Store, error) {
+	var stores []Store
+	if opts.File != "" {
+		store, err := NewFileStore(opts.File)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, store)
+	}
+	if opts.Redis {
+		client, err := redis.NewRedisClient(redisOpts)
+		if err != nil {
+			return nil, fmt.Errorf("error constructing redis client for api keys: %v", err)
+		}
+		stores = append(stores, NewPersistentStore(&redis.SessionStore{Client: client}))
+	}
+	return stores, nil
+}
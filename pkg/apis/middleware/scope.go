@@ -21,6 +21,12 @@ type RequestScope struct {
 	// mode and if request `X-Forwarded-*` headers should be trusted
 	ReverseProxy bool
 
+	// ForwardedHost and ForwardedProto are the host and protocol requested by
+	// the client according to the `Forwarded` or `X-Forwarded-*` headers,
+	// when they are trusted
+	ForwardedHost  string
+	ForwardedProto string
+
 	// RequestID is set to the request's `X-Request-Id` header if set.
 	// Otherwise a random UUID is set.
 	RequestID string
@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
@@ -20,11 +21,13 @@ type VerifyFunc func(ctx context.Context, token string) (*oidc.IDToken, error)
 func CreateTokenToSessionFunc(verify VerifyFunc) TokenToSessionFunc {
 	return func(ctx context.Context, token string) (*sessionsapi.SessionState, error) {
 		var claims struct {
-			Subject           string   `json:"sub"`
-			Email             string   `json:"email"`
-			Verified          *bool    `json:"email_verified"`
-			PreferredUsername string   `json:"preferred_username"`
-			Groups            []string `json:"groups"`
+			Subject           string      `json:"sub"`
+			Email             string      `json:"email"`
+			Verified          *bool       `json:"email_verified"`
+			PreferredUsername string      `json:"preferred_username"`
+			Groups            []string    `json:"groups"`
+			Scope             interface{} `json:"scope"`
+			Scp               interface{} `json:"scp"`
 		}
 
 		idToken, err := verify(ctx, token)
@@ -49,6 +52,8 @@ func CreateTokenToSessionFunc(verify VerifyFunc) TokenToSessionFunc {
 			User:              claims.Subject,
 			Groups:            claims.Groups,
 			PreferredUsername: claims.PreferredUsername,
+			Scopes:            ScopesFromClaims(claims.Scope, claims.Scp),
+			Audiences:         idToken.Audience,
 			AccessToken:       token,
 			IDToken:           token,
 			RefreshToken:      "",
@@ -58,3 +63,36 @@ func CreateTokenToSessionFunc(verify VerifyFunc) TokenToSessionFunc {
 		return newSession, nil
 	}
 }
+
+// ScopesFromClaims returns the scopes granted to a token from its `scope`
+// claim (RFC 9068), falling back to the `scp` claim used by some providers.
+// Each claim may be a space delimited string or a list of strings.
+func ScopesFromClaims(scope, scp interface{}) []string {
+	if scopes := scopesFromClaim(scope); len(scopes) > 0 {
+		return scopes
+	}
+	return scopesFromClaim(scp)
+}
+
+func scopesFromClaim(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		scopes := make([]string, 0, len(v))
+		for _, scope := range v {
+			if s, ok := scope.(string); ok {
+				scopes = append(scopes, strings.Fields(s)...)
+			}
+		}
+		return scopes
+	case []string:
+		scopes := make([]string, 0, len(v))
+		for _, s := range v {
+			scopes = append(scopes, strings.Fields(s)...)
+		}
+		return scopes
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,64 @@
+package options
+
+// AllowlistPolicy decides how requests matching an AllowlistRule are handled
+type AllowlistPolicy string
+
+const (
+	// SkipAuthAllowlistPolicy allows matching requests without authentication.
+	// Sessions are still loaded, so that their headers are passed upstream,
+	// but they are not authorized.
+	SkipAuthAllowlistPolicy AllowlistPolicy = "skipAuth"
+
+	// AnonymousAllowlistPolicy authenticates and authorizes matching requests
+	// with a session as usual, but also allows requests without a session.
+	// Anonymous requests receive none of the injected headers sourced from
+	// the session.
+	AnonymousAllowlistPolicy AllowlistPolicy = "anonymous"
+)
+
+// AllowlistRule matches requests that are allowed without authentication.
+// A request matches the rule when it meets all of the conditions set on the
+// rule. Rules are checked in order and the first matching rule applies.
+type AllowlistRule struct {
+	// ID is an optional name for the rule, used in logs.
+	ID string `json:"id,omitempty"`
+
+	// Policy decides how matching requests are handled.
+	// Either `skipAuth` (the default) or `anonymous`.
+	Policy AllowlistPolicy `json:"policy,omitempty"`
+
+	// Hosts restricts the rule to requests for one of these hosts.
+	// A leading `*.` matches any subdomain, but not the domain itself,
+	// e.g. `*.example.com`.
+	Hosts []string `json:"hosts,omitempty"`
+
+	// Methods restricts the rule to requests with one of these HTTP methods.
+	// Methods are uppercased and compared with the request method exactly.
+	Methods []string `json:"methods,omitempty"`
+
+	// Path is a regular expression the request path, including the query,
+	// must match.
+	Path string `json:"path,omitempty"`
+
+	// NegatePath inverts the Path condition, so that the rule matches
+	// requests whose path does not match the Path regular expression.
+	NegatePath bool `json:"negatePath,omitempty"`
+
+	// SourceCIDRs restricts the rule to clients with an IP address in one of
+	// these networks, e.g. `10.0.0.0/8`. The client IP is determined in the
+	// same way as for `--trusted-ip`.
+	SourceCIDRs []string `json:"sourceCIDRs,omitempty"`
+
+	// Headers restricts the rule to requests with all of these headers.
+	Headers []AllowlistHeader `json:"headers,omitempty"`
+}
+
+// AllowlistHeader is a request header condition of an AllowlistRule
+type AllowlistHeader struct {
+	// Name is the name of the request header.
+	Name string `json:"name"`
+
+	// Value is a regular expression one of the values of the header must
+	// match. When empty, the header only needs to be present.
+	Value string `json:"value,omitempty"`
+}
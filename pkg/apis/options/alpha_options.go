@@ -43,6 +43,16 @@ type AlphaOptions struct {
 
 	// Providers is used to configure multiple providers.
 	Providers Providers `json:"providers,omitempty"`
+
+	// ProxyJWT is used to configure the signing of JWTs minted by the proxy
+	// for upstreams. The tokens are injected into headers using a header
+	// value with a proxyJWT source.
+	ProxyJWT *ProxyJWT `json:"proxyJWT,omitempty"`
+
+	// AllowlistRules is used to configure requests that are allowed without
+	// authentication, based on their host, method, path, source IP address
+	// and headers.
+	AllowlistRules []AllowlistRule `json:"allowlistRules,omitempty"`
 }
 
 // MergeInto replaces alpha options in the Options struct with the values
@@ -54,6 +64,8 @@ func (a *AlphaOptions) MergeInto(opts *Options) {
 	opts.Server = a.Server
 	opts.MetricsServer = a.MetricsServer
 	opts.Providers = a.Providers
+	opts.ProxyJWT = a.ProxyJWT
+	opts.AllowlistRules = a.AllowlistRules
 }
 
 // ExtractFrom populates the fields in the AlphaOptions with the values from
@@ -65,4 +77,6 @@ func (a *AlphaOptions) ExtractFrom(opts *Options) {
 	a.Server = opts.Server
 	a.MetricsServer = opts.MetricsServer
 	a.Providers = opts.Providers
+	a.ProxyJWT = opts.ProxyJWT
+	a.AllowlistRules = opts.AllowlistRules
 }
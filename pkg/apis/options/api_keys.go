@@ -0,0 +1,38 @@
+package options
+
+import "github.com/spf13/pflag"
+
+// APIKeys contains configuration options for authenticating service callers
+// with API keys
+type APIKeys struct {
+	File       string `flag:"api-keys-file" cfg:"api_keys_file"`
+	Redis      bool   `flag:"api-keys-redis" cfg:"api_keys_redis"`
+	Header     string `flag:"api-key-header" cfg:"api_key_header"`
+	QueryParam string `flag:"api-key-query-param" cfg:"api_key_query_param"`
+}
+
+func apiKeysFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("api-keys", pflag.ExitOnError)
+
+	flagSet.String("api-keys-file", "", "authenticate requests with API keys whose hashes are listed in this YAML file")
+	flagSet.Bool("api-keys-redis", false, "authenticate requests with API keys whose hashes are stored in the Redis server configured with the --redis-* options")
+	flagSet.String("api-key-header", "X-API-Key", "request header to read API keys from")
+	flagSet.String("api-key-query-param", "", "query parameter to read API keys from; API keys are not read from the query if empty")
+
+	return flagSet
+}
+
+// apiKeysDefaults creates an APIKeys structure, populating each field with its default value
+func apiKeysDefaults() APIKeys {
+	return APIKeys{
+		File:       "",
+		Redis:      false,
+		Header:     "X-API-Key",
+		QueryParam: "",
+	}
+}
+
+// Enabled returns true if API keys are looked up in any store
+func (k APIKeys) Enabled() bool {
+	return k.File != "" || k.Redis
+}
@@ -3,29 +3,50 @@ package options
 import (
 	"time"
 
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
 	"github.com/spf13/pflag"
 )
 
 // Cookie contains configuration options relating to Cookie configuration
 type Cookie struct {
-	Name           string        `flag:"cookie-name" cfg:"cookie_name"`
-	Secret         string        `flag:"cookie-secret" cfg:"cookie_secret"`
-	Domains        []string      `flag:"cookie-domain" cfg:"cookie_domains"`
-	Path           string        `flag:"cookie-path" cfg:"cookie_path"`
-	Expire         time.Duration `flag:"cookie-expire" cfg:"cookie_expire"`
-	Refresh        time.Duration `flag:"cookie-refresh" cfg:"cookie_refresh"`
-	Secure         bool          `flag:"cookie-secure" cfg:"cookie_secure"`
-	HTTPOnly       bool          `flag:"cookie-httponly" cfg:"cookie_httponly"`
-	SameSite       string        `flag:"cookie-samesite" cfg:"cookie_samesite"`
-	CSRFPerRequest bool          `flag:"cookie-csrf-per-request" cfg:"cookie_csrf_per_request"`
-	CSRFExpire     time.Duration `flag:"cookie-csrf-expire" cfg:"cookie_csrf_expire"`
+	Name             string        `flag:"cookie-name" cfg:"cookie_name"`
+	Secret           string        `flag:"cookie-secret" cfg:"cookie_secret"`
+	PreviousSecrets  []string      `flag:"cookie-previous-secret" cfg:"cookie_previous_secrets"`
+	SecretKeysetFile string        `flag:"cookie-secret-keyset-file" cfg:"cookie_secret_keyset_file"`
+	Domains          []string      `flag:"cookie-domain" cfg:"cookie_domains"`
+	Path             string        `flag:"cookie-path" cfg:"cookie_path"`
+	Expire           time.Duration `flag:"cookie-expire" cfg:"cookie_expire"`
+	Refresh          time.Duration `flag:"cookie-refresh" cfg:"cookie_refresh"`
+	Secure           bool          `flag:"cookie-secure" cfg:"cookie_secure"`
+	HTTPOnly         bool          `flag:"cookie-httponly" cfg:"cookie_httponly"`
+	SameSite         string        `flag:"cookie-samesite" cfg:"cookie_samesite"`
+	CSRFPerRequest   bool          `flag:"cookie-csrf-per-request" cfg:"cookie_csrf_per_request"`
+	CSRFExpire       time.Duration `flag:"cookie-csrf-expire" cfg:"cookie_csrf_expire"`
+
+	// internal value set at startup when the secrets are loaded from the SecretKeysetFile
+	keyset *encryption.Keyset
 }
 
+// Keyset returns the secrets used to sign and encrypt cookies. Unless a
+// keyset has been loaded from the SecretKeysetFile, the Secret is the primary
+// secret followed by the PreviousSecrets.
+func (c *Cookie) Keyset() *encryption.Keyset {
+	if c.keyset != nil {
+		return c.keyset
+	}
+	return encryption.NewKeyset(append([]string{c.Secret}, c.PreviousSecrets...)...)
+}
+
+// SetKeyset sets the keyset loaded from the SecretKeysetFile
+func (c *Cookie) SetKeyset(k *encryption.Keyset) { c.keyset = k }
+
 func cookieFlagSet() *pflag.FlagSet {
 	flagSet := pflag.NewFlagSet("cookie", pflag.ExitOnError)
 
 	flagSet.String("cookie-name", "_oauth2_proxy", "the name of the cookie that the oauth_proxy creates")
 	flagSet.String("cookie-secret", "", "the seed string for secure cookies (optionally base64 encoded)")
+	flagSet.StringSlice("cookie-previous-secret", []string{}, "previous cookie secrets that are still accepted for existing cookies while rotating the cookie secret (may be given multiple times)")
+	flagSet.String("cookie-secret-keyset-file", "", "path to a file of cookie secrets, one per line, starting with the secret used for new cookies. The file is watched for updates")
 	flagSet.StringSlice("cookie-domain", []string{}, "Optional cookie domains to force cookies to (ie: `.yourcompany.com`). The longest domain matching the request's host will be used (or the shortest cookie domain if there is no match).")
 	flagSet.String("cookie-path", "/", "an optional cookie path to force cookies to (ie: /poc/)*")
 	flagSet.Duration("cookie-expire", time.Duration(168)*time.Hour, "expire timeframe for cookie")
@@ -41,16 +62,18 @@ func cookieFlagSet() *pflag.FlagSet {
 // cookieDefaults creates a Cookie populating each field with its default value
 func cookieDefaults() Cookie {
 	return Cookie{
-		Name:           "_oauth2_proxy",
-		Secret:         "",
-		Domains:        nil,
-		Path:           "/",
-		Expire:         time.Duration(168) * time.Hour,
-		Refresh:        time.Duration(0),
-		Secure:         true,
-		HTTPOnly:       true,
-		SameSite:       "",
-		CSRFPerRequest: false,
-		CSRFExpire:     time.Duration(15) * time.Minute,
+		Name:             "_oauth2_proxy",
+		Secret:           "",
+		PreviousSecrets:  nil,
+		SecretKeysetFile: "",
+		Domains:          nil,
+		Path:             "/",
+		Expire:           time.Duration(168) * time.Hour,
+		Refresh:          time.Duration(0),
+		Secure:           true,
+		HTTPOnly:         true,
+		SameSite:         "",
+		CSRFPerRequest:   false,
+		CSRFExpire:       time.Duration(15) * time.Minute,
 	}
 }
@@ -25,6 +25,9 @@ type HeaderValue struct {
 
 	// Allow users to load the value from a session claim
 	*ClaimSource `json:",omitempty"`
+
+	// Allow users to set the value to a JWT signed by the proxy
+	ProxyJWT *ProxyJWTSource `json:"proxyJWT,omitempty"`
 }
 
 // ClaimSource allows loading a header value from a claim within the session
@@ -43,3 +46,20 @@ type ClaimSource struct {
 	// basicAuthPassword will be used as the password value.
 	BasicAuthPassword *SecretSource `json:"basicAuthPassword,omitempty"`
 }
+
+// ProxyJWTSource sets a header value to a JWT signed by the proxy with the
+// key configured in ProxyJWT. The token identifies the user with the `sub`,
+// `email`, `preferred_username` and `groups` claims of the session.
+type ProxyJWTSource struct {
+	// Audience is the `aud` claim of the token, identifying the upstream
+	// the token is intended for.
+	Audience string `json:"audience,omitempty"`
+
+	// Claims lists additional session claims to include in the token.
+	// Available claims are the same as for a ClaimSource.
+	Claims []string `json:"claims,omitempty"`
+
+	// Prefix is an optional prefix that will be prepended to the token,
+	// e.g. "Bearer ".
+	Prefix string `json:"prefix,omitempty"`
+}
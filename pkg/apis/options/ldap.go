@@ -0,0 +1,61 @@
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// LDAP contains configuration options for authenticating basic auth and
+// sign in form credentials against an LDAP directory
+type LDAP struct {
+	URL                string        `flag:"ldap-url" cfg:"ldap_url"`
+	StartTLS           bool          `flag:"ldap-start-tls" cfg:"ldap_start_tls"`
+	InsecureSkipVerify bool          `flag:"ldap-insecure-skip-verify" cfg:"ldap_insecure_skip_verify"`
+	Timeout            time.Duration `flag:"ldap-timeout" cfg:"ldap_timeout"`
+	BindDN             string        `flag:"ldap-bind-dn" cfg:"ldap_bind_dn"`
+	BindPassword       string        `flag:"ldap-bind-password" cfg:"ldap_bind_password"`
+	UserBaseDN         string        `flag:"ldap-user-base-dn" cfg:"ldap_user_base_dn"`
+	UserFilter         string        `flag:"ldap-user-filter" cfg:"ldap_user_filter"`
+	GroupBaseDN        string        `flag:"ldap-group-base-dn" cfg:"ldap_group_base_dn"`
+	GroupFilter        string        `flag:"ldap-group-filter" cfg:"ldap_group_filter"`
+	GroupNameAttribute string        `flag:"ldap-group-name-attribute" cfg:"ldap_group_name_attribute"`
+	CacheTTL           time.Duration `flag:"ldap-cache-ttl" cfg:"ldap_cache_ttl"`
+}
+
+func ldapFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("ldap", pflag.ExitOnError)
+
+	flagSet.String("ldap-url", "", "authenticate basic auth and sign in form credentials against this LDAP server (eg: ldaps://ldap.example.com:636)")
+	flagSet.Bool("ldap-start-tls", false, "upgrade ldap:// connections to TLS with StartTLS")
+	flagSet.Bool("ldap-insecure-skip-verify", false, "skip validation of the LDAP server certificate")
+	flagSet.Duration("ldap-timeout", 10*time.Second, "timeout for LDAP requests")
+	flagSet.String("ldap-bind-dn", "", "DN of the service account used to search for users and groups; anonymous searches are used if empty")
+	flagSet.String("ldap-bind-password", "", "password of the LDAP service account")
+	flagSet.String("ldap-user-base-dn", "", "base DN to search for users in")
+	flagSet.String("ldap-user-filter", "(uid=%s)", "filter to find a user, %s is replaced with the escaped username")
+	flagSet.String("ldap-group-base-dn", "", "base DN to search for the user's groups in; groups are not looked up if empty")
+	flagSet.String("ldap-group-filter", "(member=%s)", "filter to find the user's groups, %s is replaced with the escaped user DN")
+	flagSet.String("ldap-group-name-attribute", "cn", "attribute of a group entry used as the group name in the session")
+	flagSet.Duration("ldap-cache-ttl", time.Minute, "how long successfully validated credentials are cached before the LDAP server is asked again; 0 disables the cache")
+
+	return flagSet
+}
+
+// ldapDefaults creates a LDAP structure, populating each field with its default value
+func ldapDefaults() LDAP {
+	return LDAP{
+		URL:                "",
+		StartTLS:           false,
+		InsecureSkipVerify: false,
+		Timeout:            10 * time.Second,
+		BindDN:             "",
+		BindPassword:       "",
+		UserBaseDN:         "",
+		UserFilter:         "(uid=%s)",
+		GroupBaseDN:        "",
+		GroupFilter:        "(member=%s)",
+		GroupNameAttribute: "cn",
+		CacheTTL:           time.Minute,
+	}
+}
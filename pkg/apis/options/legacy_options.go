@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/url"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -25,6 +26,9 @@ type LegacyOptions struct {
 	// Legacy options for single provider
 	LegacyProvider LegacyProvider `cfg:",squash"`
 
+	// Legacy options for requests allowed without authentication
+	LegacySkipAuth LegacySkipAuth `cfg:",squash"`
+
 	Options Options `cfg:",squash"`
 }
 
@@ -72,6 +76,7 @@ func NewLegacyFlagSet() *pflag.FlagSet {
 	flagSet.AddFlagSet(legacyServerFlagset())
 	flagSet.AddFlagSet(legacyProviderFlagSet())
 	flagSet.AddFlagSet(legacyGoogleFlagSet())
+	flagSet.AddFlagSet(legacySkipAuthFlagSet())
 
 	return flagSet
 }
@@ -95,6 +100,8 @@ func (l *LegacyOptions) ToOptions() (*Options, error) {
 	}
 	l.Options.Providers = providers
 
+	l.Options.AllowlistRules = l.LegacySkipAuth.convert()
+
 	return &l.Options, nil
 }
 
@@ -186,6 +193,59 @@ func (l *LegacyUpstreams) convert() (UpstreamConfig, error) {
 	return upstreams, nil
 }
 
+type LegacySkipAuth struct {
+	SkipAuthRegex  []string `flag:"skip-auth-regex" cfg:"skip_auth_regex"`
+	SkipAuthRoutes []string `flag:"skip-auth-route" cfg:"skip_auth_routes"`
+}
+
+func legacySkipAuthFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("skip-auth", pflag.ExitOnError)
+
+	flagSet.StringSlice("skip-auth-regex", []string{}, "(DEPRECATED for --skip-auth-route) bypass authentication for requests path's that match (may be given multiple times)")
+	flagSet.StringSlice("skip-auth-route", []string{}, "bypass authentication for requests that match the method & path. Format: method=path_regex OR method!=path_regex. For all methods: path_regex OR !=path_regex")
+
+	return flagSet
+}
+
+// convert translates the skip auth regexes and method=path routes into
+// allowlist rules. Routes with a `!=` separator match requests whose path
+// does not match the regex.
+func (l *LegacySkipAuth) convert() []AllowlistRule {
+	rules := make([]AllowlistRule, 0, len(l.SkipAuthRegex)+len(l.SkipAuthRoutes))
+
+	for _, path := range l.SkipAuthRegex {
+		rules = append(rules, AllowlistRule{
+			Path: path,
+		})
+	}
+
+	for _, methodPath := range l.SkipAuthRoutes {
+		rule := AllowlistRule{
+			NegatePath: strings.Contains(methodPath, "!="),
+		}
+
+		parts := legacySkipAuthRouteSeparator.Split(methodPath, 2)
+		if len(parts) == 1 {
+			rule.Path = parts[0]
+		} else {
+			rule.Path = parts[1]
+			if parts[0] != "" {
+				rule.Methods = []string{strings.ToUpper(parts[0])}
+			}
+		}
+		rules = append(rules, rule)
+	}
+
+	if len(rules) == 0 {
+		return nil
+	}
+	return rules
+}
+
+// legacySkipAuthRouteSeparator separates the method and path of a skip auth
+// route
+var legacySkipAuthRouteSeparator = regexp.MustCompile("!?=")
+
 type LegacyHeaders struct {
 	PassBasicAuth     bool `flag:"pass-basic-auth" cfg:"pass_basic_auth"`
 	PassAccessToken   bool `flag:"pass-access-token" cfg:"pass_access_token"`
@@ -522,6 +582,8 @@ type LegacyProvider struct {
 	OIDCExtraAudiences                 []string `flag:"oidc-extra-audience" cfg:"oidc_extra_audiences"`
 	LoginURL                           string   `flag:"login-url" cfg:"login_url"`
 	RedeemURL                          string   `flag:"redeem-url" cfg:"redeem_url"`
+	DeviceAuthURL                      string   `flag:"device-auth-url" cfg:"device_auth_url"`
+	IntrospectionURL                   string   `flag:"introspection-url" cfg:"introspection_url"`
 	ProfileURL                         string   `flag:"profile-url" cfg:"profile_url"`
 	SkipClaimsFromProfileURL           bool     `flag:"skip-claims-from-profile-url" cfg:"skip_claims_from_profile_url"`
 	ProtectedResource                  string   `flag:"resource" cfg:"resource"`
@@ -542,6 +604,8 @@ type LegacyProvider struct {
 	CodeChallengeMethod string `flag:"code-challenge-method" cfg:"code_challenge_method"`
 	// Provided for legacy reasons, to be dropped in newer version see #1667
 	ForceCodeChallengeMethod string `flag:"force-code-challenge-method" cfg:"force_code_challenge_method"`
+	// Bind tokens to a per-session key pair (RFC 9449)
+	DPoP bool `flag:"dpop" cfg:"dpop"`
 }
 
 func legacyProviderFlagSet() *pflag.FlagSet {
@@ -579,6 +643,8 @@ func legacyProviderFlagSet() *pflag.FlagSet {
 	flagSet.StringSlice("oidc-extra-audience", []string{}, "additional audiences allowed to pass audience verification")
 	flagSet.String("login-url", "", "Authentication endpoint")
 	flagSet.String("redeem-url", "", "Token redemption endpoint")
+	flagSet.String("device-auth-url", "", "Device authorization endpoint (RFC 8628)")
+	flagSet.String("introspection-url", "", "Token introspection endpoint (RFC 7662)")
 	flagSet.String("profile-url", "", "Profile access endpoint")
 	flagSet.Bool("skip-claims-from-profile-url", false, "Skip loading missing claims from profile URL")
 	flagSet.String("resource", "", "The resource that is protected (Azure AD only)")
@@ -588,6 +654,7 @@ func legacyProviderFlagSet() *pflag.FlagSet {
 	flagSet.String("approval-prompt", "force", "OAuth approval_prompt")
 	flagSet.String("code-challenge-method", "", "use PKCE code challenges with the specified method. Either 'plain' or 'S256'")
 	flagSet.String("force-code-challenge-method", "", "Deprecated - use --code-challenge-method")
+	flagSet.Bool("dpop", false, "bind tokens to a per-session key pair with DPoP (RFC 9449)")
 
 	flagSet.String("acr-values", "", "acr values string:  optional")
 	flagSet.String("jwt-key", "", "private key in PEM format used to sign JWT, so that you can say something like -jwt-key=\"${OAUTH2_PROXY_JWT_KEY}\": required by login.gov")
@@ -670,6 +737,8 @@ func (l *LegacyProvider) convert() (Providers, error) {
 		UseSystemTrustStore:      l.UseSystemTrustStore,
 		LoginURL:                 l.LoginURL,
 		RedeemURL:                l.RedeemURL,
+		DeviceAuthURL:            l.DeviceAuthURL,
+		IntrospectionURL:         l.IntrospectionURL,
 		ProfileURL:               l.ProfileURL,
 		SkipClaimsFromProfileURL: l.SkipClaimsFromProfileURL,
 		ProtectedResource:        l.ProtectedResource,
@@ -677,6 +746,7 @@ func (l *LegacyProvider) convert() (Providers, error) {
 		Scope:                    l.Scope,
 		AllowedGroups:            l.AllowedGroups,
 		CodeChallengeMethod:      l.CodeChallengeMethod,
+		DPoP:                     l.DPoP,
 		BackendLogoutURL:         l.BackendLogoutURL,
 	}
 
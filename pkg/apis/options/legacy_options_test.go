@@ -1038,4 +1038,74 @@ var _ = Describe("Legacy Options", func() {
 			}),
 		)
 	})
+
+	Context("Legacy Skip Auth", func() {
+		type legacySkipAuthTableInput struct {
+			legacySkipAuth LegacySkipAuth
+			expectedRules  []AllowlistRule
+		}
+
+		DescribeTable("should convert to allowlist rules",
+			func(in legacySkipAuthTableInput) {
+				Expect(in.legacySkipAuth.convert()).To(Equal(in.expectedRules))
+			},
+			Entry("with no skip auth configured", legacySkipAuthTableInput{
+				legacySkipAuth: LegacySkipAuth{
+					SkipAuthRegex:  []string{},
+					SkipAuthRoutes: []string{},
+				},
+				expectedRules: nil,
+			}),
+			Entry("with only skipAuthRegex configured", legacySkipAuthTableInput{
+				legacySkipAuth: LegacySkipAuth{
+					SkipAuthRegex: []string{
+						"^/foo/bar",
+						"^/baz/[0-9]+/thing",
+					},
+				},
+				expectedRules: []AllowlistRule{
+					{Path: "^/foo/bar"},
+					{Path: "^/baz/[0-9]+/thing"},
+				},
+			}),
+			Entry("with only skipAuthRoutes configured", legacySkipAuthTableInput{
+				legacySkipAuth: LegacySkipAuth{
+					SkipAuthRoutes: []string{
+						"GET=^/foo/bar",
+						"post=^/baz/[0-9]+/thing",
+						"^/all/methods$",
+						"WEIRD=^/methods/are/allowed",
+						"PATCH=/second/equals?are=handled&just=fine",
+						"!=^/api",
+						"METHOD!=^/api",
+					},
+				},
+				expectedRules: []AllowlistRule{
+					{Methods: []string{"GET"}, Path: "^/foo/bar"},
+					{Methods: []string{"POST"}, Path: "^/baz/[0-9]+/thing"},
+					{Path: "^/all/methods$"},
+					{Methods: []string{"WEIRD"}, Path: "^/methods/are/allowed"},
+					{Methods: []string{"PATCH"}, Path: "/second/equals?are=handled&just=fine"},
+					{Path: "^/api", NegatePath: true},
+					{Methods: []string{"METHOD"}, Path: "^/api", NegatePath: true},
+				},
+			}),
+			Entry("with both skipAuthRegex and skipAuthRoutes configured", legacySkipAuthTableInput{
+				legacySkipAuth: LegacySkipAuth{
+					SkipAuthRegex: []string{
+						"^/foo/bar/regex",
+					},
+					SkipAuthRoutes: []string{
+						"GET=^/foo/bar",
+						"^/all/methods$",
+					},
+				},
+				expectedRules: []AllowlistRule{
+					{Path: "^/foo/bar/regex"},
+					{Methods: []string{"GET"}, Path: "^/foo/bar"},
+					{Path: "^/all/methods$"},
+				},
+			}),
+		)
+	})
 })
@@ -47,16 +47,20 @@ var _ = Describe("Load", func() {
 		},
 
 		Options: Options{
-			ProxyPrefix:        "/oauth2",
-			PingPath:           "/ping",
-			ReadyPath:          "/ready",
-			RealClientIPHeader: "X-Real-IP",
-			ForceHTTPS:         false,
-			Cookie:             cookieDefaults(),
-			Session:            sessionOptionsDefaults(),
-			Templates:          templatesDefaults(),
-			SkipAuthPreflight:  false,
-			Logging:            loggingDefaults(),
+			ProxyPrefix:            "/oauth2",
+			PingPath:               "/ping",
+			ReadyPath:              "/ready",
+			RealClientIPHeader:     "X-Real-IP",
+			ForceHTTPS:             false,
+			Cookie:                 cookieDefaults(),
+			Session:                sessionOptionsDefaults(),
+			Templates:              templatesDefaults(),
+			SkipAuthPreflight:      false,
+			IntrospectionCacheSize: 1000,
+			Logging:                loggingDefaults(),
+			SessionEvents:          sessionEventsDefaults(),
+			LDAP:                   ldapDefaults(),
+			APIKeys:                apiKeysDefaults(),
 		},
 	}
 
@@ -3,6 +3,7 @@ package options
 import (
 	"crypto"
 	"net/url"
+	"time"
 
 	ipapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/ip"
 	internaloidc "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/providers/oidc"
@@ -24,6 +25,7 @@ type Options struct {
 	ReadyPath           string   `flag:"ready-path" cfg:"ready_path"`
 	ReverseProxy        bool     `flag:"reverse-proxy" cfg:"reverse_proxy"`
 	RealClientIPHeader  string   `flag:"real-client-ip-header" cfg:"real_client_ip_header"`
+	TrustedProxies      []string `flag:"trusted-proxy" cfg:"trusted_proxies"`
 	TrustedIPs          []string `flag:"trusted-ip" cfg:"trusted_ips"`
 	ForceHTTPS          bool     `flag:"force-https" cfg:"force_https"`
 	RawRedirectURL      string   `flag:"redirect-url" cfg:"redirect_url"`
@@ -34,11 +36,15 @@ type Options struct {
 	WhitelistDomains        []string `flag:"whitelist-domain" cfg:"whitelist_domains"`
 	HtpasswdFile            string   `flag:"htpasswd-file" cfg:"htpasswd_file"`
 	HtpasswdUserGroups      []string `flag:"htpasswd-user-group" cfg:"htpasswd_user_groups"`
+	HtpasswdGroupsFile      string   `flag:"htpasswd-groups-file" cfg:"htpasswd_groups_file"`
 
-	Cookie    Cookie         `cfg:",squash"`
-	Session   SessionOptions `cfg:",squash"`
-	Logging   Logging        `cfg:",squash"`
-	Templates Templates      `cfg:",squash"`
+	Cookie        Cookie         `cfg:",squash"`
+	Session       SessionOptions `cfg:",squash"`
+	Logging       Logging        `cfg:",squash"`
+	Templates     Templates      `cfg:",squash"`
+	SessionEvents SessionEvents  `cfg:",squash"`
+	LDAP          LDAP           `cfg:",squash"`
+	APIKeys       APIKeys        `cfg:",squash"`
 
 	// Not used in the legacy config, name not allowed to match an external key (upstreams)
 	// TODO(JoelSpeed): Rename when legacy config is removed
@@ -52,9 +58,13 @@ type Options struct {
 
 	Providers Providers `cfg:",internal"`
 
+	ProxyJWT *ProxyJWT `cfg:",internal"`
+
+	AllowlistRules []AllowlistRule `cfg:",internal"`
+
 	APIRoutes             []string `flag:"api-route" cfg:"api_routes"`
-	SkipAuthRegex         []string `flag:"skip-auth-regex" cfg:"skip_auth_regex"`
-	SkipAuthRoutes        []string `flag:"skip-auth-route" cfg:"skip_auth_routes"`
+	APIRouteScopes        []string `flag:"api-route-scope" cfg:"api_route_scopes"`
+	APIRouteAudiences     []string `flag:"api-route-audience" cfg:"api_route_audiences"`
 	SkipJwtBearerTokens   bool     `flag:"skip-jwt-bearer-tokens" cfg:"skip_jwt_bearer_tokens"`
 	ExtraJwtIssuers       []string `flag:"extra-jwt-issuers" cfg:"extra_jwt_issuers"`
 	SkipProviderButton    bool     `flag:"skip-provider-button" cfg:"skip_provider_button"`
@@ -63,6 +73,10 @@ type Options struct {
 	ForceJSONErrors       bool     `flag:"force-json-errors" cfg:"force_json_errors"`
 	EncodeState           bool     `flag:"encode-state" cfg:"encode_state"`
 	AllowQuerySemicolons  bool     `flag:"allow-query-semicolons" cfg:"allow_query_semicolons"`
+	EnableDeviceFlow      bool     `flag:"enable-device-flow" cfg:"enable_device_flow"`
+
+	IntrospectBearerTokens bool `flag:"introspect-bearer-tokens" cfg:"introspect_bearer_tokens"`
+	IntrospectionCacheSize int  `flag:"introspection-cache-size" cfg:"introspection_cache_size"`
 
 	SignatureKey    string `flag:"signature-key" cfg:"signature_key"`
 	GCPHealthChecks bool   `flag:"gcp-healthchecks" cfg:"gcp_healthchecks"`
@@ -97,17 +111,21 @@ func (o *Options) SetRealClientIPParser(s ipapi.RealClientIPParser)       { o.re
 // NewOptions constructs a new Options with defaulted values
 func NewOptions() *Options {
 	return &Options{
-		ProxyPrefix:        "/oauth2",
-		Providers:          providerDefaults(),
-		PingPath:           "/ping",
-		ReadyPath:          "/ready",
-		RealClientIPHeader: "X-Real-IP",
-		ForceHTTPS:         false,
-		Cookie:             cookieDefaults(),
-		Session:            sessionOptionsDefaults(),
-		Templates:          templatesDefaults(),
-		SkipAuthPreflight:  false,
-		Logging:            loggingDefaults(),
+		ProxyPrefix:            "/oauth2",
+		Providers:              providerDefaults(),
+		PingPath:               "/ping",
+		ReadyPath:              "/ready",
+		RealClientIPHeader:     "X-Real-IP",
+		ForceHTTPS:             false,
+		Cookie:                 cookieDefaults(),
+		Session:                sessionOptionsDefaults(),
+		Templates:              templatesDefaults(),
+		SkipAuthPreflight:      false,
+		IntrospectionCacheSize: 1000,
+		Logging:                loggingDefaults(),
+		SessionEvents:          sessionEventsDefaults(),
+		LDAP:                   ldapDefaults(),
+		APIKeys:                apiKeysDefaults(),
 	}
 }
 
@@ -116,14 +134,16 @@ func NewFlagSet() *pflag.FlagSet {
 	flagSet := pflag.NewFlagSet("oauth2-proxy", pflag.ExitOnError)
 
 	flagSet.Bool("reverse-proxy", false, "are we running behind a reverse proxy, controls whether headers like X-Real-Ip are accepted")
-	flagSet.String("real-client-ip-header", "X-Real-IP", "Header used to determine the real IP of the client (one of: X-Forwarded-For, X-Real-IP, X-ProxyUser-IP, or X-Envoy-External-Address)")
+	flagSet.String("real-client-ip-header", "X-Real-IP", "Header used to determine the real IP of the client (one of: X-Forwarded-For, X-Real-IP, X-ProxyUser-IP, X-Envoy-External-Address, or Forwarded)")
+	flagSet.StringSlice("trusted-proxy", []string{}, "list of IPs or CIDR ranges of reverse proxies trusted to set forwarding headers (may be given multiple times). When set, forwarding headers are only accepted from these proxies and the real client IP is the rightmost address in the header that is not a trusted proxy")
 	flagSet.StringSlice("trusted-ip", []string{}, "list of IPs or CIDR ranges to allow to bypass authentication. WARNING: trusting by IP has inherent security flaws, read the configuration documentation for more information.")
 	flagSet.Bool("force-https", false, "force HTTPS redirect for HTTP requests")
 	flagSet.String("redirect-url", "", "the OAuth Redirect URL. ie: \"https://internalapp.yourcompany.com/oauth2/callback\"")
 	flagSet.Bool("relative-redirect-url", false, "allow relative OAuth Redirect URL.")
-	flagSet.StringSlice("skip-auth-regex", []string{}, "(DEPRECATED for --skip-auth-route) bypass authentication for requests path's that match (may be given multiple times)")
-	flagSet.StringSlice("skip-auth-route", []string{}, "bypass authentication for requests that match the method & path. Format: method=path_regex OR method!=path_regex. For all methods: path_regex OR !=path_regex")
+	flagSet.String("htpasswd-groups-file", "", "file mapping htpasswd users to groups, with a \"group: user [user...]\" line per group")
 	flagSet.StringSlice("api-route", []string{}, "return HTTP 401 instead of redirecting to authentication server if token is not valid. Format: path_regex")
+	flagSet.StringSlice("api-route-scope", []string{}, "API route whose requests must be authorized with all of the given OAuth scopes, otherwise HTTP 403 is returned. Format: scope[ scope...]=path_regex")
+	flagSet.StringSlice("api-route-audience", []string{}, "API route whose requests must be authorized with a token issued for one of the given audiences, otherwise HTTP 403 is returned. Format: audience[ audience...]=path_regex")
 	flagSet.Bool("skip-provider-button", false, "will skip sign-in-page to directly reach the next step: oauth/start")
 	flagSet.Bool("skip-auth-preflight", false, "will skip authentication for OPTIONS requests")
 	flagSet.Bool("ssl-insecure-skip-verify", false, "skip validation of certificates presented when using HTTPS providers")
@@ -131,19 +151,45 @@ func NewFlagSet() *pflag.FlagSet {
 	flagSet.Bool("force-json-errors", false, "will force JSON errors instead of HTTP error pages or redirects")
 	flagSet.Bool("encode-state", false, "will encode oauth state with base64")
 	flagSet.Bool("allow-query-semicolons", false, "allow the use of semicolons in query args")
+	flagSet.Bool("enable-device-flow", false, "enable the OAuth 2.0 device authorization grant endpoints for CLI clients")
 	flagSet.StringSlice("extra-jwt-issuers", []string{}, "if skip-jwt-bearer-tokens is set, a list of extra JWT issuer=audience pairs (where the issuer URL has a .well-known/openid-configuration or a .well-known/jwks.json)")
+	flagSet.Bool("introspect-bearer-tokens", false, "will skip requests that have bearer tokens, including opaque tokens, which the provider's introspection endpoint reports as active (default false)")
+	flagSet.Int("introspection-cache-size", 1000, "maximum number of active token introspection results to cache until the tokens expire; 0 to disable caching")
 
 	flagSet.StringSlice("email-domain", []string{}, "authenticate emails with the specified domain (may be given multiple times). Use * to authenticate any email")
 	flagSet.StringSlice("whitelist-domain", []string{}, "allowed domains for redirection after authentication. Prefix domain with a . or a *. to allow subdomains (eg .example.com, *.example.com)")
 	flagSet.String("authenticated-emails-file", "", "authenticate against emails via file (one per line)")
-	flagSet.String("htpasswd-file", "", "additionally authenticate against a htpasswd file. Entries must be created with \"htpasswd -B\" for bcrypt encryption")
+	flagSet.String("htpasswd-file", "", "additionally authenticate against a htpasswd file. Entries must be created with \"htpasswd -B\" for bcrypt encryption, or hashed with argon2id, scrypt or SHA-crypt")
 	flagSet.StringSlice("htpasswd-user-group", []string{}, "the groups to be set on sessions for htpasswd users (may be given multiple times)")
 	flagSet.String("proxy-prefix", "/oauth2", "the url root path that this proxy should be nested under (e.g. /<oauth2>/sign_in)")
 	flagSet.String("ping-path", "/ping", "the ping endpoint that can be used for basic health checks")
 	flagSet.String("ping-user-agent", "", "special User-Agent that will be used for basic health checks")
 	flagSet.String("ready-path", "/ready", "the ready endpoint that can be used for deep health checks")
 	flagSet.String("session-store-type", "cookie", "the session storage provider to use")
+	flagSet.Duration("session-idle-timeout", time.Duration(0), "expire sessions that have not been used for this duration; 0 to disable")
+	flagSet.Duration("session-activity-write-interval", time.Minute, "how often the last activity time of a session is saved when using --session-idle-timeout")
+	flagSet.Duration("session-max-age", time.Duration(0), "absolute maximum age of a session from login, regardless of refreshes or activity; 0 to disable")
+	flagSet.Duration("session-refresh-skew", time.Duration(0), "refresh sessions when the access token expires within this duration, in addition to --cookie-refresh; 0 to disable")
+	flagSet.Bool("session-migrate-on-read", false, "save sessions stored in a session format older than --session-write-version again when they are loaded")
+	flagSet.Int("session-write-version", 1, "session format version sessions are saved in; 1 can be read by every release, set 2 once every instance supports it")
+	flagSet.Int("session-max-concurrent", 0, "maximum number of concurrent sessions per user (redis session store only); 0 for no limit")
+	flagSet.String("session-concurrent-limit-policy", EvictOldestSessionLimitPolicy, "what to do when a login exceeds --session-max-concurrent: \"evict-oldest\" or \"reject\"")
 	flagSet.Bool("session-cookie-minimal", false, "strip OAuth tokens from cookie session stores if they aren't needed (cookie session store only)")
+	flagSet.Int("session-hybrid-threshold", 4000, "size in bytes of the session cookie above which the hybrid session store moves a session to its persistent backend")
+	flagSet.String("session-hybrid-backend", RedisSessionStoreType, "the persistent session store used by the hybrid session store for large sessions: \"redis\" or \"plugin\"")
+	flagSet.String("session-plugin-address", "", "address of the session plugin for plugin session storage (eg: unix:///run/oauth2-proxy/sessions.sock or http://HOST:PORT)")
+	flagSet.Duration("session-plugin-timeout", 5*time.Second, "timeout of requests to the session plugin")
+	flagSet.String("session-key-provider", "", "envelope encrypt sessions with data keys wrapped by this key provider (currently only \"file\" is supported)")
+	flagSet.String("session-kek-file", "", "path to the key encryption key used by the \"file\" session key provider")
+	flagSet.Bool("session-background-refresh", false, "refresh persisted sessions in the background before their access token expires (redis, hybrid or plugin session stores only)")
+	flagSet.Duration("session-background-refresh-window", 5*time.Minute, "refresh sessions in the background when their access token expires within this duration")
+	flagSet.Duration("session-background-refresh-jitter", time.Minute, "maximum random amount each background refresh is brought forward by, to spread refreshes out")
+	flagSet.Duration("session-background-refresh-interval", 30*time.Second, "how often sessions due a background refresh are looked for")
+	flagSet.Int("session-background-refresh-concurrency", 4, "maximum number of sessions refreshed in the background at once")
+	flagSet.StringSlice("session-binding", []string{}, "bind sessions to a fingerprint of the client: \"client-ip\", \"user-agent\" and/or \"tls-client-cert\" (may be given multiple times)")
+	flagSet.Int("session-binding-ipv4-prefix", 24, "prefix length of the IPv4 network sessions are bound to with the \"client-ip\" session binding")
+	flagSet.Int("session-binding-ipv6-prefix", 64, "prefix length of the IPv6 network sessions are bound to with the \"client-ip\" session binding")
+	flagSet.String("session-binding-mismatch-action", DropSessionBindingAction, "what to do when a session is used by a different client: \"drop\" or \"revoke\"")
 	flagSet.String("redis-connection-url", "", "URL of redis server for redis session storage (eg: redis://[USER[:PASSWORD]@]HOST[:PORT])")
 	flagSet.String("redis-username", "", "Redis username. Applicable for Redis configurations where ACL has been configured. Will override any username set in `--redis-connection-url`")
 	flagSet.String("redis-password", "", "Redis password. Applicable for all Redis configurations. Will override any password set in `--redis-connection-url`")
@@ -162,6 +208,9 @@ func NewFlagSet() *pflag.FlagSet {
 	flagSet.AddFlagSet(cookieFlagSet())
 	flagSet.AddFlagSet(loggingFlagSet())
 	flagSet.AddFlagSet(templatesFlagSet())
+	flagSet.AddFlagSet(sessionEventsFlagSet())
+	flagSet.AddFlagSet(ldapFlagSet())
+	flagSet.AddFlagSet(apiKeysFlagSet())
 
 	return flagSet
 }
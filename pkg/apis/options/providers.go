@@ -68,6 +68,26 @@ type Provider struct {
 	LoginURLParameters []LoginURLParameter `json:"loginURLParameters,omitempty"`
 	// RedeemURL is the token redemption endpoint
 	RedeemURL string `json:"redeemURL,omitempty"`
+	// DeviceAuthURL is the device authorization endpoint (RFC 8628)
+	// When using OIDC discovery this is populated from `device_authorization_endpoint`
+	DeviceAuthURL string `json:"deviceAuthURL,omitempty"`
+	// PushedAuthorizationRequestURL is the pushed authorization request endpoint (RFC 9126)
+	// It is used when PushedAuthorizationRequests is enabled.
+	// When using OIDC discovery this is populated from `pushed_authorization_request_endpoint`
+	PushedAuthorizationRequestURL string `json:"pushedAuthorizationRequestURL,omitempty"`
+	// PushedAuthorizationRequests pushes the login parameters to the
+	// PushedAuthorizationRequestURL, so that the user is redirected to the
+	// LoginURL with only the resulting `request_uri`.
+	// It is always enabled when OIDC discovery reports that the provider
+	// requires it with `require_pushed_authorization_requests`.
+	PushedAuthorizationRequests bool `json:"pushedAuthorizationRequests,omitempty"`
+	// IntrospectionURL is the token introspection endpoint (RFC 7662)
+	// It is used to validate opaque bearer tokens when `--introspect-bearer-tokens` is set.
+	// When using OIDC discovery this is populated from `introspection_endpoint`
+	IntrospectionURL string `json:"introspectionURL,omitempty"`
+	// RequestObject configures signed authorization request objects (RFC 9101)
+	// When set, the login parameters are sent to the provider as a signed JWT.
+	RequestObject *RequestObject `json:"requestObject,omitempty"`
 	// ProfileURL is the profile access endpoint
 	ProfileURL string `json:"profileURL,omitempty"`
 	// SkipClaimsFromProfileURL allows to skip request to Profile URL for resolving claims not present in id_token
@@ -83,6 +103,10 @@ type Provider struct {
 	AllowedGroups []string `json:"allowedGroups,omitempty"`
 	// The code challenge method
 	CodeChallengeMethod string `json:"code_challenge_method,omitempty"`
+	// DPoP binds the session's tokens to a per-session key pair using
+	// OAuth 2.0 Demonstrating Proof of Possession (RFC 9449).
+	// Proofs are sent when redeeming, refreshing and calling the profile endpoint.
+	DPoP bool `json:"dpop,omitempty"`
 
 	// URL to call to perform backend logout, `{id_token}` would be replaced by the actual `id_token` if available in the session
 	BackendLogoutURL string `json:"backendLogoutURL"`
@@ -240,8 +264,50 @@ type OIDCOptions struct {
 	// ExtraAudiences is a list of additional audiences that are allowed
 	// to pass verification in addition to the client id.
 	ExtraAudiences []string `json:"extraAudiences,omitempty"`
+	// UserInfo enables enrichment of sessions with the claims returned by the
+	// userinfo endpoint. When unset, the userinfo endpoint is only used for
+	// claims missing from the ID token.
+	UserInfo *UserInfoOptions `json:"userInfo,omitempty"`
+	// ClaimsProviderIssuers are the issuers of the claims providers trusted
+	// to sign aggregated and distributed claims. Distributed claims returned
+	// as a JWT are also accepted from the issuer of the endpoint they are
+	// fetched from.
+	ClaimsProviderIssuers []string `json:"claimsProviderIssuers,omitempty"`
 }
 
+// UserInfoOptions configures how claims from the OIDC userinfo endpoint are
+// merged with the claims of the ID token.
+type UserInfoOptions struct {
+	// Precedence determines the source of claims present in both the ID token
+	// and the userinfo response.
+	// Either `idToken`, `userInfo` or `merge`, defaults to `idToken`.
+	// With `merge`, list claims such as groups contain the values of both sources.
+	Precedence ClaimPrecedence `json:"precedence,omitempty"`
+	// ClaimPrecedence overrides the precedence for individual claims.
+	ClaimPrecedence []ClaimPrecedenceRule `json:"claimPrecedence,omitempty"`
+}
+
+// ClaimPrecedenceRule sets the precedence of a single claim.
+type ClaimPrecedenceRule struct {
+	// Claim is the name of the claim, or a path to a nested claim.
+	Claim string `json:"claim,omitempty"`
+	// Precedence is the source of the claim, either `idToken`, `userInfo` or `merge`.
+	Precedence ClaimPrecedence `json:"precedence,omitempty"`
+}
+
+// ClaimPrecedence is the source a claim is read from when it is present in
+// both the ID token and the userinfo response.
+type ClaimPrecedence string
+
+const (
+	// IDTokenClaimPrecedence reads the claim from the ID token
+	IDTokenClaimPrecedence ClaimPrecedence = "idToken"
+	// UserInfoClaimPrecedence reads the claim from the userinfo response
+	UserInfoClaimPrecedence ClaimPrecedence = "userInfo"
+	// MergeClaimPrecedence combines the values of both sources
+	MergeClaimPrecedence ClaimPrecedence = "merge"
+)
+
 type LoginGovOptions struct {
 	// JWTKey is a private key in PEM format used to sign JWT,
 	JWTKey string `json:"jwtKey,omitempty"`
@@ -272,3 +338,13 @@ func providerDefaults() Providers {
 	}
 	return providers
 }
+
+// RequestObject configures the signing of authorization request objects (RFC 9101).
+type RequestObject struct {
+	// SigningKey is the PEM encoded RSA or ECDSA (P-256) private key used to
+	// sign request objects. RSA keys sign with RS256 and ECDSA keys with ES256.
+	SigningKey *SecretSource `json:"signingKey,omitempty"`
+	// KeyID is set as the `kid` header of the request object so that the
+	// provider can select the matching public key from the registered JWKS.
+	KeyID string `json:"keyID,omitempty"`
+}
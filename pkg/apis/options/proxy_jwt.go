@@ -0,0 +1,29 @@
+package options
+
+// ProxyJWT configures the signing of JWTs minted by the proxy to propagate
+// the user's identity to upstreams. The tokens are injected with a header
+// value using a ProxyJWTSource and can be verified by upstreams with the
+// public key served at the `/oauth2/jwks` endpoint.
+type ProxyJWT struct {
+	// SigningKey is the PEM encoded RSA or ECDSA (P-256) private key used to
+	// sign the tokens. RSA keys sign with RS256 and ECDSA keys with ES256.
+	SigningKey *SecretSource `json:"signingKey,omitempty"`
+
+	// KeyID is set as the `kid` header of the tokens and in the JWKS.
+	// Defaults to the JWK thumbprint of the public key.
+	KeyID string `json:"keyID,omitempty"`
+
+	// Issuer is the `iss` claim of the tokens.
+	// Defaults to "oauth2-proxy".
+	Issuer string `json:"issuer,omitempty"`
+
+	// Lifetime is how long the tokens are valid for.
+	// Defaults to 5 minutes.
+	Lifetime *Duration `json:"lifetime,omitempty"`
+
+	// PerSession reuses one token for the requests of a session instead of
+	// issuing one per request. The token expires after the Lifetime, or with
+	// the session's access token if that is sooner, and is renewed shortly
+	// before it expires.
+	PerSession bool `json:"perSession,omitempty"`
+}
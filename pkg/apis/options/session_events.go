@@ -0,0 +1,39 @@
+package options
+
+import "github.com/spf13/pflag"
+
+// SessionEvents contains configuration options for exporting session events
+// such as logins, refreshes and logouts for auditing
+type SessionEvents struct {
+	File              string `flag:"session-events-file" cfg:"session_events_file"`
+	WebhookURL        string `flag:"session-events-webhook-url" cfg:"session_events_webhook_url"`
+	WebhookQueueSize  int    `flag:"session-events-webhook-queue-size" cfg:"session_events_webhook_queue_size"`
+	WebhookMaxRetries int    `flag:"session-events-webhook-max-retries" cfg:"session_events_webhook_max_retries"`
+	Syslog            bool   `flag:"session-events-syslog" cfg:"session_events_syslog"`
+	SyslogAddress     string `flag:"session-events-syslog-address" cfg:"session_events_syslog_address"`
+}
+
+func sessionEventsFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("sessionevents", pflag.ExitOnError)
+
+	flagSet.String("session-events-file", "", "append session events as JSON lines to this file")
+	flagSet.String("session-events-webhook-url", "", "post session events as JSON to this URL")
+	flagSet.Int("session-events-webhook-queue-size", 1000, "maximum number of session events queued for delivery to the webhook")
+	flagSet.Int("session-events-webhook-max-retries", 5, "number of times delivery of a session event to the webhook is retried")
+	flagSet.Bool("session-events-syslog", false, "write session events as JSON to syslog")
+	flagSet.String("session-events-syslog-address", "", "address of the syslog server (eg: udp://host:514), empty for the local syslog daemon")
+
+	return flagSet
+}
+
+// sessionEventsDefaults creates a SessionEvents structure, populating each field with its default value
+func sessionEventsDefaults() SessionEvents {
+	return SessionEvents{
+		File:              "",
+		WebhookURL:        "",
+		WebhookQueueSize:  1000,
+		WebhookMaxRetries: 5,
+		Syslog:            false,
+		SyslogAddress:     "",
+	}
+}
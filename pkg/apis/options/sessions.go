@@ -1,10 +1,25 @@
 package options
 
+import "time"
+
 // SessionOptions contains configuration options for the SessionStore providers.
 type SessionOptions struct {
-	Type   string             `flag:"session-store-type" cfg:"session_store_type"`
-	Cookie CookieStoreOptions `cfg:",squash"`
-	Redis  RedisStoreOptions  `cfg:",squash"`
+	Type                  string                   `flag:"session-store-type" cfg:"session_store_type"`
+	IdleTimeout           time.Duration            `flag:"session-idle-timeout" cfg:"session_idle_timeout"`
+	ActivityWriteInterval time.Duration            `flag:"session-activity-write-interval" cfg:"session_activity_write_interval"`
+	MaxAge                time.Duration            `flag:"session-max-age" cfg:"session_max_age"`
+	RefreshSkew           time.Duration            `flag:"session-refresh-skew" cfg:"session_refresh_skew"`
+	MigrateOnRead         bool                     `flag:"session-migrate-on-read" cfg:"session_migrate_on_read"`
+	WriteVersion          int                      `flag:"session-write-version" cfg:"session_write_version"`
+	MaxConcurrent         int                      `flag:"session-max-concurrent" cfg:"session_max_concurrent"`
+	ConcurrentLimitPolicy string                   `flag:"session-concurrent-limit-policy" cfg:"session_concurrent_limit_policy"`
+	Cookie                CookieStoreOptions       `cfg:",squash"`
+	Redis                 RedisStoreOptions        `cfg:",squash"`
+	Hybrid                HybridStoreOptions       `cfg:",squash"`
+	Plugin                PluginStoreOptions       `cfg:",squash"`
+	Encryption            SessionEncryptionOptions `cfg:",squash"`
+	Binding               SessionBindingOptions    `cfg:",squash"`
+	BackgroundRefresh     BackgroundRefreshOptions `cfg:",squash"`
 }
 
 // CookieSessionStoreType is used to indicate the CookieSessionStore should be
@@ -15,6 +30,24 @@ var CookieSessionStoreType = "cookie"
 // used for storing sessions.
 var RedisSessionStoreType = "redis"
 
+// HybridSessionStoreType is used to indicate the hybrid SessionStore should be
+// used for storing sessions, keeping small sessions in cookies and larger
+// sessions in a persistent store.
+var HybridSessionStoreType = "hybrid"
+
+// PluginSessionStoreType is used to indicate sessions should be stored in an
+// external session plugin.
+var PluginSessionStoreType = "plugin"
+
+// RejectSessionLimitPolicy is used to indicate that a login should be rejected
+// when the user already has the maximum number of concurrent sessions.
+var RejectSessionLimitPolicy = "reject"
+
+// EvictOldestSessionLimitPolicy is used to indicate that the user's oldest
+// session should be removed when a login exceeds the maximum number of
+// concurrent sessions.
+var EvictOldestSessionLimitPolicy = "evict-oldest"
+
 // CookieStoreOptions contains configuration options for the CookieSessionStore.
 type CookieStoreOptions struct {
 	Minimal bool `flag:"session-cookie-minimal" cfg:"session_cookie_minimal"`
@@ -36,11 +69,114 @@ type RedisStoreOptions struct {
 	IdleTimeout            int      `flag:"redis-connection-idle-timeout" cfg:"redis_connection_idle_timeout"`
 }
 
+// HybridStoreOptions contains configuration options for the hybrid
+// SessionStore.
+type HybridStoreOptions struct {
+	// Threshold is the size in bytes of the session cookie above which the
+	// session is moved to the persistent store
+	Threshold int `flag:"session-hybrid-threshold" cfg:"session_hybrid_threshold"`
+	// Backend is the persistent session store type used for large sessions
+	Backend string `flag:"session-hybrid-backend" cfg:"session_hybrid_backend"`
+}
+
+// PluginStoreOptions contains configuration options for the plugin
+// SessionStore.
+type PluginStoreOptions struct {
+	// Address is the `unix://` socket or `http(s)://` URL of the plugin
+	Address string        `flag:"session-plugin-address" cfg:"session_plugin_address"`
+	Timeout time.Duration `flag:"session-plugin-timeout" cfg:"session_plugin_timeout"`
+}
+
+// FileKeyProvider is used to indicate sessions should be envelope encrypted
+// with data keys wrapped by a key encryption key read from a file.
+var FileKeyProvider = "file"
+
+// SessionEncryptionOptions contains configuration options for envelope
+// encryption of stored sessions. When no key provider is set, sessions are
+// encrypted with the cookie secret (cookie sessions) or the ticket secret
+// (persisted sessions) only.
+type SessionEncryptionOptions struct {
+	KeyProvider string `flag:"session-key-provider" cfg:"session_key_provider"`
+	KEKFile     string `flag:"session-kek-file" cfg:"session_kek_file"`
+}
+
+// ClientIPSessionBinding binds sessions to the client IP network
+var ClientIPSessionBinding = "client-ip"
+
+// UserAgentSessionBinding binds sessions to the client User-Agent
+var UserAgentSessionBinding = "user-agent"
+
+// TLSClientCertSessionBinding binds sessions to the client's TLS certificate
+var TLSClientCertSessionBinding = "tls-client-cert"
+
+// DropSessionBindingAction is used to indicate that a request whose
+// fingerprint does not match its session is treated as unauthenticated,
+// leaving the session valid for the client it is bound to.
+var DropSessionBindingAction = "drop"
+
+// RevokeSessionBindingAction is used to indicate that a session is cleared when
+// it is used by a client whose fingerprint does not match, forcing the user to
+// re-authenticate.
+var RevokeSessionBindingAction = "revoke"
+
+// SessionBindingOptions contains configuration options for binding sessions
+// to a fingerprint of the client that created them
+type SessionBindingOptions struct {
+	Components     []string `flag:"session-binding" cfg:"session_binding"`
+	IPv4Prefix     int      `flag:"session-binding-ipv4-prefix" cfg:"session_binding_ipv4_prefix"`
+	IPv6Prefix     int      `flag:"session-binding-ipv6-prefix" cfg:"session_binding_ipv6_prefix"`
+	MismatchAction string   `flag:"session-binding-mismatch-action" cfg:"session_binding_mismatch_action"`
+}
+
+// BackgroundRefreshOptions contains configuration options for refreshing
+// persisted sessions in the background before their access token expires
+type BackgroundRefreshOptions struct {
+	Enabled bool `flag:"session-background-refresh" cfg:"session_background_refresh"`
+	// Window is how long before the access token expires a session is
+	// refreshed
+	Window time.Duration `flag:"session-background-refresh-window" cfg:"session_background_refresh_window"`
+	// Jitter is the maximum random amount each refresh is brought forward by,
+	// to spread refreshes of sessions created at the same time
+	Jitter time.Duration `flag:"session-background-refresh-jitter" cfg:"session_background_refresh_jitter"`
+	// Interval is how often sessions due a refresh are looked for
+	Interval time.Duration `flag:"session-background-refresh-interval" cfg:"session_background_refresh_interval"`
+	// Concurrency is the maximum number of sessions refreshed at once
+	Concurrency int `flag:"session-background-refresh-concurrency" cfg:"session_background_refresh_concurrency"`
+}
+
 func sessionOptionsDefaults() SessionOptions {
 	return SessionOptions{
-		Type: CookieSessionStoreType,
+		Type:                  CookieSessionStoreType,
+		IdleTimeout:           time.Duration(0),
+		ActivityWriteInterval: time.Minute,
+		MaxAge:                time.Duration(0),
+		RefreshSkew:           time.Duration(0),
+		MigrateOnRead:         false,
+		WriteVersion:          1,
+		MaxConcurrent:         0,
+		ConcurrentLimitPolicy: EvictOldestSessionLimitPolicy,
 		Cookie: CookieStoreOptions{
 			Minimal: false,
 		},
+		Hybrid: HybridStoreOptions{
+			Threshold: 4000,
+			Backend:   RedisSessionStoreType,
+		},
+		Plugin: PluginStoreOptions{
+			Timeout: 5 * time.Second,
+		},
+		Binding: SessionBindingOptions{
+			Components:     []string{},
+			IPv4Prefix:     24,
+			IPv6Prefix:     64,
+			MismatchAction: DropSessionBindingAction,
+		},
+		BackgroundRefresh: BackgroundRefreshOptions{
+			Enabled:     false,
+			Window:      5 * time.Minute,
+			Jitter:      time.Minute,
+			Interval:    30 * time.Second,
+			Concurrency: 4,
+		},
 	}
 }
@@ -93,4 +93,65 @@ type Upstream struct {
 	// Timeout is the maximum duration the server will wait for a response from the upstream server.
 	// Defaults to 30 seconds.
 	Timeout *Duration `json:"timeout,omitempty"`
+
+	// TokenExchange exchanges the session's access token for a token scoped
+	// to this upstream using OAuth 2.0 Token Exchange (RFC 8693) before the
+	// request is proxied.
+	// A DPoP-bound access token is exchanged with a DPoP proof signed with
+	// the session's key. The exchanged token is injected as a bearer token,
+	// so the provider must not bind it to the key.
+	// This option can only be used with HTTP(S) and unix socket upstreams.
+	TokenExchange *TokenExchange `json:"tokenExchange,omitempty"`
+
+	// ForwardDPoP passes the session's DPoP-bound access token to the upstream
+	// in the `Authorization` header with a freshly signed `DPoP` proof for
+	// each request.
+	// This requires DPoP to be enabled for the provider and cannot be combined
+	// with a TokenExchange, whose exchanged token is forwarded instead.
+	ForwardDPoP bool `json:"forwardDPoP,omitempty"`
+
+	// StepUp requires a stronger or more recent authentication for requests
+	// to this upstream. Users whose session does not satisfy it are sent back
+	// to the provider to re-authenticate, and then returned to the original URL.
+	StepUp *StepUp `json:"stepUp,omitempty"`
+}
+
+// StepUp configures the authentication requirements of an upstream.
+// When a session does not meet them, the login is restarted with the
+// `acr_values`, `max_age` and `prompt=login` parameters.
+type StepUp struct {
+	// ACRValues lists the authentication context class references that satisfy
+	// the upstream, in order of preference. The session's `acr` claim must
+	// match one of them.
+	ACRValues []string `json:"acrValues,omitempty"`
+
+	// MaxAuthAge is the maximum time since the user last actively
+	// authenticated, as given by the `auth_time` claim of the ID token.
+	MaxAuthAge *Duration `json:"maxAuthAge,omitempty"`
+}
+
+// TokenExchange configures an OAuth 2.0 Token Exchange (RFC 8693) for an upstream.
+// The exchange is made against the provider's token endpoint and the resulting
+// token is cached for the session until it expires.
+type TokenExchange struct {
+	// Audience is the logical name of the upstream the exchanged token is
+	// intended for.
+	Audience string `json:"audience,omitempty"`
+
+	// Resource is the URI of the upstream the exchanged token is intended for.
+	Resource string `json:"resource,omitempty"`
+
+	// Scopes is the list of scopes requested for the exchanged token.
+	Scopes []string `json:"scopes,omitempty"`
+
+	// InjectRequestHeaders defines how the exchanged token is passed to the
+	// upstream. Within these headers the `access_token` claim resolves to the
+	// exchanged token.
+	// Defaults to setting the `Authorization` header to `Bearer <token>`.
+	InjectRequestHeaders []Header `json:"injectRequestHeaders,omitempty"`
+
+	// CacheSize is the maximum number of exchanged tokens cached until they
+	// expire. The least recently used tokens are evicted first.
+	// Defaults to 1000. Set to 0 to disable caching.
+	CacheSize *int `json:"cacheSize,omitempty"`
 }
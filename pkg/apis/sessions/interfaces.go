@@ -18,6 +18,14 @@ type SessionStore interface {
 var ErrLockNotObtained = errors.New("lock: not obtained")
 var ErrNotLocked = errors.New("tried to release not existing lock")
 
+// ErrSessionLimitExceeded is returned when saving a new session would exceed
+// the maximum number of concurrent sessions for the user
+var ErrSessionLimitExceeded = errors.New("too many concurrent sessions")
+
+// ErrSessionNotFound is returned by persistent stores loading a key that
+// nothing is stored under
+var ErrSessionNotFound = errors.New("session not found")
+
 // Lock is an interface for controlling session locks
 type Lock interface {
 	// Obtain obtains the lock on the distributed
@@ -0,0 +1,159 @@
+package sessions
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// sessionCorpusEntry is a session encoded by a previous release, stored in
+// testdata/session_corpus.json. Source is the commit whose EncodeSessionState
+// produced the entry. New entries should be generated from the release that
+// introduces each session format version, and existing entries must never be
+// removed.
+type sessionCorpusEntry struct {
+	Name       string `json:"name"`
+	Source     string `json:"source"`
+	Version    uint8  `json:"version"`
+	Cipher     string `json:"cipher"`
+	Secret     string `json:"secret"`
+	Compressed bool   `json:"compressed"`
+	Encoded    string `json:"encoded"`
+	Session    string `json:"session"`
+}
+
+func TestDecodeSessionStateCompatibility(t *testing.T) {
+	created := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	expires := created.Add(time.Hour)
+	expectedSessions := map[string]*SessionState{
+		"full": {
+			Email:             "john.doe@example.com",
+			User:              "john.doe",
+			PreferredUsername: "john",
+			Groups:            []string{"admins", "developers"},
+			AccessToken:       "access.token.value",
+			IDToken:           "id.token.value",
+			RefreshToken:      "refresh.token.value",
+			Nonce:             []byte("0123456789abcdef"),
+			CreatedAt:         &created,
+			ExpiresOn:         &expires,
+		},
+		"minimal": {
+			Email:     "jane.doe@example.com",
+			User:      "jane.doe",
+			CreatedAt: &created,
+		},
+	}
+
+	data, err := os.ReadFile("testdata/session_corpus.json")
+	require.NoError(t, err)
+	var corpus []sessionCorpusEntry
+	require.NoError(t, json.Unmarshal(data, &corpus))
+	require.NotEmpty(t, corpus)
+
+	for _, entry := range corpus {
+		t.Run(entry.Name, func(t *testing.T) {
+			var c encryption.Cipher
+			switch entry.Cipher {
+			case "cfb":
+				c, err = encryption.NewCFBCipher([]byte(entry.Secret))
+			case "gcm":
+				c, err = encryption.NewGCMCipher([]byte(entry.Secret))
+			default:
+				t.Fatalf("unknown cipher %q", entry.Cipher)
+			}
+			require.NoError(t, err)
+
+			encoded, err := base64.StdEncoding.DecodeString(entry.Encoded)
+			require.NoError(t, err)
+
+			decoded, err := DecodeSessionState(encoded, c, entry.Compressed)
+			require.NoError(t, err)
+			assert.Equal(t, entry.Version, decoded.FormatVersion())
+			assert.Equal(t, entry.Version < CurrentSessionFormatVersion, decoded.NeedsMigration(CurrentSessionFormatVersion))
+			assert.False(t, decoded.NeedsMigration(LegacySessionFormatVersion))
+
+			expected, ok := expectedSessions[entry.Session]
+			require.True(t, ok, "unknown corpus session %q", entry.Session)
+			exp := *expected
+			exp.formatVersion = decoded.formatVersion
+			compareSessionStates(t, &exp, decoded)
+
+			// Re-encoding migrates the session to the current format
+			reencoded, err := decoded.EncodeSessionState(c, entry.Compressed, CurrentSessionFormatVersion)
+			require.NoError(t, err)
+			assert.False(t, decoded.NeedsMigration(CurrentSessionFormatVersion))
+			migrated, err := DecodeSessionState(reencoded, c, false)
+			require.NoError(t, err)
+			assert.Equal(t, CurrentSessionFormatVersion, migrated.FormatVersion())
+			compareSessionStates(t, decoded, migrated)
+		})
+	}
+}
+
+func TestEncodeSessionStateLegacyFormat(t *testing.T) {
+	c, err := encryption.NewGCMCipher([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+
+	ss := &SessionState{User: "john.doe"}
+	encoded, err := ss.EncodeSessionState(c, false, LegacySessionFormatVersion)
+	require.NoError(t, err)
+	assert.Equal(t, LegacySessionFormatVersion, ss.FormatVersion())
+
+	// Releases from before the session format header was introduced decode
+	// the decrypted session as plain MessagePack
+	decrypted, err := c.Decrypt(encoded)
+	require.NoError(t, err)
+	var legacy SessionState
+	require.NoError(t, msgpack.Unmarshal(decrypted, &legacy))
+	assert.Equal(t, "john.doe", legacy.User)
+
+	_, err = ss.EncodeSessionState(c, false, CurrentSessionFormatVersion+1)
+	assert.EqualError(t, err, "cannot encode session format version 3")
+}
+
+func TestDecodeSessionStateVersionErrors(t *testing.T) {
+	c, err := encryption.NewGCMCipher([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+
+	packed, err := msgpack.Marshal(&SessionState{User: "john.doe"})
+	require.NoError(t, err)
+
+	newer := append(append([]byte{}, sessionFormatMagic...), CurrentSessionFormatVersion+1, 0)
+	encrypted, err := c.Encrypt(append(newer, packed...))
+	require.NoError(t, err)
+	_, err = DecodeSessionState(encrypted, c, false)
+	assert.EqualError(t, err, "session format version 3 is newer than the supported version 2")
+
+	encrypted, err = c.Encrypt(append(append([]byte{}, sessionFormatMagic...), CurrentSessionFormatVersion))
+	require.NoError(t, err)
+	_, err = DecodeSessionState(encrypted, c, false)
+	assert.EqualError(t, err, "session format header is truncated")
+}
+
+func TestDecodeSessionStateIgnoresUnknownFields(t *testing.T) {
+	c, err := encryption.NewGCMCipher([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+
+	// A session written by a newer release within the same format version
+	// may contain fields this release does not know about
+	packed, err := msgpack.Marshal(map[string]interface{}{
+		"u":  "john.doe",
+		"zz": "a future field",
+	})
+	require.NoError(t, err)
+	header := append(append([]byte{}, sessionFormatMagic...), CurrentSessionFormatVersion, 0)
+	encrypted, err := c.Encrypt(append(header, packed...))
+	require.NoError(t, err)
+
+	decoded, err := DecodeSessionState(encrypted, c, false)
+	require.NoError(t, err)
+	assert.Equal(t, "john.doe", decoded.User)
+}
@@ -3,6 +3,7 @@ package sessions
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"time"
@@ -13,11 +14,60 @@ import (
 	"github.com/vmihailenco/msgpack/v5"
 )
 
+const (
+	// LegacySessionFormatVersion is the unversioned format used before the
+	// session format header was introduced: MessagePack, optionally lz4
+	// compressed, where the compression must be known by the reader.
+	// Every release can read it, so it is written by default until all
+	// instances can read newer versions.
+	LegacySessionFormatVersion uint8 = 1
+
+	// versionedSessionFormatVersion prefixes the legacy format with the
+	// session format header, which records the compression.
+	versionedSessionFormatVersion uint8 = 2
+
+	// CurrentSessionFormatVersion is the newest session format version this
+	// release can read and write
+	CurrentSessionFormatVersion = versionedSessionFormatVersion
+
+	// sessionFlagCompressed is set in the header flags when the payload is
+	// lz4 compressed
+	sessionFlagCompressed byte = 1 << 0
+)
+
+// sessionFormatMagic starts the session format header. A legacy session
+// starts with either a MessagePack map or the lz4 frame magic number, so it
+// can never start with a zero byte.
+var sessionFormatMagic = []byte{0x00, 'o', 's'}
+
+// sessionDecoder decodes the payload of a session format version into the
+// current SessionState
+type sessionDecoder func(payload []byte, compressed bool) (*SessionState, error)
+
+// sessionDecoders holds a decoder for every supported session format version.
+// When the format changes, register a decoder for the new version and keep
+// the decoders for previous versions so that existing sessions can be read
+// during and after a rolling upgrade.
+var sessionDecoders = map[uint8]sessionDecoder{
+	LegacySessionFormatVersion:    decodeMessagePackSession,
+	versionedSessionFormatVersion: decodeMessagePackSession,
+}
+
 // SessionState is used to store information about the currently authenticated user session
 type SessionState struct {
 	CreatedAt *time.Time `msgpack:"ca,omitempty"`
 	ExpiresOn *time.Time `msgpack:"eo,omitempty"`
 
+	// RefreshExpiresOn is when the refresh token expires, if the provider
+	// reports it. The session cannot be refreshed after this time.
+	RefreshExpiresOn *time.Time `msgpack:"reo,omitempty"`
+
+	// AuthenticatedAt is when the user logged in. Unlike CreatedAt it is not
+	// reset when the session is refreshed.
+	AuthenticatedAt *time.Time `msgpack:"aa,omitempty"`
+	// LastActivityAt is when the session was last used
+	LastActivityAt *time.Time `msgpack:"la,omitempty"`
+
 	AccessToken  string `msgpack:"at,omitempty"`
 	IDToken      string `msgpack:"it,omitempty"`
 	RefreshToken string `msgpack:"rt,omitempty"`
@@ -29,9 +79,30 @@ type SessionState struct {
 	Groups            []string `msgpack:"g,omitempty"`
 	PreferredUsername string   `msgpack:"pu,omitempty"`
 
+	// Scopes are the OAuth scopes granted to the access token, when known
+	Scopes []string `msgpack:"sc,omitempty"`
+	// Audiences are the audiences the access token was issued for, when known
+	Audiences []string `msgpack:"aud,omitempty"`
+
+	// DPoPKey is the key pair the session's tokens are bound to (RFC 9449)
+	DPoPKey []byte `msgpack:"dk,omitempty"`
+
+	// Fingerprint identifies the client the session is bound to
+	Fingerprint string `msgpack:"fp,omitempty"`
+
+	// ACR, AMR and AuthTime are the `acr`, `amr` and `auth_time` claims of
+	// the ID token, describing how and when the user last authenticated
+	ACR      string     `msgpack:"acr,omitempty"`
+	AMR      []string   `msgpack:"amr,omitempty"`
+	AuthTime *time.Time `msgpack:"atm,omitempty"`
+
 	// Internal helpers, not serialized
 	Clock clock.Clock `msgpack:"-"`
 	Lock  Lock        `msgpack:"-"`
+
+	// formatVersion is the format the session was last decoded from or
+	// encoded to, 0 if the session has never been encoded
+	formatVersion uint8
 }
 
 func (s *SessionState) ObtainLock(ctx context.Context, expiration time.Duration) error {
@@ -68,6 +139,12 @@ func (s *SessionState) CreatedAtNow() {
 	s.CreatedAt = &now
 }
 
+// AuthenticatedAtNow records that the user logged in now
+func (s *SessionState) AuthenticatedAtNow() {
+	now := s.Clock.Now()
+	s.AuthenticatedAt = &now
+}
+
 // SetExpiresOn sets an expiration
 func (s *SessionState) SetExpiresOn(exp time.Time) {
 	s.ExpiresOn = &exp
@@ -91,6 +168,24 @@ func (s *SessionState) IsExpired() bool {
 	return false
 }
 
+// ExpiresWithin checks whether the access token expires within the given
+// duration. Sessions without an expiry never expire.
+func (s *SessionState) ExpiresWithin(d time.Duration) bool {
+	if s.ExpiresOn == nil || s.ExpiresOn.IsZero() {
+		return false
+	}
+	return s.ExpiresOn.Add(-d).Before(s.Clock.Now())
+}
+
+// IsRefreshExpired checks whether the refresh token has expired, in which
+// case the session can no longer be refreshed
+func (s *SessionState) IsRefreshExpired() bool {
+	if s.RefreshExpiresOn != nil && !s.RefreshExpiresOn.IsZero() && s.RefreshExpiresOn.Before(s.Clock.Now()) {
+		return true
+	}
+	return false
+}
+
 // Age returns the age of a session
 func (s *SessionState) Age() time.Duration {
 	if s.CreatedAt != nil && !s.CreatedAt.IsZero() {
@@ -99,6 +194,48 @@ func (s *SessionState) Age() time.Duration {
 	return 0
 }
 
+// IdleExpiresOn returns when the session expires if it is not used, given the
+// idle timeout. It returns nil if there is no idle timeout.
+func (s *SessionState) IdleExpiresOn(idleTimeout time.Duration) *time.Time {
+	lastActivity := s.LastActivityAt
+	if lastActivity == nil || lastActivity.IsZero() {
+		lastActivity = s.CreatedAt
+	}
+	return addDuration(lastActivity, idleTimeout)
+}
+
+// MaxAgeExpiresOn returns when the session reaches the absolute maximum
+// session age. It returns nil if there is no maximum age.
+func (s *SessionState) MaxAgeExpiresOn(maxAge time.Duration) *time.Time {
+	authenticatedAt := s.AuthenticatedAt
+	if authenticatedAt == nil || authenticatedAt.IsZero() {
+		authenticatedAt = s.CreatedAt
+	}
+	return addDuration(authenticatedAt, maxAge)
+}
+
+// LastAuthenticatedAt returns when the user last actively authenticated. This
+// is the ID token's auth_time when the provider supplies one, otherwise when
+// the user logged in. It returns nil when neither is known, as for sessions
+// created before the login time was recorded.
+func (s *SessionState) LastAuthenticatedAt() *time.Time {
+	if s.AuthTime != nil && !s.AuthTime.IsZero() {
+		return s.AuthTime
+	}
+	if s.AuthenticatedAt != nil && !s.AuthenticatedAt.IsZero() {
+		return s.AuthenticatedAt
+	}
+	return nil
+}
+
+func addDuration(t *time.Time, d time.Duration) *time.Time {
+	if d <= 0 || t == nil || t.IsZero() {
+		return nil
+	}
+	expires := t.Add(d)
+	return &expires
+}
+
 // String constructs a summary of the session state
 func (s *SessionState) String() string {
 	o := fmt.Sprintf("Session{email:%s user:%s PreferredUsername:%s", s.Email, s.User, s.PreferredUsername)
@@ -117,6 +254,9 @@ func (s *SessionState) String() string {
 	if s.RefreshToken != "" {
 		o += " refresh_token:true"
 	}
+	if s.RefreshExpiresOn != nil && !s.RefreshExpiresOn.IsZero() {
+		o += fmt.Sprintf(" refresh_expires:%s", s.RefreshExpiresOn)
+	}
 	if len(s.Groups) > 0 {
 		o += fmt.Sprintf(" groups:%v", s.Groups)
 	}
@@ -158,41 +298,104 @@ func (s *SessionState) CheckNonce(hashed string) bool {
 	return encryption.CheckNonce(s.Nonce, hashed)
 }
 
-// EncodeSessionState returns an encrypted, lz4 compressed, MessagePack encoded session
-func (s *SessionState) EncodeSessionState(c encryption.Cipher, compress bool) ([]byte, error) {
+// NeedsMigration reports whether the session was decoded from a format
+// version older than the version sessions are written in, and should be
+// saved again to upgrade it
+func (s *SessionState) NeedsMigration(writeVersion uint8) bool {
+	return s.formatVersion != 0 && s.formatVersion < writeVersion
+}
+
+// FormatVersion returns the format version the session was last decoded from
+// or encoded to, or 0 if it has been neither
+func (s *SessionState) FormatVersion() uint8 {
+	return s.formatVersion
+}
+
+// EncodeSessionState returns an encrypted, lz4 compressed, MessagePack encoded
+// session in the given session format version. Sessions in the legacy format
+// have no header, so the reader must know whether they are compressed.
+func (s *SessionState) EncodeSessionState(c encryption.Cipher, compress bool, version uint8) ([]byte, error) {
+	if version < LegacySessionFormatVersion || version > CurrentSessionFormatVersion {
+		return nil, fmt.Errorf("cannot encode session format version %d", version)
+	}
+
 	packed, err := msgpack.Marshal(s)
 	if err != nil {
 		return nil, fmt.Errorf("error marshalling session state to msgpack: %w", err)
 	}
 
-	if !compress {
-		return c.Encrypt(packed)
+	var flags byte
+	if compress {
+		flags |= sessionFlagCompressed
+		packed, err = lz4Compress(packed)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	compressed, err := lz4Compress(packed)
+	if version != LegacySessionFormatVersion {
+		header := append(append([]byte{}, sessionFormatMagic...), version, flags)
+		packed = append(header, packed...)
+	}
+	encrypted, err := c.Encrypt(packed)
 	if err != nil {
 		return nil, err
 	}
-	return c.Encrypt(compressed)
+
+	s.formatVersion = version
+	return encrypted, nil
 }
 
-// DecodeSessionState decodes a LZ4 compressed MessagePack into a Session State
+// DecodeSessionState decrypts and decodes a session encoded by any supported
+// session format version. The compressed argument is only used for sessions
+// in the legacy unversioned format, which does not record it.
 func DecodeSessionState(data []byte, c encryption.Cipher, compressed bool) (*SessionState, error) {
 	decrypted, err := c.Decrypt(data)
 	if err != nil {
 		return nil, fmt.Errorf("error decrypting the session state: %w", err)
 	}
 
-	packed := decrypted
+	version, payload := LegacySessionFormatVersion, decrypted
+	if bytes.HasPrefix(decrypted, sessionFormatMagic) {
+		header := decrypted[len(sessionFormatMagic):]
+		if len(header) < 2 {
+			return nil, errors.New("session format header is truncated")
+		}
+		version = header[0]
+		compressed = header[1]&sessionFlagCompressed != 0
+		payload = header[2:]
+	}
+
+	if version > CurrentSessionFormatVersion {
+		return nil, fmt.Errorf("session format version %d is newer than the supported version %d", version, CurrentSessionFormatVersion)
+	}
+	decode, ok := sessionDecoders[version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported session format version %d", version)
+	}
+
+	ss, err := decode(payload, compressed)
+	if err != nil {
+		return nil, err
+	}
+	ss.formatVersion = version
+	return ss, nil
+}
+
+// decodeMessagePackSession decodes an optionally lz4 compressed MessagePack
+// session
+func decodeMessagePackSession(payload []byte, compressed bool) (*SessionState, error) {
+	packed := payload
 	if compressed {
-		packed, err = lz4Decompress(decrypted)
+		var err error
+		packed, err = lz4Decompress(payload)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	var ss SessionState
-	err = msgpack.Unmarshal(packed, &ss)
+	err := msgpack.Unmarshal(packed, &ss)
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshalling data to session state: %w", err)
 	}
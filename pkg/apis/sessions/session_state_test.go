@@ -147,6 +147,29 @@ func TestIsExpired(t *testing.T) {
 	assert.Equal(t, false, s.IsExpired())
 }
 
+func TestExpiresWithin(t *testing.T) {
+	s := &SessionState{ExpiresOn: timePtr(time.Now().Add(time.Duration(30) * time.Second))}
+	assert.Equal(t, true, s.ExpiresWithin(time.Minute))
+	assert.Equal(t, false, s.ExpiresWithin(10*time.Second))
+
+	s = &SessionState{ExpiresOn: timePtr(time.Now().Add(time.Duration(-1) * time.Minute))}
+	assert.Equal(t, true, s.ExpiresWithin(0))
+
+	s = &SessionState{}
+	assert.Equal(t, false, s.ExpiresWithin(time.Hour))
+}
+
+func TestIsRefreshExpired(t *testing.T) {
+	s := &SessionState{RefreshExpiresOn: timePtr(time.Now().Add(time.Duration(-1) * time.Minute))}
+	assert.Equal(t, true, s.IsRefreshExpired())
+
+	s = &SessionState{RefreshExpiresOn: timePtr(time.Now().Add(time.Duration(1) * time.Minute))}
+	assert.Equal(t, false, s.IsRefreshExpired())
+
+	s = &SessionState{}
+	assert.Equal(t, false, s.IsRefreshExpired())
+}
+
 func TestAge(t *testing.T) {
 	ss := &SessionState{}
 
@@ -158,6 +181,57 @@ func TestAge(t *testing.T) {
 	assert.Equal(t, time.Hour, ss.Age().Round(time.Minute))
 }
 
+func TestIdleExpiresOn(t *testing.T) {
+	created := time.Now().Add(-1 * time.Hour)
+	lastActivity := time.Now().Add(-1 * time.Minute)
+
+	// No idle timeout
+	ss := &SessionState{CreatedAt: &created}
+	assert.Nil(t, ss.IdleExpiresOn(0))
+
+	// Falls back to CreatedAt without activity
+	assert.Equal(t, created.Add(2*time.Hour), *ss.IdleExpiresOn(2 * time.Hour))
+
+	ss.LastActivityAt = &lastActivity
+	assert.Equal(t, lastActivity.Add(2*time.Hour), *ss.IdleExpiresOn(2 * time.Hour))
+}
+
+func TestMaxAgeExpiresOn(t *testing.T) {
+	created := time.Now().Add(-1 * time.Minute)
+	authenticated := time.Now().Add(-1 * time.Hour)
+
+	// No maximum age
+	ss := &SessionState{CreatedAt: &created}
+	assert.Nil(t, ss.MaxAgeExpiresOn(0))
+
+	// Falls back to CreatedAt without an authentication time
+	assert.Equal(t, created.Add(8*time.Hour), *ss.MaxAgeExpiresOn(8 * time.Hour))
+
+	ss.AuthenticatedAt = &authenticated
+	assert.Equal(t, authenticated.Add(8*time.Hour), *ss.MaxAgeExpiresOn(8 * time.Hour))
+
+	assert.Nil(t, (&SessionState{}).MaxAgeExpiresOn(8*time.Hour))
+}
+
+func TestLastAuthenticatedAt(t *testing.T) {
+	created := time.Now().Add(-1 * time.Minute)
+	authenticated := time.Now().Add(-1 * time.Hour)
+	authTime := time.Now().Add(-2 * time.Hour)
+
+	// CreatedAt is not when the user authenticated
+	ss := &SessionState{CreatedAt: &created}
+	assert.Nil(t, ss.LastAuthenticatedAt())
+
+	ss.AuthenticatedAt = &authenticated
+	assert.Equal(t, authenticated, *ss.LastAuthenticatedAt())
+
+	// The provider's auth_time takes precedence
+	ss.AuthTime = &authTime
+	assert.Equal(t, authTime, *ss.LastAuthenticatedAt())
+
+	assert.Nil(t, (&SessionState{}).LastAuthenticatedAt())
+}
+
 // TestEncodeAndDecodeSessionState encodes & decodes various session states
 // and confirms the operation is 1:1
 func TestEncodeAndDecodeSessionState(t *testing.T) {
@@ -246,22 +320,25 @@ func TestEncodeAndDecodeSessionState(t *testing.T) {
 			for cipherName, c := range ciphers {
 				t.Run(cipherName, func(t *testing.T) {
 					for testName, ss := range testCases {
-						t.Run(testName, func(t *testing.T) {
-							encoded, err := ss.EncodeSessionState(c, false)
-							require.NoError(t, err)
-							encodedCompressed, err := ss.EncodeSessionState(c, true)
-							require.NoError(t, err)
-							// Make sure compressed version is smaller than if not compressed
-							assert.Greater(t, len(encoded), len(encodedCompressed))
-
-							decoded, err := DecodeSessionState(encoded, c, false)
-							require.NoError(t, err)
-							decodedCompressed, err := DecodeSessionState(encodedCompressed, c, true)
-							require.NoError(t, err)
-
-							compareSessionStates(t, decoded, decodedCompressed)
-							compareSessionStates(t, decoded, &ss)
-						})
+						for _, version := range []uint8{LegacySessionFormatVersion, CurrentSessionFormatVersion} {
+							t.Run(fmt.Sprintf("%s format version %d", testName, version), func(t *testing.T) {
+								encoded, err := ss.EncodeSessionState(c, false, version)
+								require.NoError(t, err)
+								encodedCompressed, err := ss.EncodeSessionState(c, true, version)
+								require.NoError(t, err)
+								// Make sure compressed version is smaller than if not compressed
+								assert.Greater(t, len(encoded), len(encodedCompressed))
+
+								decoded, err := DecodeSessionState(encoded, c, false)
+								require.NoError(t, err)
+								decodedCompressed, err := DecodeSessionState(encodedCompressed, c, true)
+								require.NoError(t, err)
+								assert.Equal(t, version, decoded.FormatVersion())
+
+								compareSessionStates(t, decoded, decodedCompressed)
+								compareSessionStates(t, decoded, &ss)
+							})
+						}
 					}
 				})
 			}
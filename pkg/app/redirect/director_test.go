@@ -34,7 +34,9 @@ var _ = Describe("Director Suite", func() {
 				}
 			}
 			req = middleware.AddRequestScope(req, &middleware.RequestScope{
-				ReverseProxy: in.reverseProxy,
+				ReverseProxy:   in.reverseProxy,
+				ForwardedHost:  req.Header.Get("X-Forwarded-Host"),
+				ForwardedProto: req.Header.Get("X-Forwarded-Proto"),
 			})
 
 			redirect, err := appDirector.GetRedirect(req)
@@ -5,9 +5,11 @@ import (
 	"crypto/sha1" // #nosec G505
 	"encoding/base64"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"sync"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
@@ -16,10 +18,13 @@ import (
 )
 
 // htpasswdMap represents the structure of an htpasswd file.
-// Passwords must be generated with -B for bcrypt or -s for SHA1.
+// Passwords must be generated with -B for bcrypt or -s for SHA1, or hashed
+// with argon2id, scrypt or SHA-crypt.
+// The groups of each user are loaded from an optional groups file.
 type htpasswdMap struct {
-	users map[string]interface{}
-	rwm   sync.RWMutex
+	users  map[string]interface{}
+	groups map[string][]string
+	rwm    sync.RWMutex
 }
 
 // bcryptPass is used to identify bcrypt passwords in the
@@ -31,8 +36,9 @@ type bcryptPass string
 type sha1Pass string
 
 // NewHTPasswdValidator constructs an httpasswd based validator from the file
-// at the path given.
-func NewHTPasswdValidator(path string) (Validator, error) {
+// at the path given. If a groups file path is given, the groups of the users
+// are loaded from it.
+func NewHTPasswdValidator(path string, groupsPath string) (GroupsValidator, error) {
 	h := &htpasswdMap{users: make(map[string]interface{})}
 
 	if err := h.loadHTPasswdFile(path); err != nil {
@@ -48,6 +54,21 @@ func NewHTPasswdValidator(path string) (Validator, error) {
 		return nil, fmt.Errorf("could not watch htpasswd file: %v", err)
 	}
 
+	if groupsPath != "" {
+		if err := h.loadGroupsFile(groupsPath); err != nil {
+			return nil, fmt.Errorf("could not load htpasswd groups file: %v", err)
+		}
+
+		if err := watcher.WatchFileForUpdates(groupsPath, nil, func() {
+			err := h.loadGroupsFile(groupsPath)
+			if err != nil {
+				logger.Errorf("%v: no changes were made to the current htpasswd groups", err)
+			}
+		}); err != nil {
+			return nil, fmt.Errorf("could not watch htpasswd groups file: %v", err)
+		}
+	}
+
 	return h, nil
 }
 
@@ -98,7 +119,7 @@ func createHtpasswdMap(records [][]string) (*htpasswdMap, error) {
 		switch {
 		case lr == 2:
 			user, realPassword := record[0], record[1]
-			invalidEntries = passShaOrBcrypt(h, user, realPassword)
+			invalidEntries = append(invalidEntries, addHtpasswdEntry(h, user, realPassword)...)
 		case lr == 1, lr > 2:
 			invalidRecords = append(invalidRecords, record[0])
 		}
@@ -109,7 +130,7 @@ func createHtpasswdMap(records [][]string) (*htpasswdMap, error) {
 	}
 
 	if len(invalidEntries) > 0 {
-		return h, fmt.Errorf("'%+q' user(s) could not be added: invalid password, must be a SHA or bcrypt entry", invalidEntries)
+		return h, fmt.Errorf("'%+q' user(s) could not be added: invalid password, must be a SHA, bcrypt, argon2id, scrypt or SHA-crypt entry", invalidEntries)
 	}
 
 	if len(h.users) == 0 {
@@ -119,10 +140,11 @@ func createHtpasswdMap(records [][]string) (*htpasswdMap, error) {
 	return h, nil
 }
 
-// passShaOrBcrypt checks if a htpasswd entry is valid and the password is encrypted with SHA or bcrypt.
-// Valid user entries are saved in the htpasswdMap, invalid records are reurned.
-func passShaOrBcrypt(h *htpasswdMap, user, password string) (invalidEntries []string) {
+// addHtpasswdEntry checks if a htpasswd entry is valid and the password is hashed with a supported algorithm.
+// Valid user entries are saved in the htpasswdMap, invalid records are returned.
+func addHtpasswdEntry(h *htpasswdMap, user, password string) (invalidEntries []string) {
 	passLen := len(password)
+	var err error
 	switch {
 	case passLen > 6 && password[:5] == "{SHA}":
 		h.users[user] = sha1Pass(password[5:])
@@ -132,10 +154,20 @@ func passShaOrBcrypt(h *htpasswdMap, user, password string) (invalidEntries []st
 			password[:4] == "$2x$" ||
 			password[:4] == "$2a$"):
 		h.users[user] = bcryptPass(password)
+	case strings.HasPrefix(password, "$argon2id$"):
+		h.users[user], err = parseArgon2Pass(password)
+	case strings.HasPrefix(password, "$scrypt$"):
+		h.users[user], err = parseScryptPass(password)
+	case strings.HasPrefix(password, sha256Crypt.prefix), strings.HasPrefix(password, sha512Crypt.prefix):
+		h.users[user], err = parseSHACryptPass(password)
 	default:
-		invalidEntries = append(invalidEntries, user)
+		err = errors.New("unsupported password hash")
 	}
 
+	if err != nil {
+		delete(h.users, user)
+		invalidEntries = append(invalidEntries, user)
+	}
 	return invalidEntries
 }
 
@@ -152,7 +184,9 @@ func (h *htpasswdMap) GetUsers() map[string]interface{} {
 
 // Validate checks a users password against the htpasswd entries
 func (h *htpasswdMap) Validate(user string, password string) bool {
+	h.rwm.RLock()
 	realPassword, exists := h.users[user]
+	h.rwm.RUnlock()
 	if !exists {
 		return false
 	}
@@ -168,6 +202,12 @@ func (h *htpasswdMap) Validate(user string, password string) bool {
 		return string(rp) == base64.StdEncoding.EncodeToString(d.Sum(nil))
 	case bcryptPass:
 		return bcrypt.CompareHashAndPassword([]byte(rp), []byte(password)) == nil
+	case argon2Pass:
+		return rp.compare(password)
+	case scryptPass:
+		return rp.compare(password)
+	case shaCryptPass:
+		return rp.compare(password)
 	default:
 		return false
 	}
@@ -0,0 +1,79 @@
+package basic
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ValidateGroups checks a users password against the htpasswd entries and
+// returns the groups of the user from the groups file.
+func (h *htpasswdMap) ValidateGroups(user string, password string) (bool, []string) {
+	if !h.Validate(user, password) {
+		return false, nil
+	}
+
+	h.rwm.RLock()
+	defer h.rwm.RUnlock()
+	return true, h.groups[user]
+}
+
+// loadGroupsFile loads the groups of the users from a groups file.
+// Each line of the file names a group followed by its members, as in an
+// Apache AuthGroupFile:
+//
+//	admins: alice bob
+//	developers: bob carol
+func (h *htpasswdMap) loadGroupsFile(filename string) error {
+	// We allow the groups file location via config options
+	f, err := os.Open(filename) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("could not open groups file: %v", err)
+	}
+	defer f.Close()
+
+	groups, err := parseGroupsFile(bufio.NewScanner(f))
+	if err != nil {
+		return fmt.Errorf("could not read groups file: %v", err)
+	}
+
+	h.rwm.Lock()
+	h.groups = groups
+	h.rwm.Unlock()
+
+	return nil
+}
+
+// parseGroupsFile maps each user to the groups they are a member of
+func parseGroupsFile(scanner *bufio.Scanner) (map[string][]string, error) {
+	groups := make(map[string][]string)
+	seen := make(map[string]map[string]struct{})
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		group, members, found := strings.Cut(line, ":")
+		group = strings.TrimSpace(group)
+		if !found || group == "" {
+			return nil, fmt.Errorf("invalid group on line %d: must be of the form group: user [user...]", lineNumber)
+		}
+
+		for _, user := range strings.Fields(members) {
+			if seen[user] == nil {
+				seen[user] = make(map[string]struct{})
+			}
+			if _, ok := seen[user][group]; ok {
+				continue
+			}
+			seen[user][group] = struct{}{}
+			groups[user] = append(groups[user], group)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
@@ -0,0 +1,316 @@
+package basic
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// argon2Pass is used to identify argon2id passwords in the htpasswdMap users.
+// Entries use the PHC string format:
+// $argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<parallelism>$<salt>$<hash>
+type argon2Pass struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	hash        []byte
+}
+
+// scryptPass is used to identify scrypt passwords in the htpasswdMap users.
+// Entries use the PHC string format:
+// $scrypt$ln=<log2 N>,r=<block size>,p=<parallelism>$<salt>$<hash>
+type scryptPass struct {
+	n    int
+	r    int
+	p    int
+	salt []byte
+	hash []byte
+}
+
+// shaCryptPass is used to identify SHA-256 ($5$) and SHA-512 ($6$) crypt
+// passwords in the htpasswdMap users.
+type shaCryptPass struct {
+	entry string
+}
+
+// phcEncoding is the unpadded base64 encoding of salts and hashes in PHC strings
+var phcEncoding = base64.RawStdEncoding
+
+func parseArgon2Pass(entry string) (argon2Pass, error) {
+	// "", "argon2id", "v=19", params, salt, hash
+	parts := strings.Split(entry, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return argon2Pass{}, errors.New("invalid argon2id entry")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Pass{}, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+
+	var p argon2Pass
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return argon2Pass{}, fmt.Errorf("invalid argon2id parameters %q", parts[3])
+	}
+	if p.iterations == 0 || p.parallelism == 0 {
+		return argon2Pass{}, fmt.Errorf("invalid argon2id parameters %q", parts[3])
+	}
+
+	var err error
+	if p.salt, err = phcEncoding.DecodeString(parts[4]); err != nil {
+		return argon2Pass{}, fmt.Errorf("invalid argon2id salt: %v", err)
+	}
+	if p.hash, err = phcEncoding.DecodeString(parts[5]); err != nil || len(p.hash) == 0 {
+		return argon2Pass{}, errors.New("invalid argon2id hash")
+	}
+	return p, nil
+}
+
+func (p argon2Pass) compare(password string) bool {
+	hash := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.hash)))
+	return subtle.ConstantTimeCompare(hash, p.hash) == 1
+}
+
+func parseScryptPass(entry string) (scryptPass, error) {
+	// "", "scrypt", params, salt, hash
+	parts := strings.Split(entry, "$")
+	if len(parts) != 5 || parts[1] != "scrypt" {
+		return scryptPass{}, errors.New("invalid scrypt entry")
+	}
+
+	var logN uint
+	var p scryptPass
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &logN, &p.r, &p.p); err != nil {
+		return scryptPass{}, fmt.Errorf("invalid scrypt parameters %q", parts[2])
+	}
+	if logN == 0 || logN > 30 || p.r <= 0 || p.p <= 0 {
+		return scryptPass{}, fmt.Errorf("invalid scrypt parameters %q", parts[2])
+	}
+	p.n = 1 << logN
+
+	var err error
+	if p.salt, err = phcEncoding.DecodeString(parts[3]); err != nil {
+		return scryptPass{}, fmt.Errorf("invalid scrypt salt: %v", err)
+	}
+	if p.hash, err = phcEncoding.DecodeString(parts[4]); err != nil || len(p.hash) == 0 {
+		return scryptPass{}, errors.New("invalid scrypt hash")
+	}
+	return p, nil
+}
+
+func (p scryptPass) compare(password string) bool {
+	hash, err := scrypt.Key([]byte(password), p.salt, p.n, p.r, p.p, len(p.hash))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(hash, p.hash) == 1
+}
+
+// SHA-crypt parameters, see https://www.akkadia.org/drepper/SHA-crypt.txt
+const (
+	shaCryptRoundsPrefix  = "rounds="
+	shaCryptDefaultRounds = 5000
+	shaCryptMinRounds     = 1000
+	shaCryptMaxRounds     = 999999999
+	shaCryptMaxSaltLength = 16
+	shaCryptAlphabet      = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// shaCryptVariant holds what differs between SHA-256 and SHA-512 crypt
+type shaCryptVariant struct {
+	prefix string
+	hash   func() hash.Hash
+	// order lists the bytes of the digest in groups of three in the order
+	// they are encoded.
+	order [][3]int
+}
+
+var (
+	sha256Crypt = shaCryptVariant{
+		prefix: "$5$",
+		hash:   sha256.New,
+		order: [][3]int{
+			{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14},
+			{15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29},
+			{-1, 31, 30},
+		},
+	}
+	sha512Crypt = shaCryptVariant{
+		prefix: "$6$",
+		hash:   sha512.New,
+		order: [][3]int{
+			{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+			{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+			{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+			{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+			{62, 20, 41}, {-1, -1, 63},
+		},
+	}
+)
+
+func parseSHACryptPass(entry string) (shaCryptPass, error) {
+	if _, _, _, err := splitSHACrypt(entry); err != nil {
+		return shaCryptPass{}, err
+	}
+	return shaCryptPass{entry: entry}, nil
+}
+
+func (p shaCryptPass) compare(password string) bool {
+	hash, err := shaCrypt(password, p.entry)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(p.entry)) == 1
+}
+
+// splitSHACrypt splits a SHA-crypt entry into its variant, rounds and salt.
+// The rounds are 0 if the entry does not specify them.
+func splitSHACrypt(entry string) (shaCryptVariant, int, string, error) {
+	var variant shaCryptVariant
+	switch {
+	case strings.HasPrefix(entry, sha256Crypt.prefix):
+		variant = sha256Crypt
+	case strings.HasPrefix(entry, sha512Crypt.prefix):
+		variant = sha512Crypt
+	default:
+		return variant, 0, "", errors.New("invalid SHA-crypt entry")
+	}
+
+	parts := strings.Split(entry[len(variant.prefix):], "$")
+	rounds := 0
+	if strings.HasPrefix(parts[0], shaCryptRoundsPrefix) {
+		var err error
+		rounds, err = strconv.Atoi(parts[0][len(shaCryptRoundsPrefix):])
+		if err != nil || rounds <= 0 {
+			return variant, 0, "", fmt.Errorf("invalid SHA-crypt rounds %q", parts[0])
+		}
+		parts = parts[1:]
+	}
+	if len(parts) != 2 || parts[1] == "" {
+		return variant, 0, "", errors.New("invalid SHA-crypt entry")
+	}
+	return variant, rounds, parts[0], nil
+}
+
+// shaCrypt hashes the password with the variant, rounds and salt of the
+// entry and returns the resulting entry.
+func shaCrypt(password, entry string) (string, error) {
+	variant, rounds, salt, err := splitSHACrypt(entry)
+	if err != nil {
+		return "", err
+	}
+
+	prefix := variant.prefix
+	if rounds == 0 {
+		rounds = shaCryptDefaultRounds
+	} else {
+		rounds = min(max(rounds, shaCryptMinRounds), shaCryptMaxRounds)
+		prefix += fmt.Sprintf("%s%d$", shaCryptRoundsPrefix, rounds)
+	}
+	if len(salt) > shaCryptMaxSaltLength {
+		salt = salt[:shaCryptMaxSaltLength]
+	}
+
+	digest := shaCryptDigest(variant.hash, []byte(password), []byte(salt), rounds)
+	return prefix + salt + "$" + shaCryptEncode(digest, variant.order), nil
+}
+
+func shaCryptDigest(newHash func() hash.Hash, password, salt []byte, rounds int) []byte {
+	h := newHash()
+	size := h.Size()
+
+	h.Write(password)
+	h.Write(salt)
+	h.Write(password)
+	b := h.Sum(nil)
+
+	h.Reset()
+	h.Write(password)
+	h.Write(salt)
+	h.Write(repeatBytes(b, len(password)))
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write(b)
+		} else {
+			h.Write(password)
+		}
+	}
+	a := h.Sum(nil)
+
+	h.Reset()
+	for i := 0; i < len(password); i++ {
+		h.Write(password)
+	}
+	p := repeatBytes(h.Sum(nil), len(password))
+
+	h.Reset()
+	for i := 0; i < 16+int(a[0]); i++ {
+		h.Write(salt)
+	}
+	s := repeatBytes(h.Sum(nil), len(salt))
+
+	c := a
+	for i := 0; i < rounds; i++ {
+		h.Reset()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(c[:0])
+	}
+	return c[:size]
+}
+
+// repeatBytes repeats the bytes up to the given length
+func repeatBytes(b []byte, length int) []byte {
+	result := make([]byte, 0, length)
+	for len(result) < length {
+		result = append(result, b[:min(len(b), length-len(result))]...)
+	}
+	return result
+}
+
+// shaCryptEncode encodes the digest with the crypt base64 alphabet. Groups
+// with missing (-1) leading bytes produce fewer characters.
+func shaCryptEncode(digest []byte, order [][3]int) string {
+	var sb strings.Builder
+	for _, group := range order {
+		var w uint32
+		n := 4
+		for _, i := range group {
+			w <<= 8
+			if i < 0 {
+				n--
+				continue
+			}
+			w |= uint32(digest[i])
+		}
+		for ; n > 0; n-- {
+			sb.WriteByte(shaCryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	return sb.String()
+}
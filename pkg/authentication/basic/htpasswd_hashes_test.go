@@ -0,0 +1,62 @@
+package basic
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTPasswd Hashes Suite", func() {
+	// Test vectors from https://www.akkadia.org/drepper/SHA-crypt.txt, checked
+	// against the output of openssl passwd
+	DescribeTable("shaCrypt",
+		func(password, entry, expected string) {
+			hash, err := shaCrypt(password, entry)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hash).To(Equal(expected))
+
+			p, err := parseSHACryptPass(expected)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.compare(password)).To(BeTrue())
+			Expect(p.compare(password + "!")).To(BeFalse())
+		},
+		Entry("SHA-256", "Hello world!", "$5$saltstring$x",
+			"$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5"),
+		Entry("SHA-256 with rounds and a long salt", "Hello world!", "$5$rounds=10000$saltstringsaltstring$x",
+			"$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA"),
+		Entry("SHA-256 with too few rounds", "we have a short salt string but not a short password", "$5$rounds=10$roundstoolow$x",
+			"$5$rounds=1000$roundstoolow$p20OiWa5GmKDHyeQuvXKgAXjYozUMLD5yQL6RzRpZCC"),
+		Entry("SHA-512", "Hello world!", "$6$saltstring$x",
+			"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"),
+		Entry("SHA-512 with rounds and a long salt", "Hello world!", "$6$rounds=10000$saltstringsaltstring$x",
+			"$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v."),
+	)
+
+	DescribeTable("parsing invalid entries",
+		func(parse func(string) error, entry string) {
+			Expect(parse(entry)).ToNot(Succeed())
+		},
+		Entry("argon2id without a hash", argon2ParseErr, "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA"),
+		Entry("argon2id with an unsupported version", argon2ParseErr, "$argon2id$v=16$m=19456,t=2,p=1$c2FsdA$aGFzaA"),
+		Entry("argon2id with zero iterations", argon2ParseErr, "$argon2id$v=19$m=19456,t=0,p=1$c2FsdA$aGFzaA"),
+		Entry("argon2id with invalid base64", argon2ParseErr, "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$!!!"),
+		Entry("scrypt with invalid parameters", scryptParseErr, "$scrypt$n=14,r=8,p=1$c2FsdA$aGFzaA"),
+		Entry("scrypt with a zero cost", scryptParseErr, "$scrypt$ln=0,r=8,p=1$c2FsdA$aGFzaA"),
+		Entry("SHA-crypt without a hash", shaCryptParseErr, "$6$salt"),
+		Entry("SHA-crypt with invalid rounds", shaCryptParseErr, "$5$rounds=abc$salt$hash"),
+	)
+})
+
+func argon2ParseErr(entry string) error {
+	_, err := parseArgon2Pass(entry)
+	return err
+}
+
+func scryptParseErr(entry string) error {
+	_, err := parseScryptPass(entry)
+	return err
+}
+
+func shaCryptParseErr(entry string) error {
+	_, err := parseSHACryptPass(entry)
+	return err
+}
@@ -36,7 +36,7 @@ var _ = Describe("HTPasswd Suite", func() {
 
 			BeforeEach(func() {
 				var validator Validator
-				validator, err = NewHTPasswdValidator(filePath)
+				validator, err = NewHTPasswdValidator(filePath, "")
 
 				var ok bool
 				htpasswd, ok = validator.(*htpasswdMap)
@@ -88,13 +88,102 @@ var _ = Describe("HTPasswd Suite", func() {
 				assertHtpasswdMapFromFile(filePath)
 			})
 
+			Context("with argon2id, scrypt and SHA-crypt entries", func() {
+				const filePath = "./test/htpasswd-modern.txt"
+
+				assertHtpasswdMapFromFile(filePath)
+			})
+
+			Context("with invalid entries", func() {
+				It("reports each user with an invalid password", func() {
+					_, err := createHtpasswdMap([][]string{
+						{adminUser, "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA"},
+						{user1, "$scrypt$ln=0,r=8,p=1$c2FsdA$aGFzaA"},
+						{user2, "$6$salt"},
+						{"user3", "$1$salt$hash"},
+						{"user4", "{SHA}Dvs/L78raajL4jEAHPkwflQXJzI="},
+					})
+					Expect(err).To(MatchError("'[\"admin\" \"user1\" \"user2\" \"user3\"]' user(s) could not be added: invalid password, must be a SHA, bcrypt, argon2id, scrypt or SHA-crypt entry"))
+				})
+			})
+
+			Context("with a groups file", func() {
+				var htpasswd GroupsValidator
+
+				BeforeEach(func() {
+					var err error
+					htpasswd, err = NewHTPasswdValidator("./test/htpasswd-mixed.txt", "./test/htpasswd-groups.txt")
+					Expect(err).ToNot(HaveOccurred())
+				})
+
+				It("returns the groups of valid users", func() {
+					valid, groups := htpasswd.ValidateGroups(adminUser, adminPassword)
+					Expect(valid).To(BeTrue())
+					Expect(groups).To(Equal([]string{"admins", "developers"}))
+
+					valid, groups = htpasswd.ValidateGroups(user1, user1Password)
+					Expect(valid).To(BeTrue())
+					Expect(groups).To(Equal([]string{"developers"}))
+				})
+
+				It("returns no groups for invalid passwords", func() {
+					valid, groups := htpasswd.ValidateGroups(user2, "12345")
+					Expect(valid).To(BeFalse())
+					Expect(groups).To(BeNil())
+				})
+			})
+
+			Context("with an invalid groups file", func() {
+				It("returns an error", func() {
+					file, err := os.CreateTemp("", "htpasswd-groups-invalid-")
+					Expect(err).ToNot(HaveOccurred())
+					fileNames = append(fileNames, file.Name())
+					_, err = file.WriteString("admins: admin\ndevelopers user1\n")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(file.Close()).To(Succeed())
+
+					_, err = NewHTPasswdValidator("./test/htpasswd-mixed.txt", file.Name())
+					Expect(err).To(MatchError("could not load htpasswd groups file: could not read groups file: invalid group on line 2: must be of the form group: user [user...]"))
+				})
+			})
+
+			Context("groups file is updated", func() {
+				var htpasswd GroupsValidator
+				var groupsFile string
+
+				BeforeEach(func() {
+					file, err := os.CreateTemp("", "htpasswd-groups-updated-")
+					Expect(err).ToNot(HaveOccurred())
+					groupsFile = file.Name()
+					fileNames = append(fileNames, groupsFile)
+					_, err = file.WriteString("admins: admin\n")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(file.Close()).To(Succeed())
+
+					htpasswd, err = NewHTPasswdValidator("./test/htpasswd-mixed.txt", groupsFile)
+					Expect(err).ToNot(HaveOccurred())
+				})
+
+				It("reloads the groups", func() {
+					_, groups := htpasswd.ValidateGroups(adminUser, adminPassword)
+					Expect(groups).To(Equal([]string{"admins"}))
+
+					Expect(os.WriteFile(groupsFile, []byte("auditors: admin\n"), 0644)).To(Succeed())
+
+					Eventually(func() []string {
+						_, groups := htpasswd.ValidateGroups(adminUser, adminPassword)
+						return groups
+					}).Should(Equal([]string{"auditors"}))
+				})
+			})
+
 			Context("with a non existent file", func() {
 				const filePath = "./test/htpasswd-doesnt-exist.txt"
 				var validator Validator
 				var err error
 
 				BeforeEach(func() {
-					validator, err = NewHTPasswdValidator(filePath)
+					validator, err = NewHTPasswdValidator(filePath, "")
 				})
 
 				It("returns an error", func() {
@@ -129,7 +218,7 @@ var _ = Describe("HTPasswd Suite", func() {
 					_, err = file.WriteString(adminUserHtpasswdEntry + "\n")
 					Expect(err).ToNot(HaveOccurred())
 
-					validator, err = NewHTPasswdValidator(file.Name())
+					validator, err = NewHTPasswdValidator(file.Name(), "")
 					Expect(err).ToNot(HaveOccurred())
 
 					htpasswd, ok := validator.(*htpasswdMap)
@@ -0,0 +1,229 @@
+package basic
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cache"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+// ldapCacheSize is the maximum number of validated credentials cached
+const ldapCacheSize = 1000
+
+// ldapValidator validates credentials against an LDAP directory.
+// Users are found with a search as the service account and their password is
+// checked by binding as the user's DN.
+type ldapValidator struct {
+	opts      options.LDAP
+	tlsConfig *tls.Config
+
+	// validations caches the groups of successfully validated credentials
+	// by a keyed hash of the credentials, so that the passwords are not held
+	// in memory
+	validations *cache.LRU[[]string]
+	hashKey     []byte
+}
+
+// NewLDAPValidator constructs a validator that authenticates users against
+// the LDAP directory and looks up their groups.
+func NewLDAPValidator(opts options.LDAP) (GroupsValidator, error) {
+	if opts.URL == "" {
+		return nil, errors.New("LDAP URL is required")
+	}
+	if !strings.Contains(opts.UserFilter, "%s") {
+		return nil, fmt.Errorf("LDAP user filter %q must contain %%s", opts.UserFilter)
+	}
+	if opts.GroupBaseDN != "" && !strings.Contains(opts.GroupFilter, "%s") {
+		return nil, fmt.Errorf("LDAP group filter %q must contain %%s", opts.GroupFilter)
+	}
+
+	hashKey := make([]byte, 32)
+	if _, err := rand.Read(hashKey); err != nil {
+		return nil, fmt.Errorf("could not generate LDAP cache key: %v", err)
+	}
+	cacheSize := ldapCacheSize
+	if opts.CacheTTL <= 0 {
+		cacheSize = 0
+	}
+
+	return &ldapValidator{
+		opts: opts,
+		tlsConfig: &tls.Config{
+			InsecureSkipVerify: opts.InsecureSkipVerify, // #nosec G402 -- InsecureSkipVerify is a configurable option we allow
+			MinVersion:         tls.VersionTLS12,
+		},
+		validations: cache.NewLRU[[]string](cacheSize),
+		hashKey:     hashKey,
+	}, nil
+}
+
+// Validate checks the credentials against the LDAP directory
+func (l *ldapValidator) Validate(user, password string) bool {
+	valid, _ := l.ValidateGroups(user, password)
+	return valid
+}
+
+// ValidateGroups checks the credentials against the LDAP directory and
+// returns the names of the groups the user is a member of.
+// Successful validations are cached for the cache TTL, so that every basic
+// auth request does not connect to the LDAP server.
+func (l *ldapValidator) ValidateGroups(user, password string) (bool, []string) {
+	// An empty password would make the bind an unauthenticated bind, which
+	// most servers accept for any DN.
+	if user == "" || password == "" {
+		return false, nil
+	}
+
+	key := l.credentialsKey(user, password)
+	if groups, ok := l.validations.Get(key, time.Now()); ok {
+		return true, append([]string(nil), groups...)
+	}
+
+	valid, groups := l.validateGroups(user, password)
+	if valid {
+		now := time.Now()
+		l.validations.Set(key, append([]string(nil), groups...), now.Add(l.opts.CacheTTL), now)
+	}
+	return valid, groups
+}
+
+// credentialsKey identifies the credentials in the cache by their HMAC
+func (l *ldapValidator) credentialsKey(user, password string) string {
+	mac := hmac.New(sha256.New, l.hashKey)
+	_, _ = fmt.Fprintf(mac, "%d:%s%s", len(user), user, password)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateGroups binds to the LDAP directory to check the credentials and
+// search for the user's groups
+func (l *ldapValidator) validateGroups(user, password string) (bool, []string) {
+	conn, err := l.dial()
+	if err != nil {
+		logger.Errorf("Error connecting to LDAP server: %v", err)
+		return false, nil
+	}
+	defer conn.Close()
+
+	if err := l.bindServiceAccount(conn); err != nil {
+		logger.Errorf("Error binding to LDAP server as %q: %v", l.opts.BindDN, err)
+		return false, nil
+	}
+
+	userDN, err := l.findUserDN(conn, user)
+	if err != nil {
+		logger.Printf("Could not find LDAP user %q: %v", user, err)
+		return false, nil
+	}
+
+	if err := conn.Bind(userDN, password); err != nil {
+		if !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			logger.Errorf("Error binding to LDAP server as %q: %v", userDN, err)
+		}
+		return false, nil
+	}
+
+	if l.opts.GroupBaseDN == "" {
+		return true, nil
+	}
+
+	// Groups are searched for as the service account as users are not
+	// necessarily allowed to read group memberships.
+	if err := l.bindServiceAccount(conn); err != nil {
+		logger.Errorf("Error binding to LDAP server as %q: %v", l.opts.BindDN, err)
+		return false, nil
+	}
+	groups, err := l.findGroups(conn, userDN)
+	if err != nil {
+		logger.Errorf("Error searching LDAP groups of %q: %v", userDN, err)
+		return false, nil
+	}
+	return true, groups
+}
+
+func (l *ldapValidator) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(l.opts.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: l.opts.Timeout}),
+		ldap.DialWithTLSConfig(l.tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if l.opts.Timeout > 0 {
+		conn.SetTimeout(l.opts.Timeout)
+	}
+
+	if l.opts.StartTLS {
+		if err := conn.StartTLS(l.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("could not start TLS: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+func (l *ldapValidator) bindServiceAccount(conn *ldap.Conn) error {
+	if l.opts.BindDN == "" {
+		return conn.UnauthenticatedBind("")
+	}
+	return conn.Bind(l.opts.BindDN, l.opts.BindPassword)
+}
+
+// findUserDN searches for the DN of the user, which must match exactly one entry
+func (l *ldapValidator) findUserDN(conn *ldap.Conn, user string) (string, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		l.opts.UserBaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(l.opts.Timeout.Seconds()), false,
+		fmt.Sprintf(l.opts.UserFilter, ldap.EscapeFilter(user)),
+		[]string{"dn"},
+		nil,
+	))
+	// A size limit error still returns the entries found, which are
+	// reported as multiple matches below.
+	if err != nil && (result == nil || !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded)) {
+		return "", err
+	}
+
+	switch len(result.Entries) {
+	case 0:
+		return "", errors.New("no matching entry")
+	case 1:
+		return result.Entries[0].DN, nil
+	default:
+		return "", errors.New("multiple matching entries")
+	}
+}
+
+// findGroups searches for the groups that have the user as a member
+func (l *ldapValidator) findGroups(conn *ldap.Conn, userDN string) ([]string, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		l.opts.GroupBaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, int(l.opts.Timeout.Seconds()), false,
+		fmt.Sprintf(l.opts.GroupFilter, ldap.EscapeFilter(userDN)),
+		[]string{l.opts.GroupNameAttribute},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []string{}
+	for _, entry := range result.Entries {
+		if name := entry.GetAttributeValue(l.opts.GroupNameAttribute); name != "" {
+			groups = append(groups, name)
+		}
+	}
+	return groups, nil
+}
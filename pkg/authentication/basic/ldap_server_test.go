@@ -0,0 +1,234 @@
+package basic
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// LDAP protocol operations and result codes used by the test server
+const (
+	ldapBindRequest        ber.Tag = 0
+	ldapBindResponse       ber.Tag = 1
+	ldapUnbindRequest      ber.Tag = 2
+	ldapSearchRequest      ber.Tag = 3
+	ldapSearchResEntry     ber.Tag = 4
+	ldapSearchResDone      ber.Tag = 5
+	ldapFilterAnd          ber.Tag = 0
+	ldapFilterOr           ber.Tag = 1
+	ldapFilterEquality     ber.Tag = 3
+	ldapFilterPresent      ber.Tag = 7
+	ldapSuccess                    = 0
+	ldapInvalidCreds               = 49
+	ldapInsufficientPerm           = 50
+	ldapUnwillingToPerform         = 53
+)
+
+// testLDAPEntry is an entry in the directory of the test LDAP server
+type testLDAPEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// testLDAPServer is a minimal in-process LDAP server supporting simple binds
+// and searches with and, or, equality and presence filters.
+type testLDAPServer struct {
+	listener net.Listener
+	entries  []testLDAPEntry
+
+	// searchDN is the only DN allowed to search the directory
+	searchDN string
+
+	// connections counts the connections accepted by the server
+	connections atomic.Int32
+
+	wg sync.WaitGroup
+}
+
+func newTestLDAPServer(searchDN string, entries ...testLDAPEntry) (*testLDAPServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &testLDAPServer{
+		listener: listener,
+		entries:  entries,
+		searchDN: searchDN,
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+func (s *testLDAPServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *testLDAPServer) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *testLDAPServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.connections.Add(1)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *testLDAPServer) handle(conn net.Conn) {
+	boundDN := ""
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldapBindRequest:
+			name := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+			code := s.bind(name, password)
+			if code == ldapSuccess {
+				boundDN = name
+			} else {
+				boundDN = ""
+			}
+			s.write(conn, ldapResult(messageID, ldapBindResponse, code))
+		case ldapSearchRequest:
+			if boundDN != s.searchDN {
+				s.write(conn, ldapResult(messageID, ldapSearchResDone, ldapInsufficientPerm))
+				continue
+			}
+			for _, entry := range s.search(op) {
+				s.write(conn, entry.encode(messageID, op.Children[7]))
+			}
+			s.write(conn, ldapResult(messageID, ldapSearchResDone, ldapSuccess))
+		case ldapUnbindRequest:
+			return
+		default:
+			s.write(conn, ldapResult(messageID, op.Tag+1, ldapUnwillingToPerform))
+		}
+	}
+}
+
+func (s *testLDAPServer) write(conn net.Conn, packet *ber.Packet) {
+	_, _ = conn.Write(packet.Bytes())
+}
+
+func (s *testLDAPServer) bind(name, password string) int64 {
+	if name == "" && password == "" {
+		return ldapSuccess
+	}
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.dn, name) && entry.password != "" && entry.password == password {
+			return ldapSuccess
+		}
+	}
+	return ldapInvalidCreds
+}
+
+func (s *testLDAPServer) search(op *ber.Packet) []testLDAPEntry {
+	baseDN := strings.ToLower(op.Children[0].Data.String())
+	filter := op.Children[6]
+
+	entries := []testLDAPEntry{}
+	for _, entry := range s.entries {
+		if !strings.HasSuffix(strings.ToLower(entry.dn), baseDN) {
+			continue
+		}
+		if entry.matches(filter) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func (e testLDAPEntry) matches(filter *ber.Packet) bool {
+	switch filter.Tag {
+	case ldapFilterAnd:
+		for _, child := range filter.Children {
+			if !e.matches(child) {
+				return false
+			}
+		}
+		return true
+	case ldapFilterOr:
+		for _, child := range filter.Children {
+			if e.matches(child) {
+				return true
+			}
+		}
+		return false
+	case ldapFilterEquality:
+		attribute := filter.Children[0].Data.String()
+		value := filter.Children[1].Data.String()
+		for _, v := range e.attributes[attribute] {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+	case ldapFilterPresent:
+		return len(e.attributes[filter.Data.String()]) > 0
+	default:
+		return false
+	}
+}
+
+func (e testLDAPEntry) encode(messageID int64, requested *ber.Packet) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapSearchResEntry, nil, "")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, ""))
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	for _, r := range requested.Children {
+		name := r.Data.String()
+		values, ok := e.attributes[name]
+		if !ok {
+			continue
+		}
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	op.AppendChild(attributes)
+
+	return ldapMessage(messageID, op)
+}
+
+func ldapResult(messageID int64, tag ber.Tag, code int64) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return ldapMessage(messageID, op)
+}
+
+func ldapMessage(messageID int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, ""))
+	packet.AppendChild(op)
+	return packet
+}
@@ -0,0 +1,241 @@
+package basic
+
+import (
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	ldapServiceDN       = "cn=oauth2-proxy,ou=services,dc=example,dc=com"
+	ldapServicePassword = "s3rv1ceP455"
+	ldapUserDN          = "uid=jdoe,ou=people,dc=example,dc=com"
+	ldapUserPassword    = "jd0eP455W0Rd"
+)
+
+var _ = Describe("LDAP Suite", func() {
+	var server *testLDAPServer
+	var opts options.LDAP
+
+	BeforeEach(func() {
+		var err error
+		server, err = newTestLDAPServer(ldapServiceDN,
+			testLDAPEntry{
+				dn:       ldapServiceDN,
+				password: ldapServicePassword,
+			},
+			testLDAPEntry{
+				dn:       ldapUserDN,
+				password: ldapUserPassword,
+				attributes: map[string][]string{
+					"uid":         {"jdoe"},
+					"objectClass": {"person"},
+				},
+			},
+			testLDAPEntry{
+				dn: "uid=nopass,ou=people,dc=example,dc=com",
+				attributes: map[string][]string{
+					"uid":         {"nopass"},
+					"objectClass": {"person"},
+				},
+			},
+			testLDAPEntry{
+				dn: "cn=admins,ou=groups,dc=example,dc=com",
+				attributes: map[string][]string{
+					"cn":     {"admins"},
+					"member": {ldapUserDN},
+				},
+			},
+			testLDAPEntry{
+				dn: "cn=developers,ou=groups,dc=example,dc=com",
+				attributes: map[string][]string{
+					"cn":     {"developers"},
+					"member": {"uid=other,ou=people,dc=example,dc=com", ldapUserDN},
+				},
+			},
+			testLDAPEntry{
+				dn: "cn=finance,ou=groups,dc=example,dc=com",
+				attributes: map[string][]string{
+					"cn":     {"finance"},
+					"member": {"uid=other,ou=people,dc=example,dc=com"},
+				},
+			},
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		opts = options.LDAP{
+			URL:                server.URL(),
+			Timeout:            5 * time.Second,
+			BindDN:             ldapServiceDN,
+			BindPassword:       ldapServicePassword,
+			UserBaseDN:         "ou=people,dc=example,dc=com",
+			UserFilter:         "(&(objectClass=person)(uid=%s))",
+			GroupBaseDN:        "ou=groups,dc=example,dc=com",
+			GroupFilter:        "(member=%s)",
+			GroupNameAttribute: "cn",
+			CacheTTL:           time.Minute,
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Context("NewLDAPValidator", func() {
+		It("requires a URL", func() {
+			opts.URL = ""
+			_, err := NewLDAPValidator(opts)
+			Expect(err).To(MatchError("LDAP URL is required"))
+		})
+
+		It("requires the user filter to contain the username placeholder", func() {
+			opts.UserFilter = "(uid=jdoe)"
+			_, err := NewLDAPValidator(opts)
+			Expect(err).To(MatchError("LDAP user filter \"(uid=jdoe)\" must contain %s"))
+		})
+
+		It("requires the group filter to contain the user DN placeholder", func() {
+			opts.GroupFilter = "(member=*)"
+			_, err := NewLDAPValidator(opts)
+			Expect(err).To(MatchError("LDAP group filter \"(member=*)\" must contain %s"))
+		})
+	})
+
+	Context("ValidateGroups", func() {
+		var validator GroupsValidator
+
+		JustBeforeEach(func() {
+			var err error
+			validator, err = NewLDAPValidator(opts)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("accepts the correct password and returns the user's groups", func() {
+			valid, groups := validator.ValidateGroups("jdoe", ldapUserPassword)
+			Expect(valid).To(BeTrue())
+			Expect(groups).To(ConsistOf("admins", "developers"))
+			Expect(validator.Validate("jdoe", ldapUserPassword)).To(BeTrue())
+		})
+
+		It("rejects an incorrect password", func() {
+			valid, groups := validator.ValidateGroups("jdoe", "wrong")
+			Expect(valid).To(BeFalse())
+			Expect(groups).To(BeNil())
+		})
+
+		It("rejects an empty password", func() {
+			valid, _ := validator.ValidateGroups("nopass", "")
+			Expect(valid).To(BeFalse())
+		})
+
+		It("rejects an unknown user", func() {
+			valid, _ := validator.ValidateGroups("unknown", ldapUserPassword)
+			Expect(valid).To(BeFalse())
+		})
+
+		It("escapes the username in the user filter", func() {
+			valid, _ := validator.ValidateGroups("*", ldapUserPassword)
+			Expect(valid).To(BeFalse())
+		})
+
+		It("caches successful validations", func() {
+			for i := 0; i < 2; i++ {
+				valid, groups := validator.ValidateGroups("jdoe", ldapUserPassword)
+				Expect(valid).To(BeTrue())
+				Expect(groups).To(ConsistOf("admins", "developers"))
+			}
+			Expect(server.connections.Load()).To(BeEquivalentTo(1))
+		})
+
+		It("does not accept another password for cached credentials", func() {
+			valid, _ := validator.ValidateGroups("jdoe", ldapUserPassword)
+			Expect(valid).To(BeTrue())
+
+			valid, _ = validator.ValidateGroups("jdoe", "wrong")
+			Expect(valid).To(BeFalse())
+			Expect(server.connections.Load()).To(BeEquivalentTo(2))
+		})
+
+		It("does not cache failed validations", func() {
+			for i := 0; i < 2; i++ {
+				valid, _ := validator.ValidateGroups("jdoe", "wrong")
+				Expect(valid).To(BeFalse())
+			}
+			Expect(server.connections.Load()).To(BeEquivalentTo(2))
+		})
+
+		It("does not share the cached groups with callers", func() {
+			_, groups := validator.ValidateGroups("jdoe", ldapUserPassword)
+			groups[0] = "modified"
+
+			_, groups = validator.ValidateGroups("jdoe", ldapUserPassword)
+			Expect(groups).To(ConsistOf("admins", "developers"))
+		})
+
+		Context("with the cache disabled", func() {
+			BeforeEach(func() {
+				opts.CacheTTL = 0
+			})
+
+			It("validates the credentials against the server every time", func() {
+				for i := 0; i < 2; i++ {
+					valid, _ := validator.ValidateGroups("jdoe", ldapUserPassword)
+					Expect(valid).To(BeTrue())
+				}
+				Expect(server.connections.Load()).To(BeEquivalentTo(2))
+			})
+		})
+
+		Context("once the cache TTL has expired", func() {
+			BeforeEach(func() {
+				opts.CacheTTL = time.Nanosecond
+			})
+
+			It("validates the credentials against the server again", func() {
+				valid, _ := validator.ValidateGroups("jdoe", ldapUserPassword)
+				Expect(valid).To(BeTrue())
+				time.Sleep(time.Millisecond)
+
+				valid, _ = validator.ValidateGroups("jdoe", ldapUserPassword)
+				Expect(valid).To(BeTrue())
+				Expect(server.connections.Load()).To(BeEquivalentTo(2))
+			})
+		})
+
+		Context("without a group base DN", func() {
+			BeforeEach(func() {
+				opts.GroupBaseDN = ""
+			})
+
+			It("accepts the user without looking up groups", func() {
+				valid, groups := validator.ValidateGroups("jdoe", ldapUserPassword)
+				Expect(valid).To(BeTrue())
+				Expect(groups).To(BeEmpty())
+			})
+		})
+
+		Context("with an incorrect service account password", func() {
+			BeforeEach(func() {
+				opts.BindPassword = "wrong"
+			})
+
+			It("rejects the user", func() {
+				valid, _ := validator.ValidateGroups("jdoe", ldapUserPassword)
+				Expect(valid).To(BeFalse())
+			})
+		})
+
+		Context("when the server is unreachable", func() {
+			BeforeEach(func() {
+				server.Close()
+			})
+
+			It("rejects the user", func() {
+				valid, _ := validator.ValidateGroups("jdoe", ldapUserPassword)
+				Expect(valid).To(BeFalse())
+			})
+		})
+	})
+})
@@ -5,3 +5,84 @@ package basic
 type Validator interface {
 	Validate(user, password string) bool
 }
+
+// GroupsValidator is a Validator that also knows the groups of the users it
+// validates, such as a directory service.
+type GroupsValidator interface {
+	Validator
+
+	// ValidateGroups validates the username and password combination and
+	// returns the groups of the user when they are valid.
+	ValidateGroups(user, password string) (bool, []string)
+}
+
+// Authenticate validates the username and password combination with the
+// validator, returning the groups of the user if the validator provides them.
+func Authenticate(validator Validator, user, password string) (bool, []string) {
+	if v, ok := validator.(GroupsValidator); ok {
+		return v.ValidateGroups(user, password)
+	}
+	return validator.Validate(user, password), nil
+}
+
+// validatorChain tries each of its validators in turn until one of them
+// accepts the credentials.
+type validatorChain []Validator
+
+// NewValidatorChain composes the validators into a single Validator. The
+// credentials are valid if any of the validators accepts them, and the
+// groups of the user are those of the first validator to accept them.
+// Nil validators are skipped and nil is returned if no validators remain.
+func NewValidatorChain(validators ...Validator) Validator {
+	chain := validatorChain{}
+	for _, v := range validators {
+		if v != nil {
+			chain = append(chain, v)
+		}
+	}
+
+	switch len(chain) {
+	case 0:
+		return nil
+	case 1:
+		return chain[0]
+	default:
+		return chain
+	}
+}
+
+// Validate checks the credentials against each validator in the chain
+func (c validatorChain) Validate(user, password string) bool {
+	valid, _ := c.ValidateGroups(user, password)
+	return valid
+}
+
+// ValidateGroups checks the credentials against each validator in the chain
+// and returns the groups from the first validator to accept them.
+func (c validatorChain) ValidateGroups(user, password string) (bool, []string) {
+	for _, v := range c {
+		if valid, groups := Authenticate(v, user, password); valid {
+			return true, groups
+		}
+	}
+	return false, nil
+}
+
+// MergeGroups combines the static groups of basic auth sessions with the groups of the user
+// found by a validator, dropping duplicates.
+func MergeGroups(sessionGroups, userGroups []string) []string {
+	if len(userGroups) == 0 {
+		return sessionGroups
+	}
+
+	groups := make([]string, 0, len(sessionGroups)+len(userGroups))
+	seen := make(map[string]struct{}, cap(groups))
+	for _, group := range append(append([]string{}, sessionGroups...), userGroups...) {
+		if _, ok := seen[group]; ok {
+			continue
+		}
+		seen[group] = struct{}{}
+		groups = append(groups, group)
+	}
+	return groups
+}
@@ -0,0 +1,83 @@
+package basic
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type staticValidator struct {
+	user     string
+	password string
+}
+
+func (v staticValidator) Validate(user, password string) bool {
+	return user == v.user && password == v.password
+}
+
+type staticGroupsValidator struct {
+	staticValidator
+	groups []string
+}
+
+func (v staticGroupsValidator) ValidateGroups(user, password string) (bool, []string) {
+	if !v.Validate(user, password) {
+		return false, nil
+	}
+	return true, v.groups
+}
+
+var _ = Describe("Validator Chain Suite", func() {
+	It("returns nil without any validators", func() {
+		Expect(NewValidatorChain(nil, nil)).To(BeNil())
+	})
+
+	It("returns a single validator as is", func() {
+		v := staticValidator{user: user1, password: user1Password}
+		Expect(NewValidatorChain(nil, v)).To(Equal(v))
+	})
+
+	Context("with multiple validators", func() {
+		var chain Validator
+
+		BeforeEach(func() {
+			chain = NewValidatorChain(
+				staticValidator{user: user1, password: user1Password},
+				staticGroupsValidator{
+					staticValidator: staticValidator{user: user2, password: user2Password},
+					groups:          []string{"developers"},
+				},
+				staticGroupsValidator{
+					staticValidator: staticValidator{user: user1, password: "other"},
+					groups:          []string{"admins"},
+				},
+			)
+		})
+
+		It("accepts credentials accepted by any validator", func() {
+			Expect(chain.Validate(user1, user1Password)).To(BeTrue())
+			Expect(chain.Validate(user2, user2Password)).To(BeTrue())
+			Expect(chain.Validate(user1, "other")).To(BeTrue())
+		})
+
+		It("rejects credentials rejected by all validators", func() {
+			Expect(chain.Validate(user2, user1Password)).To(BeFalse())
+			valid, groups := Authenticate(chain, adminUser, adminPassword)
+			Expect(valid).To(BeFalse())
+			Expect(groups).To(BeNil())
+		})
+
+		It("returns the groups of the first validator to accept the credentials", func() {
+			valid, groups := Authenticate(chain, user1, user1Password)
+			Expect(valid).To(BeTrue())
+			Expect(groups).To(BeNil())
+
+			valid, groups = Authenticate(chain, user2, user2Password)
+			Expect(valid).To(BeTrue())
+			Expect(groups).To(ConsistOf("developers"))
+
+			valid, groups = Authenticate(chain, user1, "other")
+			Expect(valid).To(BeTrue())
+			Expect(groups).To(ConsistOf("admins"))
+		})
+	})
+})
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is a bounded least recently used cache of values that expire.
+// It is safe for concurrent use.
+type LRU[V any] struct {
+	size    int
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type lruEntry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+// NewLRU creates a cache holding at most size values. A size of 0 or less
+// disables the cache.
+func NewLRU[V any](size int) *LRU[V] {
+	return &LRU[V]{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Get returns the value cached for the key if it has not expired by now
+func (c *LRU[V]) Get(key string, now time.Time) (V, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var zero V
+	elem, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+	entry := elem.Value.(*lruEntry[V])
+	if !now.Before(entry.expires) {
+		c.remove(elem)
+		return zero, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Set caches the value until it expires. When the cache is full, expired
+// values are evicted and then the least recently used values.
+func (c *LRU[V]) Set(key string, value V, expires time.Time, now time.Time) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*lruEntry[V])
+		entry.value = value
+		entry.expires = expires
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[V]{key: key, value: value, expires: expires})
+
+	if c.order.Len() > c.size {
+		for elem := c.order.Back(); elem != nil; {
+			prev := elem.Prev()
+			if !now.Before(elem.Value.(*lruEntry[V]).expires) {
+				c.remove(elem)
+			}
+			elem = prev
+		}
+	}
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Len returns the number of cached values, including expired values that
+// have not been evicted yet
+func (c *LRU[V]) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.order.Len()
+}
+
+// remove deletes the entry of the list element
+func (c *LRU[V]) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*lruEntry[V]).key)
+}
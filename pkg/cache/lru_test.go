@@ -0,0 +1,75 @@
+package cache_test
+
+import (
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cache"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LRU", func() {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := now.Add(time.Hour)
+
+	It("returns cached values until they expire", func() {
+		c := cache.NewLRU[string](2)
+		c.Set("key", "value", later, now)
+
+		value, ok := c.Get("key", now)
+		Expect(ok).To(BeTrue())
+		Expect(value).To(Equal("value"))
+
+		_, ok = c.Get("key", later)
+		Expect(ok).To(BeFalse())
+		Expect(c.Len()).To(Equal(0))
+	})
+
+	It("replaces the value of a cached key", func() {
+		c := cache.NewLRU[string](2)
+		c.Set("key", "first", later, now)
+		c.Set("key", "second", later, now)
+
+		value, ok := c.Get("key", now)
+		Expect(ok).To(BeTrue())
+		Expect(value).To(Equal("second"))
+		Expect(c.Len()).To(Equal(1))
+	})
+
+	It("evicts the least recently used value when it is full", func() {
+		c := cache.NewLRU[string](2)
+		c.Set("first", "1", later, now)
+		c.Set("second", "2", later, now)
+		_, _ = c.Get("first", now)
+		c.Set("third", "3", later, now)
+
+		_, ok := c.Get("second", now)
+		Expect(ok).To(BeFalse())
+		_, ok = c.Get("first", now)
+		Expect(ok).To(BeTrue())
+		_, ok = c.Get("third", now)
+		Expect(ok).To(BeTrue())
+	})
+
+	It("evicts expired values before the least recently used value", func() {
+		c := cache.NewLRU[string](2)
+		c.Set("first", "1", later, now)
+		c.Set("expiring", "2", now.Add(time.Minute), now)
+		_, _ = c.Get("first", now)
+		c.Set("second", "3", later, now.Add(time.Minute))
+
+		Expect(c.Len()).To(Equal(2))
+		_, ok := c.Get("first", now)
+		Expect(ok).To(BeTrue())
+		_, ok = c.Get("second", now)
+		Expect(ok).To(BeTrue())
+	})
+
+	It("does not cache values when the size is 0", func() {
+		c := cache.NewLRU[string](0)
+		c.Set("key", "value", later, now)
+
+		_, ok := c.Get("key", now)
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -33,7 +33,8 @@ var _ = Describe("Cookie Tests", func() {
 				if in.xForwardedHost != "" {
 					req.Header.Add("X-Forwarded-Host", in.xForwardedHost)
 					req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{
-						ReverseProxy: true,
+						ReverseProxy:  true,
+						ForwardedHost: in.xForwardedHost,
 					})
 				}
 
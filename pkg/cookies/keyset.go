@@ -0,0 +1,96 @@
+package cookies
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/watcher"
+)
+
+// NewKeysetFromFile loads the cookie secrets from a keyset file and reloads
+// them whenever the file is updated. If a reloaded file contains an invalid
+// secret, the current secrets are kept.
+func NewKeysetFromFile(path string) (*encryption.Keyset, error) {
+	secrets, err := loadValidKeysetFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keyset := encryption.NewKeyset(secrets...)
+
+	if err := watcher.WatchFileForUpdates(path, nil, func() {
+		secrets, err := loadValidKeysetFile(path)
+		if err != nil {
+			logger.Errorf("%v: no changes were made to the current cookie secrets", err)
+			return
+		}
+		keyset.Update(secrets)
+	}); err != nil {
+		return nil, fmt.Errorf("could not watch cookie secret keyset file: %v", err)
+	}
+
+	return keyset, nil
+}
+
+// loadValidKeysetFile reads the cookie secrets from a keyset file and checks
+// that every secret can be used to encrypt cookies.
+func loadValidKeysetFile(path string) ([]string, error) {
+	secrets, err := LoadKeysetFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for i, secret := range secrets {
+		if err := ValidateSecret(secret); err != nil {
+			return nil, fmt.Errorf("invalid cookie secret keyset file entry %d: %v", i+1, err)
+		}
+	}
+	return secrets, nil
+}
+
+// ValidateSecret checks that the secret can be used to create the AES cipher
+// that cookies are encrypted with.
+func ValidateSecret(secret string) error {
+	secretBytes := encryption.SecretBytes(secret)
+	switch len(secretBytes) {
+	case 16, 24, 32:
+	default:
+		return fmt.Errorf("cookie_secret must be 16, 24, or 32 bytes to create an AES cipher, but is %d bytes", len(secretBytes))
+	}
+
+	if _, err := encryption.NewCFBCipher(secretBytes); err != nil {
+		return fmt.Errorf("could not create cookie cipher: %v", err)
+	}
+	return nil
+}
+
+// LoadKeysetFile reads the cookie secrets from a keyset file.
+// The file contains one secret per line, starting with the primary secret.
+// Empty lines and lines starting with `#` are ignored.
+func LoadKeysetFile(path string) ([]string, error) {
+	f, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("could not open cookie secret keyset file: %v", err)
+	}
+	defer f.Close()
+
+	secrets := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		secrets = append(secrets, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read cookie secret keyset file: %v", err)
+	}
+	if len(secrets) == 0 {
+		return nil, errors.New("cookie secret keyset file does not contain any secrets")
+	}
+	return secrets, nil
+}
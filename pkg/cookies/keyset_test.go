@@ -0,0 +1,67 @@
+package cookies
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Keyset File Tests", func() {
+	var keysetFile string
+
+	BeforeEach(func() {
+		keysetFile = filepath.Join(GinkgoT().TempDir(), "keyset")
+	})
+
+	It("loads secrets in order, ignoring comments and empty lines", func() {
+		Expect(os.WriteFile(keysetFile, []byte("# new secret\nprimary\n\n  previous  \n"), 0600)).To(Succeed())
+
+		secrets, err := LoadKeysetFile(keysetFile)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(secrets).To(Equal([]string{"primary", "previous"}))
+	})
+
+	It("returns an error for a file without secrets", func() {
+		Expect(os.WriteFile(keysetFile, []byte("# no secrets\n"), 0600)).To(Succeed())
+
+		_, err := LoadKeysetFile(keysetFile)
+		Expect(err).To(MatchError("cookie secret keyset file does not contain any secrets"))
+	})
+
+	const first = "first-0123456789"
+	const second = "second-012345678"
+
+	It("reloads the keyset when the file is updated", func() {
+		Expect(os.WriteFile(keysetFile, []byte(first+"\n"), 0600)).To(Succeed())
+
+		keyset, err := NewKeysetFromFile(keysetFile)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(keyset.Secrets()).To(Equal([]string{first}))
+
+		Expect(os.WriteFile(keysetFile, []byte(second+"\n"+first+"\n"), 0600)).To(Succeed())
+		Eventually(keyset.Primary).Should(Equal(second))
+		Expect(keyset.Secrets()).To(Equal([]string{second, first}))
+	})
+
+	It("rejects a keyset file with an invalid secret", func() {
+		Expect(os.WriteFile(keysetFile, []byte(first+"\ntoo-short\n"), 0600)).To(Succeed())
+
+		_, err := NewKeysetFromFile(keysetFile)
+		Expect(err).To(MatchError("invalid cookie secret keyset file entry 2: cookie_secret must be 16, 24, or 32 bytes to create an AES cipher, but is 9 bytes"))
+	})
+
+	It("keeps the current secrets when a reloaded secret is invalid", func() {
+		Expect(os.WriteFile(keysetFile, []byte(first+"\n"), 0600)).To(Succeed())
+
+		keyset, err := NewKeysetFromFile(keysetFile)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(os.WriteFile(keysetFile, []byte("too-short\n"+first+"\n"), 0600)).To(Succeed())
+		Consistently(keyset.Secrets, "200ms").Should(Equal([]string{first}))
+
+		Expect(os.WriteFile(keysetFile, []byte(second+"\n"+first+"\n"), 0600)).To(Succeed())
+		Eventually(keyset.Primary).Should(Equal(second))
+	})
+})
@@ -0,0 +1,161 @@
+// Package dpop implements sender-constrained tokens using OAuth 2.0
+// Demonstrating Proof of Possession (RFC 9449).
+package dpop
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+)
+
+const (
+	// HeaderName is the name of the header carrying a DPoP proof
+	HeaderName = "DPoP"
+
+	// NonceHeaderName is the name of the header a server uses to provide a nonce
+	NonceHeaderName = "DPoP-Nonce"
+
+	// TokenType is the authorization scheme and token type of DPoP-bound tokens
+	TokenType = "DPoP"
+
+	proofType = "dpop+jwt"
+)
+
+type contextKey struct{}
+
+// GenerateKey generates a new P-256 key pair for binding a session's tokens.
+func GenerateKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// MarshalKey encodes the key so that it can be stored in a session.
+func MarshalKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	return x509.MarshalECPrivateKey(key)
+}
+
+// ParseKey decodes a key stored in a session by MarshalKey.
+func ParseKey(der []byte) (*ecdsa.PrivateKey, error) {
+	return x509.ParseECPrivateKey(der)
+}
+
+// NewContext returns a context carrying the DPoP key. Requests made through
+// pkg/requests with this context are sent with a DPoP proof.
+func NewContext(ctx context.Context, key *ecdsa.PrivateKey) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// KeyFromContext returns the DPoP key in the context, if any.
+func KeyFromContext(ctx context.Context) *ecdsa.PrivateKey {
+	key, _ := ctx.Value(contextKey{}).(*ecdsa.PrivateKey)
+	return key
+}
+
+// ContextForSession returns a context carrying the session's DPoP key.
+// If the session is not DPoP-bound the context is returned unchanged.
+func ContextForSession(ctx context.Context, s *sessionsapi.SessionState) (context.Context, error) {
+	if s == nil || len(s.DPoPKey) == 0 {
+		return ctx, nil
+	}
+	key, err := ParseKey(s.DPoPKey)
+	if err != nil {
+		return ctx, fmt.Errorf("could not parse session DPoP key: %v", err)
+	}
+	return NewContext(ctx, key), nil
+}
+
+// NewProof creates a DPoP proof for a request with the given method and URI.
+// The access token is optional and binds the proof to the token when
+// calling a protected resource. The nonce is optional and is only sent
+// when the server has requested one.
+func NewProof(key *ecdsa.PrivateKey, method, uri, accessToken, nonce string) (string, error) {
+	htu, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("could not parse request URI: %v", err)
+	}
+	// The htu claim excludes the query and fragment
+	htu.RawQuery = ""
+	htu.Fragment = ""
+
+	jti, err := encryption.Nonce(32)
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"jti": base64.RawURLEncoding.EncodeToString(jti),
+		"htm": method,
+		"htu": htu.String(),
+		"iat": time.Now().Unix(),
+	}
+	if accessToken != "" {
+		claims["ath"] = tokenHash(accessToken)
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	jwk, err := publicJWK(key)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = proofType
+	token.Header["jwk"] = jwk
+	return token.SignedString(key)
+}
+
+// Thumbprint returns the JWK thumbprint (RFC 7638) of the key's public key.
+// This is the value of the `jkt` confirmation claim of a DPoP-bound token.
+func Thumbprint(key *ecdsa.PrivateKey) (string, error) {
+	jwk, err := publicJWK(key)
+	if err != nil {
+		return "", err
+	}
+	// Members in lexicographic order as required by RFC 7638
+	canonical, err := json.Marshal(struct {
+		Crv string `json:"crv"`
+		Kty string `json:"kty"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}{jwk["crv"], jwk["kty"], jwk["x"], jwk["y"]})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// publicJWK encodes the public key of a P-256 key pair as a JWK
+func publicJWK(key *ecdsa.PrivateKey) (map[string]string, error) {
+	ecdhKey, err := key.PublicKey.ECDH()
+	if err != nil {
+		return nil, fmt.Errorf("invalid DPoP key: %v", err)
+	}
+	// The uncompressed point is encoded as 0x04 || X || Y
+	point := ecdhKey.Bytes()
+	return map[string]string{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(point[1:33]),
+		"y":   base64.RawURLEncoding.EncodeToString(point[33:]),
+	}, nil
+}
+
+// tokenHash is the `ath` claim binding a proof to an access token
+func tokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,13 @@
+package dpop
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestDPoPSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "DPoP")
+}
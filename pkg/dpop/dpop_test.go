@@ -0,0 +1,124 @@
+package dpop
+
+import (
+	"context"
+	"crypto/ecdsa"
+
+	"github.com/golang-jwt/jwt/v5"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DPoP", func() {
+	var key *ecdsa.PrivateKey
+
+	BeforeEach(func() {
+		var err error
+		key, err = GenerateKey()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	parseProof := func(proof string) (*jwt.Token, jwt.MapClaims) {
+		claims := jwt.MapClaims{}
+		token, err := jwt.ParseWithClaims(proof, claims, func(*jwt.Token) (interface{}, error) {
+			return &key.PublicKey, nil
+		}, jwt.WithValidMethods([]string{"ES256"}))
+		Expect(err).ToNot(HaveOccurred())
+		return token, claims
+	}
+
+	It("round trips a marshalled key", func() {
+		der, err := MarshalKey(key)
+		Expect(err).ToNot(HaveOccurred())
+
+		parsed, err := ParseKey(der)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parsed.Equal(key)).To(BeTrue())
+	})
+
+	Context("NewProof", func() {
+		It("creates a proof for the request", func() {
+			proof, err := NewProof(key, "POST", "https://idp.example.com/token?foo=bar#frag", "", "")
+			Expect(err).ToNot(HaveOccurred())
+
+			token, claims := parseProof(proof)
+			Expect(token.Header["typ"]).To(Equal("dpop+jwt"))
+			Expect(token.Header["jwk"]).To(HaveKeyWithValue("kty", "EC"))
+			Expect(token.Header["jwk"]).To(HaveKeyWithValue("crv", "P-256"))
+			Expect(claims["htm"]).To(Equal("POST"))
+			Expect(claims["htu"]).To(Equal("https://idp.example.com/token"))
+			Expect(claims["jti"]).ToNot(BeEmpty())
+			Expect(claims).To(HaveKey("iat"))
+			Expect(claims).ToNot(HaveKey("ath"))
+			Expect(claims).ToNot(HaveKey("nonce"))
+		})
+
+		It("binds the proof to an access token and nonce", func() {
+			proof, err := NewProof(key, "GET", "https://api.example.com/", "access-token", "server-nonce")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, claims := parseProof(proof)
+			// base64url(sha256("access-token"))
+			Expect(claims["ath"]).To(Equal(tokenHash("access-token")))
+			Expect(claims["ath"]).To(HaveLen(43))
+			Expect(claims["nonce"]).To(Equal("server-nonce"))
+		})
+
+		It("uses a unique jti for each proof", func() {
+			first, err := NewProof(key, "GET", "https://api.example.com/", "", "")
+			Expect(err).ToNot(HaveOccurred())
+			second, err := NewProof(key, "GET", "https://api.example.com/", "", "")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, firstClaims := parseProof(first)
+			_, secondClaims := parseProof(second)
+			Expect(firstClaims["jti"]).ToNot(Equal(secondClaims["jti"]))
+		})
+	})
+
+	Context("Thumbprint", func() {
+		It("is stable for a key", func() {
+			first, err := Thumbprint(key)
+			Expect(err).ToNot(HaveOccurred())
+			second, err := Thumbprint(key)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(first).To(Equal(second))
+			Expect(first).To(HaveLen(43))
+		})
+
+		It("differs between keys", func() {
+			other, err := GenerateKey()
+			Expect(err).ToNot(HaveOccurred())
+
+			first, err := Thumbprint(key)
+			Expect(err).ToNot(HaveOccurred())
+			second, err := Thumbprint(other)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(first).ToNot(Equal(second))
+		})
+	})
+
+	Context("ContextForSession", func() {
+		It("returns the context unchanged for sessions without a key", func() {
+			ctx, err := ContextForSession(context.Background(), &sessionsapi.SessionState{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(KeyFromContext(ctx)).To(BeNil())
+		})
+
+		It("adds the session's key to the context", func() {
+			der, err := MarshalKey(key)
+			Expect(err).ToNot(HaveOccurred())
+
+			ctx, err := ContextForSession(context.Background(), &sessionsapi.SessionState{DPoPKey: der})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(KeyFromContext(ctx).Equal(key)).To(BeTrue())
+		})
+
+		It("returns an error for an invalid key", func() {
+			_, err := ContextForSession(context.Background(), &sessionsapi.SessionState{DPoPKey: []byte("invalid")})
+			Expect(err).To(MatchError(ContainSubstring("could not parse session DPoP key")))
+		})
+	})
+})
@@ -0,0 +1,159 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// envelopeMagic prefixes all values encrypted by the envelope cipher so that
+// they can be distinguished from values encrypted with the legacy ciphers
+var envelopeMagic = []byte("oek1")
+
+const (
+	// envelopeDataKeySize is the size of the per value AES-256 data key
+	envelopeDataKeySize = 32
+
+	// fileKeyIDSize is the size of the KEK fingerprint prepended to
+	// wrapped data keys by the file key wrapper
+	fileKeyIDSize = 8
+
+	// gcmOverhead is the size of the nonce and tag added by the GCM cipher
+	gcmOverhead = 12 + 16
+)
+
+// KeyWrapper wraps and unwraps data keys using a key encryption key (KEK)
+// held by an external key service. The KEK itself never leaves the service.
+type KeyWrapper interface {
+	WrapKey(dataKey []byte) ([]byte, error)
+	UnwrapKey(wrappedKey []byte) ([]byte, error)
+}
+
+type envelopeCipher struct {
+	wrapper KeyWrapper
+}
+
+// NewEnvelopeCipher returns a Cipher that encrypts each value with a fresh
+// AES-GCM data key and stores the data key, wrapped by the KeyWrapper,
+// alongside the ciphertext
+func NewEnvelopeCipher(wrapper KeyWrapper) Cipher {
+	return &envelopeCipher{wrapper: wrapper}
+}
+
+// IsEnvelope reports whether the ciphertext was produced by an envelope cipher
+func IsEnvelope(ciphertext []byte) bool {
+	return bytes.HasPrefix(ciphertext, envelopeMagic)
+}
+
+// Encrypt with a new data key wrapped by the KeyWrapper
+func (c *envelopeCipher) Encrypt(value []byte) ([]byte, error) {
+	dataKey := make([]byte, envelopeDataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, fmt.Errorf("failed to create data key: %v", err)
+	}
+
+	wrappedKey, err := c.wrapper.WrapKey(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %v", err)
+	}
+	if len(wrappedKey) > 0xffff {
+		return nil, fmt.Errorf("wrapped data key is too large: %d bytes", len(wrappedKey))
+	}
+
+	gcm, err := NewGCMCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := gcm.Encrypt(value)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext := make([]byte, 0, len(envelopeMagic)+2+len(wrappedKey)+len(encrypted))
+	ciphertext = append(ciphertext, envelopeMagic...)
+	ciphertext = binary.BigEndian.AppendUint16(ciphertext, uint16(len(wrappedKey)))
+	ciphertext = append(ciphertext, wrappedKey...)
+	return append(ciphertext, encrypted...), nil
+}
+
+// Decrypt an envelope ciphertext by unwrapping its data key
+func (c *envelopeCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	if !IsEnvelope(ciphertext) {
+		return nil, errors.New("value is not envelope encrypted")
+	}
+	ciphertext = ciphertext[len(envelopeMagic):]
+
+	if len(ciphertext) < 2 {
+		return nil, errors.New("envelope is missing the wrapped data key")
+	}
+	keyLen := int(binary.BigEndian.Uint16(ciphertext))
+	ciphertext = ciphertext[2:]
+	if len(ciphertext) < keyLen+gcmOverhead {
+		return nil, errors.New("envelope is too short")
+	}
+
+	dataKey, err := c.wrapper.UnwrapKey(ciphertext[:keyLen])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %v", err)
+	}
+
+	gcm, err := NewGCMCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Decrypt(ciphertext[keyLen:])
+}
+
+type fileKeyWrapper struct {
+	keyID []byte
+	kek   Cipher
+}
+
+// NewFileKeyWrapper returns a KeyWrapper that wraps data keys with a local
+// AES-GCM KEK read from a file. The file should contain a 16, 24 or 32 byte
+// key, optionally base64 encoded. This is intended for testing and for
+// deployments where the file is provided by an external secret store.
+func NewFileKeyWrapper(path string) (KeyWrapper, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read key encryption key file: %v", err)
+	}
+
+	kek := SecretBytes(strings.TrimSpace(string(data)))
+	c, err := NewGCMCipher(kek)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key encryption key: %v", err)
+	}
+
+	fingerprint := sha256.Sum256(kek)
+	return &fileKeyWrapper{
+		keyID: fingerprint[:fileKeyIDSize],
+		kek:   c,
+	}, nil
+}
+
+// WrapKey encrypts the data key with the KEK, prefixed with the KEK's ID
+func (w *fileKeyWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	wrapped, err := w.kek.Encrypt(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, w.keyID...), wrapped...), nil
+}
+
+// UnwrapKey decrypts a data key previously wrapped with the same KEK
+func (w *fileKeyWrapper) UnwrapKey(wrappedKey []byte) ([]byte, error) {
+	if len(wrappedKey) < fileKeyIDSize+gcmOverhead {
+		return nil, errors.New("wrapped key is too short")
+	}
+	if !bytes.Equal(wrappedKey[:fileKeyIDSize], w.keyID) {
+		return nil, errors.New("data key was wrapped with a different key encryption key")
+	}
+	return w.kek.Decrypt(wrappedKey[fileKeyIDSize:])
+}
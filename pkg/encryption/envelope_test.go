@@ -0,0 +1,70 @@
+package encryption
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeKEKFile(t *testing.T, kek string) string {
+	path := filepath.Join(t.TempDir(), "kek")
+	if err := os.WriteFile(path, []byte(kek+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEnvelopeEncryptAndDecrypt(t *testing.T) {
+	wrapper, err := NewFileKeyWrapper(writeKEKFile(t, "A3Xbr6fu6Al0HkgrP1ztjb-mYiwmxgNPP-XbNsz1WBk="))
+	assert.NoError(t, err)
+	c := NewEnvelopeCipher(wrapper)
+
+	value := []byte("my session")
+	encrypted, err := c.Encrypt(value)
+	assert.NoError(t, err)
+	assert.True(t, IsEnvelope(encrypted))
+	assert.NotContains(t, string(encrypted), string(value))
+
+	// Each value is encrypted with a fresh data key
+	encrypted2, err := c.Encrypt(value)
+	assert.NoError(t, err)
+	assert.NotEqual(t, encrypted, encrypted2)
+
+	decrypted, err := c.Decrypt(encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, value, decrypted)
+}
+
+func TestEnvelopeDecryptErrors(t *testing.T) {
+	wrapper, err := NewFileKeyWrapper(writeKEKFile(t, "0123456789abcdefghijklmnopqrstuv"))
+	assert.NoError(t, err)
+	otherWrapper, err := NewFileKeyWrapper(writeKEKFile(t, "vutsrqponmlkjihgfedcba9876543210"))
+	assert.NoError(t, err)
+
+	encrypted, err := NewEnvelopeCipher(wrapper).Encrypt([]byte("my session"))
+	assert.NoError(t, err)
+
+	_, err = NewEnvelopeCipher(otherWrapper).Decrypt(encrypted)
+	assert.EqualError(t, err, "failed to unwrap data key: data key was wrapped with a different key encryption key")
+
+	_, err = NewEnvelopeCipher(wrapper).Decrypt([]byte("not an envelope"))
+	assert.EqualError(t, err, "value is not envelope encrypted")
+
+	_, err = NewEnvelopeCipher(wrapper).Decrypt(encrypted[:len(encrypted)-40])
+	assert.EqualError(t, err, "envelope is too short")
+
+	tampered := append([]byte{}, encrypted...)
+	tampered[len(tampered)-1] ^= 0xff
+	_, err = NewEnvelopeCipher(wrapper).Decrypt(tampered)
+	assert.Error(t, err)
+}
+
+func TestNewFileKeyWrapperErrors(t *testing.T) {
+	_, err := NewFileKeyWrapper(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+
+	_, err = NewFileKeyWrapper(writeKEKFile(t, "too-short"))
+	assert.EqualError(t, err, "invalid key encryption key: crypto/aes: invalid key size 9")
+}
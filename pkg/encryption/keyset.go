@@ -0,0 +1,78 @@
+package encryption
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Keyset is an ordered list of secrets used to sign and encrypt cookies.
+// The first secret is the primary secret, used for all new values.
+// The remaining secrets are only used to validate and decrypt existing
+// values so that secrets can be rotated without invalidating every cookie.
+type Keyset struct {
+	secrets []string
+	rwm     sync.RWMutex
+}
+
+// NewKeyset creates a keyset from the secrets given, ignoring empty secrets.
+func NewKeyset(secrets ...string) *Keyset {
+	k := &Keyset{}
+	k.setSecrets(secrets)
+	return k
+}
+
+// Update replaces the secrets of the keyset, eg. after a keyset file has
+// been reloaded.
+func (k *Keyset) Update(secrets []string) {
+	k.setSecrets(secrets)
+}
+
+// Primary returns the secret used to sign and encrypt new values.
+func (k *Keyset) Primary() string {
+	k.rwm.RLock()
+	defer k.rwm.RUnlock()
+
+	if len(k.secrets) == 0 {
+		return ""
+	}
+	return k.secrets[0]
+}
+
+// Secrets returns all secrets in the keyset, starting with the primary.
+func (k *Keyset) Secrets() []string {
+	k.rwm.RLock()
+	defer k.rwm.RUnlock()
+
+	return append([]string{}, k.secrets...)
+}
+
+// SignedValue signs the value with the primary secret.
+func (k *Keyset) SignedValue(key string, value []byte, now time.Time) (string, error) {
+	return SignedValue(k.Primary(), key, value, now)
+}
+
+// Validate checks the cookie signature against each secret in the keyset.
+// The secret that signed the cookie is returned so that the value can be
+// decrypted with the matching cipher.
+func (k *Keyset) Validate(cookie *http.Cookie, expiration time.Duration) (value []byte, t time.Time, secret string, ok bool) {
+	for _, secret := range k.Secrets() {
+		if value, t, ok := Validate(cookie, secret, expiration); ok {
+			return value, t, secret, true
+		}
+	}
+	return nil, time.Time{}, "", false
+}
+
+func (k *Keyset) setSecrets(secrets []string) {
+	filtered := []string{}
+	for _, secret := range secrets {
+		if secret != "" {
+			filtered = append(filtered, secret)
+		}
+	}
+
+	k.rwm.Lock()
+	defer k.rwm.Unlock()
+	k.secrets = filtered
+}
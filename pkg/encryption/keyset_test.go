@@ -0,0 +1,40 @@
+package encryption
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeysetSignAndValidate(t *testing.T) {
+	const name = "_oauth2_proxy"
+	now := time.Now()
+
+	oldKeyset := NewKeyset("old-secret")
+	oldValue, err := oldKeyset.SignedValue(name, []byte("value"), now)
+	assert.NoError(t, err)
+
+	keyset := NewKeyset("new-secret", "", "old-secret")
+	assert.Equal(t, "new-secret", keyset.Primary())
+	assert.Equal(t, []string{"new-secret", "old-secret"}, keyset.Secrets())
+
+	// Cookies signed with a previous secret are still valid
+	value, _, secret, ok := keyset.Validate(&http.Cookie{Name: name, Value: oldValue}, time.Hour)
+	assert.True(t, ok)
+	assert.Equal(t, "old-secret", secret)
+	assert.Equal(t, []byte("value"), value)
+
+	// New values are signed with the primary secret
+	newValue, err := keyset.SignedValue(name, []byte("value"), now)
+	assert.NoError(t, err)
+	_, _, secret, ok = keyset.Validate(&http.Cookie{Name: name, Value: newValue}, time.Hour)
+	assert.True(t, ok)
+	assert.Equal(t, "new-secret", secret)
+
+	// Once the old secret is removed, old cookies are no longer valid
+	keyset.Update([]string{"new-secret"})
+	_, _, _, ok = keyset.Validate(&http.Cookie{Name: name, Value: oldValue}, time.Hour)
+	assert.False(t, ok)
+}
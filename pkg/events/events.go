@@ -0,0 +1,122 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	ipapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/ip"
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+// Type identifies the kind of session event
+type Type string
+
+const (
+	// Login is emitted when a user logs in and a new session is created
+	Login Type = "login"
+
+	// Refresh is emitted when a session's tokens are refreshed
+	Refresh Type = "refresh"
+
+	// RefreshFailure is emitted when refreshing a session's tokens fails
+	RefreshFailure Type = "refresh_failure"
+
+	// Logout is emitted when a user signs out
+	Logout Type = "logout"
+
+	// AuthorizationDenied is emitted when an authenticated user is not
+	// authorized
+	AuthorizationDenied Type = "authorization_denied"
+
+	// SessionExpired is emitted when a session is removed because it expired
+	SessionExpired Type = "session_expired"
+
+	// SessionBindingMismatch is emitted when a session is used by a client
+	// other than the one it is bound to
+	SessionBindingMismatch Type = "session_binding_mismatch"
+)
+
+// Event is a structured record of a change to a user's session
+type Event struct {
+	Type      Type      `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	User      string    `json:"user,omitempty"`
+	Email     string    `json:"email,omitempty"`
+	Provider  string    `json:"provider,omitempty"`
+	ClientIP  string    `json:"clientIP,omitempty"`
+	RequestID string    `json:"requestID,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// Sink receives session events, for example to export them to a SIEM
+type Sink interface {
+	Send(Event) error
+	Close() error
+}
+
+// Dispatcher builds session events and sends them to all of its sinks.
+// A nil Dispatcher discards all events.
+type Dispatcher struct {
+	provider       string
+	clientIPParser ipapi.RealClientIPParser
+	sinks          []Sink
+}
+
+// NewDispatcher creates a Dispatcher for the named provider. The parser is
+// used to determine the client IP of each event.
+func NewDispatcher(provider string, clientIPParser ipapi.RealClientIPParser, sinks ...Sink) *Dispatcher {
+	return &Dispatcher{
+		provider:       provider,
+		clientIPParser: clientIPParser,
+		sinks:          sinks,
+	}
+}
+
+// Emit builds an event of the given type for the request and session and
+// sends it to every sink. Sink errors are logged and never fail the request.
+func (d *Dispatcher) Emit(req *http.Request, eventType Type, session *sessionsapi.SessionState, format string, a ...interface{}) {
+	if d == nil || len(d.sinks) == 0 {
+		return
+	}
+
+	event := Event{
+		Type:      eventType,
+		Timestamp: time.Now().UTC(),
+		Provider:  d.provider,
+		ClientIP:  ip.GetClientString(d.clientIPParser, req, false),
+		Message:   fmt.Sprintf(format, a...),
+	}
+	if scope := middlewareapi.GetRequestScope(req); scope != nil {
+		event.RequestID = scope.RequestID
+	}
+	if session != nil {
+		event.User = session.User
+		event.Email = session.Email
+	}
+
+	for _, sink := range d.sinks {
+		if err := sink.Send(event); err != nil {
+			logger.Errorf("Error sending %s session event: %v", eventType, err)
+		}
+	}
+}
+
+// Close closes all of the sinks, flushing any queued events
+func (d *Dispatcher) Close() error {
+	if d == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, sink := range d.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,88 @@
+package events
+
+import (
+	"errors"
+	"net/http/httptest"
+	"sync"
+
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeSink struct {
+	mu      sync.Mutex
+	events  []Event
+	sendErr error
+	closed  bool
+}
+
+func (s *fakeSink) Send(event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return s.sendErr
+}
+
+func (s *fakeSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+var _ = Describe("Dispatcher", func() {
+	It("sends events describing the request and session to every sink", func() {
+		parser, err := ip.GetRealClientIPParser("X-Real-IP", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		failing := &fakeSink{sendErr: errors.New("unavailable")}
+		sink := &fakeSink{}
+		dispatcher := NewDispatcher("Google", parser, failing, sink)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Real-IP", "10.0.0.1")
+		req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{RequestID: "request-1"})
+		session := &sessionsapi.SessionState{User: "jdoe", Email: "jdoe@example.com"}
+
+		dispatcher.Emit(req, Logout, session, "Signed out %s", "jdoe")
+
+		Expect(failing.events).To(HaveLen(1))
+		Expect(sink.events).To(HaveLen(1))
+		event := sink.events[0]
+		Expect(event.Type).To(Equal(Logout))
+		Expect(event.Timestamp).ToNot(BeZero())
+		Expect(event.User).To(Equal("jdoe"))
+		Expect(event.Email).To(Equal("jdoe@example.com"))
+		Expect(event.Provider).To(Equal("Google"))
+		Expect(event.ClientIP).To(Equal("10.0.0.1"))
+		Expect(event.RequestID).To(Equal("request-1"))
+		Expect(event.Message).To(Equal("Signed out jdoe"))
+	})
+
+	It("sends events without a session", func() {
+		sink := &fakeSink{}
+		dispatcher := NewDispatcher("Google", nil, sink)
+
+		dispatcher.Emit(httptest.NewRequest("GET", "/", nil), AuthorizationDenied, nil, "Denied")
+
+		Expect(sink.events).To(HaveLen(1))
+		Expect(sink.events[0].User).To(BeEmpty())
+		Expect(sink.events[0].ClientIP).To(Equal("192.0.2.1"))
+	})
+
+	It("closes every sink", func() {
+		sinks := []*fakeSink{{}, {}}
+		dispatcher := NewDispatcher("Google", nil, sinks[0], sinks[1])
+
+		Expect(dispatcher.Close()).To(Succeed())
+		Expect(sinks[0].closed).To(BeTrue())
+		Expect(sinks[1].closed).To(BeTrue())
+	})
+
+	It("discards events when nil", func() {
+		var dispatcher *Dispatcher
+		dispatcher.Emit(httptest.NewRequest("GET", "/", nil), Login, nil, "Login")
+		Expect(dispatcher.Close()).To(Succeed())
+	})
+})
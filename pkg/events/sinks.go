@@ -0,0 +1,40 @@
+package events
+
+import (
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+)
+
+// NewSinks creates the session event sinks enabled in the options
+func NewSinks(opts options.SessionEvents) ([]Sink, error) {
+	sinks := []Sink{}
+
+	if opts.File != "" {
+		sink, err := NewFileSink(opts.File)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if opts.Syslog {
+		sink, err := NewSyslogSink(opts.SyslogAddress)
+		if err != nil {
+			closeSinks(sinks)
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if opts.WebhookURL != "" {
+		sinks = append(sinks, NewWebhookSink(opts.WebhookURL, opts.WebhookQueueSize, opts.WebhookMaxRetries))
+	}
+
+	return sinks, nil
+}
+
+// closeSinks closes sinks that were created before a later sink failed
+func closeSinks(sinks []Sink) {
+	for _, sink := range sinks {
+		_ = sink.Close()
+	}
+}
@@ -0,0 +1,141 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sinks", func() {
+	event := Event{
+		Type:     Login,
+		User:     "jdoe",
+		Email:    "jdoe@example.com",
+		Provider: "Google",
+		Message:  "Logged in",
+	}
+
+	Context("File", func() {
+		It("appends events as JSON lines", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "events.log")
+
+			sink, err := NewFileSink(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sink.Send(event)).To(Succeed())
+			Expect(sink.Send(Event{Type: Logout})).To(Succeed())
+			Expect(sink.Close()).To(Succeed())
+
+			data, err := os.ReadFile(path)
+			Expect(err).ToNot(HaveOccurred())
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			Expect(lines).To(HaveLen(2))
+
+			var written Event
+			Expect(json.Unmarshal([]byte(lines[0]), &written)).To(Succeed())
+			Expect(written).To(Equal(event))
+			Expect(lines[1]).To(Equal(`{"type":"logout","timestamp":"0001-01-01T00:00:00Z"}`))
+
+			info, err := os.Stat(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+	})
+
+	Context("Webhook", func() {
+		var (
+			mu       sync.Mutex
+			attempts int
+			bodies   []string
+			failures int
+			server   *httptest.Server
+		)
+
+		BeforeEach(func() {
+			attempts, bodies, failures = 0, nil, 0
+			server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				attempts++
+				if attempts <= failures {
+					rw.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				body, _ := io.ReadAll(req.Body)
+				bodies = append(bodies, string(body))
+				rw.WriteHeader(http.StatusAccepted)
+			}))
+			DeferCleanup(server.Close)
+		})
+
+		It("posts events as JSON", func() {
+			sink := newWebhookSink(server.URL, 10, 0, time.Millisecond)
+			Expect(sink.Send(event)).To(Succeed())
+			Expect(sink.Close()).To(Succeed())
+
+			Expect(bodies).To(HaveLen(1))
+			var written Event
+			Expect(json.Unmarshal([]byte(bodies[0]), &written)).To(Succeed())
+			Expect(written).To(Equal(event))
+		})
+
+		It("retries failed deliveries", func() {
+			failures = 2
+			sink := newWebhookSink(server.URL, 10, 2, time.Millisecond)
+			Expect(sink.Send(event)).To(Succeed())
+			Expect(sink.Close()).To(Succeed())
+
+			Expect(attempts).To(Equal(3))
+			Expect(bodies).To(HaveLen(1))
+		})
+
+		It("delivers new events while a failed delivery waits for its retry", func() {
+			failures = 1
+			sink := newWebhookSink(server.URL, 10, 1, 200*time.Millisecond)
+			Expect(sink.Send(event)).To(Succeed())
+			Expect(sink.Send(Event{Type: Logout})).To(Succeed())
+
+			Eventually(func() int {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(bodies)
+			}).Should(Equal(1))
+			Expect(sink.Close()).To(Succeed())
+
+			Expect(attempts).To(Equal(3))
+			Expect(bodies).To(HaveLen(2))
+			Expect(bodies[0]).To(Equal(`{"type":"logout","timestamp":"0001-01-01T00:00:00Z"}`))
+		})
+
+		It("gives up after the maximum retries", func() {
+			failures = 5
+			sink := newWebhookSink(server.URL, 10, 1, time.Millisecond)
+			Expect(sink.Send(event)).To(Succeed())
+			Expect(sink.Close()).To(Succeed())
+
+			Expect(attempts).To(Equal(2))
+			Expect(bodies).To(BeEmpty())
+		})
+
+		It("drops events when the queue is full", func() {
+			// Build the sink without starting delivery so the queue fills up
+			sink := &webhookSink{queue: make(chan Event, 1)}
+			Expect(sink.Send(event)).To(Succeed())
+			Expect(sink.Send(event)).To(MatchError("webhook queue is full, dropping event"))
+		})
+
+		It("rejects events once closed", func() {
+			sink := newWebhookSink(server.URL, 10, 0, time.Millisecond)
+			Expect(sink.Close()).To(Succeed())
+			Expect(sink.Send(event)).To(MatchError("webhook sink is closed"))
+		})
+	})
+})
@@ -0,0 +1,54 @@
+//go:build !windows && !plan9
+
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net/url"
+)
+
+const syslogTag = "oauth2-proxy"
+
+// syslogSink writes events as JSON to syslog
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+// NewSyslogSink creates a Sink that writes each event as JSON to syslog with
+// the AUTH facility. An empty address uses the local syslog daemon, otherwise
+// the address should be of the form udp://host:port or tcp://host:port.
+func NewSyslogSink(address string) (Sink, error) {
+	network, raddr := "", ""
+	if address != "" {
+		u, err := url.Parse(address)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse syslog address: %v", err)
+		}
+		if u.Scheme != "udp" && u.Scheme != "tcp" {
+			return nil, fmt.Errorf("unsupported syslog network %q: must be udp or tcp", u.Scheme)
+		}
+		network, raddr = u.Scheme, u.Host
+	}
+
+	writer, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_AUTH, syslogTag)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to syslog: %v", err)
+	}
+	return &syslogSink{writer: writer}, nil
+}
+
+// Send writes the event to syslog
+func (s *syslogSink) Send(event Event) error {
+	message, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("could not marshal session event: %v", err)
+	}
+	return s.writer.Info(string(message))
+}
+
+// Close closes the connection to syslog
+func (s *syslogSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,39 @@
+//go:build !windows && !plan9
+
+package events
+
+import (
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Syslog", func() {
+	It("writes events as JSON to a remote syslog server", func() {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(conn.Close)
+
+		sink, err := NewSyslogSink("udp://" + conn.LocalAddr().String())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sink.Send(Event{Type: Logout, User: "jdoe"})).To(Succeed())
+		Expect(sink.Close()).To(Succeed())
+
+		buf := make([]byte, 1024)
+		Expect(conn.SetReadDeadline(time.Now().Add(5 * time.Second))).To(Succeed())
+		n, _, err := conn.ReadFrom(buf)
+		Expect(err).ToNot(HaveOccurred())
+
+		// <facility AUTH (4) * 8 + severity INFO (6)>
+		Expect(string(buf[:n])).To(HavePrefix("<38>"))
+		Expect(string(buf[:n])).To(ContainSubstring(`oauth2-proxy`))
+		Expect(string(buf[:n])).To(HaveSuffix(`{"type":"logout","timestamp":"0001-01-01T00:00:00Z","user":"jdoe"}` + "\n"))
+	})
+
+	It("rejects unsupported networks", func() {
+		_, err := NewSyslogSink("unix:///dev/log")
+		Expect(err).To(MatchError(`unsupported syslog network "unix": must be udp or tcp`))
+	})
+})
@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package events
+
+import "errors"
+
+// NewSyslogSink is not supported on this platform
+func NewSyslogSink(_ string) (Sink, error) {
+	return nil, errors.New("syslog session events are not supported on this platform")
+}
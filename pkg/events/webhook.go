@@ -0,0 +1,197 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+)
+
+const (
+	// webhookTimeout is the timeout for each webhook delivery attempt
+	webhookTimeout = 10 * time.Second
+
+	// webhookRetryDelay is the delay before the first retry of a failed
+	// delivery. It doubles with every retry.
+	webhookRetryDelay = time.Second
+)
+
+// webhookSink posts events as JSON to an HTTP endpoint. Events are queued
+// and delivered in the background so that a slow or unavailable endpoint
+// never delays requests. Failed deliveries wait for their retry in a separate
+// queue, so that retries never hold up the delivery of new events.
+type webhookSink struct {
+	url        string
+	maxRetries int
+	retryDelay time.Duration
+
+	queue  chan Event
+	done   chan struct{}
+	mu     sync.RWMutex
+	closed bool
+}
+
+// webhookDelivery is an event waiting for its next delivery attempt
+type webhookDelivery struct {
+	event   Event
+	body    []byte
+	attempt int
+	next    time.Time
+}
+
+// NewWebhookSink creates a Sink that posts each event to the URL. Up to
+// queueSize events are queued for delivery, and failed deliveries are retried
+// up to maxRetries times with exponential backoff.
+func NewWebhookSink(url string, queueSize int, maxRetries int) Sink {
+	return newWebhookSink(url, queueSize, maxRetries, webhookRetryDelay)
+}
+
+func newWebhookSink(url string, queueSize int, maxRetries int, retryDelay time.Duration) *webhookSink {
+	s := &webhookSink{
+		url:        url,
+		maxRetries: maxRetries,
+		retryDelay: retryDelay,
+		queue:      make(chan Event, queueSize),
+		done:       make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Send queues the event for delivery. It returns an error if the queue is full.
+func (s *webhookSink) Send(event Event) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return errors.New("webhook sink is closed")
+	}
+
+	select {
+	case s.queue <- event:
+		return nil
+	default:
+		return errors.New("webhook queue is full, dropping event")
+	}
+}
+
+// Close stops accepting events and waits for the queued events and pending
+// retries to be delivered
+func (s *webhookSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+	return nil
+}
+
+// run delivers queued events and retries failed deliveries once their
+// backoff has passed, until the queue is closed and no retries are pending.
+// Up to the queue size of deliveries wait for a retry; beyond that, failed
+// deliveries are dropped.
+func (s *webhookSink) run() {
+	defer close(s.done)
+
+	queue := s.queue
+	var retries []*webhookDelivery
+	for queue != nil || len(retries) > 0 {
+		var timer *time.Timer
+		var retryC <-chan time.Time
+		if len(retries) > 0 {
+			timer = time.NewTimer(time.Until(retries[0].next))
+			retryC = timer.C
+		}
+
+		var delivery *webhookDelivery
+		select {
+		case event, ok := <-queue:
+			if !ok {
+				queue = nil
+				break
+			}
+			delivery = &webhookDelivery{event: event}
+		case <-retryC:
+			delivery, retries = retries[0], retries[1:]
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if delivery == nil || !s.deliver(delivery) {
+			continue
+		}
+
+		if len(retries) >= cap(s.queue) {
+			logger.Errorf("Error delivering %s session event to webhook: too many pending retries, dropping event", delivery.event.Type)
+			continue
+		}
+		retries = insertDelivery(retries, delivery)
+	}
+}
+
+// deliver attempts to post the event. It returns true if the delivery failed
+// and should be retried at delivery.next.
+func (s *webhookSink) deliver(delivery *webhookDelivery) bool {
+	if delivery.body == nil {
+		body, err := json.Marshal(delivery.event)
+		if err != nil {
+			logger.Errorf("Error delivering %s session event to webhook: could not marshal session event: %v", delivery.event.Type, err)
+			return false
+		}
+		delivery.body = body
+	}
+
+	err := s.post(delivery.body)
+	if err == nil {
+		return false
+	}
+	if delivery.attempt >= s.maxRetries {
+		logger.Errorf("Error delivering %s session event to webhook: giving up after %d attempts: %v", delivery.event.Type, delivery.attempt+1, err)
+		return false
+	}
+
+	delivery.next = time.Now().Add(s.retryDelay << delivery.attempt)
+	delivery.attempt++
+	return true
+}
+
+// insertDelivery inserts the delivery into the retries, ordered by the time
+// of their next attempt
+func insertDelivery(retries []*webhookDelivery, delivery *webhookDelivery) []*webhookDelivery {
+	i := sort.Search(len(retries), func(i int) bool {
+		return retries[i].next.After(delivery.next)
+	})
+	retries = append(retries, nil)
+	copy(retries[i+1:], retries[i:])
+	retries[i] = delivery
+	return retries
+}
+
+func (s *webhookSink) post(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	result := requests.New(s.url).
+		WithContext(ctx).
+		WithMethod(http.MethodPost).
+		WithBody(bytes.NewReader(body)).
+		SetHeader("Content-Type", "application/json").
+		Do()
+	if result.Error() != nil {
+		return result.Error()
+	}
+	if result.StatusCode() < 200 || result.StatusCode() > 299 {
+		return fmt.Errorf("unexpected status code %d", result.StatusCode())
+	}
+	return nil
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options/util"
 	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/proxyjwt"
 )
 
 type Injector interface {
@@ -24,11 +26,13 @@ func (i injector) Inject(header http.Header, session *sessionsapi.SessionState)
 	}
 }
 
-func NewInjector(headers []options.Header) (Injector, error) {
+// NewInjector builds an Injector for the headers. The signer mints the tokens
+// of proxyJWT header values and may be nil if no header uses one.
+func NewInjector(headers []options.Header, signer *proxyjwt.Signer) (Injector, error) {
 	injectors := []valueInjector{}
 	for _, header := range headers {
 		for _, value := range header.Values {
-			injector, err := newValueinjector(header.Name, value)
+			injector, err := newValueinjector(header.Name, value, signer)
 			if err != nil {
 				return nil, fmt.Errorf("error building injector for header %q: %v", header.Name, err)
 			}
@@ -43,12 +47,14 @@ type valueInjector interface {
 	inject(http.Header, *sessionsapi.SessionState)
 }
 
-func newValueinjector(name string, value options.HeaderValue) (valueInjector, error) {
+func newValueinjector(name string, value options.HeaderValue, signer *proxyjwt.Signer) (valueInjector, error) {
 	switch {
-	case value.SecretSource != nil && value.ClaimSource == nil:
+	case value.SecretSource != nil && value.ClaimSource == nil && value.ProxyJWT == nil:
 		return newSecretInjector(name, value.SecretSource)
-	case value.SecretSource == nil && value.ClaimSource != nil:
+	case value.SecretSource == nil && value.ClaimSource != nil && value.ProxyJWT == nil:
 		return newClaimInjector(name, value.ClaimSource)
+	case value.SecretSource == nil && value.ClaimSource == nil && value.ProxyJWT != nil:
+		return newProxyJWTInjector(name, value.ProxyJWT, signer)
 	default:
 		return nil, fmt.Errorf("header %q value has multiple entries: only one entry per value is allowed", name)
 	}
@@ -116,3 +122,21 @@ func newClaimInjector(name string, source *options.ClaimSource) (valueInjector,
 		}), nil
 	}
 }
+
+func newProxyJWTInjector(name string, source *options.ProxyJWTSource, signer *proxyjwt.Signer) (valueInjector, error) {
+	if signer == nil {
+		return nil, fmt.Errorf("proxy JWT signing is not configured")
+	}
+
+	return newInjectorFunc(func(header http.Header, session *sessionsapi.SessionState) {
+		if session == nil {
+			return
+		}
+		token, err := signer.Sign(session, source.Audience, source.Claims)
+		if err != nil {
+			logger.Errorf("Error signing proxy JWT for header %q: %v", name, err)
+			return
+		}
+		header.Add(name, source.Prefix+token)
+	}), nil
+}
@@ -23,7 +23,7 @@ var _ = Describe("Injector Suite", func() {
 
 		DescribeTable("creates an injector",
 			func(in newInjectorTableInput) {
-				injector, err := NewInjector(in.headers)
+				injector, err := NewInjector(in.headers, nil)
 				if in.expectedErr != nil {
 					Expect(err).To(MatchError(in.expectedErr))
 					Expect(injector).To(BeNil())
@@ -339,6 +339,26 @@ var _ = Describe("Injector Suite", func() {
 				expectedHeaders: nil,
 				expectedErr:     errors.New("error building injector for header \"X-Auth-Request-Authorization\": error loading basicAuthPassword: secret source is invalid: exactly one entry required, specify either value, fromEnv or fromFile"),
 			}),
+			Entry("with a proxyJWT valued header without a signer", newInjectorTableInput{
+				headers: []options.Header{
+					{
+						Name: "X-Proxy-JWT",
+						Values: []options.HeaderValue{
+							{
+								ProxyJWT: &options.ProxyJWTSource{
+									Audience: "upstream",
+								},
+							},
+						},
+					},
+				},
+				initialHeaders: http.Header{
+					"foo": []string{"bar", "baz"},
+				},
+				session:         &sessionsapi.SessionState{},
+				expectedHeaders: nil,
+				expectedErr:     errors.New("error building injector for header \"X-Proxy-JWT\": proxy JWT signing is not configured"),
+			}),
 			Entry("with a mix of configured headers", newInjectorTableInput{
 				headers: []options.Header{
 					{
@@ -1,6 +1,7 @@
 package ip
 
 import (
+	"fmt"
 	"net"
 	"strings"
 )
@@ -37,3 +38,21 @@ func ParseIPNet(s string) *net.IPNet {
 		return ipNet
 	}
 }
+
+// ParseNetSet parses IPs and CIDR ranges into a NetSet. It returns nil if
+// there are none.
+func ParseNetSet(ipStrs []string) (*NetSet, error) {
+	if len(ipStrs) == 0 {
+		return nil, nil
+	}
+
+	set := NewNetSet()
+	for _, ipStr := range ipStrs {
+		ipNet := ParseIPNet(ipStr)
+		if ipNet == nil {
+			return nil, fmt.Errorf("could not parse IP network (%s)", ipStr)
+		}
+		set.AddIPNet(*ipNet)
+	}
+	return set, nil
+}
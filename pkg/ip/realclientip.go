@@ -7,63 +7,205 @@ import (
 	"strings"
 
 	ipapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/ip"
+	requestutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests/util"
 )
 
-func GetRealClientIPParser(headerKey string) (ipapi.RealClientIPParser, error) {
+// GetRealClientIPParser returns the parser for the given header. When
+// trustedProxies is set, the real client IP is only taken from requests sent
+// by a trusted proxy and the proxy chain in the header is walked from the
+// right, skipping trusted proxies. Otherwise all requests are trusted and the
+// first address in the header is used.
+func GetRealClientIPParser(headerKey string, trustedProxies *NetSet) (ipapi.RealClientIPParser, error) {
 	headerKey = http.CanonicalHeaderKey(headerKey)
 
 	switch headerKey {
-	case http.CanonicalHeaderKey("X-Forwarded-For"),
+	case xForwardedFor,
 		http.CanonicalHeaderKey("X-Real-IP"),
 		http.CanonicalHeaderKey("X-ProxyUser-IP"),
 		http.CanonicalHeaderKey("X-Envoy-External-Address"):
-		return &xForwardedForClientIPParser{header: headerKey}, nil
+		return &xForwardedForClientIPParser{header: headerKey, trustedProxies: trustedProxies}, nil
+	case requestutil.Forwarded:
+		return &forwardedClientIPParser{trustedProxies: trustedProxies}, nil
 	}
 
-	// TODO: implement the more standardized but more complex `Forwarded` header.
 	return nil, fmt.Errorf("the http header key (%s) is either invalid or unsupported", headerKey)
 }
 
+const xForwardedFor = "X-Forwarded-For"
+
 type xForwardedForClientIPParser struct {
-	header string
+	header         string
+	trustedProxies *NetSet
 }
 
 // GetRealClientIP obtain the IP address of the end-user (not proxy).
 // Parses headers sharing the format as specified by:
 // * https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/X-Forwarded-For.
-// Returns the `<client>` portion specified in the above document.
+// Returns the `<client>` portion specified in the above document, or the
+// rightmost address that is not a trusted proxy when trusted proxies are set.
 // Additionally, is capable of parsing IPs with the port included, for v4 in the format "<ip>:<port>" and for v6 in the
 // format "[<ip>]:<port>".  With-port and without-port formats are seamlessly supported concurrently.
 func (p xForwardedForClientIPParser) GetRealClientIP(h http.Header) (net.IP, error) {
-	var ipStr string
-	if realIP := h.Get(p.header); realIP != "" {
-		ipStr = realIP
-	} else {
+	values := h.Values(p.header)
+	if len(values) == 0 || values[0] == "" {
 		return nil, nil
 	}
 
 	// Each successive proxy may append itself, comma separated, to the end of the X-Forwarded-for header.
-	// Select only the first IP listed, as it is the client IP recorded by the first proxy.
-	if commaIndex := strings.IndexRune(ipStr, ','); commaIndex != -1 {
-		ipStr = ipStr[:commaIndex]
+	hops := splitHops(values)
+	ips := make([]net.IP, len(hops))
+	for i, hop := range hops {
+		ips[i] = parseHop(hop)
 	}
-	ipStr = strings.TrimSpace(ipStr)
 
-	if ipHost, _, err := net.SplitHostPort(ipStr); err == nil {
-		ipStr = ipHost
+	client := ClientHop(ips, p.trustedProxies)
+	if ips[client] == nil {
+		ipStr := hops[client]
+		if ipHost, _, err := net.SplitHostPort(ipStr); err == nil {
+			ipStr = ipHost
+		}
+		return nil, fmt.Errorf("unable to parse ip (%s) from %s header", ipStr, http.CanonicalHeaderKey(p.header))
 	}
+	return ips[client], nil
+}
 
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
-		return nil, fmt.Errorf("unable to parse ip (%s) from %s header", ipStr, http.CanonicalHeaderKey(p.header))
+func (p xForwardedForClientIPParser) trusts(req *http.Request) bool {
+	return IsTrustedProxy(p.trustedProxies, req)
+}
+
+type forwardedClientIPParser struct {
+	trustedProxies *NetSet
+}
+
+// GetRealClientIP obtains the IP address of the end-user from the `for`
+// parameter of the RFC 7239 `Forwarded` header element selected by
+// GetForwardedClient. Obfuscated identifiers, `unknown` and elements without
+// a `for` parameter have no IP address.
+func (p forwardedClientIPParser) GetRealClientIP(h http.Header) (net.IP, error) {
+	client := GetForwardedClient(h, p.trustedProxies)
+	if client == nil || client.For == "" {
+		return nil, nil
 	}
 
+	ip := parseHop(client.For)
+	if ip == nil && client.For != "unknown" && !strings.HasPrefix(client.For, "_") {
+		return nil, fmt.Errorf("unable to parse ip (%s) from %s header", client.For, requestutil.Forwarded)
+	}
 	return ip, nil
 }
 
+func (p forwardedClientIPParser) trusts(req *http.Request) bool {
+	return IsTrustedProxy(p.trustedProxies, req)
+}
+
+// GetForwardedClient returns the element of the `Forwarded` header that
+// describes the request sent by the client: the first element, or the element
+// of the rightmost address that is not a trusted proxy when trusted proxies
+// are set. It returns nil if the header is not present.
+func GetForwardedClient(h http.Header, trustedProxies *NetSet) *requestutil.ForwardedElement {
+	elements := requestutil.ParseForwarded(h)
+	if len(elements) == 0 {
+		return nil
+	}
+
+	ips := make([]net.IP, len(elements))
+	for i, e := range elements {
+		ips[i] = parseHop(e.For)
+	}
+	return &elements[ClientHop(ips, trustedProxies)]
+}
+
+// GetXForwardedValue returns the value of an `X-Forwarded-*` header, such as
+// `X-Forwarded-Host`, set for the request sent by the client: the first value,
+// or when trusted proxies are set the value of the client hop of the
+// `X-Forwarded-For` chain selected by ClientHop. Each trusted proxy skipped in
+// that chain skips a value from the right, so that clients cannot choose the
+// value by adding their own. It returns an empty string if the header is not
+// present.
+func GetXForwardedValue(h http.Header, header string, trustedProxies *NetSet) string {
+	values := splitHops(h.Values(header))
+	if len(values) == 0 {
+		return ""
+	}
+	if trustedProxies == nil {
+		return values[0]
+	}
+
+	trustedHops := 0
+	if hops := splitHops(h.Values(xForwardedFor)); len(hops) > 0 {
+		ips := make([]net.IP, len(hops))
+		for i, hop := range hops {
+			ips[i] = parseHop(hop)
+		}
+		trustedHops = len(hops) - 1 - ClientHop(ips, trustedProxies)
+	}
+	// Proxies that overwrite the header rather than append to it leave fewer
+	// values than hops, the leftmost value is then the closest to the client
+	return values[max(len(values)-1-trustedHops, 0)]
+}
+
+// splitHops splits the comma separated values of a header listing a proxy
+// chain into its hops
+func splitHops(values []string) []string {
+	if len(values) == 0 || values[0] == "" {
+		return nil
+	}
+	hops := strings.Split(strings.Join(values, ","), ",")
+	for i, hop := range hops {
+		hops[i] = strings.TrimSpace(hop)
+	}
+	return hops
+}
+
+// parseHop parses the IP address of a hop of a proxy chain, with or without
+// a port. It returns nil if the hop is not an IP address.
+func parseHop(hop string) net.IP {
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		hop = host
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]"))
+}
+
+// ClientHop returns the index of the client in a proxy chain, listed from
+// the original client to the closest proxy. Without trusted proxies, the
+// first hop is the client. Otherwise the chain is walked from the right and
+// the first hop that is not a trusted proxy is the client, so that clients
+// cannot spoof their address by adding hops to the chain.
+func ClientHop(hops []net.IP, trustedProxies *NetSet) int {
+	if trustedProxies == nil {
+		return 0
+	}
+	for i := len(hops) - 1; i > 0; i-- {
+		if hops[i] == nil || !trustedProxies.Has(hops[i]) {
+			return i
+		}
+	}
+	return 0
+}
+
+// IsTrustedProxy checks whether the request was sent by a trusted proxy.
+// Without trusted proxies, all requests are trusted.
+func IsTrustedProxy(trustedProxies *NetSet, req *http.Request) bool {
+	if trustedProxies == nil {
+		return true
+	}
+	remoteIP, err := getRemoteIP(req)
+	return err == nil && trustedProxies.Has(remoteIP)
+}
+
+// trustsRequest checks whether the real client IP headers of the request can
+// be trusted by the parser
+func trustsRequest(p ipapi.RealClientIPParser, req *http.Request) bool {
+	if tp, ok := p.(interface{ trusts(*http.Request) bool }); ok {
+		return tp.trusts(req)
+	}
+	return true
+}
+
 // GetClientIP obtains the perceived end-user IP address from headers if p != nil else from req.RemoteAddr.
+// Headers of requests that were not sent by a trusted proxy are ignored.
 func GetClientIP(p ipapi.RealClientIPParser, req *http.Request) (net.IP, error) {
-	if p != nil {
+	if p != nil && trustsRequest(p, req) {
 		return p.GetRealClientIP(req.Header)
 	}
 	return getRemoteIP(req)
@@ -85,7 +227,7 @@ func getRemoteIP(req *http.Request) (net.IP, error) {
 // GetClientString obtains the human readable string of the remote IP and optionally the real client IP if available
 func GetClientString(p ipapi.RealClientIPParser, req *http.Request, full bool) (s string) {
 	var realClientIPStr string
-	if p != nil {
+	if p != nil && trustsRequest(p, req) {
 		if realClientIP, err := p.GetRealClientIP(req.Header); err == nil && realClientIP != nil {
 			realClientIPStr = realClientIP.String()
 		}
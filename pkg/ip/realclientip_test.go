@@ -12,6 +12,7 @@ import (
 
 func TestGetRealClientIPParser(t *testing.T) {
 	forwardedForType := reflect.TypeOf((*xForwardedForClientIPParser)(nil))
+	forwardedType := reflect.TypeOf((*forwardedClientIPParser)(nil))
 
 	tests := []struct {
 		header     string
@@ -23,12 +24,13 @@ func TestGetRealClientIPParser(t *testing.T) {
 		{"x-proxyuser-ip", "", forwardedForType},
 		{"x-envoy-external-address", "", forwardedForType},
 		{"", "the http header key () is either invalid or unsupported", nil},
-		{"Forwarded", "the http header key (Forwarded) is either invalid or unsupported", nil},
+		{"Forwarded", "", forwardedType},
+		{"forwarded", "", forwardedType},
 		{"2#* @##$$:kd", "the http header key (2#* @##$$:kd) is either invalid or unsupported", nil},
 	}
 
 	for _, test := range tests {
-		p, err := GetRealClientIPParser(test.header)
+		p, err := GetRealClientIPParser(test.header, nil)
 
 		if test.errString == "" {
 			assert.Nil(t, err)
@@ -105,6 +107,152 @@ func TestXForwardedForClientIPParserIgnoresOthers(t *testing.T) {
 	assert.Equal(t, ip, net.ParseIP(expectedIPString))
 }
 
+func TestXForwardedForClientIPParserWithTrustedProxies(t *testing.T) {
+	trustedProxies, err := ParseNetSet([]string{"10.0.0.0/8", "::1"})
+	assert.NoError(t, err)
+	p := &xForwardedForClientIPParser{header: http.CanonicalHeaderKey("X-Forwarded-For"), trustedProxies: trustedProxies}
+
+	tests := []struct {
+		headerValues []string
+		errString    string
+		expectedIP   net.IP
+	}{
+		{[]string{"1.2.3.4"}, "", net.ParseIP("1.2.3.4")},
+		{[]string{"1.2.3.4, 10.0.0.1"}, "", net.ParseIP("1.2.3.4")},
+		{[]string{"6.6.6.6, 1.2.3.4, 10.0.0.2, 10.0.0.1"}, "", net.ParseIP("1.2.3.4")},
+		{[]string{"6.6.6.6, 1.2.3.4", "10.0.0.2, [::1]:1234"}, "", net.ParseIP("1.2.3.4")},
+		{[]string{"10.0.0.3, 10.0.0.2, 10.0.0.1"}, "", net.ParseIP("10.0.0.3")},
+		{[]string{"nil, 1.2.3.4, 10.0.0.1"}, "", net.ParseIP("1.2.3.4")},
+		{[]string{"1.2.3.4, nil, 10.0.0.1"}, "unable to parse ip (nil) from X-Forwarded-For header", nil},
+	}
+
+	for _, test := range tests {
+		h := http.Header{}
+		for _, value := range test.headerValues {
+			h.Add("X-Forwarded-For", value)
+		}
+
+		ip, err := p.GetRealClientIP(h)
+
+		if test.errString == "" {
+			assert.Nil(t, err)
+		} else {
+			assert.NotNil(t, err)
+			assert.Equal(t, test.errString, err.Error())
+		}
+		assert.Equal(t, test.expectedIP, ip)
+	}
+}
+
+func TestForwardedClientIPParser(t *testing.T) {
+	trustedProxies, err := ParseNetSet([]string{"10.0.0.0/8", "2001:db8::/32"})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		headerValue    string
+		trustedProxies *NetSet
+		errString      string
+		expectedIP     net.IP
+	}{
+		{"", nil, "", nil},
+		{"for=192.0.2.60;proto=http;by=203.0.113.43", nil, "", net.ParseIP("192.0.2.60")},
+		{`For="[2001:db8:cafe::17]:4711"`, nil, "", net.ParseIP("2001:db8:cafe::17")},
+		{"for=192.0.2.43, for=198.51.100.17", nil, "", net.ParseIP("192.0.2.43")},
+		{"for=6.6.6.6, for=192.0.2.43, for=10.0.0.2, for=10.0.0.1", trustedProxies, "", net.ParseIP("192.0.2.43")},
+		{`for=192.0.2.43, for="[2001:db8::1]"`, trustedProxies, "", net.ParseIP("192.0.2.43")},
+		{"for=unknown, for=10.0.0.1", trustedProxies, "", nil},
+		{"for=_hidden, for=10.0.0.1", trustedProxies, "", nil},
+		{"proto=https", nil, "", nil},
+		{"for=nil", nil, "unable to parse ip (nil) from Forwarded header", nil},
+	}
+
+	for _, test := range tests {
+		p := &forwardedClientIPParser{trustedProxies: test.trustedProxies}
+		h := http.Header{}
+		h.Add("Forwarded", test.headerValue)
+
+		ip, err := p.GetRealClientIP(h)
+
+		if test.errString == "" {
+			assert.Nil(t, err)
+		} else {
+			assert.NotNil(t, err)
+			assert.Equal(t, test.errString, err.Error())
+		}
+		assert.Equal(t, test.expectedIP, ip)
+	}
+}
+
+func TestGetXForwardedValue(t *testing.T) {
+	trustedProxies, err := ParseNetSet([]string{"10.0.0.0/8"})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		forwardedFor   string
+		forwardedHost  string
+		trustedProxies *NetSet
+		expectedHost   string
+	}{
+		{"", "", nil, ""},
+		{"1.2.3.4, 10.0.0.1", "evil.example.com, app.example.com", nil, "evil.example.com"},
+		{"", "app.example.com", trustedProxies, "app.example.com"},
+		{"1.2.3.4", "evil.example.com, app.example.com", trustedProxies, "app.example.com"},
+		{"1.2.3.4, 10.0.0.1", "evil.example.com, app.example.com, internal", trustedProxies, "app.example.com"},
+		{"6.6.6.6, 1.2.3.4, 10.0.0.2, 10.0.0.1", "evil.example.com, app.example.com, internal, internal", trustedProxies, "app.example.com"},
+		// Trusted proxies that overwrite the header leave a single value
+		{"1.2.3.4, 10.0.0.2, 10.0.0.1", "app.example.com", trustedProxies, "app.example.com"},
+	}
+
+	for _, test := range tests {
+		h := http.Header{}
+		if test.forwardedFor != "" {
+			h.Add("X-Forwarded-For", test.forwardedFor)
+		}
+		if test.forwardedHost != "" {
+			h.Add("X-Forwarded-Host", test.forwardedHost)
+		}
+
+		assert.Equal(t, test.expectedHost, GetXForwardedValue(h, "X-Forwarded-Host", test.trustedProxies))
+	}
+}
+
+func TestGetClientIPWithTrustedProxies(t *testing.T) {
+	trustedProxies, err := ParseNetSet([]string{"10.0.0.0/8"})
+	assert.NoError(t, err)
+	p, err := GetRealClientIPParser("X-Forwarded-For", trustedProxies)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		remoteAddr  string
+		headerValue string
+		expectedIP  net.IP
+	}{
+		{"10.0.0.1:1234", "1.2.3.4", net.ParseIP("1.2.3.4")},
+		{"10.0.0.1:1234", "", nil},
+		// Headers of clients that are not trusted proxies are ignored
+		{"192.0.2.1:1234", "10.0.0.5", net.ParseIP("192.0.2.1")},
+	}
+
+	for _, test := range tests {
+		h := http.Header{}
+		h.Add("X-Forwarded-For", test.headerValue)
+		req := &http.Request{
+			Header:     h,
+			RemoteAddr: test.remoteAddr,
+		}
+
+		ip, err := GetClientIP(p, req)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expectedIP, ip)
+	}
+
+	req := &http.Request{
+		Header:     http.Header{"X-Forwarded-For": []string{"10.0.0.5"}},
+		RemoteAddr: "192.0.2.1:1234",
+	}
+	assert.Equal(t, "192.0.2.1", GetClientString(p, req, true))
+}
+
 func TestGetRemoteIP(t *testing.T) {
 	tests := []struct {
 		remoteAddr string
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/justinas/alice"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apikeys"
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	requestutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests/util"
+)
+
+// APIKeySessionLoaderOptions contains all of the requirements to construct
+// an API key session loader.
+type APIKeySessionLoaderOptions struct {
+	// Stores are searched in order for the key
+	Stores []apikeys.Store
+
+	// Header is the request header the API key is read from
+	Header string
+
+	// QueryParam is the query parameter the API key is read from, if any
+	QueryParam string
+
+	// AuthOnlyPath is the path of the auth only endpoint. Key routes are
+	// matched against the X-Forwarded-Uri of requests to this path when they
+	// are sent by a trusted reverse proxy.
+	AuthOnlyPath string
+}
+
+// NewAPIKeySessionLoader creates a session loader for API keys in a request
+// header or query parameter. The API key is removed from the request so that
+// it is not passed to the upstream.
+func NewAPIKeySessionLoader(opts *APIKeySessionLoaderOptions) alice.Constructor {
+	loader := &apiKeySessionLoader{
+		stores:       opts.Stores,
+		header:       opts.Header,
+		queryParam:   opts.QueryParam,
+		authOnlyPath: opts.AuthOnlyPath,
+		now:          time.Now,
+	}
+	return loader.loadSession
+}
+
+// apiKeySessionLoader is responsible for loading sessions from API keys
+type apiKeySessionLoader struct {
+	stores       []apikeys.Store
+	header       string
+	queryParam   string
+	authOnlyPath string
+	now          func() time.Time
+}
+
+// loadSession attempts to load a session from an API key in the request.
+// If no API key is found, or the key is invalid, no session will be loaded
+// and the request will be passed to the next handler.
+// If a session was loaded by a previous handler, it will not be replaced.
+func (l *apiKeySessionLoader) loadSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		key := l.extractKey(req)
+
+		scope := middlewareapi.GetRequestScope(req)
+		// If scope is nil, this will panic.
+		// A scope should always be injected before this handler is called.
+		if scope.Session != nil || key == "" {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		session, err := l.getAPIKeySession(req, key)
+		if err != nil {
+			logger.PrintAuthf("", req, logger.AuthFailure, "Invalid authentication via API key: %v", err)
+		}
+
+		// Add the session to the scope if it was found
+		scope.Session = session
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// extractKey reads the API key from the request and removes it
+func (l *apiKeySessionLoader) extractKey(req *http.Request) string {
+	key := req.Header.Get(l.header)
+	req.Header.Del(l.header)
+
+	if l.queryParam != "" {
+		query := req.URL.Query()
+		if query.Has(l.queryParam) {
+			if key == "" {
+				key = query.Get(l.queryParam)
+			}
+			query.Del(l.queryParam)
+			req.URL.RawQuery = query.Encode()
+
+			// Upstreams are proxied the RequestURI to keep the path as it
+			// was sent, so the key must be removed from it too.
+			if req.RequestURI != "" {
+				path, _, _ := strings.Cut(req.RequestURI, "?")
+				if req.URL.RawQuery != "" {
+					path += "?" + req.URL.RawQuery
+				}
+				req.RequestURI = path
+			}
+		}
+	}
+	return key
+}
+
+// getAPIKeySession looks up the hash of the API key in the stores and creates
+// a session for the caller the key was issued to.
+func (l *apiKeySessionLoader) getAPIKeySession(req *http.Request, key string) (*sessionsapi.SessionState, error) {
+	hash := apikeys.Hash(key)
+
+	var entry *apikeys.Key
+	for _, store := range l.stores {
+		var err error
+		entry, err = store.Lookup(req.Context(), hash)
+		if errors.Is(err, apikeys.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error looking up key: %v", err)
+		}
+		break
+	}
+	if entry == nil {
+		return nil, errors.New("unknown key")
+	}
+
+	now := l.now()
+	if entry.Expired(now) {
+		return nil, fmt.Errorf("key for user %q expired on %s", entry.User, entry.ExpiresOn.Format(time.RFC3339))
+	}
+	if path := l.requestPath(req); !entry.AllowsPath(path) {
+		return nil, fmt.Errorf("key for user %q is not allowed on path %q", entry.User, path)
+	}
+
+	logger.PrintAuthf(entry.User, req, logger.AuthSuccess, "Authenticated via API key")
+	return &sessionsapi.SessionState{
+		User:      entry.User,
+		Email:     entry.Email,
+		Groups:    entry.Groups,
+		CreatedAt: &now,
+	}, nil
+}
+
+// requestPath returns the path key routes are matched against: the request
+// path, or the path of the X-Forwarded-Uri on the auth only endpoint when the
+// request was sent by a trusted reverse proxy.
+func (l *apiKeySessionLoader) requestPath(req *http.Request) string {
+	if l.authOnlyPath == "" || req.URL.Path != l.authOnlyPath || !requestutil.IsProxied(req) {
+		return req.URL.Path
+	}
+	path, _, _ := strings.Cut(requestutil.GetRequestURI(req), "?")
+	return path
+}
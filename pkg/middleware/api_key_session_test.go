@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apikeys"
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeAPIKeyStore struct {
+	keys map[string]*apikeys.Key
+	err  error
+}
+
+func (f fakeAPIKeyStore) Lookup(_ context.Context, hash string) (*apikeys.Key, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	key, ok := f.keys[hash]
+	if !ok {
+		return nil, apikeys.ErrKeyNotFound
+	}
+	return key, nil
+}
+
+var _ = Describe("API Key Session Suite", func() {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Hour)
+
+	keys := map[string]*apikeys.Key{
+		apikeys.Hash("ci-key"): {
+			User:   "ci",
+			Email:  "ci@example.com",
+			Groups: []string{"deployers"},
+		},
+		apikeys.Hash("expired-key"): {
+			User:      "old",
+			ExpiresOn: &expired,
+		},
+	}
+
+	type apiKeySessionLoaderTableInput struct {
+		stores          []apikeys.Store
+		queryParam      string
+		path            string
+		header          string
+		existingSession *sessionsapi.SessionState
+		expectedSession *sessionsapi.SessionState
+		expectedQuery   string
+	}
+
+	DescribeTable("with an API key",
+		func(in apiKeySessionLoaderTableInput) {
+			scope := &middlewareapi.RequestScope{
+				Session: in.existingSession,
+			}
+
+			path := in.path
+			if path == "" {
+				path = "/"
+			}
+			req := httptest.NewRequest("", path, nil)
+			if in.header != "" {
+				req.Header.Set("X-API-Key", in.header)
+			}
+			req = middlewareapi.AddRequestScope(req, scope)
+
+			stores := in.stores
+			if stores == nil {
+				stores = []apikeys.Store{fakeAPIKeyStore{keys: keys}}
+			}
+			loader := &apiKeySessionLoader{
+				stores:     stores,
+				header:     "X-API-Key",
+				queryParam: in.queryParam,
+				now:        func() time.Time { return now },
+			}
+
+			var gotSession *sessionsapi.SessionState
+			var gotReq *http.Request
+			handler := loader.loadSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotSession = middlewareapi.GetRequestScope(r).Session
+				gotReq = r
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			Expect(gotSession).To(Equal(in.expectedSession))
+			Expect(gotReq.Header.Get("X-API-Key")).To(BeEmpty())
+			Expect(gotReq.URL.RawQuery).To(Equal(in.expectedQuery))
+			Expect(gotReq.RequestURI).To(Equal(gotReq.URL.RequestURI()))
+		},
+		Entry("without a key", apiKeySessionLoaderTableInput{
+			expectedSession: nil,
+		}),
+		Entry("with a valid key in the header", apiKeySessionLoaderTableInput{
+			header: "ci-key",
+			expectedSession: &sessionsapi.SessionState{
+				User:      "ci",
+				Email:     "ci@example.com",
+				Groups:    []string{"deployers"},
+				CreatedAt: &now,
+			},
+		}),
+		Entry("with a valid key and an existing session", apiKeySessionLoaderTableInput{
+			header:          "ci-key",
+			existingSession: &sessionsapi.SessionState{User: "user"},
+			expectedSession: &sessionsapi.SessionState{User: "user"},
+		}),
+		Entry("with a valid key in the query", apiKeySessionLoaderTableInput{
+			queryParam: "api_key",
+			path:       "/?api_key=ci-key&page=2",
+			expectedSession: &sessionsapi.SessionState{
+				User:      "ci",
+				Email:     "ci@example.com",
+				Groups:    []string{"deployers"},
+				CreatedAt: &now,
+			},
+			expectedQuery: "page=2",
+		}),
+		Entry("with a key in the query when the query param is disabled", apiKeySessionLoaderTableInput{
+			path:            "/?api_key=ci-key",
+			expectedSession: nil,
+			expectedQuery:   "api_key=ci-key",
+		}),
+		Entry("with an unknown key", apiKeySessionLoaderTableInput{
+			header:          "unknown-key",
+			expectedSession: nil,
+		}),
+		Entry("with an expired key", apiKeySessionLoaderTableInput{
+			header:          "expired-key",
+			expectedSession: nil,
+		}),
+		Entry("with a key found in a later store", apiKeySessionLoaderTableInput{
+			stores: []apikeys.Store{
+				fakeAPIKeyStore{},
+				fakeAPIKeyStore{keys: keys},
+			},
+			header: "ci-key",
+			expectedSession: &sessionsapi.SessionState{
+				User:      "ci",
+				Email:     "ci@example.com",
+				Groups:    []string{"deployers"},
+				CreatedAt: &now,
+			},
+		}),
+		Entry("with a store error", apiKeySessionLoaderTableInput{
+			stores:          []apikeys.Store{fakeAPIKeyStore{err: errors.New("connection refused")}},
+			header:          "ci-key",
+			expectedSession: nil,
+		}),
+	)
+
+	Context("with a key restricted to routes", func() {
+		var handler http.Handler
+		var gotSession *sessionsapi.SessionState
+
+		BeforeEach(func() {
+			path := filepath.Join(GinkgoT().TempDir(), "api-keys.yaml")
+			Expect(os.WriteFile(path, []byte(fmt.Sprintf("keys:\n- hash: %s\n  user: ci\n  routes: [\"^/api/\"]\n", apikeys.Hash("ci-key"))), 0600)).To(Succeed())
+			store, err := apikeys.NewFileStore(path)
+			Expect(err).ToNot(HaveOccurred())
+
+			handler = NewAPIKeySessionLoader(&APIKeySessionLoaderOptions{
+				Stores:       []apikeys.Store{store},
+				Header:       "X-API-Key",
+				AuthOnlyPath: "/oauth2/auth",
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotSession = middlewareapi.GetRequestScope(r).Session
+			}))
+		})
+
+		DescribeTable("only creates sessions on the allowed routes",
+			func(path string, forwardedURI string, reverseProxy bool, expectSession bool) {
+				req := httptest.NewRequest("", path, nil)
+				req.Header.Set("X-API-Key", "ci-key")
+				if forwardedURI != "" {
+					req.Header.Set("X-Forwarded-Uri", forwardedURI)
+				}
+				req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{ReverseProxy: reverseProxy})
+
+				gotSession = nil
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+				if expectSession {
+					Expect(gotSession).ToNot(BeNil())
+					Expect(gotSession.User).To(Equal("ci"))
+				} else {
+					Expect(gotSession).To(BeNil())
+				}
+			},
+			Entry("on an allowed route", "/api/deploy", "", false, true),
+			Entry("on another route", "/admin", "", false, false),
+			Entry("on another route with an allowed route in the query", "/admin?next=/api/deploy", "", false, false),
+			Entry("on an allowed route forwarded to the auth endpoint", "/oauth2/auth", "/api/deploy?page=2", true, true),
+			Entry("on another route forwarded to the auth endpoint", "/oauth2/auth", "/admin", true, false),
+			Entry("on an allowed route forwarded to the auth endpoint by an untrusted client", "/oauth2/auth", "/api/deploy", false, false),
+			Entry("on another route with a forged X-Forwarded-Uri", "/admin", "/api/deploy", true, false),
+			Entry("on an allowed route with another X-Forwarded-Uri", "/api/deploy", "/admin", true, true),
+		)
+	})
+})
@@ -60,8 +60,9 @@ func loadBasicAuthSession(validator basic.Validator, sessionGroups []string, pre
 }
 
 // getBasicSession attempts to load a basic session from the request.
-// If the credentials in the request exist within the htpasswdMap,
-// a new session will be created.
+// If the validator accepts the credentials in the request, a new session will
+// be created with the static session groups and any groups of the user known
+// to the validator.
 func getBasicSession(validator basic.Validator, sessionGroups []string, req *http.Request) (*sessionsapi.SessionState, error) {
 	auth := req.Header.Get("Authorization")
 	if auth == "" {
@@ -74,13 +75,13 @@ func getBasicSession(validator basic.Validator, sessionGroups []string, req *htt
 		return nil, err
 	}
 
-	if validator.Validate(user, password) {
-		logger.PrintAuthf(user, req, logger.AuthSuccess, "Authenticated via basic auth and HTpasswd File")
+	if valid, groups := basic.Authenticate(validator, user, password); valid {
+		logger.PrintAuthf(user, req, logger.AuthSuccess, "Authenticated via basic auth")
 
-		return &sessionsapi.SessionState{User: user, Groups: sessionGroups}, nil
+		return &sessionsapi.SessionState{User: user, Groups: basic.MergeGroups(sessionGroups, groups)}, nil
 	}
 
-	logger.PrintAuthf(user, req, logger.AuthFailure, "Invalid authentication via basic auth: not in Htpasswd File")
+	logger.PrintAuthf(user, req, logger.AuthFailure, "Invalid authentication via basic auth: credentials rejected")
 	return nil, nil
 }
 
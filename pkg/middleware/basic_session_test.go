@@ -50,6 +50,9 @@ var _ = Describe("Basic Auth Session Suite", func() {
 						user1:     user1Password,
 						user2:     user2Password,
 					},
+					groups: map[string][]string{
+						user2: {"b", "c"},
+					},
 				}
 
 				// Create the handler with a next handler that will capture the session
@@ -105,7 +108,7 @@ var _ = Describe("Basic Auth Session Suite", func() {
 			Entry("Basic Base64(user2:<user2Password>)", basicAuthSessionLoaderTableInput{
 				authorizationHeader: "Basic dXNlcjI6dXMzcjJQNDU1VzBSZCE=",
 				existingSession:     nil,
-				expectedSession:     &sessionsapi.SessionState{User: "user2"},
+				expectedSession:     &sessionsapi.SessionState{User: "user2", Groups: []string{"b", "c"}},
 			}),
 			Entry("Basic Base64(admin:<adminPassword>)", basicAuthSessionLoaderTableInput{
 				authorizationHeader: "Basic YWRtaW46QWRtMW4xc3RyJHQwcg==",
@@ -118,6 +121,12 @@ var _ = Describe("Basic Auth Session Suite", func() {
 				existingSession:     nil,
 				expectedSession:     &sessionsapi.SessionState{User: "admin", Groups: []string{"a", "b"}},
 			}),
+			Entry("Basic with groups from the validator", basicAuthSessionLoaderTableInput{
+				authorizationHeader: "Basic dXNlcjI6dXMzcjJQNDU1VzBSZCE=",
+				sessionGroups:       []string{"a", "b"},
+				existingSession:     nil,
+				expectedSession:     &sessionsapi.SessionState{User: "user2", Groups: []string{"a", "b", "c"}},
+			}),
 			Entry("Basic Base64(user1:<user1Password>) (with PreferEmailToUser)", basicAuthSessionLoaderTableInput{
 				authorizationHeader: "Basic dXNlcjE6VXNFck9uM1A0NTU=",
 				preferEmail:         true,
@@ -129,7 +138,8 @@ var _ = Describe("Basic Auth Session Suite", func() {
 })
 
 type fakeBasicValidator struct {
-	users map[string]string
+	users  map[string]string
+	groups map[string][]string
 }
 
 func (f fakeBasicValidator) Validate(user, password string) bool {
@@ -141,3 +151,10 @@ func (f fakeBasicValidator) Validate(user, password string) bool {
 	}
 	return false
 }
+
+func (f fakeBasicValidator) ValidateGroups(user, password string) (bool, []string) {
+	if !f.Validate(user, password) {
+		return false, nil
+	}
+	return true, f.groups[user]
+}
@@ -9,10 +9,11 @@ import (
 	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/header"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/proxyjwt"
 )
 
-func NewRequestHeaderInjector(headers []options.Header) (alice.Constructor, error) {
-	headerInjector, err := newRequestHeaderInjector(headers)
+func NewRequestHeaderInjector(headers []options.Header, signer *proxyjwt.Signer) (alice.Constructor, error) {
+	headerInjector, err := newRequestHeaderInjector(headers, signer)
 	if err != nil {
 		return nil, fmt.Errorf("error building request header injector: %v", err)
 	}
@@ -59,8 +60,8 @@ func stripHeaders(headers []string, next http.Handler) http.Handler {
 	})
 }
 
-func newRequestHeaderInjector(headers []options.Header) (alice.Constructor, error) {
-	injector, err := header.NewInjector(headers)
+func newRequestHeaderInjector(headers []options.Header, signer *proxyjwt.Signer) (alice.Constructor, error) {
+	injector, err := header.NewInjector(headers, signer)
 	if err != nil {
 		return nil, fmt.Errorf("error building request injector: %v", err)
 	}
@@ -82,8 +83,8 @@ func injectRequestHeaders(injector header.Injector, next http.Handler) http.Hand
 	})
 }
 
-func NewResponseHeaderInjector(headers []options.Header) (alice.Constructor, error) {
-	headerInjector, err := newResponseHeaderInjector(headers)
+func NewResponseHeaderInjector(headers []options.Header, signer *proxyjwt.Signer) (alice.Constructor, error) {
+	headerInjector, err := newResponseHeaderInjector(headers, signer)
 	if err != nil {
 		return nil, fmt.Errorf("error building response header injector: %v", err)
 	}
@@ -91,8 +92,8 @@ func NewResponseHeaderInjector(headers []options.Header) (alice.Constructor, err
 	return headerInjector, nil
 }
 
-func newResponseHeaderInjector(headers []options.Header) (alice.Constructor, error) {
-	injector, err := header.NewInjector(headers)
+func newResponseHeaderInjector(headers []options.Header, signer *proxyjwt.Signer) (alice.Constructor, error) {
+	injector, err := header.NewInjector(headers, signer)
 	if err != nil {
 		return nil, fmt.Errorf("error building response injector: %v", err)
 	}
@@ -37,7 +37,7 @@ var _ = Describe("Headers Suite", func() {
 			// Create the handler with a next handler that will capture the headers
 			// from the request
 			var gotHeaders http.Header
-			injector, err := NewRequestHeaderInjector(in.headers)
+			injector, err := NewRequestHeaderInjector(in.headers, nil)
 			if in.expectedErr != "" {
 				Expect(err).To(MatchError(in.expectedErr))
 				return
@@ -227,7 +227,7 @@ var _ = Describe("Headers Suite", func() {
 			// Create the handler with a next handler that will capture the headers
 			// from the request
 			var gotHeaders http.Header
-			injector, err := NewResponseHeaderInjector(in.headers)
+			injector, err := NewResponseHeaderInjector(in.headers, nil)
 			if in.expectedErr != "" {
 				Expect(err).To(MatchError(in.expectedErr))
 				return
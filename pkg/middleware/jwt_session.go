@@ -16,9 +16,18 @@ import (
 const jwtRegexFormat = `^ey[IJ][a-zA-Z0-9_-]*\.ey[IJ][a-zA-Z0-9_-]*\.[a-zA-Z0-9_-]+$`
 
 func NewJwtSessionLoader(sessionLoaders []middlewareapi.TokenToSessionFunc) alice.Constructor {
+	return NewBearerTokenSessionLoader(sessionLoaders, nil)
+}
+
+// NewBearerTokenSessionLoader creates a session loader for bearer tokens.
+// JWTs are passed to the sessionLoaders and then to the opaqueSessionLoaders,
+// while bearer tokens that are not JWTs are only passed to the
+// opaqueSessionLoaders, e.g. for token introspection.
+func NewBearerTokenSessionLoader(sessionLoaders, opaqueSessionLoaders []middlewareapi.TokenToSessionFunc) alice.Constructor {
 	js := &jwtSessionLoader{
-		jwtRegex:       regexp.MustCompile(jwtRegexFormat),
-		sessionLoaders: sessionLoaders,
+		jwtRegex:             regexp.MustCompile(jwtRegexFormat),
+		sessionLoaders:       sessionLoaders,
+		opaqueSessionLoaders: opaqueSessionLoaders,
 	}
 	return js.loadSession
 }
@@ -28,6 +37,10 @@ func NewJwtSessionLoader(sessionLoaders []middlewareapi.TokenToSessionFunc) alic
 type jwtSessionLoader struct {
 	jwtRegex       *regexp.Regexp
 	sessionLoaders []middlewareapi.TokenToSessionFunc
+
+	// opaqueSessionLoaders load sessions from any bearer token, including
+	// tokens that are not JWTs
+	opaqueSessionLoaders []middlewareapi.TokenToSessionFunc
 }
 
 // loadSession attempts to load a session from a JWT stored in an Authorization
@@ -71,9 +84,14 @@ func (j *jwtSessionLoader) getJwtSession(req *http.Request) (*sessionsapi.Sessio
 		return nil, err
 	}
 
+	loaders := j.opaqueSessionLoaders
+	if j.jwtRegex.MatchString(token) {
+		loaders = append(append([]middlewareapi.TokenToSessionFunc{}, j.sessionLoaders...), j.opaqueSessionLoaders...)
+	}
+
 	// This leading error message only occurs if all session loaders fail
 	errs := []error{errors.New("unable to verify bearer token")}
-	for _, loader := range j.sessionLoaders {
+	for _, loader := range loaders {
 		session, err := loader(req.Context(), token)
 		if err != nil {
 			errs = append(errs, err)
@@ -97,6 +115,11 @@ func (j *jwtSessionLoader) findTokenFromHeader(header string) (string, error) {
 		return token, nil
 	}
 
+	if tokenType == "Bearer" && token != "" && len(j.opaqueSessionLoaders) > 0 {
+		// Found an opaque bearer token which may be introspected
+		return token, nil
+	}
+
 	if tokenType == "Basic" {
 		// Check if we have a Bearer token masquerading in Basic
 		return j.getBasicToken(token)
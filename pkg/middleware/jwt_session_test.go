@@ -65,6 +65,7 @@ Nnc3a3lGVWFCNUMxQnNJcnJMTWxka1dFaHluYmI4Ongtb2F1dGgtYmFzaWM=`
 		IDToken:     verifiedToken,
 		Email:       "john@example.com",
 		User:        "1234567890",
+		Audiences:   []string{"https://test.myapp.com"},
 		ExpiresOn:   &verifiedSessionExpiry,
 	}
 
@@ -247,6 +248,69 @@ Nnc3a3lGVWFCNUMxQnNJcnJMTWxka1dFaHluYmI4Ongtb2F1dGgtYmFzaWM=`
 				expectedSession:     verifiedSession,
 			}),
 		)
+
+		Context("with opaque session loaders", func() {
+			const opaqueToken = "2YotnFZFEjr1zCsicMWpAA"
+			opaqueSession := &sessionsapi.SessionState{User: "service", AccessToken: opaqueToken}
+
+			BeforeEach(func() {
+				j.opaqueSessionLoaders = []middlewareapi.TokenToSessionFunc{
+					func(_ context.Context, token string) (*sessionsapi.SessionState, error) {
+						if token != opaqueToken {
+							return nil, errors.New("token is not active")
+						}
+						return opaqueSession, nil
+					},
+				}
+			})
+
+			DescribeTable("with an authorization header",
+				func(in getJWTSessionTableInput) {
+					req := httptest.NewRequest("", "/", nil)
+					req.Header.Set("Authorization", in.authorizationHeader)
+
+					session, err := j.getJwtSession(req)
+					if in.expectedErr != nil {
+						Expect(err).To(MatchError(in.expectedErr))
+					} else {
+						Expect(err).ToNot(HaveOccurred())
+					}
+					Expect(session).To(Equal(in.expectedSession))
+				},
+				Entry("Bearer <opaqueToken>", getJWTSessionTableInput{
+					authorizationHeader: fmt.Sprintf("Bearer %s", opaqueToken),
+					expectedErr:         nil,
+					expectedSession:     opaqueSession,
+				}),
+				Entry("Bearer abcdef", getJWTSessionTableInput{
+					authorizationHeader: "Bearer abcdef",
+					expectedErr: k8serrors.NewAggregate([]error{
+						errors.New("unable to verify bearer token"),
+						errors.New("token is not active"),
+					}),
+					expectedSession: nil,
+				}),
+				Entry("Bearer <nonVerifiedToken>", getJWTSessionTableInput{
+					authorizationHeader: fmt.Sprintf("Bearer %s", nonVerifiedToken),
+					expectedErr: k8serrors.NewAggregate([]error{
+						errors.New("unable to verify bearer token"),
+						errors.New("oidc: malformed jwt: oidc: malformed jwt payload: illegal base64 data at input byte 8"),
+						errors.New("token is not active"),
+					}),
+					expectedSession: nil,
+				}),
+				Entry("Bearer <verifiedToken>", getJWTSessionTableInput{
+					authorizationHeader: fmt.Sprintf("Bearer %s", verifiedToken),
+					expectedErr:         nil,
+					expectedSession:     verifiedSession,
+				}),
+				Entry("Basic Base64(any-user:<opaqueToken>)", getJWTSessionTableInput{
+					authorizationHeader: fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte("any-user:"+opaqueToken))),
+					expectedErr:         errors.New("invalid basic auth token found in authorization header"),
+					expectedSession:     nil,
+				}),
+			)
+		})
 	})
 
 	Context("findTokenFromHeader", func() {
@@ -398,8 +462,10 @@ Nnc3a3lGVWFCNUMxQnNJcnJMTWxka1dFaHluYmI4Ongtb2F1dGgtYmFzaWM=`
 		notVerified := false
 
 		type idTokenClaims struct {
-			Email    string `json:"email,omitempty"`
-			Verified *bool  `json:"email_verified,omitempty"`
+			Email    string      `json:"email,omitempty"`
+			Verified *bool       `json:"email_verified,omitempty"`
+			Scope    interface{} `json:"scope,omitempty"`
+			Scp      interface{} `json:"scp,omitempty"`
 			jwt.RegisteredClaims
 		}
 
@@ -408,6 +474,7 @@ Nnc3a3lGVWFCNUMxQnNJcnJMTWxka1dFaHluYmI4Ongtb2F1dGgtYmFzaWM=`
 			expectedErr     error
 			expectedUser    string
 			expectedEmail   string
+			expectedScopes  []string
 			expectedExpires *time.Time
 		}
 
@@ -447,6 +514,8 @@ Nnc3a3lGVWFCNUMxQnNJcnJMTWxka1dFaHluYmI4Ongtb2F1dGgtYmFzaWM=`
 				Expect(session.ExpiresOn.Unix()).To(Equal(in.expectedExpires.Unix()))
 				Expect(session.RefreshToken).To(BeEmpty())
 				Expect(session.PreferredUsername).To(BeEmpty())
+				Expect(session.Scopes).To(Equal(in.expectedScopes))
+				Expect(session.Audiences).To(Equal([]string{"asdf1234"}))
 			},
 			Entry("with no email", tokenToSessionTableInput{
 				idToken: idTokenClaims{
@@ -482,6 +551,42 @@ Nnc3a3lGVWFCNUMxQnNJcnJMTWxka1dFaHluYmI4Ongtb2F1dGgtYmFzaWM=`
 				expectedEmail:   "foo@example.com",
 				expectedExpires: &expiresFuture,
 			}),
+			Entry("with a scope claim", tokenToSessionTableInput{
+				idToken: idTokenClaims{
+					RegisteredClaims: jwt.RegisteredClaims{
+						Audience:  jwt.ClaimStrings{"asdf1234"},
+						ExpiresAt: jwt.NewNumericDate(expiresFuture),
+						IssuedAt:  jwt.NewNumericDate(time.Now()),
+						Issuer:    "https://issuer.example.com",
+						NotBefore: jwt.NewNumericDate(time.Time{}),
+						Subject:   "123456789",
+					},
+					Scope: "read:users write:users",
+				},
+				expectedErr:     nil,
+				expectedUser:    "123456789",
+				expectedEmail:   "123456789",
+				expectedScopes:  []string{"read:users", "write:users"},
+				expectedExpires: &expiresFuture,
+			}),
+			Entry("with an scp claim", tokenToSessionTableInput{
+				idToken: idTokenClaims{
+					RegisteredClaims: jwt.RegisteredClaims{
+						Audience:  jwt.ClaimStrings{"asdf1234"},
+						ExpiresAt: jwt.NewNumericDate(expiresFuture),
+						IssuedAt:  jwt.NewNumericDate(time.Now()),
+						Issuer:    "https://issuer.example.com",
+						NotBefore: jwt.NewNumericDate(time.Time{}),
+						Subject:   "123456789",
+					},
+					Scp: []string{"read:users", "write:users"},
+				},
+				expectedErr:     nil,
+				expectedUser:    "123456789",
+				expectedEmail:   "123456789",
+				expectedScopes:  []string{"read:users", "write:users"},
+				expectedExpires: &expiresFuture,
+			}),
 			Entry("with a non-verified email", tokenToSessionTableInput{
 				idToken: idTokenClaims{
 					RegisteredClaims: jwt.RegisteredClaims{
@@ -37,7 +37,9 @@ var _ = Describe("RedirectToHTTPS suite", func() {
 				req.TLS = &tls.ConnectionState{}
 			}
 			scope := &middlewareapi.RequestScope{
-				ReverseProxy: in.reverseProxy,
+				ReverseProxy:   in.reverseProxy,
+				ForwardedHost:  req.Header.Get("X-Forwarded-Host"),
+				ForwardedProto: req.Header.Get("X-Forwarded-Proto"),
 			}
 			req = middlewareapi.AddRequestScope(req, scope)
 
@@ -6,21 +6,46 @@ import (
 	"github.com/google/uuid"
 	"github.com/justinas/alice"
 	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
+	requestutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests/util"
 )
 
-func NewScope(reverseProxy bool, idHeader string) alice.Constructor {
+// NewScope creates the request scope. Forwarding headers are trusted when
+// reverseProxy is set and, if trustedProxies is set, the request was sent by
+// a trusted proxy. The forwarded host and protocol are taken from the
+// `Forwarded` header when it is the realClientIPHeader, and from the
+// `X-Forwarded-Host` and `X-Forwarded-Proto` headers otherwise.
+func NewScope(reverseProxy bool, idHeader string, trustedProxies *ip.NetSet, realClientIPHeader string) alice.Constructor {
+	useForwarded := http.CanonicalHeaderKey(realClientIPHeader) == requestutil.Forwarded
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 			scope := &middlewareapi.RequestScope{
-				ReverseProxy: reverseProxy,
+				ReverseProxy: reverseProxy && ip.IsTrustedProxy(trustedProxies, req),
 				RequestID:    genRequestID(req, idHeader),
 			}
+			if scope.ReverseProxy {
+				setForwarded(scope, req.Header, trustedProxies, useForwarded)
+			}
 			req = middlewareapi.AddRequestScope(req, scope)
 			next.ServeHTTP(rw, req)
 		})
 	}
 }
 
+// setForwarded sets the host and protocol requested by the client according
+// to the trusted forwarding headers
+func setForwarded(scope *middlewareapi.RequestScope, h http.Header, trustedProxies *ip.NetSet, useForwarded bool) {
+	if useForwarded {
+		if forwarded := ip.GetForwardedClient(h, trustedProxies); forwarded != nil {
+			scope.ForwardedHost = forwarded.Host
+			scope.ForwardedProto = forwarded.Proto
+		}
+		return
+	}
+	scope.ForwardedHost = ip.GetXForwardedValue(h, requestutil.XForwardedHost, trustedProxies)
+	scope.ForwardedProto = ip.GetXForwardedValue(h, requestutil.XForwardedProto, trustedProxies)
+}
+
 // genRequestID sets a request-wide ID for use in logging or error pages.
 // If a RequestID header is set, it uses that. Otherwise, it generates a random
 // UUID for the lifespan of the request.
@@ -6,6 +6,7 @@ import (
 
 	"github.com/google/uuid"
 	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -32,7 +33,7 @@ var _ = Describe("Scope Suite", func() {
 
 		Context("ReverseProxy is false", func() {
 			BeforeEach(func() {
-				handler := NewScope(false, testRequestHeader)(
+				handler := NewScope(false, testRequestHeader, nil, "")(
 					http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 						nextRequest = r
 						w.WriteHeader(200)
@@ -61,7 +62,7 @@ var _ = Describe("Scope Suite", func() {
 
 		Context("ReverseProxy is true", func() {
 			BeforeEach(func() {
-				handler := NewScope(true, testRequestHeader)(
+				handler := NewScope(true, testRequestHeader, nil, "")(
 					http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 						nextRequest = r
 						w.WriteHeader(200)
@@ -76,10 +77,56 @@ var _ = Describe("Scope Suite", func() {
 			})
 		})
 
+		Context("ReverseProxy is true with trusted proxies", func() {
+			var trustedProxies *ip.NetSet
+
+			BeforeEach(func() {
+				var err error
+				trustedProxies, err = ip.ParseNetSet([]string{"10.0.0.0/8"})
+				Expect(err).ToNot(HaveOccurred())
+				request.Header.Add("Forwarded", "for=192.0.2.43;host=external.example.com;proto=https, for=10.0.0.2;host=internal;proto=http")
+				request.Header.Add("X-Forwarded-For", "192.0.2.43, 10.0.0.2")
+				request.Header.Add("X-Forwarded-Host", "evil.example.com, app.example.com, internal")
+				request.Header.Add("X-Forwarded-Proto", "http, https, http")
+			})
+
+			serve := func(remoteAddr, realClientIPHeader string) *middlewareapi.RequestScope {
+				request.RemoteAddr = remoteAddr
+				handler := NewScope(true, testRequestHeader, trustedProxies, realClientIPHeader)(
+					http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						nextRequest = r
+						w.WriteHeader(200)
+					}))
+				handler.ServeHTTP(rw, request)
+				return middlewareapi.GetRequestScope(nextRequest)
+			}
+
+			It("trusts the Forwarded header of requests from a trusted proxy", func() {
+				scope := serve("10.0.0.1:1234", "Forwarded")
+				Expect(scope.ReverseProxy).To(BeTrue())
+				Expect(scope.ForwardedHost).To(Equal("external.example.com"))
+				Expect(scope.ForwardedProto).To(Equal("https"))
+			})
+
+			It("trusts the X-Forwarded-* headers of requests from a trusted proxy, skipping trusted hops", func() {
+				scope := serve("10.0.0.1:1234", "X-Forwarded-For")
+				Expect(scope.ReverseProxy).To(BeTrue())
+				Expect(scope.ForwardedHost).To(Equal("app.example.com"))
+				Expect(scope.ForwardedProto).To(Equal("https"))
+			})
+
+			It("does not trust forwarding headers of other requests", func() {
+				scope := serve("192.0.2.1:1234", "Forwarded")
+				Expect(scope.ReverseProxy).To(BeFalse())
+				Expect(scope.ForwardedHost).To(BeEmpty())
+				Expect(scope.ForwardedProto).To(BeEmpty())
+			})
+		})
+
 		Context("Request ID header is present", func() {
 			BeforeEach(func() {
 				request.Header.Add(testRequestHeader, testRequestID)
-				handler := NewScope(false, testRequestHeader)(
+				handler := NewScope(false, testRequestHeader, nil, "")(
 					http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 						nextRequest = r
 						w.WriteHeader(200)
@@ -97,7 +144,7 @@ var _ = Describe("Scope Suite", func() {
 			BeforeEach(func() {
 				uuid.SetRand(mockRand{})
 
-				handler := NewScope(true, testRequestHeader)(
+				handler := NewScope(true, testRequestHeader, nil, "")(
 					http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 						nextRequest = r
 						w.WriteHeader(200)
@@ -10,7 +10,10 @@ import (
 	"github.com/justinas/alice"
 	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
 	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/dpop"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/events"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/binding"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/providers"
 )
 
@@ -31,6 +34,22 @@ const (
 	sessionRefreshRetryPeriod = 10 * time.Millisecond
 )
 
+// errSessionExpired is returned when validating a session that has expired
+var errSessionExpired = errors.New("session is expired")
+
+// errUnknownLoginTime is returned when a session needs refreshing but does
+// not record when the user logged in, so refreshing it would extend its
+// maximum age
+var errUnknownLoginTime = errors.New("session does not record the login time")
+
+// errRefreshExpired is returned when a session needs refreshing but its
+// refresh token has expired
+var errRefreshExpired = errors.New("refresh token is expired")
+
+// errSessionBindingMismatch is returned when a session is revoked because it
+// was used by a client other than the one it is bound to
+var errSessionBindingMismatch = errors.New("session fingerprint does not match the client")
+
 // StoredSessionLoaderOptions contains all of the requirements to construct
 // a stored session loader.
 // All options must be provided.
@@ -41,6 +60,34 @@ type StoredSessionLoaderOptions struct {
 	// How often should sessions be refreshed
 	RefreshPeriod time.Duration
 
+	// Refresh sessions when the access token expires within this duration,
+	// 0 to disable
+	RefreshSkew time.Duration
+
+	// How long a session may go unused before it expires, 0 to disable
+	IdleTimeout time.Duration
+
+	// How often the last activity time of a session should be saved.
+	// This prevents the session being written on every request.
+	ActivityWriteInterval time.Duration
+
+	// The absolute maximum age of a session from login, 0 to disable
+	MaxAge time.Duration
+
+	// Whether sessions loaded from an older session format should be saved
+	// again in the SessionWriteVersion format
+	MigrateOnRead bool
+
+	// The session format version sessions are saved in
+	SessionWriteVersion uint8
+
+	// Session events for refreshes and expiry, may be nil
+	SessionEvents *events.Dispatcher
+
+	// Binder checks sessions are used by the client they are bound to,
+	// may be nil
+	SessionBinder *binding.Binder
+
 	// Provider based session refreshing
 	RefreshSession func(context.Context, *sessionsapi.SessionState) (bool, error)
 
@@ -55,22 +102,49 @@ type StoredSessionLoaderOptions struct {
 // If no session is found, the request will be passed to the nex handler.
 // If a session was loader by a previous handler, it will not be replaced.
 func NewStoredSessionLoader(opts *StoredSessionLoaderOptions) alice.Constructor {
-	ss := &storedSessionLoader{
-		store:            opts.SessionStore,
-		refreshPeriod:    opts.RefreshPeriod,
-		sessionRefresher: opts.RefreshSession,
-		sessionValidator: opts.ValidateSession,
+	return newStoredSessionLoader(opts).loadSession
+}
+
+// NewBackgroundSessionRefresher creates a function which refreshes sessions
+// outside of a request, for refreshing persisted sessions in the background.
+// Sessions past their idle timeout or maximum age are not refreshed, and a
+// background refresh does not count as activity on the session.
+func NewBackgroundSessionRefresher(opts *StoredSessionLoaderOptions) func(context.Context, *sessionsapi.SessionState) (bool, error) {
+	return newStoredSessionLoader(opts).refreshInBackground
+}
+
+func newStoredSessionLoader(opts *StoredSessionLoaderOptions) *storedSessionLoader {
+	return &storedSessionLoader{
+		store:                 opts.SessionStore,
+		refreshPeriod:         opts.RefreshPeriod,
+		refreshSkew:           opts.RefreshSkew,
+		idleTimeout:           opts.IdleTimeout,
+		activityWriteInterval: opts.ActivityWriteInterval,
+		maxAge:                opts.MaxAge,
+		migrateOnRead:         opts.MigrateOnRead,
+		sessionWriteVersion:   opts.SessionWriteVersion,
+		sessionEvents:         opts.SessionEvents,
+		sessionBinder:         opts.SessionBinder,
+		sessionRefresher:      opts.RefreshSession,
+		sessionValidator:      opts.ValidateSession,
 	}
-	return ss.loadSession
 }
 
 // storedSessionLoader is responsible for loading sessions from cookie
 // identified sessions in the session store.
 type storedSessionLoader struct {
-	store            sessionsapi.SessionStore
-	refreshPeriod    time.Duration
-	sessionRefresher func(context.Context, *sessionsapi.SessionState) (bool, error)
-	sessionValidator func(context.Context, *sessionsapi.SessionState) bool
+	store                 sessionsapi.SessionStore
+	refreshPeriod         time.Duration
+	refreshSkew           time.Duration
+	idleTimeout           time.Duration
+	activityWriteInterval time.Duration
+	maxAge                time.Duration
+	migrateOnRead         bool
+	sessionWriteVersion   uint8
+	sessionEvents         *events.Dispatcher
+	sessionBinder         *binding.Binder
+	sessionRefresher      func(context.Context, *sessionsapi.SessionState) (bool, error)
+	sessionValidator      func(context.Context, *sessionsapi.SessionState) bool
 }
 
 // loadSession attempts to load a session as identified by the request cookies.
@@ -113,19 +187,86 @@ func (s *storedSessionLoader) getValidatedSession(rw http.ResponseWriter, req *h
 		return nil, err
 	}
 
+	if !s.sessionBinder.Matches(req, session) {
+		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Session fingerprint does not match the client: %s", session)
+		s.sessionEvents.Emit(req, events.SessionBindingMismatch, session, "Session fingerprint does not match the client")
+		if s.sessionBinder.Revoke() {
+			return nil, errSessionBindingMismatch
+		}
+		return nil, nil
+	}
+
+	if err := s.checkSessionLifetime(session); err != nil {
+		s.sessionEvents.Emit(req, events.SessionExpired, session, "%v", err)
+		return nil, err
+	}
+
 	err = s.refreshSessionIfNeeded(rw, req, session)
 	if err != nil {
 		return nil, fmt.Errorf("error refreshing access token for session (%s): %v", session, err)
 	}
 
+	s.saveSessionIfNeeded(rw, req, session)
 	return session, nil
 }
 
+// checkSessionLifetime ensures the session has neither been idle for longer
+// than the idle timeout nor exceeded the absolute maximum session age.
+func (s *storedSessionLoader) checkSessionLifetime(session *sessionsapi.SessionState) error {
+	now := session.Clock.Now()
+	if expires := session.MaxAgeExpiresOn(s.maxAge); expires != nil && expires.Before(now) {
+		return fmt.Errorf("session (%s) exceeded the maximum session age", session)
+	}
+	if expires := session.IdleExpiresOn(s.idleTimeout); expires != nil && expires.Before(now) {
+		return fmt.Errorf("session (%s) exceeded the idle timeout", session)
+	}
+	return nil
+}
+
+// saveSessionIfNeeded saves the session when its last activity time needs
+// updating or when it should be migrated to the current session format.
+func (s *storedSessionLoader) saveSessionIfNeeded(rw http.ResponseWriter, req *http.Request, session *sessionsapi.SessionState) {
+	activity := s.updateLastActivity(session)
+	migrate := s.migrateOnRead && session.NeedsMigration(s.sessionWriteVersion)
+	if !activity && !migrate {
+		return
+	}
+
+	if migrate {
+		logger.Printf("Migrating session from format version %d - User: %s", session.FormatVersion(), session.User)
+	}
+	if err := s.store.Save(rw, req, session); err != nil {
+		logger.PrintAuthf(session.Email, req, logger.AuthError, "error saving session: %v", err)
+	}
+}
+
+// updateLastActivity extends an idle timeout by setting a new last activity
+// time on the session. To avoid writing the session on every request, it is
+// only updated once the activity write interval has passed.
+// It returns whether the session was updated and must be saved.
+func (s *storedSessionLoader) updateLastActivity(session *sessionsapi.SessionState) bool {
+	if s.idleTimeout <= 0 {
+		return false
+	}
+
+	now := session.Clock.Now()
+	lastActivity := session.LastActivityAt
+	if lastActivity == nil || lastActivity.IsZero() {
+		lastActivity = session.CreatedAt
+	}
+	if lastActivity != nil && now.Sub(*lastActivity) < s.activityWriteInterval {
+		return false
+	}
+
+	session.LastActivityAt = &now
+	return true
+}
+
 // refreshSessionIfNeeded will attempt to refresh a session if the session
-// is older than the refresh period.
+// is older than the refresh period or its access token is about to expire.
 // Success or fail, we will then validate the session.
 func (s *storedSessionLoader) refreshSessionIfNeeded(rw http.ResponseWriter, req *http.Request, session *sessionsapi.SessionState) error {
-	if !needsRefresh(s.refreshPeriod, session) {
+	if !s.needsRefresh(session) {
 		// Refresh is disabled or the session is not old enough, do nothing
 		return nil
 	}
@@ -179,12 +320,24 @@ func (s *storedSessionLoader) refreshSessionIfNeeded(rw http.ResponseWriter, req
 	// Loading from the session store creates a new lock in the session.
 	session.Lock = lock
 
-	if !needsRefresh(s.refreshPeriod, session) {
+	if !s.needsRefresh(session) {
 		// The session must have already been refreshed while we were waiting to
 		// obtain the lock.
 		return nil
 	}
 
+	if session.IsRefreshExpired() {
+		// The session can no longer be refreshed, so the user must log in again
+		s.sessionEvents.Emit(req, events.SessionExpired, session, "Refresh token expired")
+		return errRefreshExpired
+	}
+
+	if s.unknownLoginTime(session) {
+		// The user must log in again so that the maximum age can be enforced
+		s.sessionEvents.Emit(req, events.SessionExpired, session, "Session does not record the login time")
+		return errUnknownLoginTime
+	}
+
 	// We are holding the lock and the session needs a refresh
 	logger.Printf("Refreshing session - User: %s; SessionAge: %s", session.User, session.Age())
 	if err := s.refreshSession(rw, req, session); err != nil {
@@ -194,21 +347,39 @@ func (s *storedSessionLoader) refreshSessionIfNeeded(rw http.ResponseWriter, req
 	}
 
 	// Validate all sessions after any Redeem/Refresh operation (fail or success)
-	return s.validateSession(req.Context(), session)
+	err = s.validateSession(req.Context(), session)
+	if errors.Is(err, errSessionExpired) {
+		s.sessionEvents.Emit(req, events.SessionExpired, session, "Session expired")
+	}
+	return err
 }
 
 // needsRefresh determines whether we should attempt to refresh a session or not.
-func needsRefresh(refreshPeriod time.Duration, session *sessionsapi.SessionState) bool {
-	return refreshPeriod > time.Duration(0) && session.Age() > refreshPeriod
+// Sessions are refreshed once they are older than the refresh period, and
+// sessions with a refresh token when the access token is within the refresh
+// skew of expiring.
+func (s *storedSessionLoader) needsRefresh(session *sessionsapi.SessionState) bool {
+	if s.refreshPeriod > time.Duration(0) && session.Age() > s.refreshPeriod {
+		return true
+	}
+	return s.refreshSkew > time.Duration(0) && session.RefreshToken != "" && session.ExpiresWithin(s.refreshSkew)
 }
 
 // refreshSession attempts to refresh the session with the provider
 // and will save the session if it was updated.
 func (s *storedSessionLoader) refreshSession(rw http.ResponseWriter, req *http.Request, session *sessionsapi.SessionState) error {
-	refreshed, err := s.sessionRefresher(req.Context(), session)
+	// Send DPoP proofs with the refresh if the session's tokens are bound to a key
+	ctx, err := dpop.ContextForSession(req.Context(), session)
+	if err != nil {
+		return err
+	}
+
+	refreshed, err := s.sessionRefresher(ctx, session)
 	if err != nil && !errors.Is(err, providers.ErrNotImplemented) {
+		s.sessionEvents.Emit(req, events.RefreshFailure, session, "Unable to refresh session: %v", err)
 		return fmt.Errorf("error refreshing tokens: %v", err)
 	}
+	implemented := !errors.Is(err, providers.ErrNotImplemented)
 
 	// HACK:
 	// Providers that don't implement `RefreshSession` use the default
@@ -228,6 +399,9 @@ func (s *storedSessionLoader) refreshSession(rw http.ResponseWriter, req *http.R
 	// If we refreshed, update the `CreatedAt` time to reset the refresh timer
 	// (In case underlying provider implementations forget)
 	session.CreatedAtNow()
+	if s.idleTimeout > 0 {
+		session.LastActivityAt = session.CreatedAt
+	}
 
 	// Because the session was refreshed, make sure to save it
 	err = s.store.Save(rw, req, session)
@@ -235,15 +409,71 @@ func (s *storedSessionLoader) refreshSession(rw http.ResponseWriter, req *http.R
 		logger.PrintAuthf(session.Email, req, logger.AuthError, "error saving session: %v", err)
 		return fmt.Errorf("error saving session: %v", err)
 	}
+
+	if implemented {
+		s.sessionEvents.Emit(req, events.Refresh, session, "Refreshed session")
+	}
 	return nil
 }
 
+// refreshInBackground refreshes a session without a request. It returns
+// whether the session was refreshed and must be saved.
+func (s *storedSessionLoader) refreshInBackground(ctx context.Context, session *sessionsapi.SessionState) (bool, error) {
+	if err := s.checkSessionLifetime(session); err != nil {
+		return false, err
+	}
+	if session.IsRefreshExpired() {
+		return false, errRefreshExpired
+	}
+	if s.unknownLoginTime(session) {
+		return false, errUnknownLoginTime
+	}
+
+	// Send DPoP proofs with the refresh if the session's tokens are bound to a key
+	ctx, err := dpop.ContextForSession(ctx, session)
+	if err != nil {
+		return false, err
+	}
+
+	refreshed, err := s.sessionRefresher(ctx, session)
+	if errors.Is(err, providers.ErrNotImplemented) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error refreshing tokens for session (%s): %v", session, err)
+	}
+	if !refreshed {
+		return false, nil
+	}
+
+	// A background refresh is not activity on the session, so the last
+	// activity time must not move with CreatedAt
+	if s.idleTimeout > 0 && (session.LastActivityAt == nil || session.LastActivityAt.IsZero()) && session.CreatedAt != nil {
+		lastActivity := *session.CreatedAt
+		session.LastActivityAt = &lastActivity
+	}
+	session.CreatedAtNow()
+	return true, nil
+}
+
+// unknownLoginTime checks whether the maximum age applies to a session created
+// before the login time was recorded at sign in. Its maximum age is counted
+// from CreatedAt, which refreshing resets, so such sessions are not refreshed.
+func (s *storedSessionLoader) unknownLoginTime(session *sessionsapi.SessionState) bool {
+	return s.maxAge > 0 && (session.AuthenticatedAt == nil || session.AuthenticatedAt.IsZero())
+}
+
 // validateSession checks whether the session has expired and performs
 // provider validation on the session.
 // An error implies the session is not longer valid.
 func (s *storedSessionLoader) validateSession(ctx context.Context, session *sessionsapi.SessionState) error {
 	if session.IsExpired() {
-		return errors.New("session is expired")
+		return errSessionExpired
+	}
+
+	ctx, err := dpop.ContextForSession(ctx, session)
+	if err != nil {
+		return err
 	}
 
 	if !s.sessionValidator(ctx, session) {
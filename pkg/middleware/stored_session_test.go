@@ -10,11 +10,16 @@ import (
 	"time"
 
 	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/events"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/binding"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/providers"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 type testLock struct {
@@ -435,9 +440,271 @@ var _ = Describe("Stored Session Suite", func() {
 		)
 	})
 
+	Context("with session lifetime limits", func() {
+		now := time.Now()
+		expires := now.Add(time.Hour)
+
+		BeforeEach(func() {
+			clock.Set(now)
+		})
+
+		AfterEach(func() {
+			clock.Reset()
+		})
+
+		type sessionLifetimeTableInput struct {
+			createdAt       time.Time
+			authenticatedAt *time.Time
+			lastActivityAt  *time.Time
+			idleTimeout     time.Duration
+			maxAge          time.Duration
+			expectSession   bool
+			expectSave      bool
+		}
+
+		DescribeTable("when serving a request",
+			func(in sessionLifetimeTableInput) {
+				var saved *sessionsapi.SessionState
+				store := &fakeSessionStore{
+					LoadFunc: func(*http.Request) (*sessionsapi.SessionState, error) {
+						return &sessionsapi.SessionState{
+							CreatedAt:       &in.createdAt,
+							ExpiresOn:       &expires,
+							AuthenticatedAt: in.authenticatedAt,
+							LastActivityAt:  in.lastActivityAt,
+						}, nil
+					},
+					SaveFunc: func(_ http.ResponseWriter, _ *http.Request, s *sessionsapi.SessionState) error {
+						saved = s
+						return nil
+					},
+				}
+
+				req := httptest.NewRequest("", "/", nil)
+				req.Header.Set("Cookie", "_oauth2_proxy=Session")
+				req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{})
+
+				var gotSession *sessionsapi.SessionState
+				sink := &recordingSink{}
+				handler := NewStoredSessionLoader(&StoredSessionLoaderOptions{
+					SessionStore:          store,
+					SessionEvents:         events.NewDispatcher("test", nil, sink),
+					IdleTimeout:           in.idleTimeout,
+					ActivityWriteInterval: time.Minute,
+					MaxAge:                in.maxAge,
+					RefreshSession:        func(context.Context, *sessionsapi.SessionState) (bool, error) { return false, nil },
+					ValidateSession:       func(context.Context, *sessionsapi.SessionState) bool { return true },
+				})(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+					gotSession = middlewareapi.GetRequestScope(r).Session
+				}))
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+
+				if !in.expectSession {
+					Expect(gotSession).To(BeNil())
+					Expect(sink.types()).To(ConsistOf(events.SessionExpired))
+					return
+				}
+				Expect(gotSession).ToNot(BeNil())
+				Expect(sink.types()).To(BeEmpty())
+
+				if !in.expectSave {
+					Expect(saved).To(BeNil())
+					return
+				}
+				Expect(saved).ToNot(BeNil())
+				Expect(*saved.LastActivityAt).To(BeTemporally("==", now))
+			},
+			Entry("with no limits", sessionLifetimeTableInput{
+				createdAt:     now.Add(-48 * time.Hour),
+				expectSession: true,
+			}),
+			Entry("with a session within the idle timeout, used recently", sessionLifetimeTableInput{
+				createdAt:      now.Add(-2 * time.Hour),
+				lastActivityAt: timePtr(now.Add(-30 * time.Second)),
+				idleTimeout:    time.Hour,
+				expectSession:  true,
+				expectSave:     false,
+			}),
+			Entry("with a session within the idle timeout, not used recently", sessionLifetimeTableInput{
+				createdAt:      now.Add(-2 * time.Hour),
+				lastActivityAt: timePtr(now.Add(-30 * time.Minute)),
+				idleTimeout:    time.Hour,
+				expectSession:  true,
+				expectSave:     true,
+			}),
+			Entry("with a session that exceeded the idle timeout", sessionLifetimeTableInput{
+				createdAt:      now.Add(-3 * time.Hour),
+				lastActivityAt: timePtr(now.Add(-2 * time.Hour)),
+				idleTimeout:    time.Hour,
+				expectSession:  false,
+			}),
+			Entry("with a session without activity that exceeded the idle timeout", sessionLifetimeTableInput{
+				createdAt:     now.Add(-2 * time.Hour),
+				idleTimeout:   time.Hour,
+				expectSession: false,
+			}),
+			Entry("with a session within the maximum age", sessionLifetimeTableInput{
+				createdAt:       now.Add(-time.Minute),
+				authenticatedAt: timePtr(now.Add(-7 * time.Hour)),
+				maxAge:          8 * time.Hour,
+				expectSession:   true,
+			}),
+			Entry("with a refreshed session that exceeded the maximum age", sessionLifetimeTableInput{
+				createdAt:       now.Add(-time.Minute),
+				authenticatedAt: timePtr(now.Add(-9 * time.Hour)),
+				maxAge:          8 * time.Hour,
+				expectSession:   false,
+			}),
+			Entry("with a session without an authentication time that exceeded the maximum age", sessionLifetimeTableInput{
+				createdAt:     now.Add(-9 * time.Hour),
+				maxAge:        8 * time.Hour,
+				expectSession: false,
+			}),
+		)
+	})
+
+	Context("with a session in an older session format", func() {
+		var legacySession *sessionsapi.SessionState
+
+		BeforeEach(func() {
+			// Sessions encoded before the session format header was introduced
+			// were plain MessagePack
+			c, err := encryption.NewGCMCipher([]byte("0123456789abcdef"))
+			Expect(err).ToNot(HaveOccurred())
+			packed, err := msgpack.Marshal(&sessionsapi.SessionState{User: "john.doe"})
+			Expect(err).ToNot(HaveOccurred())
+			encrypted, err := c.Encrypt(packed)
+			Expect(err).ToNot(HaveOccurred())
+
+			legacySession, err = sessionsapi.DecodeSessionState(encrypted, c, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(legacySession.NeedsMigration(sessionsapi.CurrentSessionFormatVersion)).To(BeTrue())
+		})
+
+		DescribeTable("when serving a request",
+			func(migrateOnRead bool, writeVersion uint8, expectSave bool) {
+				saved := false
+				store := &fakeSessionStore{
+					LoadFunc: func(*http.Request) (*sessionsapi.SessionState, error) {
+						return legacySession, nil
+					},
+					SaveFunc: func(http.ResponseWriter, *http.Request, *sessionsapi.SessionState) error {
+						saved = true
+						return nil
+					},
+				}
+
+				req := httptest.NewRequest("", "/", nil)
+				req.Header.Set("Cookie", "_oauth2_proxy=Session")
+				req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{})
+
+				handler := NewStoredSessionLoader(&StoredSessionLoaderOptions{
+					SessionStore:        store,
+					MigrateOnRead:       migrateOnRead,
+					SessionWriteVersion: writeVersion,
+					RefreshSession:      func(context.Context, *sessionsapi.SessionState) (bool, error) { return false, nil },
+					ValidateSession:     func(context.Context, *sessionsapi.SessionState) bool { return true },
+				})(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+					Expect(middlewareapi.GetRequestScope(r).Session).To(Equal(legacySession))
+				}))
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+
+				Expect(saved).To(Equal(expectSave))
+			},
+			Entry("does not save the session without migrate on read", false, sessionsapi.CurrentSessionFormatVersion, false),
+			Entry("saves the session in the current format with migrate on read", true, sessionsapi.CurrentSessionFormatVersion, true),
+			Entry("does not save the session when it is already in the write format", true, sessionsapi.LegacySessionFormatVersion, false),
+		)
+	})
+
+	Context("with session binding", func() {
+		type sessionBindingTableInput struct {
+			userAgent      string
+			mismatchAction string
+			expectSession  bool
+			expectCleared  bool
+			expectedEvents []events.Type
+		}
+
+		DescribeTable("when serving a request",
+			func(in sessionBindingTableInput) {
+				binder, err := binding.NewBinder(options.SessionBindingOptions{
+					Components:     []string{options.UserAgentSessionBinding},
+					MismatchAction: in.mismatchAction,
+				}, nil)
+				Expect(err).ToNot(HaveOccurred())
+
+				session := &sessionsapi.SessionState{User: "john.doe"}
+				loginReq := httptest.NewRequest("", "/", nil)
+				loginReq.Header.Set("User-Agent", "Mozilla/5.0")
+				binder.Bind(loginReq, session)
+
+				cleared := false
+				store := &fakeSessionStore{
+					LoadFunc: func(*http.Request) (*sessionsapi.SessionState, error) {
+						return session, nil
+					},
+					ClearFunc: func(http.ResponseWriter, *http.Request) error {
+						cleared = true
+						return nil
+					},
+				}
+
+				req := httptest.NewRequest("", "/", nil)
+				req.Header.Set("Cookie", "_oauth2_proxy=Session")
+				req.Header.Set("User-Agent", in.userAgent)
+				req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{})
+
+				var gotSession *sessionsapi.SessionState
+				sink := &recordingSink{}
+				handler := NewStoredSessionLoader(&StoredSessionLoaderOptions{
+					SessionStore:    store,
+					SessionEvents:   events.NewDispatcher("test", nil, sink),
+					SessionBinder:   binder,
+					RefreshSession:  func(context.Context, *sessionsapi.SessionState) (bool, error) { return false, nil },
+					ValidateSession: func(context.Context, *sessionsapi.SessionState) bool { return true },
+				})(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+					gotSession = middlewareapi.GetRequestScope(r).Session
+				}))
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+
+				if in.expectSession {
+					Expect(gotSession).To(Equal(session))
+				} else {
+					Expect(gotSession).To(BeNil())
+				}
+				Expect(cleared).To(Equal(in.expectCleared))
+				Expect(sink.types()).To(Equal(in.expectedEvents))
+			},
+			Entry("with the client the session is bound to", sessionBindingTableInput{
+				userAgent:      "Mozilla/5.0",
+				mismatchAction: options.DropSessionBindingAction,
+				expectSession:  true,
+				expectCleared:  false,
+				expectedEvents: []events.Type{},
+			}),
+			Entry("with a different client, dropping the session", sessionBindingTableInput{
+				userAgent:      "curl/8.0",
+				mismatchAction: options.DropSessionBindingAction,
+				expectSession:  false,
+				expectCleared:  false,
+				expectedEvents: []events.Type{events.SessionBindingMismatch},
+			}),
+			Entry("with a different client, revoking the session", sessionBindingTableInput{
+				userAgent:      "curl/8.0",
+				mismatchAction: options.RevokeSessionBindingAction,
+				expectSession:  false,
+				expectCleared:  true,
+				expectedEvents: []events.Type{events.SessionBindingMismatch},
+			}),
+		)
+	})
+
 	Context("refreshSessionIfNeeded", func() {
 		type refreshSessionIfNeededTableInput struct {
 			refreshPeriod            time.Duration
+			refreshSkew              time.Duration
+			maxAge                   time.Duration
 			session                  *sessionsapi.SessionState
 			concurrentSessionRefresh bool
 			expectedErr              error
@@ -448,6 +715,7 @@ var _ = Describe("Stored Session Suite", func() {
 
 		createdPast := time.Now().Add(-5 * time.Minute)
 		createdFuture := time.Now().Add(5 * time.Minute)
+		expiresSoon := time.Now().Add(30 * time.Second)
 
 		DescribeTable("with a session",
 			func(in refreshSessionIfNeededTableInput) {
@@ -475,6 +743,8 @@ var _ = Describe("Stored Session Suite", func() {
 
 				s := &storedSessionLoader{
 					refreshPeriod: in.refreshPeriod,
+					refreshSkew:   in.refreshSkew,
+					maxAge:        in.maxAge,
 					store:         store,
 					sessionRefresher: func(_ context.Context, ss *sessionsapi.SessionState) (bool, error) {
 						refreshed = true
@@ -628,14 +898,94 @@ var _ = Describe("Stored Session Suite", func() {
 				expectValidated:      true,
 				expectedLockObtained: true,
 			}),
+			Entry("when the access token expires within the refresh skew", refreshSessionIfNeededTableInput{
+				refreshSkew: 1 * time.Minute,
+				session: &sessionsapi.SessionState{
+					RefreshToken: refresh,
+					CreatedAt:    &createdFuture,
+					ExpiresOn:    &expiresSoon,
+					Lock:         &testLock{},
+				},
+				expectedErr:          nil,
+				expectRefreshed:      true,
+				expectValidated:      true,
+				expectedLockObtained: true,
+			}),
+			Entry("when the access token does not expire within the refresh skew", refreshSessionIfNeededTableInput{
+				refreshSkew: 1 * time.Minute,
+				session: &sessionsapi.SessionState{
+					RefreshToken: refresh,
+					CreatedAt:    &createdPast,
+					ExpiresOn:    &createdFuture,
+					Lock:         &testLock{},
+				},
+				expectedErr:          nil,
+				expectRefreshed:      false,
+				expectValidated:      false,
+				expectedLockObtained: false,
+			}),
+			Entry("when the access token expires within the refresh skew, without a refresh token", refreshSessionIfNeededTableInput{
+				refreshSkew: 1 * time.Minute,
+				session: &sessionsapi.SessionState{
+					CreatedAt: &createdPast,
+					ExpiresOn: &expiresSoon,
+					Lock:      &testLock{},
+				},
+				expectedErr:          nil,
+				expectRefreshed:      false,
+				expectValidated:      false,
+				expectedLockObtained: false,
+			}),
+			Entry("when the session needs refreshing but the refresh token has expired", refreshSessionIfNeededTableInput{
+				refreshPeriod: 1 * time.Minute,
+				session: &sessionsapi.SessionState{
+					RefreshToken:     refresh,
+					CreatedAt:        &createdPast,
+					ExpiresOn:        &createdFuture,
+					RefreshExpiresOn: &createdPast,
+					Lock:             &testLock{},
+				},
+				expectedErr:          errRefreshExpired,
+				expectRefreshed:      false,
+				expectValidated:      false,
+				expectedLockObtained: true,
+			}),
+			Entry("when the session needs refreshing with a maximum age and records the login time", refreshSessionIfNeededTableInput{
+				refreshPeriod: 1 * time.Minute,
+				maxAge:        8 * time.Hour,
+				session: &sessionsapi.SessionState{
+					RefreshToken:    refresh,
+					CreatedAt:       &createdPast,
+					AuthenticatedAt: &createdPast,
+					Lock:            &testLock{},
+				},
+				expectedErr:          nil,
+				expectRefreshed:      true,
+				expectValidated:      true,
+				expectedLockObtained: true,
+			}),
+			Entry("when the session needs refreshing with a maximum age but does not record the login time", refreshSessionIfNeededTableInput{
+				refreshPeriod: 1 * time.Minute,
+				maxAge:        8 * time.Hour,
+				session: &sessionsapi.SessionState{
+					RefreshToken: refresh,
+					CreatedAt:    &createdPast,
+					Lock:         &testLock{},
+				},
+				expectedErr:          errUnknownLoginTime,
+				expectRefreshed:      false,
+				expectValidated:      false,
+				expectedLockObtained: true,
+			}),
 		)
 	})
 
 	Context("refreshSession", func() {
 		type refreshSessionWithProviderTableInput struct {
-			session     *sessionsapi.SessionState
-			expectedErr error
-			expectSaved bool
+			session       *sessionsapi.SessionState
+			expectedErr   error
+			expectSaved   bool
+			expectedEvent events.Type
 		}
 
 		now := time.Now()
@@ -643,8 +993,10 @@ var _ = Describe("Stored Session Suite", func() {
 		DescribeTable("when refreshing with the provider",
 			func(in refreshSessionWithProviderTableInput) {
 				saved := false
+				sink := &recordingSink{}
 
 				s := &storedSessionLoader{
+					sessionEvents: events.NewDispatcher("test", nil, sink),
 					store: &fakeSessionStore{
 						SaveFunc: func(_ http.ResponseWriter, _ *http.Request, ss *sessionsapi.SessionState) error {
 							saved = true
@@ -677,6 +1029,11 @@ var _ = Describe("Stored Session Suite", func() {
 					Expect(err).ToNot(HaveOccurred())
 				}
 				Expect(saved).To(Equal(in.expectSaved))
+				if in.expectedEvent != "" {
+					Expect(sink.types()).To(ConsistOf(in.expectedEvent))
+				} else {
+					Expect(sink.types()).To(BeEmpty())
+				}
 			},
 			Entry("when the provider does not refresh the session", refreshSessionWithProviderTableInput{
 				session: &sessionsapi.SessionState{
@@ -689,8 +1046,9 @@ var _ = Describe("Stored Session Suite", func() {
 				session: &sessionsapi.SessionState{
 					RefreshToken: refresh,
 				},
-				expectedErr: nil,
-				expectSaved: true,
+				expectedErr:   nil,
+				expectSaved:   true,
+				expectedEvent: events.Refresh,
 			}),
 			Entry("when the provider doesn't implement refresh", refreshSessionWithProviderTableInput{
 				session: &sessionsapi.SessionState{
@@ -705,8 +1063,9 @@ var _ = Describe("Stored Session Suite", func() {
 					CreatedAt:    &now,
 					ExpiresOn:    &now,
 				},
-				expectedErr: errors.New("error refreshing tokens: error refreshing session"),
-				expectSaved: false,
+				expectedErr:   errors.New("error refreshing tokens: error refreshing session"),
+				expectSaved:   false,
+				expectedEvent: events.RefreshFailure,
 			}),
 			Entry("when the saving the session returns an error", refreshSessionWithProviderTableInput{
 				session: &sessionsapi.SessionState{
@@ -719,6 +1078,89 @@ var _ = Describe("Stored Session Suite", func() {
 		)
 	})
 
+	Context("refreshInBackground", func() {
+		var (
+			s               *storedSessionLoader
+			refreshed       bool
+			createdAt       time.Time
+			authenticatedAt time.Time
+		)
+
+		BeforeEach(func() {
+			refreshed = false
+			createdAt = time.Now().Add(-30 * time.Minute)
+			authenticatedAt = time.Now().Add(-2 * time.Hour)
+			s = newStoredSessionLoader(&StoredSessionLoaderOptions{
+				IdleTimeout: time.Hour,
+				MaxAge:      8 * time.Hour,
+				RefreshSession: func(_ context.Context, ss *sessionsapi.SessionState) (bool, error) {
+					switch ss.RefreshToken {
+					case refresh:
+						refreshed = true
+						return true, nil
+					case noRefresh:
+						return false, nil
+					case notImplemented:
+						return false, providers.ErrNotImplemented
+					default:
+						return false, errors.New("error refreshing session")
+					}
+				},
+			})
+		})
+
+		It("refreshes the session without extending its idle timeout or maximum age", func() {
+			session := &sessionsapi.SessionState{RefreshToken: refresh, CreatedAt: &createdAt, AuthenticatedAt: &authenticatedAt}
+			ok, err := s.refreshInBackground(context.Background(), session)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+
+			Expect(session.CreatedAt.After(createdAt)).To(BeTrue())
+			Expect(*session.LastActivityAt).To(Equal(createdAt))
+			Expect(*session.AuthenticatedAt).To(Equal(authenticatedAt))
+		})
+
+		It("does not refresh sessions that do not record the login time", func() {
+			session := &sessionsapi.SessionState{RefreshToken: refresh, CreatedAt: &createdAt}
+			_, err := s.refreshInBackground(context.Background(), session)
+			Expect(err).To(MatchError(errUnknownLoginTime))
+			Expect(refreshed).To(BeFalse())
+			Expect(session.AuthenticatedAt).To(BeNil())
+		})
+
+		It("does not save sessions the provider did not refresh", func() {
+			for _, token := range []string{noRefresh, notImplemented} {
+				session := &sessionsapi.SessionState{RefreshToken: token, CreatedAt: &createdAt, AuthenticatedAt: &authenticatedAt}
+				ok, err := s.refreshInBackground(context.Background(), session)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ok).To(BeFalse())
+				Expect(*session.CreatedAt).To(Equal(createdAt))
+			}
+		})
+
+		It("returns provider errors", func() {
+			session := &sessionsapi.SessionState{RefreshToken: "RefreshError", CreatedAt: &createdAt, AuthenticatedAt: &authenticatedAt}
+			_, err := s.refreshInBackground(context.Background(), session)
+			Expect(err).To(MatchError(ContainSubstring("error refreshing session")))
+		})
+
+		It("does not refresh idle sessions", func() {
+			idleSince := time.Now().Add(-2 * time.Hour)
+			session := &sessionsapi.SessionState{RefreshToken: refresh, CreatedAt: &idleSince}
+			_, err := s.refreshInBackground(context.Background(), session)
+			Expect(err).To(MatchError(ContainSubstring("exceeded the idle timeout")))
+			Expect(refreshed).To(BeFalse())
+		})
+
+		It("does not refresh sessions with an expired refresh token", func() {
+			expired := time.Now().Add(-time.Minute)
+			session := &sessionsapi.SessionState{RefreshToken: refresh, CreatedAt: &createdAt, RefreshExpiresOn: &expired}
+			_, err := s.refreshInBackground(context.Background(), session)
+			Expect(err).To(MatchError(errRefreshExpired))
+			Expect(refreshed).To(BeFalse())
+		})
+	})
+
 	Context("validateSession", func() {
 		var s *storedSessionLoader
 
@@ -796,3 +1238,34 @@ func (f *fakeSessionStore) Clear(rw http.ResponseWriter, req *http.Request) erro
 func (f *fakeSessionStore) VerifyConnection(_ context.Context) error {
 	return nil
 }
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+// recordingSink records the types of the session events it receives
+type recordingSink struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+func (r *recordingSink) Send(event events.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *recordingSink) Close() error {
+	return nil
+}
+
+func (r *recordingSink) types() []events.Type {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	types := []events.Type{}
+	for _, event := range r.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
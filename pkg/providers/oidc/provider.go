@@ -16,6 +16,10 @@ type providerJSON struct {
 	TokenURL             string   `json:"token_endpoint"`
 	JWKsURL              string   `json:"jwks_uri"`
 	UserInfoURL          string   `json:"userinfo_endpoint"`
+	DeviceAuthURL        string   `json:"device_authorization_endpoint"`
+	PARURL               string   `json:"pushed_authorization_request_endpoint"`
+	RequirePAR           bool     `json:"require_pushed_authorization_requests"`
+	IntrospectionURL     string   `json:"introspection_endpoint"`
 	CodeChallengeAlgs    []string `json:"code_challenge_methods_supported"`
 	SupportedSigningAlgs []string `json:"id_token_signing_alg_values_supported"`
 }
@@ -23,10 +27,13 @@ type providerJSON struct {
 // Endpoints represents the endpoints discovered as part of the OIDC discovery process
 // that will be used by the authentication providers.
 type Endpoints struct {
-	AuthURL     string
-	TokenURL    string
-	JWKsURL     string
-	UserInfoURL string
+	AuthURL          string
+	TokenURL         string
+	JWKsURL          string
+	UserInfoURL      string
+	DeviceAuthURL    string
+	PARURL           string
+	IntrospectionURL string
 }
 
 // PKCE holds information relevant to the PKCE (code challenge) support of the
@@ -41,6 +48,7 @@ type DiscoveryProvider interface {
 	Endpoints() Endpoints
 	PKCE() PKCE
 	SupportedSigningAlgs() []string
+	RequirePAR() bool
 }
 
 // NewProvider allows a user to perform an OIDC discovery and returns the DiscoveryProvider.
@@ -69,6 +77,10 @@ func NewProvider(ctx context.Context, issuerURL string, skipIssuerVerification b
 		tokenURL:             p.TokenURL,
 		jwksURL:              p.JWKsURL,
 		userInfoURL:          p.UserInfoURL,
+		deviceAuthURL:        p.DeviceAuthURL,
+		parURL:               p.PARURL,
+		requirePAR:           p.RequirePAR,
+		introspectionURL:     p.IntrospectionURL,
 		codeChallengeAlgs:    p.CodeChallengeAlgs,
 		supportedSigningAlgs: p.SupportedSigningAlgs,
 	}, nil
@@ -80,6 +92,10 @@ type discoveryProvider struct {
 	tokenURL             string
 	jwksURL              string
 	userInfoURL          string
+	deviceAuthURL        string
+	parURL               string
+	requirePAR           bool
+	introspectionURL     string
 	codeChallengeAlgs    []string
 	supportedSigningAlgs []string
 }
@@ -87,10 +103,13 @@ type discoveryProvider struct {
 // Endpoints returns the discovered endpoints needed for an authentication provider.
 func (p *discoveryProvider) Endpoints() Endpoints {
 	return Endpoints{
-		AuthURL:     p.authURL,
-		TokenURL:    p.tokenURL,
-		JWKsURL:     p.jwksURL,
-		UserInfoURL: p.userInfoURL,
+		AuthURL:          p.authURL,
+		TokenURL:         p.tokenURL,
+		JWKsURL:          p.jwksURL,
+		UserInfoURL:      p.userInfoURL,
+		DeviceAuthURL:    p.deviceAuthURL,
+		PARURL:           p.parURL,
+		IntrospectionURL: p.introspectionURL,
 	}
 }
 
@@ -105,3 +124,9 @@ func (p *discoveryProvider) PKCE() PKCE {
 func (p *discoveryProvider) SupportedSigningAlgs() []string {
 	return p.supportedSigningAlgs
 }
+
+// RequirePAR returns true when the provider only accepts authorization
+// requests pushed to its pushed authorization request endpoint (RFC 9126).
+func (p *discoveryProvider) RequirePAR() bool {
+	return p.requirePAR
+}
@@ -24,10 +24,60 @@ type ClaimExtractor interface {
 	GetClaimInto(claim string, dst interface{}) (bool, error)
 }
 
+// Precedence determines which source a claim is read from when it is present
+// in both the ID Token and the userinfo response.
+type Precedence int
+
+const (
+	// PreferIDToken reads the claim from the ID Token
+	PreferIDToken Precedence = iota
+	// PreferUserInfo reads the claim from the userinfo response
+	PreferUserInfo
+	// MergeValues combines the values of both sources into a list
+	MergeValues
+)
+
+// PrecedenceRules returns the precedence for a claim
+type PrecedenceRules func(claim string) Precedence
+
 // NewClaimExtractor constructs a new ClaimExtractor from the raw ID Token.
 // If needed, it will use the profile URL to look up a claim if it isn't present
 // within the ID Token.
-func NewClaimExtractor(ctx context.Context, idToken string, profileURL *url.URL, profileRequestHeaders http.Header) (ClaimExtractor, error) {
+// Aggregated and distributed claims referenced by the ID Token or profile
+// response are resolved when they are requested. Claims returned as a JWT
+// must be issued by one of the claims provider issuers or, for distributed
+// claims, by the claims provider of the endpoint they are fetched from.
+func NewClaimExtractor(ctx context.Context, idToken string, profileURL *url.URL, profileRequestHeaders http.Header, claimsProviderIssuers []string) (ClaimExtractor, error) {
+	return newClaimExtractor(ctx, idToken, profileURL, profileRequestHeaders, claimsProviderIssuers)
+}
+
+// NewUserInfoClaimExtractor constructs a new ClaimExtractor that merges the
+// claims of the ID Token with the claims returned by the userinfo endpoint.
+// The userinfo endpoint is always requested and the precedence rules decide
+// which source is used for claims present in both.
+func NewUserInfoClaimExtractor(ctx context.Context, idToken string, userInfoURL *url.URL, userInfoRequestHeaders http.Header, precedence PrecedenceRules, claimsProviderIssuers []string) (ClaimExtractor, error) {
+	extractor, err := newClaimExtractor(ctx, idToken, userInfoURL, userInfoRequestHeaders, claimsProviderIssuers)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := extractor.ensureProfileClaims(); err != nil {
+		return nil, fmt.Errorf("failed to fetch claims from userinfo endpoint: %v", err)
+	}
+
+	// The userinfo response must not be used if it is for another user
+	// (OpenID Connect Core 1.0 section 5.3.2)
+	tokenSubject, _ := extractor.tokenClaims.Get("sub").String()
+	profileSubject, _ := extractor.profileClaims.Get("sub").String()
+	if tokenSubject != "" && profileSubject != "" && tokenSubject != profileSubject {
+		return nil, fmt.Errorf("userinfo subject %q does not match ID Token subject %q", profileSubject, tokenSubject)
+	}
+
+	extractor.precedence = precedence
+	return extractor, nil
+}
+
+func newClaimExtractor(ctx context.Context, idToken string, profileURL *url.URL, profileRequestHeaders http.Header, claimsProviderIssuers []string) (*claimExtractor, error) {
 	payload, err := parseJWT(idToken)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse ID Token: %v", err)
@@ -38,11 +88,18 @@ func NewClaimExtractor(ctx context.Context, idToken string, profileURL *url.URL,
 		return nil, fmt.Errorf("failed to parse ID Token payload: %v", err)
 	}
 
+	tokenSources, err := newClaimSources(ctx, tokenClaims, claimsProviderIssuers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ID Token claim sources: %v", err)
+	}
+
 	return &claimExtractor{
 		ctx:            ctx,
+		issuers:        claimsProviderIssuers,
 		profileURL:     profileURL,
 		requestHeaders: profileRequestHeaders,
 		tokenClaims:    tokenClaims,
+		tokenSources:   tokenSources,
 	}, nil
 }
 
@@ -52,7 +109,13 @@ type claimExtractor struct {
 	ctx            context.Context
 	requestHeaders map[string][]string
 	tokenClaims    *simplejson.Json
+	tokenSources   *claimSources
+	issuers        []string
 	profileClaims  *simplejson.Json
+	profileSources *claimSources
+
+	// precedence is set when claims are merged with the userinfo response
+	precedence PrecedenceRules
 }
 
 // GetClaim will return the value claim if it exists.
@@ -63,26 +126,77 @@ func (c *claimExtractor) GetClaim(claim string) (interface{}, bool, error) {
 		return nil, false, nil
 	}
 
-	if value := getClaimFrom(claim, c.tokenClaims); value != nil {
-		return value, true, nil
+	if c.precedence != nil {
+		return c.getMergedClaim(claim)
 	}
 
-	if c.profileClaims == nil {
-		profileClaims, err := c.loadProfileClaims()
-		if err != nil {
-			return nil, false, fmt.Errorf("failed to fetch claims from profile URL: %v", err)
-		}
+	value, err := getClaimWithSources(claim, c.tokenClaims, c.tokenSources)
+	if err != nil {
+		return nil, false, err
+	}
+	if value != nil {
+		return value, true, nil
+	}
 
-		c.profileClaims = profileClaims
+	if err := c.ensureProfileClaims(); err != nil {
+		return nil, false, fmt.Errorf("failed to fetch claims from profile URL: %v", err)
 	}
 
-	if value := getClaimFrom(claim, c.profileClaims); value != nil {
+	value, err = getClaimWithSources(claim, c.profileClaims, c.profileSources)
+	if err != nil {
+		return nil, false, err
+	}
+	if value != nil {
 		return value, true, nil
 	}
 
 	return nil, false, nil
 }
 
+// getMergedClaim reads the claim from both the ID Token and the userinfo
+// response and chooses the value based on the precedence of the claim.
+func (c *claimExtractor) getMergedClaim(claim string) (interface{}, bool, error) {
+	tokenValue, err := getClaimWithSources(claim, c.tokenClaims, c.tokenSources)
+	if err != nil {
+		return nil, false, err
+	}
+	profileValue, err := getClaimWithSources(claim, c.profileClaims, c.profileSources)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var value interface{}
+	switch c.precedence(claim) {
+	case PreferUserInfo:
+		value = firstNonNil(profileValue, tokenValue)
+	case MergeValues:
+		value = mergeClaimValues(tokenValue, profileValue)
+	default:
+		value = firstNonNil(tokenValue, profileValue)
+	}
+	return value, value != nil, nil
+}
+
+// ensureProfileClaims loads the profile claims if they have not been loaded yet.
+func (c *claimExtractor) ensureProfileClaims() error {
+	if c.profileClaims != nil {
+		return nil
+	}
+
+	profileClaims, err := c.loadProfileClaims()
+	if err != nil {
+		return err
+	}
+	profileSources, err := newClaimSources(c.ctx, profileClaims, c.issuers)
+	if err != nil {
+		return fmt.Errorf("failed to parse claim sources: %v", err)
+	}
+
+	c.profileClaims = profileClaims
+	c.profileSources = profileSources
+	return nil
+}
+
 // loadProfileClaims will fetch the profileURL using the provided headers as
 // authentication.
 func (c *claimExtractor) loadProfileClaims() (*simplejson.Json, error) {
@@ -149,6 +263,53 @@ func getClaimFrom(claim string, src *simplejson.Json) interface{} {
 	return src.GetPath(claimParts...).Interface()
 }
 
+// getClaimWithSources gets a claim from a Json object, falling back to the
+// aggregated or distributed claim sources referenced by the object.
+func getClaimWithSources(claim string, src *simplejson.Json, sources *claimSources) (interface{}, error) {
+	if value := getClaimFrom(claim, src); value != nil || sources == nil {
+		return value, nil
+	}
+	return sources.getClaim(claim)
+}
+
+func firstNonNil(values ...interface{}) interface{} {
+	for _, v := range values {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// mergeClaimValues combines two claim values into a list without duplicates.
+// When neither value is a list, the first value is returned.
+func mergeClaimValues(a, b interface{}) interface{} {
+	_, aIsList := a.([]interface{})
+	_, bIsList := b.([]interface{})
+	if a == nil || b == nil || (!aIsList && !bIsList) {
+		return firstNonNil(a, b)
+	}
+
+	merged := []interface{}{}
+	seen := make(map[string]struct{})
+	for _, value := range []interface{}{a, b} {
+		list, ok := value.([]interface{})
+		if !ok {
+			list = []interface{}{value}
+		}
+		for _, v := range list {
+			// Values decoded from JSON can always be marshalled back
+			key, _ := toString(v)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			merged = append(merged, v)
+		}
+	}
+	return merged
+}
+
 // coerceClaim tries to convert the value into the destination interface type.
 // If it can convert the value, it will then store the value in the destination
 // interface.
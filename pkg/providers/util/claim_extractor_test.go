@@ -74,7 +74,7 @@ var _ = Describe("Claim Extractor Suite", func() {
 
 		DescribeTable("NewClaimExtractor",
 			func(in newClaimExtractorTableInput) {
-				_, err := NewClaimExtractor(context.Background(), in.idToken, nil, nil)
+				_, err := NewClaimExtractor(context.Background(), in.idToken, nil, nil, nil)
 				if in.expectedError != nil {
 					Expect(err).To(MatchError(in.expectedError))
 				} else {
@@ -310,6 +310,100 @@ var _ = Describe("Claim Extractor Suite", func() {
 		Expect(value).To(BeNil())
 	})
 
+	Context("UserInfo Claim Extractor", func() {
+		userInfoPayload := `{
+			"sub": "subject",
+			"user": "userInfoUser",
+			"groups": ["idTokenGroup2", "userInfoGroup"],
+			"picture": "https://example.com/picture.png"
+		}`
+		idTokenPayload := `{
+			"sub": "subject",
+			"user": "idTokenUser",
+			"email": "idTokenEmail",
+			"groups": ["idTokenGroup1", "idTokenGroup2"]
+		}`
+
+		newUserInfoExtractor := func(handler http.HandlerFunc, precedence PrecedenceRules) (ClaimExtractor, error) {
+			server := httptest.NewServer(handler)
+			DeferCleanup(server.Close)
+			userInfoURL, err := url.Parse(server.URL + profilePath)
+			Expect(err).ToNot(HaveOccurred())
+
+			return NewUserInfoClaimExtractor(context.Background(), createJWTFromPayload(idTokenPayload), userInfoURL, newAuthorizedHeader(), precedence, nil)
+		}
+
+		userInfoHandler := func(rw http.ResponseWriter, req *http.Request) {
+			if !hasAuthorizedHeader(req.Header) {
+				rw.WriteHeader(403)
+				return
+			}
+			rw.Write([]byte(userInfoPayload))
+		}
+
+		type userInfoClaimTableInput struct {
+			precedence    PrecedenceRules
+			claim         string
+			expectedValue interface{}
+		}
+
+		DescribeTable("GetClaim",
+			func(in userInfoClaimTableInput) {
+				extractor, err := newUserInfoExtractor(userInfoHandler, in.precedence)
+				Expect(err).ToNot(HaveOccurred())
+
+				value, exists, err := extractor.GetClaim(in.claim)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(exists).To(BeTrue())
+				Expect(value).To(Equal(in.expectedValue))
+			},
+			Entry("prefers the ID Token by default", userInfoClaimTableInput{
+				precedence:    func(string) Precedence { return PreferIDToken },
+				claim:         "user",
+				expectedValue: "idTokenUser",
+			}),
+			Entry("prefers the userinfo response when configured", userInfoClaimTableInput{
+				precedence:    func(string) Precedence { return PreferUserInfo },
+				claim:         "user",
+				expectedValue: "userInfoUser",
+			}),
+			Entry("falls back to the ID Token for claims missing from userinfo", userInfoClaimTableInput{
+				precedence:    func(string) Precedence { return PreferUserInfo },
+				claim:         "email",
+				expectedValue: "idTokenEmail",
+			}),
+			Entry("includes claims only present in the userinfo response", userInfoClaimTableInput{
+				precedence:    func(string) Precedence { return PreferIDToken },
+				claim:         "picture",
+				expectedValue: "https://example.com/picture.png",
+			}),
+			Entry("merges list claims without duplicates", userInfoClaimTableInput{
+				precedence:    func(string) Precedence { return MergeValues },
+				claim:         "groups",
+				expectedValue: []interface{}{"idTokenGroup1", "idTokenGroup2", "userInfoGroup"},
+			}),
+			Entry("uses the ID Token for merged single value claims", userInfoClaimTableInput{
+				precedence:    func(string) Precedence { return MergeValues },
+				claim:         "user",
+				expectedValue: "idTokenUser",
+			}),
+		)
+
+		It("rejects a userinfo response for another subject", func() {
+			_, err := newUserInfoExtractor(func(rw http.ResponseWriter, _ *http.Request) {
+				rw.Write([]byte(`{"sub": "other"}`))
+			}, func(string) Precedence { return PreferUserInfo })
+			Expect(err).To(MatchError("userinfo subject \"other\" does not match ID Token subject \"subject\""))
+		})
+
+		It("returns an error when the userinfo endpoint fails", func() {
+			_, err := newUserInfoExtractor(func(rw http.ResponseWriter, _ *http.Request) {
+				rw.WriteHeader(http.StatusInternalServerError)
+			}, func(string) Precedence { return PreferUserInfo })
+			Expect(err).To(MatchError(ContainSubstring("failed to fetch claims from userinfo endpoint")))
+		})
+	})
+
 	type getClaimIntoTableInput struct {
 		testClaimExtractorOpts
 		into          interface{}
@@ -524,7 +618,7 @@ func newTestClaimExtractor(in testClaimExtractorOpts) (ClaimExtractor, func(), e
 
 	rawIDToken := createJWTFromPayload(in.idTokenPayload)
 
-	claimExtractor, err := NewClaimExtractor(context.Background(), rawIDToken, profileURL, in.profileRequestHeaders)
+	claimExtractor, err := NewClaimExtractor(context.Background(), rawIDToken, profileURL, in.profileRequestHeaders, nil)
 	return claimExtractor, closeServer, err
 }
 
@@ -0,0 +1,152 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cache"
+	internaloidc "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/providers/oidc"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// claimsProviderCacheSize is the maximum number of claims providers whose
+	// verifiers are cached
+	claimsProviderCacheSize = 100
+
+	// claimsProviderCacheTTL is how long the discovered verifier of a claims
+	// provider is used before discovery is repeated
+	claimsProviderCacheTTL = 24 * time.Hour
+)
+
+// claimsProviderVerifiers holds the verifiers of the claims providers that
+// signed aggregated and distributed claims, by issuer
+var claimsProviderVerifiers = &claimsProviderVerifierCache{
+	verifiers: cache.NewLRU[*oidc.IDTokenVerifier](claimsProviderCacheSize),
+}
+
+// claimsProviderVerifierCache discovers the signing keys of claims providers
+// once per issuer. The key sets refresh themselves when a JWT is signed with
+// an unknown key.
+type claimsProviderVerifierCache struct {
+	verifiers *cache.LRU[*oidc.IDTokenVerifier]
+	discovery singleflight.Group
+}
+
+// get returns the verifier for JWTs issued by the claims provider, using OIDC
+// discovery to find its JWKS the first time the issuer is seen. Concurrent
+// requests for the same issuer share a single discovery, and discovery of
+// one issuer does not block verification for other issuers.
+func (c *claimsProviderVerifierCache) get(ctx context.Context, issuer string) (*oidc.IDTokenVerifier, error) {
+	if verifier, ok := c.verifiers.Get(issuer, time.Now()); ok {
+		return verifier, nil
+	}
+
+	verifier, err, _ := c.discovery.Do(issuer, func() (interface{}, error) {
+		if verifier, ok := c.verifiers.Get(issuer, time.Now()); ok {
+			return verifier, nil
+		}
+		verifier, err := newClaimsProviderVerifier(ctx, issuer)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		c.verifiers.Set(issuer, verifier, now.Add(claimsProviderCacheTTL), now)
+		return verifier, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return verifier.(*oidc.IDTokenVerifier), nil
+}
+
+// newClaimsProviderVerifier discovers the JWKS of the claims provider and
+// creates a verifier for the JWTs it issues
+func newClaimsProviderVerifier(ctx context.Context, issuer string) (*oidc.IDTokenVerifier, error) {
+	provider, err := internaloidc.NewProvider(ctx, issuer, false)
+	if err != nil {
+		return nil, err
+	}
+	jwksURL := provider.Endpoints().JWKsURL
+	if jwksURL == "" {
+		return nil, fmt.Errorf("claims provider %q does not publish a jwks_uri", issuer)
+	}
+
+	// The key set outlives the request, so it must not use the request context
+	keySet := oidc.NewRemoteKeySet(oidc.ClientContext(context.Background(), requests.DefaultHTTPClient), jwksURL)
+	return oidc.NewVerifier(issuer, keySet, &oidc.Config{
+		// Claims JWTs are issued for the relying party of the ID Token and
+		// are not required to have an audience or an expiry
+		SkipClientIDCheck:    true,
+		SkipExpiryCheck:      true,
+		SupportedSigningAlgs: provider.SupportedSigningAlgs(),
+	}), nil
+}
+
+// trustsClaimsIssuer checks whether claims JWTs may be issued by the issuer:
+// a trusted claims provider, or for distributed claims the claims provider
+// at the origin of the endpoint the claims were fetched from. Other issuers
+// are rejected before discovery so that the unverified `iss` claim cannot
+// make the proxy request arbitrary URLs.
+func trustsClaimsIssuer(issuer string, trustedIssuers []string, endpoint string) bool {
+	for _, trusted := range trustedIssuers {
+		if issuer == trusted {
+			return true
+		}
+	}
+	if endpoint == "" {
+		return false
+	}
+
+	issuerURL, err := url.Parse(issuer)
+	if err != nil {
+		return false
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return false
+	}
+	return issuerURL.Scheme == endpointURL.Scheme && issuerURL.Host != "" && issuerURL.Host == endpointURL.Host
+}
+
+// verifyClaimsJWT verifies the signature of an aggregated or distributed
+// claims JWT against the JWKS of the claims provider named by its `iss` claim
+// and returns the JWT payload. The endpoint is the URL distributed claims
+// were fetched from, and is empty for aggregated claims.
+func verifyClaimsJWT(ctx context.Context, rawJWT string, trustedIssuers []string, endpoint string) ([]byte, error) {
+	payload, err := parseJWT(rawJWT)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("error reading json: %v", err)
+	}
+	if claims.Issuer == "" {
+		return nil, fmt.Errorf("claims JWT has no issuer")
+	}
+	if !trustsClaimsIssuer(claims.Issuer, trustedIssuers, endpoint) {
+		return nil, fmt.Errorf("claims JWT issuer %q is not a trusted claims provider", claims.Issuer)
+	}
+
+	verifier, err := claimsProviderVerifiers.get(ctx, claims.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("could not load keys of claims provider: %v", err)
+	}
+	token, err := verifier.Verify(oidc.ClientContext(ctx, requests.DefaultHTTPClient), rawJWT)
+	if err != nil {
+		return nil, fmt.Errorf("could not verify claims JWT: %v", err)
+	}
+	if !token.Expiry.IsZero() && token.Expiry.Before(time.Now()) {
+		return nil, fmt.Errorf("claims JWT expired at %s", token.Expiry)
+	}
+	return payload, nil
+}
@@ -0,0 +1,151 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+)
+
+// claimSources resolves aggregated and distributed claims as described in
+// OpenID Connect Core 1.0 section 5.6.2.
+// Claims listed in `_claim_names` are loaded from the source referenced in
+// `_claim_sources` the first time they are requested.
+type claimSources struct {
+	ctx      context.Context
+	issuers  []string
+	names    map[string]string
+	sources  map[string]claimSource
+	resolved map[string]*simplejson.Json
+}
+
+// claimSource is an entry of `_claim_sources`. Aggregated claims are
+// contained in a JWT while distributed claims are fetched from an endpoint.
+type claimSource struct {
+	JWT         string `json:"JWT"`
+	Endpoint    string `json:"endpoint"`
+	AccessToken string `json:"access_token"`
+}
+
+// newClaimSources reads the claim sources from a set of claims.
+// If the claims do not reference any other sources, nil is returned.
+// Claims returned as a JWT must be issued by one of the trusted issuers or,
+// for distributed claims, by the claims provider of the endpoint.
+func newClaimSources(ctx context.Context, claims *simplejson.Json, trustedIssuers []string) (*claimSources, error) {
+	namesJSON, ok := claims.CheckGet("_claim_names")
+	if !ok {
+		return nil, nil
+	}
+
+	s := &claimSources{
+		ctx:      ctx,
+		issuers:  trustedIssuers,
+		resolved: make(map[string]*simplejson.Json),
+	}
+	if err := unmarshalSimpleJSON(namesJSON, &s.names); err != nil {
+		return nil, fmt.Errorf("invalid _claim_names: %v", err)
+	}
+	if err := unmarshalSimpleJSON(claims.Get("_claim_sources"), &s.sources); err != nil {
+		return nil, fmt.Errorf("invalid _claim_sources: %v", err)
+	}
+	return s, nil
+}
+
+// getClaim returns the value of the claim from the source it is published in.
+// Claim paths are resolved from the source of their top level claim.
+func (s *claimSources) getClaim(claim string) (interface{}, error) {
+	sourceName, ok := s.names[claim]
+	if !ok {
+		sourceName, ok = s.names[strings.Split(claim, ".")[0]]
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	claims, err := s.resolve(sourceName)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve claim source %q: %v", sourceName, err)
+	}
+	return getClaimFrom(claim, claims), nil
+}
+
+// resolve loads the claims of a source, caching the result so that each
+// source is only fetched once.
+func (s *claimSources) resolve(name string) (*simplejson.Json, error) {
+	if claims, ok := s.resolved[name]; ok {
+		return claims, nil
+	}
+
+	source, ok := s.sources[name]
+	if !ok {
+		return nil, fmt.Errorf("source is not defined in _claim_sources")
+	}
+
+	var claims *simplejson.Json
+	var err error
+	switch {
+	case source.JWT != "":
+		claims, err = s.parseClaimsResponse([]byte(source.JWT), "")
+	case source.Endpoint != "":
+		claims, err = s.fetch(source)
+	default:
+		err = fmt.Errorf("source has neither a JWT nor an endpoint")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.resolved[name] = claims
+	return claims, nil
+}
+
+// fetch requests distributed claims from the source endpoint, using the
+// access token issued for the endpoint if there is one.
+func (s *claimSources) fetch(source claimSource) (*simplejson.Json, error) {
+	builder := requests.New(source.Endpoint).WithContext(s.ctx)
+	if source.AccessToken != "" {
+		builder = builder.SetHeader("Authorization", "Bearer "+source.AccessToken)
+	}
+
+	result := builder.Do()
+	if result.Error() != nil {
+		return nil, result.Error()
+	}
+	if result.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status \"%d\": %s", result.StatusCode(), result.Body())
+	}
+	return s.parseClaimsResponse(result.Body(), source.Endpoint)
+}
+
+// parseClaimsResponse parses claims that are returned either as a JSON
+// object or as a JWT. JWTs must be signed by the claims provider.
+func (s *claimSources) parseClaimsResponse(body []byte, endpoint string) (*simplejson.Json, error) {
+	body = bytes.TrimSpace(body)
+	if !bytes.HasPrefix(body, []byte("{")) {
+		payload, err := verifyClaimsJWT(s.ctx, string(body), s.issuers, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		body = payload
+	}
+
+	claims, err := simplejson.NewJson(body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading json: %v", err)
+	}
+	return claims, nil
+}
+
+// unmarshalSimpleJSON decodes a simplejson value into a typed destination.
+func unmarshalSimpleJSON(src *simplejson.Json, dst interface{}) error {
+	data, err := src.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
@@ -0,0 +1,293 @@
+package util
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/golang-jwt/jwt/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const claimsProviderKeyID = "claims-provider-key"
+
+var _ = Describe("Claim Sources Suite", func() {
+	var sourceServer *httptest.Server
+	var sourceRequests int32
+	var claimsProvider *httptest.Server
+	var claimsProviderKey *rsa.PrivateKey
+	var discoveryRequests int32
+
+	// signClaims creates a JWT with the claims, signed by the key of the
+	// claims provider
+	signClaims := func(key *rsa.PrivateKey, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = claimsProviderKeyID
+		signed, err := token.SignedString(key)
+		Expect(err).ToNot(HaveOccurred())
+		return signed
+	}
+
+	BeforeEach(func() {
+		var err error
+		claimsProviderKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).ToNot(HaveOccurred())
+
+		// serveDiscovery serves the OIDC discovery document and JWKS of a
+		// claims provider, returning false for other paths
+		serveDiscovery := func(server **httptest.Server, rw http.ResponseWriter, req *http.Request) bool {
+			rw.Header().Set("Content-Type", "application/json")
+			switch req.URL.Path {
+			case "/.well-known/openid-configuration":
+				atomic.AddInt32(&discoveryRequests, 1)
+				json.NewEncoder(rw).Encode(map[string]interface{}{
+					"issuer":   (*server).URL,
+					"jwks_uri": (*server).URL + "/jwks",
+				})
+			case "/jwks":
+				json.NewEncoder(rw).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+					Key:       &claimsProviderKey.PublicKey,
+					KeyID:     claimsProviderKeyID,
+					Algorithm: "RS256",
+					Use:       "sig",
+				}}})
+			default:
+				return false
+			}
+			return true
+		}
+
+		discoveryRequests = 0
+		claimsProvider = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if !serveDiscovery(&claimsProvider, rw, req) {
+				rw.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		sourceRequests = 0
+		sourceServer = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if serveDiscovery(&sourceServer, rw, req) {
+				return
+			}
+			atomic.AddInt32(&sourceRequests, 1)
+			if req.Header.Get("Authorization") != "Bearer source-token" {
+				rw.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			switch req.URL.Path {
+			case "/json":
+				rw.Write([]byte(`{"groups": ["distributedGroup1", "distributedGroup2"]}`))
+			case "/jwt":
+				rw.Header().Set("Content-Type", "application/jwt")
+				rw.Write([]byte(signClaims(claimsProviderKey, jwt.MapClaims{
+					"iss":    claimsProvider.URL,
+					"groups": []string{"signedGroup"},
+				})))
+			case "/self-issued-jwt":
+				rw.Header().Set("Content-Type", "application/jwt")
+				rw.Write([]byte(signClaims(claimsProviderKey, jwt.MapClaims{
+					"iss":    sourceServer.URL,
+					"groups": []string{"selfSignedGroup"},
+				})))
+			default:
+				rw.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		sourceServer.Close()
+		claimsProvider.Close()
+	})
+
+	distributedPayload := func(path, accessToken string) string {
+		return fmt.Sprintf(`{
+			"sub": "user",
+			"_claim_names": {"groups": "src1"},
+			"_claim_sources": {"src1": {"endpoint": %q, "access_token": %q}}
+		}`, sourceServer.URL+path, accessToken)
+	}
+
+	aggregatedPayload := func(aggregated string) string {
+		return fmt.Sprintf(`{
+			"_claim_names": {"groups": "src1", "org": "src1"},
+			"_claim_sources": {"src1": {"JWT": %q}}
+		}`, aggregated)
+	}
+
+	It("resolves aggregated claims", func() {
+		aggregated := signClaims(claimsProviderKey, jwt.MapClaims{
+			"iss":    claimsProvider.URL,
+			"groups": []string{"aggregatedGroup"},
+			"org":    map[string]string{"name": "example"},
+		})
+		extractor, err := NewClaimExtractor(context.Background(), createJWTFromPayload(aggregatedPayload(aggregated)), nil, nil, []string{claimsProvider.URL})
+		Expect(err).ToNot(HaveOccurred())
+
+		value, exists, err := extractor.GetClaim("groups")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exists).To(BeTrue())
+		Expect(value).To(Equal([]interface{}{"aggregatedGroup"}))
+
+		value, exists, err = extractor.GetClaim("org.name")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exists).To(BeTrue())
+		Expect(value).To(Equal("example"))
+	})
+
+	It("rejects aggregated claims from issuers that are not trusted without discovering them", func() {
+		aggregated := signClaims(claimsProviderKey, jwt.MapClaims{
+			"iss":    claimsProvider.URL,
+			"groups": []string{"aggregatedGroup"},
+		})
+		extractor, err := NewClaimExtractor(context.Background(), createJWTFromPayload(aggregatedPayload(aggregated)), nil, nil, []string{"https://claims.example.com"})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, _, err = extractor.GetClaim("groups")
+		Expect(err).To(MatchError(fmt.Sprintf("could not resolve claim source \"src1\": claims JWT issuer %q is not a trusted claims provider", claimsProvider.URL)))
+		Expect(discoveryRequests).To(BeEquivalentTo(0))
+	})
+
+	It("rejects aggregated claims that are not signed by the claims provider", func() {
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).ToNot(HaveOccurred())
+		aggregated := signClaims(otherKey, jwt.MapClaims{
+			"iss":    claimsProvider.URL,
+			"groups": []string{"aggregatedGroup"},
+		})
+		extractor, err := NewClaimExtractor(context.Background(), createJWTFromPayload(aggregatedPayload(aggregated)), nil, nil, []string{claimsProvider.URL})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, _, err = extractor.GetClaim("groups")
+		Expect(err).To(MatchError(ContainSubstring("could not resolve claim source \"src1\": could not verify claims JWT")))
+	})
+
+	It("rejects unsigned aggregated claims", func() {
+		aggregated := createJWTFromPayload(fmt.Sprintf(`{"iss": %q, "groups": ["aggregatedGroup"]}`, claimsProvider.URL))
+		extractor, err := NewClaimExtractor(context.Background(), createJWTFromPayload(aggregatedPayload(aggregated)), nil, nil, []string{claimsProvider.URL})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, _, err = extractor.GetClaim("groups")
+		Expect(err).To(MatchError(ContainSubstring("could not verify claims JWT")))
+	})
+
+	It("rejects aggregated claims without an issuer", func() {
+		aggregated := signClaims(claimsProviderKey, jwt.MapClaims{"groups": []string{"aggregatedGroup"}})
+		extractor, err := NewClaimExtractor(context.Background(), createJWTFromPayload(aggregatedPayload(aggregated)), nil, nil, []string{claimsProvider.URL})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, _, err = extractor.GetClaim("groups")
+		Expect(err).To(MatchError("could not resolve claim source \"src1\": claims JWT has no issuer"))
+	})
+
+	It("rejects expired aggregated claims", func() {
+		aggregated := signClaims(claimsProviderKey, jwt.MapClaims{
+			"iss":    claimsProvider.URL,
+			"exp":    time.Now().Add(-time.Hour).Unix(),
+			"groups": []string{"aggregatedGroup"},
+		})
+		extractor, err := NewClaimExtractor(context.Background(), createJWTFromPayload(aggregatedPayload(aggregated)), nil, nil, []string{claimsProvider.URL})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, _, err = extractor.GetClaim("groups")
+		Expect(err).To(MatchError(ContainSubstring("claims JWT expired at")))
+	})
+
+	It("resolves distributed claims once per source", func() {
+		extractor, err := NewClaimExtractor(context.Background(), createJWTFromPayload(distributedPayload("/json", "source-token")), nil, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		for i := 0; i < 2; i++ {
+			value, exists, err := extractor.GetClaim("groups")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exists).To(BeTrue())
+			Expect(value).To(Equal([]interface{}{"distributedGroup1", "distributedGroup2"}))
+		}
+		Expect(sourceRequests).To(BeEquivalentTo(1))
+	})
+
+	It("resolves distributed claims returned as a JWT by a trusted claims provider", func() {
+		extractor, err := NewClaimExtractor(context.Background(), createJWTFromPayload(distributedPayload("/jwt", "source-token")), nil, nil, []string{claimsProvider.URL})
+		Expect(err).ToNot(HaveOccurred())
+
+		var groups []string
+		exists, err := extractor.GetClaimInto("groups", &groups)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exists).To(BeTrue())
+		Expect(groups).To(ConsistOf("signedGroup"))
+	})
+
+	It("resolves distributed claims returned as a JWT issued by the claims provider of the endpoint", func() {
+		extractor, err := NewClaimExtractor(context.Background(), createJWTFromPayload(distributedPayload("/self-issued-jwt", "source-token")), nil, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		var groups []string
+		exists, err := extractor.GetClaimInto("groups", &groups)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exists).To(BeTrue())
+		Expect(groups).To(ConsistOf("selfSignedGroup"))
+	})
+
+	It("rejects distributed claims returned as a JWT issued by another claims provider", func() {
+		extractor, err := NewClaimExtractor(context.Background(), createJWTFromPayload(distributedPayload("/jwt", "source-token")), nil, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, _, err = extractor.GetClaim("groups")
+		Expect(err).To(MatchError(ContainSubstring("is not a trusted claims provider")))
+		Expect(discoveryRequests).To(BeEquivalentTo(0))
+	})
+
+	It("does not request sources for claims that are not referenced", func() {
+		extractor, err := NewClaimExtractor(context.Background(), createJWTFromPayload(distributedPayload("/json", "source-token")), nil, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		value, exists, err := extractor.GetClaim("sub")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exists).To(BeTrue())
+		Expect(value).To(Equal("user"))
+		Expect(sourceRequests).To(BeEquivalentTo(0))
+	})
+
+	It("returns an error when a distributed source cannot be fetched", func() {
+		extractor, err := NewClaimExtractor(context.Background(), createJWTFromPayload(distributedPayload("/json", "wrong-token")), nil, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, _, err = extractor.GetClaim("groups")
+		Expect(err).To(MatchError(ContainSubstring("could not resolve claim source \"src1\": unexpected status \"401\"")))
+	})
+
+	It("returns an error when a claim references an undefined source", func() {
+		extractor, err := NewClaimExtractor(context.Background(), createJWTFromPayload(`{"_claim_names": {"groups": "missing"}}`), nil, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, _, err = extractor.GetClaim("groups")
+		Expect(err).To(MatchError("could not resolve claim source \"missing\": source is not defined in _claim_sources"))
+	})
+
+	It("resolves distributed claims referenced by the profile URL", func() {
+		profileServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			rw.Write([]byte(distributedPayload("/json", "source-token")))
+		}))
+		defer profileServer.Close()
+		profileURL, err := url.Parse(profileServer.URL + profilePath)
+		Expect(err).ToNot(HaveOccurred())
+
+		extractor, err := NewClaimExtractor(context.Background(), createJWTFromPayload(emptyJSON), profileURL, newAuthorizedHeader(), nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		var groups []string
+		exists, err := extractor.GetClaimInto("groups", &groups)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exists).To(BeTrue())
+		Expect(groups).To(ConsistOf("distributedGroup1", "distributedGroup2"))
+	})
+})
@@ -0,0 +1,28 @@
+package proxyjwt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+)
+
+// sessionTokenCacheSize is the maximum number of per session tokens cached
+const sessionTokenCacheSize = 10000
+
+// sessionTokenCacheKey identifies the token of a session for an audience and
+// set of claims. Sessions are identified by a hash of their access token, or
+// of their user and creation time when they have none, so that a refreshed
+// session gets a new token with its updated claims.
+func sessionTokenCacheKey(session *sessionsapi.SessionState, audience string, claimNames []string) string {
+	identity := session.AccessToken
+	if identity == "" {
+		identity = session.User
+		if session.CreatedAt != nil {
+			identity += "\x00" + session.CreatedAt.String()
+		}
+	}
+	sum := sha256.Sum256([]byte(strings.Join(append([]string{identity, audience}, claimNames...), "\x00")))
+	return hex.EncodeToString(sum[:])
+}
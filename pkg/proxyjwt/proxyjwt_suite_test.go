@@ -0,0 +1,13 @@
+package proxyjwt
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestProxyJWTSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Proxy JWT")
+}
@@ -0,0 +1,223 @@
+// Package proxyjwt mints JWTs signed by the proxy to propagate the identity
+// of the authenticated user to upstreams, which can verify them offline with
+// the proxy's JWKS.
+package proxyjwt
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options/util"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cache"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+)
+
+const (
+	// DefaultIssuer is the `iss` claim of tokens when no issuer is configured
+	DefaultIssuer = "oauth2-proxy"
+
+	// DefaultLifetime is how long tokens are valid for when no lifetime is configured
+	DefaultLifetime = 5 * time.Minute
+
+	// sessionTokenRenewDivisor sets when per session tokens are renewed: once
+	// less than this fraction of their lifetime remains, so that upstreams
+	// are not sent tokens that are about to expire
+	sessionTokenRenewDivisor = 5
+)
+
+// Signer signs JWTs carrying the identity of a session
+type Signer struct {
+	key        crypto.Signer
+	method     jwt.SigningMethod
+	keyID      string
+	issuer     string
+	lifetime   time.Duration
+	perSession bool
+	jwks       []byte
+
+	// cache holds the per session tokens until they are due for renewal
+	cache *cache.LRU[string]
+
+	clock clock.Clock
+}
+
+// NewSigner loads the signing key and builds a Signer from the options.
+func NewSigner(opts options.ProxyJWT) (*Signer, error) {
+	if opts.SigningKey == nil {
+		return nil, errors.New("signing key is required")
+	}
+	keyData, err := util.GetSecretValue(opts.SigningKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not load signing key: %v", err)
+	}
+
+	s := &Signer{
+		keyID:      opts.KeyID,
+		issuer:     opts.Issuer,
+		lifetime:   DefaultLifetime,
+		perSession: opts.PerSession,
+	}
+	if s.issuer == "" {
+		s.issuer = DefaultIssuer
+	}
+	if opts.Lifetime != nil {
+		s.lifetime = opts.Lifetime.Duration()
+	}
+	if s.perSession {
+		s.cache = cache.NewLRU[string](sessionTokenCacheSize)
+	}
+
+	if rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM(keyData); err == nil {
+		s.key = rsaKey
+		s.method = jwt.SigningMethodRS256
+	} else if ecKey, err := jwt.ParseECPrivateKeyFromPEM(keyData); err == nil {
+		if ecKey.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 ECDSA keys are supported")
+		}
+		s.key = ecKey
+		s.method = jwt.SigningMethodES256
+	} else {
+		return nil, errors.New("signing key must be a PEM encoded RSA or ECDSA private key")
+	}
+
+	if err := s.buildJWKS(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// buildJWKS serializes the public key as a JSON Web Key Set, deriving the
+// key ID from the key's thumbprint if none is configured.
+func (s *Signer) buildJWKS() error {
+	jwk := jose.JSONWebKey{
+		Key:       s.key.Public(),
+		Algorithm: s.method.Alg(),
+		Use:       "sig",
+	}
+	if s.keyID == "" {
+		thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return fmt.Errorf("could not compute key thumbprint: %v", err)
+		}
+		s.keyID = base64.RawURLEncoding.EncodeToString(thumbprint)
+	}
+	jwk.KeyID = s.keyID
+
+	jwks, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk}})
+	if err != nil {
+		return fmt.Errorf("could not marshal JWKS: %v", err)
+	}
+	s.jwks = jwks
+	return nil
+}
+
+// JWKS returns the JSON Web Key Set containing the public signing key
+func (s *Signer) JWKS() []byte {
+	return s.jwks
+}
+
+// Sign mints a token for the audience identifying the session's user.
+// The selected session claims are added to the token. Per session tokens are
+// reused for every request of the session until they are due for renewal.
+func (s *Signer) Sign(session *sessionsapi.SessionState, audience string, claimNames []string) (string, error) {
+	if session == nil {
+		return "", errors.New("no session to sign a token for")
+	}
+
+	now := s.clock.Now()
+	var cacheKey string
+	if s.perSession {
+		cacheKey = sessionTokenCacheKey(session, audience, claimNames)
+		if token, ok := s.cache.Get(cacheKey, now); ok {
+			return token, nil
+		}
+	}
+
+	claims := jwt.MapClaims{
+		"iss": s.issuer,
+		"sub": session.User,
+	}
+	if audience != "" {
+		claims["aud"] = audience
+	}
+	if session.Email != "" {
+		claims["email"] = session.Email
+	}
+	if session.PreferredUsername != "" {
+		claims["preferred_username"] = session.PreferredUsername
+	}
+	if len(session.Groups) > 0 {
+		claims["groups"] = session.Groups
+	}
+	for _, name := range claimNames {
+		if values := nonEmpty(session.GetClaim(name)); len(values) == 1 {
+			claims[name] = values[0]
+		} else if len(values) > 1 {
+			claims[name] = values
+		}
+	}
+
+	renewAt, err := s.setLifetimeClaims(claims, session, now)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(s.method, claims)
+	token.Header["kid"] = s.keyID
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		return "", err
+	}
+	if s.perSession {
+		s.cache.Set(cacheKey, signed, renewAt, now)
+	}
+	return signed, nil
+}
+
+// setLifetimeClaims sets when the token was issued and expires, and returns
+// when it is due for renewal. Tokens expire after the configured lifetime; a
+// per session token also expires with the session's access token, and is
+// renewed shortly before it expires unless the access token expires first.
+func (s *Signer) setLifetimeClaims(claims jwt.MapClaims, session *sessionsapi.SessionState, now time.Time) (time.Time, error) {
+	expiresAt := now.Add(s.lifetime)
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+
+	if s.perSession {
+		renewAt := expiresAt.Add(-s.lifetime / sessionTokenRenewDivisor)
+		if session.ExpiresOn != nil && !session.ExpiresOn.IsZero() && session.ExpiresOn.Before(expiresAt) {
+			expiresAt = *session.ExpiresOn
+			renewAt = expiresAt
+		}
+		claims["exp"] = expiresAt.Unix()
+		return renewAt, nil
+	}
+
+	jti, err := encryption.Nonce(32)
+	if err != nil {
+		return time.Time{}, err
+	}
+	claims["jti"] = base64.RawURLEncoding.EncodeToString(jti)
+	claims["exp"] = expiresAt.Unix()
+	return expiresAt, nil
+}
+
+func nonEmpty(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,182 @@
+package proxyjwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Signer", func() {
+	var ecKeyPEM []byte
+
+	BeforeEach(func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		der, err := x509.MarshalECPrivateKey(key)
+		Expect(err).ToNot(HaveOccurred())
+		ecKeyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	})
+
+	// verify parses the token with the key published in the signer's JWKS
+	verify := func(signer *Signer, token string) jwt.MapClaims {
+		var jwks jose.JSONWebKeySet
+		Expect(json.Unmarshal(signer.JWKS(), &jwks)).To(Succeed())
+		Expect(jwks.Keys).To(HaveLen(1))
+
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+			keys := jwks.Key(t.Header["kid"].(string))
+			Expect(keys).To(HaveLen(1))
+			return keys[0].Key, nil
+		}, jwt.WithValidMethods([]string{signer.method.Alg()}), jwt.WithTimeFunc(signer.clock.Now))
+		Expect(err).ToNot(HaveOccurred())
+		return claims
+	}
+
+	session := func() *sessionsapi.SessionState {
+		createdAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+		expiresOn := createdAt.Add(time.Hour)
+		return &sessionsapi.SessionState{
+			User:              "1234",
+			Email:             "jane@example.com",
+			PreferredUsername: "jane",
+			Groups:            []string{"admins", "users"},
+			AccessToken:       "access-token",
+			CreatedAt:         &createdAt,
+			ExpiresOn:         &expiresOn,
+		}
+	}
+
+	It("signs short-lived tokens for a session", func() {
+		signer, err := NewSigner(options.ProxyJWT{
+			SigningKey: &options.SecretSource{Value: ecKeyPEM},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		token, err := signer.Sign(session(), "https://upstream.example.com", []string{"access_token"})
+		Expect(err).ToNot(HaveOccurred())
+
+		claims := verify(signer, token)
+		Expect(claims["iss"]).To(Equal(DefaultIssuer))
+		Expect(claims["aud"]).To(Equal("https://upstream.example.com"))
+		Expect(claims["sub"]).To(Equal("1234"))
+		Expect(claims["email"]).To(Equal("jane@example.com"))
+		Expect(claims["preferred_username"]).To(Equal("jane"))
+		Expect(claims["groups"]).To(ConsistOf("admins", "users"))
+		Expect(claims["access_token"]).To(Equal("access-token"))
+		Expect(claims["jti"]).ToNot(BeEmpty())
+
+		exp, err := claims.GetExpirationTime()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exp.Time).To(BeTemporally("~", time.Now().Add(DefaultLifetime), time.Second))
+	})
+
+	Context("with per session tokens", func() {
+		var signer *Signer
+
+		BeforeEach(func() {
+			lifetime := options.Duration(10 * time.Minute)
+			var err error
+			signer, err = NewSigner(options.ProxyJWT{
+				SigningKey: &options.SecretSource{Value: ecKeyPEM},
+				Issuer:     "https://proxy.example.com",
+				KeyID:      "proxy-key",
+				Lifetime:   &lifetime,
+				PerSession: true,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			signer.clock.Set(time.Now().Truncate(time.Second))
+		})
+
+		It("signs tokens that expire after the lifetime", func() {
+			token, err := signer.Sign(session(), "", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			claims := verify(signer, token)
+			Expect(claims["iss"]).To(Equal("https://proxy.example.com"))
+			Expect(claims).ToNot(HaveKey("aud"))
+			Expect(claims).ToNot(HaveKey("jti"))
+
+			iat, err := claims.GetIssuedAt()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(iat.Time).To(Equal(signer.clock.Now()))
+			exp, err := claims.GetExpirationTime()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exp.Time).To(Equal(signer.clock.Now().Add(10 * time.Minute)))
+		})
+
+		It("signs tokens that expire with the session's access token", func() {
+			s := session()
+			expiresOn := signer.clock.Now().Add(time.Minute)
+			s.ExpiresOn = &expiresOn
+
+			token, err := signer.Sign(s, "", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			exp, err := verify(signer, token).GetExpirationTime()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exp.Time).To(Equal(expiresOn))
+		})
+
+		It("reuses the token of a session until it is due for renewal", func() {
+			s := session()
+			token, err := signer.Sign(s, "", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(signer.clock.Add(7 * time.Minute)).To(Succeed())
+			Expect(signer.Sign(s, "", nil)).To(Equal(token))
+
+			// Other audiences and refreshed sessions get their own token
+			Expect(signer.Sign(s, "https://upstream.example.com", nil)).ToNot(Equal(token))
+			refreshed := session()
+			refreshed.AccessToken = "refreshed-access-token"
+			Expect(signer.Sign(refreshed, "", nil)).ToNot(Equal(token))
+
+			Expect(signer.clock.Add(2 * time.Minute)).To(Succeed())
+			renewed, err := signer.Sign(s, "", nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(renewed).ToNot(Equal(token))
+
+			exp, err := verify(signer, renewed).GetExpirationTime()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exp.Time).To(Equal(signer.clock.Now().Add(10 * time.Minute)))
+		})
+	})
+
+	It("signs with RSA keys", func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).ToNot(HaveOccurred())
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+		signer, err := NewSigner(options.ProxyJWT{
+			SigningKey: &options.SecretSource{Value: keyPEM},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		token, err := signer.Sign(session(), "upstream", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(verify(signer, token)["sub"]).To(Equal("1234"))
+	})
+
+	It("rejects invalid signing keys", func() {
+		_, err := NewSigner(options.ProxyJWT{})
+		Expect(err).To(MatchError("signing key is required"))
+
+		_, err = NewSigner(options.ProxyJWT{
+			SigningKey: &options.SecretSource{Value: []byte("not a key")},
+		})
+		Expect(err).To(MatchError("signing key must be a PEM encoded RSA or ECDSA private key"))
+	})
+})
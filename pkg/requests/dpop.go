@@ -0,0 +1,71 @@
+package requests
+
+import (
+	"crypto/ecdsa"
+	"net/http"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/dpop"
+)
+
+// dpopTransport adds a DPoP proof (RFC 9449) to requests whose context
+// carries a DPoP key. Bearer authorization headers are sent with the DPoP
+// scheme and the proof is bound to the access token.
+// When the server responds with a DPoP-Nonce the request is retried once
+// with the nonce included in the proof.
+type dpopTransport struct {
+	next http.RoundTripper
+}
+
+func (t *dpopTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := dpop.KeyFromContext(req.Context())
+	if key == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	resp, err := t.roundTripWithProof(req, key, "")
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := resp.Header.Get(dpop.NonceHeaderName)
+	if nonce == "" || (resp.StatusCode != http.StatusBadRequest && resp.StatusCode != http.StatusUnauthorized) {
+		return resp, nil
+	}
+	// The body has already been consumed and can't be replayed
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	return t.roundTripWithProof(retry, key, nonce)
+}
+
+func (t *dpopTransport) roundTripWithProof(req *http.Request, key *ecdsa.PrivateKey, nonce string) (*http.Response, error) {
+	r := req.Clone(req.Context())
+
+	var accessToken string
+	auth := r.Header.Get("Authorization")
+	switch {
+	case strings.HasPrefix(auth, "Bearer "):
+		accessToken = strings.TrimPrefix(auth, "Bearer ")
+		r.Header.Set("Authorization", dpop.TokenType+" "+accessToken)
+	case strings.HasPrefix(auth, dpop.TokenType+" "):
+		accessToken = strings.TrimPrefix(auth, dpop.TokenType+" ")
+	}
+
+	proof, err := dpop.NewProof(key, r.Method, r.URL.String(), accessToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set(dpop.HeaderName, proof)
+	return t.next.RoundTrip(r)
+}
@@ -0,0 +1,106 @@
+package requests
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/dpop"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DPoP Transport", func() {
+	var key *ecdsa.PrivateKey
+	var dpopServer *httptest.Server
+	var requestNonce string
+	var received []*http.Request
+	var receivedBodies []string
+
+	BeforeEach(func() {
+		var err error
+		key, err = dpop.GenerateKey()
+		Expect(err).ToNot(HaveOccurred())
+
+		requestNonce = ""
+		received = nil
+		receivedBodies = nil
+		dpopServer = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			received = append(received, req)
+			receivedBodies = append(receivedBodies, string(body))
+
+			if requestNonce != "" && proofClaims(req, key)["nonce"] != requestNonce {
+				rw.Header().Set(dpop.NonceHeaderName, requestNonce)
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte(`{"error":"use_dpop_nonce"}`))
+				return
+			}
+			rw.Write([]byte("OK"))
+		}))
+	})
+
+	AfterEach(func() {
+		dpopServer.Close()
+	})
+
+	It("does not add a proof without a key in the context", func() {
+		result := New(dpopServer.URL + "/userinfo").
+			SetHeader("Authorization", "Bearer token").
+			Do()
+		Expect(result.Error()).ToNot(HaveOccurred())
+
+		Expect(received).To(HaveLen(1))
+		Expect(received[0].Header.Get("Authorization")).To(Equal("Bearer token"))
+		Expect(received[0].Header.Get(dpop.HeaderName)).To(BeEmpty())
+	})
+
+	It("adds a proof bound to the access token", func() {
+		result := New(dpopServer.URL + "/userinfo?schema=openid").
+			WithContext(dpop.NewContext(context.Background(), key)).
+			SetHeader("Authorization", "Bearer token").
+			Do()
+		Expect(result.Error()).ToNot(HaveOccurred())
+
+		Expect(received).To(HaveLen(1))
+		Expect(received[0].Header.Get("Authorization")).To(Equal("DPoP token"))
+
+		claims := proofClaims(received[0], key)
+		Expect(claims["htm"]).To(Equal("GET"))
+		Expect(claims["htu"]).To(Equal(dpopServer.URL + "/userinfo"))
+		Expect(claims).To(HaveKey("ath"))
+	})
+
+	It("retries once with the nonce requested by the server", func() {
+		requestNonce = "server-nonce"
+
+		result := New(dpopServer.URL + "/token").
+			WithContext(dpop.NewContext(context.Background(), key)).
+			WithMethod("POST").
+			WithBody(bytes.NewBufferString("grant_type=refresh_token")).
+			Do()
+		Expect(result.Error()).ToNot(HaveOccurred())
+		Expect(result.StatusCode()).To(Equal(http.StatusOK))
+
+		Expect(received).To(HaveLen(2))
+		Expect(proofClaims(received[0], key)).ToNot(HaveKey("nonce"))
+		Expect(proofClaims(received[0], key)).ToNot(HaveKey("ath"))
+		Expect(proofClaims(received[1], key)["nonce"]).To(Equal("server-nonce"))
+		Expect(receivedBodies).To(Equal([]string{"grant_type=refresh_token", "grant_type=refresh_token"}))
+	})
+})
+
+func proofClaims(req *http.Request, key *ecdsa.PrivateKey) jwt.MapClaims {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(req.Header.Get(dpop.HeaderName), claims, func(*jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	})
+	if err != nil {
+		return jwt.MapClaims{}
+	}
+	return claims
+}
@@ -18,7 +18,7 @@ func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error
 }
 
 var DefaultHTTPClient = &http.Client{Transport: &userAgentTransport{
-	next:      DefaultTransport,
+	next:      &dpopTransport{next: DefaultTransport},
 	userAgent: "oauth2-proxy/" + version.VERSION,
 }}
 
@@ -0,0 +1,101 @@
+package util
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Forwarded is the name of the RFC 7239 forwarding header
+const Forwarded = "Forwarded"
+
+// ForwardedElement is an element of the RFC 7239 `Forwarded` header. Each
+// proxy a request passes through appends an element describing the request
+// it received.
+type ForwardedElement struct {
+	// For identifies the client of the proxy, e.g. `192.0.2.60`,
+	// `[2001:db8::1]:4711` or `unknown`
+	For string
+
+	// By identifies the proxy itself
+	By string
+
+	// Host is the host requested by the client of the proxy
+	Host string
+
+	// Proto is the protocol used by the client of the proxy
+	Proto string
+}
+
+// ParseForwarded returns the elements of the `Forwarded` headers, from the
+// element added by the proxy closest to the client to the element added by
+// the proxy closest to us. Empty elements, unknown parameters and pairs
+// without a value are ignored.
+func ParseForwarded(h http.Header) []ForwardedElement {
+	values := h.Values(Forwarded)
+	if len(values) == 0 {
+		return nil
+	}
+
+	elements := []ForwardedElement{}
+	for _, element := range splitQuoted(strings.Join(values, ","), ',') {
+		if strings.TrimSpace(element) == "" {
+			continue
+		}
+		var e ForwardedElement
+		for _, pair := range splitQuoted(element, ';') {
+			name, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				continue
+			}
+			value = unquote(strings.TrimSpace(value))
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "for":
+				e.For = value
+			case "by":
+				e.By = value
+			case "host":
+				e.Host = value
+			case "proto":
+				e.Proto = strings.ToLower(value)
+			}
+		}
+		elements = append(elements, e)
+	}
+	return elements
+}
+
+// splitQuoted splits s around each separator outside of a quoted string
+func splitQuoted(s string, sep byte) []string {
+	parts := []string{}
+	start := 0
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquote returns the content of a quoted string, or s if it is not quoted
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+
+	var b strings.Builder
+	s = s[1 : len(s)-1]
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
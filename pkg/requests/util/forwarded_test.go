@@ -0,0 +1,43 @@
+package util_test
+
+import (
+	"net/http"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests/util"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Forwarded Suite", func() {
+	DescribeTable("ParseForwarded",
+		func(values []string, expected []util.ForwardedElement) {
+			h := http.Header{}
+			for _, value := range values {
+				h.Add("Forwarded", value)
+			}
+			Expect(util.ParseForwarded(h)).To(Equal(expected))
+		},
+		Entry("without the header", nil, nil),
+		Entry("with a single element", []string{"for=192.0.2.60;proto=HTTP;by=203.0.113.43;host=example.com"}, []util.ForwardedElement{
+			{For: "192.0.2.60", By: "203.0.113.43", Host: "example.com", Proto: "http"},
+		}),
+		Entry("with case-insensitive parameter names and spaces", []string{"For=192.0.2.43 ; Proto=https"}, []util.ForwardedElement{
+			{For: "192.0.2.43", Proto: "https"},
+		}),
+		Entry("with quoted values", []string{`for="[2001:db8:cafe::17]:4711";host="example.com:8080"`}, []util.ForwardedElement{
+			{For: "[2001:db8:cafe::17]:4711", Host: "example.com:8080"},
+		}),
+		Entry("with separators and escapes in quoted values", []string{`for="a,b;c", for="d\"e"`}, []util.ForwardedElement{
+			{For: "a,b;c"},
+			{For: `d"e`},
+		}),
+		Entry("with multiple elements and headers", []string{"for=192.0.2.43, for=198.51.100.17", "for=10.0.0.1"}, []util.ForwardedElement{
+			{For: "192.0.2.43"},
+			{For: "198.51.100.17"},
+			{For: "10.0.0.1"},
+		}),
+		Entry("with empty elements and malformed pairs", []string{", for=192.0.2.43;secret;ext=1, "}, []util.ForwardedElement{
+			{For: "192.0.2.43"},
+		}),
+	)
+})
@@ -12,24 +12,26 @@ const (
 	XForwardedURI   = "X-Forwarded-Uri"
 )
 
-// GetRequestProto returns the request scheme or X-Forwarded-Proto if present
-// and the request is proxied.
+// GetRequestProto returns the request scheme or the forwarded proto if
+// present and the request is proxied.
 func GetRequestProto(req *http.Request) string {
-	proto := req.Header.Get(XForwardedProto)
-	if !IsProxied(req) || proto == "" {
-		proto = req.URL.Scheme
+	if IsProxied(req) {
+		if proto := middlewareapi.GetRequestScope(req).ForwardedProto; proto != "" {
+			return proto
+		}
 	}
-	return proto
+	return req.URL.Scheme
 }
 
-// GetRequestHost returns the request host header or X-Forwarded-Host if
+// GetRequestHost returns the request host header or the forwarded host if
 // present and the request is proxied.
 func GetRequestHost(req *http.Request) string {
-	host := req.Header.Get(XForwardedHost)
-	if !IsProxied(req) || host == "" {
-		host = req.Host
+	if IsProxied(req) {
+		if host := middlewareapi.GetRequestScope(req).ForwardedHost; host != "" {
+			return host
+		}
 	}
-	return host
+	return req.Host
 }
 
 // GetRequestURI return the request URI or X-Forwarded-Uri if present and the
@@ -37,8 +37,8 @@ var _ = Describe("Util Suite", func() {
 				Expect(util.GetRequestHost(req)).To(Equal(host))
 			})
 
-			It("ignores X-Forwarded-Host and returns the host", func() {
-				req.Header.Add("X-Forwarded-Host", "external.oauth2proxy.text")
+			It("ignores the forwarded host and returns the host", func() {
+				middleware.GetRequestScope(req).ForwardedHost = "external.oauth2proxy.text"
 				Expect(util.GetRequestHost(req)).To(Equal(host))
 			})
 		})
@@ -50,14 +50,19 @@ var _ = Describe("Util Suite", func() {
 				})
 			})
 
-			It("returns the host if X-Forwarded-Host is not present", func() {
+			It("returns the host if the forwarded host is not present", func() {
 				Expect(util.GetRequestHost(req)).To(Equal(host))
 			})
 
-			It("returns the X-Forwarded-Host when present", func() {
-				req.Header.Add("X-Forwarded-Host", "external.oauth2proxy.text")
+			It("returns the forwarded host when present", func() {
+				middleware.GetRequestScope(req).ForwardedHost = "external.oauth2proxy.text"
 				Expect(util.GetRequestHost(req)).To(Equal("external.oauth2proxy.text"))
 			})
+
+			It("ignores X-Forwarded-Host headers not resolved by the request scope", func() {
+				req.Header.Add("X-Forwarded-Host", "external.oauth2proxy.text")
+				Expect(util.GetRequestHost(req)).To(Equal(host))
+			})
 		})
 	})
 
@@ -71,8 +76,8 @@ var _ = Describe("Util Suite", func() {
 				Expect(util.GetRequestProto(req)).To(Equal(proto))
 			})
 
-			It("ignores X-Forwarded-Proto and returns the scheme", func() {
-				req.Header.Add("X-Forwarded-Proto", "https")
+			It("ignores the forwarded proto and returns the scheme", func() {
+				middleware.GetRequestScope(req).ForwardedProto = "https"
 				Expect(util.GetRequestProto(req)).To(Equal(proto))
 			})
 		})
@@ -84,14 +89,19 @@ var _ = Describe("Util Suite", func() {
 				})
 			})
 
-			It("returns the scheme if X-Forwarded-Proto is not present", func() {
+			It("returns the scheme if the forwarded proto is not present", func() {
 				Expect(util.GetRequestProto(req)).To(Equal(proto))
 			})
 
-			It("returns the X-Forwarded-Proto when present", func() {
-				req.Header.Add("X-Forwarded-Proto", "https")
+			It("returns the forwarded proto when present", func() {
+				middleware.GetRequestScope(req).ForwardedProto = "https"
 				Expect(util.GetRequestProto(req)).To(Equal("https"))
 			})
+
+			It("ignores X-Forwarded-Proto headers not resolved by the request scope", func() {
+				req.Header.Add("X-Forwarded-Proto", "https")
+				Expect(util.GetRequestProto(req)).To(Equal(proto))
+			})
 		})
 	})
 
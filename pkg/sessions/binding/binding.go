@@ -0,0 +1,131 @@
+package binding
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+
+	ipapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/ip"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
+)
+
+// fingerprintSize is the number of bytes of the SHA-256 digest kept in the
+// session, enough to make collisions impractical while keeping cookies small
+const fingerprintSize = 16
+
+// Binder computes fingerprints of clients so that sessions can be bound to
+// the client that created them. A nil Binder binds nothing.
+type Binder struct {
+	components     []string
+	ipv4Mask       net.IPMask
+	ipv6Mask       net.IPMask
+	revoke         bool
+	clientIPParser ipapi.RealClientIPParser
+}
+
+// NewBinder creates a Binder for the configured components. It returns a nil
+// Binder when session binding is disabled.
+func NewBinder(opts options.SessionBindingOptions, clientIPParser ipapi.RealClientIPParser) (*Binder, error) {
+	if len(opts.Components) == 0 {
+		return nil, nil
+	}
+
+	for _, component := range opts.Components {
+		switch component {
+		case options.ClientIPSessionBinding, options.UserAgentSessionBinding, options.TLSClientCertSessionBinding:
+		default:
+			return nil, fmt.Errorf("unknown session binding %q", component)
+		}
+	}
+	if opts.IPv4Prefix < 0 || opts.IPv4Prefix > 32 {
+		return nil, fmt.Errorf("invalid IPv4 session binding prefix length %d", opts.IPv4Prefix)
+	}
+	if opts.IPv6Prefix < 0 || opts.IPv6Prefix > 128 {
+		return nil, fmt.Errorf("invalid IPv6 session binding prefix length %d", opts.IPv6Prefix)
+	}
+
+	var revoke bool
+	switch opts.MismatchAction {
+	case options.DropSessionBindingAction:
+	case options.RevokeSessionBindingAction:
+		revoke = true
+	default:
+		return nil, fmt.Errorf("unknown session binding mismatch action %q", opts.MismatchAction)
+	}
+
+	return &Binder{
+		components:     opts.Components,
+		ipv4Mask:       net.CIDRMask(opts.IPv4Prefix, 32),
+		ipv6Mask:       net.CIDRMask(opts.IPv6Prefix, 128),
+		revoke:         revoke,
+		clientIPParser: clientIPParser,
+	}, nil
+}
+
+// Fingerprint returns the fingerprint of the client making the request
+func (b *Binder) Fingerprint(req *http.Request) string {
+	if b == nil {
+		return ""
+	}
+
+	h := sha256.New()
+	for _, component := range b.components {
+		// Each value is length prefixed so that values cannot run together
+		value := b.componentValue(component, req)
+		fmt.Fprintf(h, "%s:%d:%s;", component, len(value), value)
+	}
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:fingerprintSize])
+}
+
+// Bind records the fingerprint of the client making the request in the session
+func (b *Binder) Bind(req *http.Request, session *sessionsapi.SessionState) {
+	if b == nil {
+		return
+	}
+	session.Fingerprint = b.Fingerprint(req)
+}
+
+// Matches reports whether the session may be used by the client making the
+// request. Sessions created before binding was enabled have no fingerprint
+// and are accepted.
+func (b *Binder) Matches(req *http.Request, session *sessionsapi.SessionState) bool {
+	if b == nil || session.Fingerprint == "" {
+		return true
+	}
+	return session.Fingerprint == b.Fingerprint(req)
+}
+
+// Revoke reports whether sessions should be cleared when they are used by a
+// client with a different fingerprint
+func (b *Binder) Revoke() bool {
+	return b != nil && b.revoke
+}
+
+// componentValue returns the part of the request a binding component uses
+func (b *Binder) componentValue(component string, req *http.Request) string {
+	switch component {
+	case options.ClientIPSessionBinding:
+		clientIP, err := ip.GetClientIP(b.clientIPParser, req)
+		if err != nil || clientIP == nil {
+			return ""
+		}
+		if v4 := clientIP.To4(); v4 != nil {
+			return v4.Mask(b.ipv4Mask).String()
+		}
+		return clientIP.Mask(b.ipv6Mask).String()
+	case options.UserAgentSessionBinding:
+		return req.UserAgent()
+	case options.TLSClientCertSessionBinding:
+		if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+			return ""
+		}
+		sum := sha256.Sum256(req.TLS.PeerCertificates[0].Raw)
+		return base64.RawURLEncoding.EncodeToString(sum[:])
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,163 @@
+package binding
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Binder", func() {
+	type request struct {
+		remoteAddr string
+		realIP     string
+		userAgent  string
+		clientCert []byte
+	}
+
+	newRequest := func(in request) *http.Request {
+		req := httptest.NewRequest("GET", "/", nil)
+		if in.remoteAddr != "" {
+			req.RemoteAddr = in.remoteAddr
+		}
+		if in.realIP != "" {
+			req.Header.Set("X-Real-IP", in.realIP)
+		}
+		req.Header.Set("User-Agent", in.userAgent)
+		if in.clientCert != nil {
+			req.TLS = &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{{Raw: in.clientCert}},
+			}
+		}
+		return req
+	}
+
+	newBinder := func(components ...string) *Binder {
+		binder, err := NewBinder(options.SessionBindingOptions{
+			Components:     components,
+			IPv4Prefix:     24,
+			IPv6Prefix:     64,
+			MismatchAction: options.DropSessionBindingAction,
+		}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		return binder
+	}
+
+	type matchTableInput struct {
+		components []string
+		login      request
+		use        request
+		matches    bool
+	}
+
+	DescribeTable("Matches",
+		func(in matchTableInput) {
+			binder := newBinder(in.components...)
+			session := &sessionsapi.SessionState{}
+			binder.Bind(newRequest(in.login), session)
+			Expect(session.Fingerprint).ToNot(BeEmpty())
+
+			Expect(binder.Matches(newRequest(in.use), session)).To(Equal(in.matches))
+		},
+		Entry("with the same client IP network", matchTableInput{
+			components: []string{options.ClientIPSessionBinding},
+			login:      request{remoteAddr: "192.0.2.10:1234"},
+			use:        request{remoteAddr: "192.0.2.200:5678"},
+			matches:    true,
+		}),
+		Entry("with a different client IP network", matchTableInput{
+			components: []string{options.ClientIPSessionBinding},
+			login:      request{remoteAddr: "192.0.2.10:1234"},
+			use:        request{remoteAddr: "198.51.100.10:1234"},
+			matches:    false,
+		}),
+		Entry("with the same IPv6 network", matchTableInput{
+			components: []string{options.ClientIPSessionBinding},
+			login:      request{remoteAddr: "[2001:db8::1]:1234"},
+			use:        request{remoteAddr: "[2001:db8::ffff]:1234"},
+			matches:    true,
+		}),
+		Entry("with a different IPv6 network", matchTableInput{
+			components: []string{options.ClientIPSessionBinding},
+			login:      request{remoteAddr: "[2001:db8::1]:1234"},
+			use:        request{remoteAddr: "[2001:db8:0:1::1]:1234"},
+			matches:    false,
+		}),
+		Entry("with the same User-Agent", matchTableInput{
+			components: []string{options.UserAgentSessionBinding},
+			login:      request{userAgent: "Mozilla/5.0"},
+			use:        request{userAgent: "Mozilla/5.0", remoteAddr: "198.51.100.10:1234"},
+			matches:    true,
+		}),
+		Entry("with a different User-Agent", matchTableInput{
+			components: []string{options.UserAgentSessionBinding},
+			login:      request{userAgent: "Mozilla/5.0"},
+			use:        request{userAgent: "curl/8.0"},
+			matches:    false,
+		}),
+		Entry("with the same TLS client certificate", matchTableInput{
+			components: []string{options.TLSClientCertSessionBinding},
+			login:      request{clientCert: []byte("certificate")},
+			use:        request{clientCert: []byte("certificate")},
+			matches:    true,
+		}),
+		Entry("with a different TLS client certificate", matchTableInput{
+			components: []string{options.TLSClientCertSessionBinding},
+			login:      request{clientCert: []byte("certificate")},
+			use:        request{clientCert: []byte("stolen")},
+			matches:    false,
+		}),
+		Entry("without a TLS client certificate", matchTableInput{
+			components: []string{options.TLSClientCertSessionBinding},
+			login:      request{clientCert: []byte("certificate")},
+			use:        request{},
+			matches:    false,
+		}),
+		Entry("with multiple components where one differs", matchTableInput{
+			components: []string{options.ClientIPSessionBinding, options.UserAgentSessionBinding},
+			login:      request{remoteAddr: "192.0.2.10:1234", userAgent: "Mozilla/5.0"},
+			use:        request{remoteAddr: "192.0.2.10:1234", userAgent: "curl/8.0"},
+			matches:    false,
+		}),
+	)
+
+	It("uses the real client IP header when configured", func() {
+		parser, err := ip.GetRealClientIPParser("X-Real-IP", nil)
+		Expect(err).ToNot(HaveOccurred())
+		binder, err := NewBinder(options.SessionBindingOptions{
+			Components:     []string{options.ClientIPSessionBinding},
+			IPv4Prefix:     32,
+			MismatchAction: options.DropSessionBindingAction,
+		}, parser)
+		Expect(err).ToNot(HaveOccurred())
+
+		session := &sessionsapi.SessionState{}
+		binder.Bind(newRequest(request{realIP: "203.0.113.1", remoteAddr: "10.0.0.1:1234"}), session)
+
+		Expect(binder.Matches(newRequest(request{realIP: "203.0.113.1", remoteAddr: "10.0.0.2:1234"}), session)).To(BeTrue())
+		Expect(binder.Matches(newRequest(request{realIP: "203.0.113.2", remoteAddr: "10.0.0.1:1234"}), session)).To(BeFalse())
+	})
+
+	It("accepts sessions created before binding was enabled", func() {
+		binder := newBinder(options.UserAgentSessionBinding)
+		Expect(binder.Matches(newRequest(request{}), &sessionsapi.SessionState{})).To(BeTrue())
+	})
+
+	It("binds nothing when disabled", func() {
+		binder, err := NewBinder(options.SessionBindingOptions{}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(binder).To(BeNil())
+
+		session := &sessionsapi.SessionState{}
+		binder.Bind(newRequest(request{userAgent: "Mozilla/5.0"}), session)
+		Expect(session.Fingerprint).To(BeEmpty())
+		Expect(binder.Matches(newRequest(request{}), &sessionsapi.SessionState{Fingerprint: "other"})).To(BeTrue())
+		Expect(binder.Revoke()).To(BeFalse())
+	})
+})
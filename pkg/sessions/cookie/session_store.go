@@ -13,6 +13,7 @@ import (
 	pkgcookies "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cookies"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/envelope"
 )
 
 const (
@@ -28,22 +29,41 @@ var _ sessions.SessionStore = &SessionStore{}
 // SessionStore is an implementation of the sessions.SessionStore
 // interface that stores sessions in client side cookies
 type SessionStore struct {
-	Cookie       *options.Cookie
-	CookieCipher encryption.Cipher
-	Minimal      bool
+	Cookie  *options.Cookie
+	Minimal bool
+
+	// Envelope, when set, is used to encrypt sessions in place of the
+	// cipher derived from the cookie secret
+	Envelope encryption.Cipher
+
+	// WriteVersion is the session format version sessions are saved in
+	WriteVersion uint8
 }
 
 // Save takes a sessions.SessionState and stores the information from it
 // within Cookies set on the HTTP response writer
 func (s *SessionStore) Save(rw http.ResponseWriter, req *http.Request, ss *sessions.SessionState) error {
+	cookies, err := s.SessionCookies(req, ss)
+	if err != nil {
+		return err
+	}
+	for _, c := range cookies {
+		http.SetCookie(rw, c)
+	}
+	return nil
+}
+
+// SessionCookies returns the cookies that Save would set to store the
+// session, split into chunks when the session exceeds the cookie size limit
+func (s *SessionStore) SessionCookies(req *http.Request, ss *sessions.SessionState) ([]*http.Cookie, error) {
 	if ss.CreatedAt == nil || ss.CreatedAt.IsZero() {
 		ss.CreatedAtNow()
 	}
 	value, err := s.cookieForSession(ss)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return s.setSessionCookie(rw, req, value, *ss.CreatedAt)
+	return s.makeSessionCookie(req, value, *ss.CreatedAt)
 }
 
 // Load reads sessions.SessionState information from Cookies within the
@@ -54,12 +74,20 @@ func (s *SessionStore) Load(req *http.Request) (*sessions.SessionState, error) {
 		// always http.ErrNoCookie
 		return nil, err
 	}
-	val, _, ok := encryption.Validate(c, s.Cookie.Secret, s.Cookie.Expire)
+	// The cookie may have been created with a previous secret, in which case
+	// it is decrypted with that secret and re-issued with the primary secret
+	// the next time the session is saved.
+	val, _, secret, ok := s.Cookie.Keyset().Validate(c, s.Cookie.Expire)
 	if !ok {
 		return nil, errors.New("cookie signature not valid")
 	}
 
-	session, err := sessions.DecodeSessionState(val, s.CookieCipher, true)
+	cipher, err := s.cipherForValue(val, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := sessions.DecodeSessionState(val, cipher, true)
 	if err != nil {
 		return nil, err
 	}
@@ -91,28 +119,38 @@ func (s *SessionStore) VerifyConnection(_ context.Context) error {
 
 // cookieForSession serializes a session state for storage in a cookie
 func (s *SessionStore) cookieForSession(ss *sessions.SessionState) ([]byte, error) {
+	var cipher encryption.Cipher = s.Envelope
+	if cipher == nil {
+		var err error
+		cipher, err = makeCipher(s.Cookie.Keyset().Primary())
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if s.Minimal && (ss.AccessToken != "" || ss.IDToken != "" || ss.RefreshToken != "") {
 		minimal := *ss
 		minimal.AccessToken = ""
 		minimal.IDToken = ""
 		minimal.RefreshToken = ""
 
-		return minimal.EncodeSessionState(s.CookieCipher, true)
+		return minimal.EncodeSessionState(cipher, true, s.WriteVersion)
 	}
 
-	return ss.EncodeSessionState(s.CookieCipher, true)
+	return ss.EncodeSessionState(cipher, true, s.WriteVersion)
 }
 
-// setSessionCookie adds the user's session cookie to the response
-func (s *SessionStore) setSessionCookie(rw http.ResponseWriter, req *http.Request, val []byte, created time.Time) error {
-	cookies, err := s.makeSessionCookie(req, val, created)
-	if err != nil {
-		return err
-	}
-	for _, c := range cookies {
-		http.SetCookie(rw, c)
+// cipherForValue selects the cipher to decrypt a session cookie value with.
+// Cookies created before envelope encryption was enabled are still decrypted
+// with the cookie secret they were signed with.
+func (s *SessionStore) cipherForValue(val []byte, secret string) (encryption.Cipher, error) {
+	if encryption.IsEnvelope(val) {
+		if s.Envelope == nil {
+			return nil, errors.New("session is envelope encrypted but no session key provider is configured")
+		}
+		return s.Envelope, nil
 	}
-	return nil
+	return makeCipher(secret)
 }
 
 // makeSessionCookie creates an http.Cookie containing the authenticated user's
@@ -121,7 +159,7 @@ func (s *SessionStore) makeSessionCookie(req *http.Request, value []byte, now ti
 	strValue := string(value)
 	if strValue != "" {
 		var err error
-		strValue, err = encryption.SignedValue(s.Cookie.Secret, s.Cookie.Name, value, now)
+		strValue, err = s.Cookie.Keyset().SignedValue(s.Cookie.Name, value, now)
 		if err != nil {
 			return nil, err
 		}
@@ -147,18 +185,39 @@ func (s *SessionStore) makeCookie(req *http.Request, name string, value string,
 // NewCookieSessionStore initialises a new instance of the SessionStore from
 // the configuration given
 func NewCookieSessionStore(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessions.SessionStore, error) {
-	cipher, err := encryption.NewCFBCipher(encryption.SecretBytes(cookieOpts.Secret))
+	for _, secret := range cookieOpts.Keyset().Secrets() {
+		if _, err := makeCipher(secret); err != nil {
+			return nil, err
+		}
+	}
+
+	envelopeCipher, err := envelope.NewCipher(opts.Encryption)
 	if err != nil {
-		return nil, fmt.Errorf("error initialising cipher: %v", err)
+		return nil, fmt.Errorf("error initialising session envelope encryption: %v", err)
+	}
+
+	writeVersion := sessions.LegacySessionFormatVersion
+	if opts.WriteVersion != 0 {
+		writeVersion = uint8(opts.WriteVersion)
 	}
 
 	return &SessionStore{
-		CookieCipher: cipher,
 		Cookie:       cookieOpts,
 		Minimal:      opts.Cookie.Minimal,
+		Envelope:     envelopeCipher,
+		WriteVersion: writeVersion,
 	}, nil
 }
 
+// makeCipher creates the cipher used to encrypt sessions with a cookie secret
+func makeCipher(secret string) (encryption.Cipher, error) {
+	cipher, err := encryption.NewCFBCipher(encryption.SecretBytes(secret))
+	if err != nil {
+		return nil, fmt.Errorf("error initialising cipher: %v", err)
+	}
+	return cipher, nil
+}
+
 // splitCookie reads the full cookie generated to store the session and splits
 // it into a slice of cookies which fit within the 4kb cookie limit indexing
 // the cookies from 0
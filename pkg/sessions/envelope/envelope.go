@@ -0,0 +1,34 @@
+package envelope
+
+import (
+	"fmt"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+)
+
+// NewCipher creates the envelope encryption Cipher for stored sessions from
+// the configured key provider. It returns a nil Cipher when no key provider
+// is configured.
+func NewCipher(opts options.SessionEncryptionOptions) (encryption.Cipher, error) {
+	wrapper, err := newKeyWrapper(opts)
+	if err != nil || wrapper == nil {
+		return nil, err
+	}
+	return encryption.NewEnvelopeCipher(wrapper), nil
+}
+
+// newKeyWrapper creates the KeyWrapper for the configured key provider
+func newKeyWrapper(opts options.SessionEncryptionOptions) (encryption.KeyWrapper, error) {
+	switch opts.KeyProvider {
+	case "":
+		return nil, nil
+	case options.FileKeyProvider:
+		if opts.KEKFile == "" {
+			return nil, fmt.Errorf("session_kek_file is required for the %q session key provider", opts.KeyProvider)
+		}
+		return encryption.NewFileKeyWrapper(opts.KEKFile)
+	default:
+		return nil, fmt.Errorf("unknown session key provider %q", opts.KeyProvider)
+	}
+}
@@ -0,0 +1,125 @@
+package hybrid
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	pkgcookies "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cookies"
+)
+
+// Ensure the hybrid SessionStore implements the interface
+var _ sessions.SessionStore = &SessionStore{}
+
+// CookieStore is a session store that keeps sessions in cookies and can
+// report the cookies a session would be stored in
+type CookieStore interface {
+	sessions.SessionStore
+	SessionCookies(req *http.Request, ss *sessions.SessionState) ([]*http.Cookie, error)
+}
+
+// PersistentStore is a session store that keeps sessions server side,
+// referenced by a ticket held in the session cookie
+type PersistentStore interface {
+	sessions.SessionStore
+	HasTicket(req *http.Request) bool
+}
+
+// SessionStore is an implementation of the sessions.SessionStore interface
+// that stores small sessions in client side cookies and moves sessions
+// exceeding a size threshold to a persistent store
+type SessionStore struct {
+	Cookie      *options.Cookie
+	CookieStore CookieStore
+	Persistent  PersistentStore
+
+	// Threshold is the total size in bytes of the session cookies above
+	// which the session is persisted instead
+	Threshold int
+}
+
+// NewHybridSessionStore initialises a new instance of the SessionStore from
+// the cookie and persistent stores given
+func NewHybridSessionStore(cookieStore CookieStore, persistent PersistentStore, cookieOpts *options.Cookie, threshold int) *SessionStore {
+	return &SessionStore{
+		Cookie:      cookieOpts,
+		CookieStore: cookieStore,
+		Persistent:  persistent,
+		Threshold:   threshold,
+	}
+}
+
+// Save stores the session in cookies when it fits within the threshold and
+// in the persistent store otherwise. Sessions that have been persisted stay
+// in the persistent store until they are cleared.
+func (s *SessionStore) Save(rw http.ResponseWriter, req *http.Request, ss *sessions.SessionState) error {
+	if s.Persistent.HasTicket(req) {
+		return s.Persistent.Save(rw, req, ss)
+	}
+
+	cookies, err := s.CookieStore.SessionCookies(req, ss)
+	if err != nil {
+		return err
+	}
+	if cookiesSize(cookies) <= s.Threshold {
+		for _, c := range cookies {
+			http.SetCookie(rw, c)
+		}
+		return nil
+	}
+
+	// The ticket cookie replaces the session cookie, but any split
+	// chunks of a previous cookie session must also be removed
+	s.clearSplitCookies(rw, req)
+	if err := s.Persistent.Save(rw, req, ss); err != nil {
+		return fmt.Errorf("error moving session to the persistent store: %v", err)
+	}
+	return nil
+}
+
+// Load reads the session from the persistent store when the session cookie
+// holds a ticket, and from the session cookie otherwise
+func (s *SessionStore) Load(req *http.Request) (*sessions.SessionState, error) {
+	if s.Persistent.HasTicket(req) {
+		return s.Persistent.Load(req)
+	}
+	return s.CookieStore.Load(req)
+}
+
+// Clear clears the session from whichever store holds it
+func (s *SessionStore) Clear(rw http.ResponseWriter, req *http.Request) error {
+	if s.Persistent.HasTicket(req) {
+		return s.Persistent.Clear(rw, req)
+	}
+	return s.CookieStore.Clear(rw, req)
+}
+
+// VerifyConnection validates the persistent store is ready and connected
+func (s *SessionStore) VerifyConnection(ctx context.Context) error {
+	return s.Persistent.VerifyConnection(ctx)
+}
+
+// clearSplitCookies clears the numbered chunks of a split session cookie
+func (s *SessionStore) clearSplitCookies(rw http.ResponseWriter, req *http.Request) {
+	// matches CookieName_<number>
+	var splitCookieRegex = regexp.MustCompile(fmt.Sprintf("^%s_\\d+$", regexp.QuoteMeta(s.Cookie.Name)))
+
+	for _, c := range req.Cookies() {
+		if splitCookieRegex.MatchString(c.Name) {
+			http.SetCookie(rw, pkgcookies.MakeCookieFromOptions(req, c.Name, "", s.Cookie, time.Hour*-1, time.Now()))
+		}
+	}
+}
+
+// cookiesSize returns the total size of the cookies as Set-Cookie headers
+func cookiesSize(cookies []*http.Cookie) int {
+	size := 0
+	for _, c := range cookies {
+		size += len(c.String())
+	}
+	return size
+}
@@ -0,0 +1,177 @@
+package hybrid
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/cookie"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/envelope"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hybrid SessionStore Tests", func() {
+	var ms *tests.MockStore
+	BeforeEach(func() {
+		ms = tests.NewMockStore()
+	})
+
+	newHybridStore := func(opts *options.SessionOptions, cookieOpts *options.Cookie, threshold int) (sessionsapi.SessionStore, error) {
+		cookieStore, err := cookie.NewCookieSessionStore(opts, cookieOpts)
+		if err != nil {
+			return nil, err
+		}
+		envelopeCipher, err := envelope.NewCipher(opts.Encryption)
+		if err != nil {
+			return nil, err
+		}
+		manager := persistence.NewManager(ms, cookieOpts)
+		manager.Envelope = envelopeCipher
+		return NewHybridSessionStore(cookieStore.(CookieStore), manager, cookieOpts, threshold), nil
+	}
+
+	Context("with sessions below the threshold", func() {
+		tests.RunSessionStoreTests(
+			func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+				return newHybridStore(opts, cookieOpts, 1<<20)
+			}, nil)
+	})
+
+	Context("with sessions above the threshold", func() {
+		tests.RunSessionStoreTests(
+			func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+				return newHybridStore(opts, cookieOpts, 0)
+			},
+			func(d time.Duration) error {
+				ms.FastForward(d)
+				return nil
+			})
+	})
+
+	Context("moving sessions between stores", func() {
+		var ss sessionsapi.SessionStore
+		var cookieOpts *options.Cookie
+
+		BeforeEach(func() {
+			cookieOpts = &options.Cookie{
+				Name:   "_oauth2_proxy",
+				Secret: "0123456789abcdefghijklmnopqrstuv",
+				Path:   "/",
+				Expire: time.Hour,
+			}
+
+			var err error
+			ss, err = newHybridStore(&options.SessionOptions{}, cookieOpts, 4000)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		// save saves the session with the cookies of the request and returns
+		// the cookies set on the response
+		save := func(req *http.Request, s *sessionsapi.SessionState) []*http.Cookie {
+			rw := httptest.NewRecorder()
+			Expect(ss.Save(rw, req, s)).To(Succeed())
+			return rw.Result().Cookies()
+		}
+
+		// requestWith creates a request carrying the cookies that have a value
+		requestWith := func(cookies []*http.Cookie) *http.Request {
+			req := httptest.NewRequest("GET", "/", nil)
+			for _, c := range cookies {
+				if c.Value != "" {
+					req.AddCookie(c)
+				}
+			}
+			return req
+		}
+
+		smallSession := func() *sessionsapi.SessionState {
+			return &sessionsapi.SessionState{Email: "john.doe@example.com", AccessToken: "AccessToken"}
+		}
+		// largeSession returns a session with random tokens so that it does
+		// not compress below the threshold
+		largeSession := func() *sessionsapi.SessionState {
+			s := smallSession()
+			for i := 0; i < 500; i++ {
+				s.Groups = append(s.Groups, fmt.Sprintf("group-%d", i))
+			}
+			token := make([]byte, 4000)
+			_, err := rand.Read(token)
+			Expect(err).ToNot(HaveOccurred())
+			s.AccessToken = base64.RawURLEncoding.EncodeToString(token)
+			return s
+		}
+
+		It("keeps small sessions in the cookie", func() {
+			cookies := save(httptest.NewRequest("GET", "/", nil), smallSession())
+			Expect(cookies).To(HaveLen(1))
+			Expect(ms.Keys()).To(BeEmpty())
+
+			loaded, err := ss.Load(requestWith(cookies))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded.Email).To(Equal("john.doe@example.com"))
+		})
+
+		It("moves large sessions to the persistent store", func() {
+			cookies := save(httptest.NewRequest("GET", "/", nil), largeSession())
+			Expect(cookies).To(HaveLen(1))
+			Expect(len(cookies[0].String())).To(BeNumerically("<", 4000))
+			Expect(ms.Keys()).To(HaveLen(1))
+
+			loaded, err := ss.Load(requestWith(cookies))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded.Groups).To(HaveLen(500))
+		})
+
+		It("clears split cookies when a cookie session grows", func() {
+			cookieStore, err := cookie.NewCookieSessionStore(&options.SessionOptions{}, cookieOpts)
+			Expect(err).ToNot(HaveOccurred())
+			rw := httptest.NewRecorder()
+			Expect(cookieStore.Save(rw, httptest.NewRequest("GET", "/", nil), largeSession())).To(Succeed())
+			split := rw.Result().Cookies()
+			Expect(len(split)).To(BeNumerically(">", 1))
+
+			req := requestWith(split)
+			loaded, err := ss.Load(req)
+			Expect(err).ToNot(HaveOccurred())
+
+			cookies := save(req, loaded)
+			names := map[string]string{}
+			for _, c := range cookies {
+				names[c.Name] = c.Value
+			}
+			Expect(names).To(HaveKeyWithValue("_oauth2_proxy_0", ""))
+			Expect(names).To(HaveKeyWithValue("_oauth2_proxy_1", ""))
+			Expect(names["_oauth2_proxy"]).ToNot(BeEmpty())
+			Expect(ms.Keys()).To(HaveLen(1))
+		})
+
+		It("keeps persisted sessions in the persistent store when they shrink", func() {
+			cookies := save(httptest.NewRequest("GET", "/", nil), largeSession())
+			req := requestWith(cookies)
+
+			resaved := save(req, smallSession())
+			Expect(resaved).To(HaveLen(1))
+			Expect(resaved[0].Value).To(Equal(cookies[0].Value))
+
+			loaded, err := ss.Load(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded.Groups).To(BeEmpty())
+		})
+
+		It("clears persisted sessions from the persistent store", func() {
+			cookies := save(httptest.NewRequest("GET", "/", nil), largeSession())
+			Expect(ms.Keys()).To(HaveLen(1))
+
+			Expect(ss.Clear(httptest.NewRecorder(), requestWith(cookies))).To(Succeed())
+			Expect(ms.Keys()).To(BeEmpty())
+		})
+	})
+})
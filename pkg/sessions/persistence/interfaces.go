@@ -17,3 +17,23 @@ type Store interface {
 	Lock(key string) sessions.Lock
 	VerifyConnection(context.Context) error
 }
+
+// SessionTracker is implemented by persistent stores that can index the
+// active sessions of each user, which allows the persistence.Manager to limit
+// the number of concurrent sessions per user.
+type SessionTracker interface {
+	// TrackSession adds the session key to the index, ordered by createdAt,
+	// unless it is already tracked. When limit is above 0 and the index
+	// already holds limit sessions, the session is rejected with
+	// sessions.ErrSessionLimitExceeded or, when evict is set, the oldest
+	// sessions are removed from the index to make room and returned. The
+	// limit must be checked and the session added atomically, so that
+	// concurrent logins cannot exceed it. The index expires after exp unless
+	// more sessions are tracked.
+	TrackSession(ctx context.Context, index string, key string, createdAt time.Time, exp time.Duration, limit int, evict bool) ([]string, error)
+	// UntrackSession removes the session key from the index
+	UntrackSession(ctx context.Context, index string, key string) error
+	// ActiveSessions returns the keys in the index that still have a stored
+	// session, oldest first
+	ActiveSessions(ctx context.Context, index string) ([]string, error)
+}
@@ -2,12 +2,16 @@ package persistence
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
 )
 
 // Manager wraps a Store and handles the implementation details of the
@@ -15,14 +19,35 @@ import (
 type Manager struct {
 	Store   Store
 	Options *options.Cookie
+
+	// Envelope, when set, additionally encrypts the ticket encrypted session
+	// before it is persisted, so that the session cannot be read with the
+	// ticket alone
+	Envelope encryption.Cipher
+
+	// WriteVersion is the session format version sessions are saved in
+	WriteVersion uint8
+
+	// SessionLimit is the maximum number of concurrent sessions per user,
+	// enforced when the Store implements SessionTracker. 0 means no limit.
+	SessionLimit int
+
+	// SessionLimitPolicy is the options.*SessionLimitPolicy applied when a new
+	// session exceeds the SessionLimit
+	SessionLimitPolicy string
+
+	// Refresher, when set, is told about the sessions loaded and saved so
+	// that it can refresh them in the background
+	Refresher *Refresher
 }
 
 // NewManager creates a Manager that can wrap a Store and manage the
 // sessions.SessionStore implementation details
 func NewManager(store Store, cookieOpts *options.Cookie) *Manager {
 	return &Manager{
-		Store:   store,
-		Options: cookieOpts,
+		Store:        store,
+		Options:      cookieOpts,
+		WriteVersion: sessions.LegacySessionFormatVersion,
 	}
 }
 
@@ -34,21 +59,25 @@ func (m *Manager) Save(rw http.ResponseWriter, req *http.Request, s *sessions.Se
 		s.CreatedAtNow()
 	}
 
+	isNew := false
 	tckt, err := decodeTicketFromRequest(req, m.Options)
 	if err != nil {
 		tckt, err = newTicket(m.Options)
 		if err != nil {
 			return fmt.Errorf("error creating a session ticket: %v", err)
 		}
+		isNew = true
 	}
 
-	err = tckt.saveSession(s, func(key string, val []byte, exp time.Duration) error {
-		return m.Store.Save(req.Context(), key, val, exp)
-	})
-	if err != nil {
+	if err := m.trackSession(req.Context(), tckt.id, s, isNew); err != nil {
 		return err
 	}
 
+	if err := tckt.saveSession(s, m.WriteVersion, m.saver(req.Context())); err != nil {
+		return err
+	}
+	m.Refresher.track(m, tckt, s)
+
 	return tckt.setCookie(rw, req, s)
 }
 
@@ -60,12 +89,12 @@ func (m *Manager) Load(req *http.Request) (*sessions.SessionState, error) {
 		return nil, err
 	}
 
-	return tckt.loadSession(
-		func(key string) ([]byte, error) {
-			return m.Store.Load(req.Context(), key)
-		},
-		m.Store.Lock,
-	)
+	s, err := tckt.loadSession(m.loader(req.Context()), m.Store.Lock)
+	if err != nil {
+		return nil, err
+	}
+	m.Refresher.track(m, tckt, s)
+	return s, nil
 }
 
 // Clear clears any saved session information for a given ticket cookie.
@@ -87,12 +116,131 @@ func (m *Manager) Clear(rw http.ResponseWriter, req *http.Request) error {
 	}
 
 	tckt.clearCookie(rw, req)
+	m.Refresher.untrack(tckt.id)
 	return tckt.clearSession(func(key string) error {
 		return m.Store.Clear(req.Context(), key)
 	})
 }
 
+// HasTicket reports whether the request's session cookie holds a session
+// ticket, rather than a session stored in the cookie itself
+func (m *Manager) HasTicket(req *http.Request) bool {
+	c, err := req.Cookie(m.Options.Name)
+	if err != nil {
+		return false
+	}
+	val, _, _, ok := m.Options.Keyset().Validate(c, m.Options.Expire)
+	return ok && isEncodedTicket(string(val))
+}
+
 // VerifyConnection validates the underlying store is ready and connected
 func (m *Manager) VerifyConnection(ctx context.Context) error {
 	return m.Store.VerifyConnection(ctx)
 }
+
+// trackSession records the ticket as one of the user's active sessions. When
+// a new session would exceed the SessionLimit, the SessionLimitPolicy either
+// rejects it or clears the user's oldest sessions to make room.
+func (m *Manager) trackSession(ctx context.Context, key string, s *sessions.SessionState, isNew bool) error {
+	if m.SessionLimit <= 0 {
+		return nil
+	}
+	tracker, ok := m.Store.(SessionTracker)
+	if !ok {
+		return nil
+	}
+	identity := s.User
+	if identity == "" {
+		identity = s.Email
+	}
+	if identity == "" {
+		return nil
+	}
+	index := m.sessionIndex(identity)
+
+	limit := 0
+	if isNew {
+		// Drop cleared and expired sessions from the index so that they do
+		// not count towards the limit
+		if _, err := tracker.ActiveSessions(ctx, index); err != nil {
+			return fmt.Errorf("error listing active sessions: %v", err)
+		}
+		limit = m.SessionLimit
+	}
+
+	evict := m.SessionLimitPolicy != options.RejectSessionLimitPolicy
+	evicted, err := tracker.TrackSession(ctx, index, key, *s.CreatedAt, m.Options.Expire, limit, evict)
+	if errors.Is(err, sessions.ErrSessionLimitExceeded) {
+		return fmt.Errorf("%w: %s already has %d active sessions", sessions.ErrSessionLimitExceeded, identity, m.SessionLimit)
+	}
+	if err != nil {
+		return fmt.Errorf("error tracking session: %v", err)
+	}
+
+	for _, oldest := range evicted {
+		if err := m.Store.Clear(ctx, oldest); err != nil {
+			return fmt.Errorf("error evicting session: %v", err)
+		}
+	}
+	return nil
+}
+
+// sessionIndex returns the key of the index of a user's active sessions. The
+// identity is hashed so that it does not appear in the store's keys.
+func (m *Manager) sessionIndex(identity string) string {
+	sum := sha256.Sum256([]byte(identity))
+	return fmt.Sprintf("%s-sessions-%s", m.Options.Name, hex.EncodeToString(sum[:]))
+}
+
+// saver returns the saveFunc which envelope encrypts ticket encrypted
+// sessions and persists them to the Store
+func (m *Manager) saver(ctx context.Context) saveFunc {
+	return func(key string, val []byte, exp time.Duration) error {
+		val, err := m.seal(val)
+		if err != nil {
+			return err
+		}
+		return m.Store.Save(ctx, key, val, exp)
+	}
+}
+
+// loader returns the loadFunc which loads sessions from the Store and
+// reverses their envelope encryption
+func (m *Manager) loader(ctx context.Context) loadFunc {
+	return func(key string) ([]byte, error) {
+		val, err := m.Store.Load(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return m.open(val)
+	}
+}
+
+// seal envelope encrypts a ticket encrypted session when envelope encryption
+// is enabled
+func (m *Manager) seal(val []byte) ([]byte, error) {
+	if m.Envelope == nil {
+		return val, nil
+	}
+	sealed, err := m.Envelope.Encrypt(val)
+	if err != nil {
+		return nil, fmt.Errorf("failed to envelope encrypt the session: %v", err)
+	}
+	return sealed, nil
+}
+
+// open reverses seal. Sessions persisted before envelope encryption was
+// enabled are returned unchanged.
+func (m *Manager) open(val []byte) ([]byte, error) {
+	if !encryption.IsEnvelope(val) {
+		return val, nil
+	}
+	if m.Envelope == nil {
+		return nil, errors.New("session is envelope encrypted but no session key provider is configured")
+	}
+	opened, err := m.Envelope.Decrypt(val)
+	if err != nil {
+		return nil, fmt.Errorf("failed to envelope decrypt the session: %v", err)
+	}
+	return opened, nil
+}
@@ -1,12 +1,16 @@
 package persistence
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"time"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/envelope"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
 	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("Persistence Manager Tests", func() {
@@ -15,11 +19,102 @@ var _ = Describe("Persistence Manager Tests", func() {
 		ms = tests.NewMockStore()
 	})
 	tests.RunSessionStoreTests(
-		func(_ *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
-			return NewManager(ms, cookieOpts), nil
+		func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+			envelopeCipher, err := envelope.NewCipher(opts.Encryption)
+			if err != nil {
+				return nil, err
+			}
+			manager := NewManager(ms, cookieOpts)
+			manager.Envelope = envelopeCipher
+			return manager, nil
 		},
 		func(d time.Duration) error {
 			ms.FastForward(d)
 			return nil
 		})
+
+	Context("with a concurrent session limit", func() {
+		var manager *Manager
+
+		BeforeEach(func() {
+			manager = NewManager(ms, &options.Cookie{
+				Name:   "_oauth2_proxy",
+				Secret: "0123456789abcdefghijklmnopqrstuv",
+				Expire: time.Hour,
+			})
+			manager.SessionLimit = 2
+		})
+
+		// login saves a new session for the user and returns its cookie
+		login := func(user string, createdAt time.Time) (*http.Cookie, error) {
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/", nil)
+			if err := manager.Save(rw, req, &sessionsapi.SessionState{User: user, CreatedAt: &createdAt}); err != nil {
+				return nil, err
+			}
+			cookies := rw.Result().Cookies()
+			Expect(cookies).To(HaveLen(1))
+			return cookies[0], nil
+		}
+
+		// loads reports whether the session for the cookie can still be loaded
+		loads := func(cookie *http.Cookie) bool {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.AddCookie(cookie)
+			_, err := manager.Load(req)
+			return err == nil
+		}
+
+		It("evicts the oldest sessions", func() {
+			now := time.Now()
+			first, err := login("jdoe", now.Add(-2*time.Minute))
+			Expect(err).ToNot(HaveOccurred())
+			second, err := login("jdoe", now.Add(-time.Minute))
+			Expect(err).ToNot(HaveOccurred())
+			other, err := login("other", now.Add(-time.Minute))
+			Expect(err).ToNot(HaveOccurred())
+			third, err := login("jdoe", now)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(loads(first)).To(BeFalse())
+			Expect(loads(second)).To(BeTrue())
+			Expect(loads(third)).To(BeTrue())
+			Expect(loads(other)).To(BeTrue())
+		})
+
+		It("rejects new sessions", func() {
+			manager.SessionLimit = 1
+			manager.SessionLimitPolicy = options.RejectSessionLimitPolicy
+
+			first, err := login("jdoe", time.Now())
+			Expect(err).ToNot(HaveOccurred())
+			_, err = login("jdoe", time.Now())
+			Expect(err).To(MatchError(sessionsapi.ErrSessionLimitExceeded))
+			Expect(loads(first)).To(BeTrue())
+
+			// Saving the existing session again, e.g. on refresh, is allowed
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/", nil)
+			req.AddCookie(first)
+			Expect(manager.Save(rw, req, &sessionsapi.SessionState{User: "jdoe"})).To(Succeed())
+		})
+
+		It("does not count cleared or expired sessions", func() {
+			manager.SessionLimit = 1
+			manager.SessionLimitPolicy = options.RejectSessionLimitPolicy
+
+			first, err := login("jdoe", time.Now())
+			Expect(err).ToNot(HaveOccurred())
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.AddCookie(first)
+			Expect(manager.Clear(httptest.NewRecorder(), req)).To(Succeed())
+			_, err = login("jdoe", time.Now())
+			Expect(err).ToNot(HaveOccurred())
+
+			ms.FastForward(2 * time.Hour)
+			_, err = login("jdoe", time.Now())
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
 })
@@ -0,0 +1,321 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// refreshLockDuration is how long the session lock is held for by a
+// background refresh. It also bounds the time allowed for the refresh.
+const refreshLockDuration = 10 * time.Second
+
+// RefreshFunc refreshes the tokens of a session outside of a request. It
+// returns whether the session was updated and must be saved.
+type RefreshFunc func(context.Context, *sessions.SessionState) (bool, error)
+
+// RefresherOptions contains all of the requirements to construct a
+// Refresher.
+type RefresherOptions struct {
+	// Refresh refreshes the tokens of a session
+	Refresh RefreshFunc
+
+	// Window is how long before the access token expires a session is
+	// refreshed
+	Window time.Duration
+
+	// Jitter is the maximum random amount each refresh is brought forward by
+	Jitter time.Duration
+
+	// Interval is how often the tracked sessions are checked for refreshes
+	// that are due
+	Interval time.Duration
+
+	// Concurrency is the maximum number of sessions refreshed at once
+	Concurrency int
+
+	// Registerer is used to register the refresh metrics
+	Registerer prometheus.Registerer
+}
+
+// Refresher refreshes persisted sessions in the background before their
+// access token expires, so that requests rarely wait on the provider.
+//
+// Sessions are encrypted with a secret only held in the session cookie, so
+// the persistent store cannot be scanned for sessions. Instead the Refresher
+// tracks the tickets of the sessions loaded and saved by this instance. Each
+// tracked session is refreshed at most once and is tracked again when it is
+// next used, so sessions that are no longer used are not kept alive.
+type Refresher struct {
+	refresh     RefreshFunc
+	window      time.Duration
+	jitter      time.Duration
+	interval    time.Duration
+	concurrency int
+
+	now         func() time.Time
+	randomDelay func(time.Duration) time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*refreshEntry
+
+	refreshes *prometheus.CounterVec
+	tracked   prometheus.Gauge
+}
+
+// refreshEntry is a tracked session ticket
+type refreshEntry struct {
+	manager   *Manager
+	ticket    *ticket
+	expiresOn time.Time
+	due       time.Time
+	inFlight  bool
+}
+
+// NewRefresher creates a Refresher. It must be set on the Manager of the
+// persistent session store and run with Run.
+func NewRefresher(opts RefresherOptions) *Refresher {
+	return &Refresher{
+		refresh:     opts.Refresh,
+		window:      opts.Window,
+		jitter:      opts.Jitter,
+		interval:    opts.Interval,
+		concurrency: max(opts.Concurrency, 1),
+		now:         time.Now,
+		randomDelay: func(d time.Duration) time.Duration {
+			if d <= 0 {
+				return 0
+			}
+			return rand.N(d) // #nosec G404
+		},
+		entries:   map[string]*refreshEntry{},
+		refreshes: registerBackgroundRefreshesCounter(opts.Registerer),
+		tracked:   registerTrackedSessionsGauge(opts.Registerer),
+	}
+}
+
+// Run checks the tracked sessions every interval and refreshes those that
+// are due until the context is cancelled. It waits for refreshes in progress
+// before returning.
+func (r *Refresher) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	sem := make(chan struct{}, r.concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, e := range r.dueEntries() {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			wg.Add(1)
+			go func(e *refreshEntry) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				r.refreshEntry(ctx, e)
+			}(e)
+		}
+	}
+}
+
+// track records the ticket of a session that can be refreshed. Sessions
+// without a refresh token or access token expiry are not tracked.
+func (r *Refresher) track(m *Manager, t *ticket, s *sessions.SessionState) {
+	if r == nil {
+		return
+	}
+	if s.RefreshToken == "" || s.ExpiresOn == nil || s.ExpiresOn.IsZero() {
+		r.untrack(t.id)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.entries[t.id]
+	if ok && existing.expiresOn.Equal(*s.ExpiresOn) {
+		// Keep the refresh time, and its jitter, of the tracked session
+		return
+	}
+	r.entries[t.id] = &refreshEntry{
+		manager:   m,
+		ticket:    t,
+		expiresOn: *s.ExpiresOn,
+		due:       s.ExpiresOn.Add(-r.window - r.randomDelay(r.jitter)),
+		inFlight:  ok && existing.inFlight,
+	}
+	r.tracked.Set(float64(len(r.entries)))
+}
+
+// untrack stops tracking the ticket with the given ID
+func (r *Refresher) untrack(id string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.entries, id)
+	r.tracked.Set(float64(len(r.entries)))
+}
+
+// dueEntries returns the tracked sessions that are due a refresh, earliest
+// first, and marks them as in flight
+func (r *Refresher) dueEntries() []*refreshEntry {
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	due := []*refreshEntry{}
+	for _, e := range r.entries {
+		if !e.inFlight && !e.due.After(now) {
+			e.inFlight = true
+			due = append(due, e)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].due.Before(due[j].due)
+	})
+	return due
+}
+
+// finish untracks a session once its refresh was attempted, or returns it
+// to the tracked sessions when it must be tried again
+func (r *Refresher) finish(e *refreshEntry, retry bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current, ok := r.entries[e.ticket.id]
+	if !ok {
+		// The session was cleared meanwhile
+		return
+	}
+	if current != e {
+		// The session was tracked again meanwhile with a new expiry
+		current.inFlight = false
+		return
+	}
+	if retry {
+		e.inFlight = false
+		return
+	}
+	delete(r.entries, e.ticket.id)
+	r.tracked.Set(float64(len(r.entries)))
+}
+
+// refreshEntry refreshes the session of a tracked ticket under the session
+// lock, so that it is not refreshed at the same time by a request or another
+// instance.
+func (r *Refresher) refreshEntry(ctx context.Context, e *refreshEntry) {
+	ctx, cancel := context.WithTimeout(ctx, refreshLockDuration)
+	defer cancel()
+
+	lock := e.manager.Store.Lock(e.ticket.id)
+	if err := lock.Obtain(ctx, refreshLockDuration); err != nil {
+		if !errors.Is(err, sessions.ErrLockNotObtained) {
+			logger.Errorf("Unable to obtain the session lock for a background refresh: %v", err)
+		}
+		// The session is being refreshed elsewhere, check it again later
+		r.finish(e, true)
+		return
+	}
+	defer func() {
+		if err := lock.Release(context.Background()); err != nil {
+			logger.Errorf("unable to release lock: %v", err)
+		}
+	}()
+
+	refreshed, err := r.refreshSession(ctx, e)
+	r.finish(e, false)
+	switch {
+	case err != nil:
+		r.refreshes.WithLabelValues("failure").Inc()
+		logger.Errorf("Unable to refresh session in the background: %v", err)
+	case refreshed:
+		r.refreshes.WithLabelValues("success").Inc()
+	}
+}
+
+// refreshSession reloads the session, in case it was refreshed since it was
+// tracked, and refreshes and saves it if it is still due. It returns whether
+// the session was refreshed.
+func (r *Refresher) refreshSession(ctx context.Context, e *refreshEntry) (bool, error) {
+	s, err := e.ticket.loadSession(e.manager.loader(ctx), e.manager.Store.Lock)
+	if err != nil {
+		return false, err
+	}
+	if s.RefreshToken == "" || !s.ExpiresWithin(r.window+r.jitter) || s.IsRefreshExpired() {
+		return false, nil
+	}
+
+	logger.Printf("Refreshing session in the background - User: %s; SessionAge: %s", s.User, s.Age())
+	refreshed, err := r.refresh(ctx, s)
+	if err != nil || !refreshed {
+		return false, err
+	}
+
+	if err := e.manager.trackSession(ctx, e.ticket.id, s, false); err != nil {
+		return false, err
+	}
+	if err := e.ticket.saveSession(s, e.manager.WriteVersion, e.manager.saver(ctx)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// registerBackgroundRefreshesCounter registers
+// 'oauth2_proxy_session_background_refreshes_total'
+// This keeps a tally of background session refreshes by their result
+func registerBackgroundRefreshesCounter(registerer prometheus.Registerer) *prometheus.CounterVec {
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "oauth2_proxy_session_background_refreshes_total",
+			Help: "Total number of background session refreshes by result.",
+		},
+		[]string{"result"},
+	)
+
+	if err := registerer.Register(counter); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			counter = are.ExistingCollector.(*prometheus.CounterVec)
+		} else {
+			panic(err)
+		}
+	}
+
+	return counter
+}
+
+// registerTrackedSessionsGauge registers
+// 'oauth2_proxy_session_background_refresh_tracked_sessions'
+// This keeps the count of sessions tracked for a background refresh
+func registerTrackedSessionsGauge(registerer prometheus.Registerer) prometheus.Gauge {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "oauth2_proxy_session_background_refresh_tracked_sessions",
+		Help: "Current number of sessions tracked for a background refresh.",
+	})
+
+	if err := registerer.Register(gauge); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			gauge = are.ExistingCollector.(prometheus.Gauge)
+		} else {
+			panic(err)
+		}
+	}
+
+	return gauge
+}
@@ -0,0 +1,168 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("Background Refresher Tests", func() {
+	var (
+		manager   *Manager
+		refresher *Refresher
+		refreshes atomic.Int32
+		refresh   RefreshFunc
+	)
+
+	BeforeEach(func() {
+		refreshes.Store(0)
+		refresh = func(_ context.Context, s *sessionsapi.SessionState) (bool, error) {
+			refreshes.Add(1)
+			s.AccessToken = "refreshed"
+			s.ExpiresIn(time.Hour)
+			return true, nil
+		}
+
+		manager = NewManager(tests.NewMockStore(), &options.Cookie{
+			Name:   "_oauth2_proxy",
+			Secret: "0123456789abcdefghijklmnopqrstuv",
+			Expire: time.Hour,
+		})
+		refresher = NewRefresher(RefresherOptions{
+			Refresh: func(ctx context.Context, s *sessionsapi.SessionState) (bool, error) {
+				return refresh(ctx, s)
+			},
+			Window:      5 * time.Minute,
+			Interval:    10 * time.Millisecond,
+			Concurrency: 2,
+			Registerer:  prometheus.NewRegistry(),
+		})
+		manager.Refresher = refresher
+	})
+
+	// login saves a new session expiring after the given duration and
+	// returns its cookie
+	login := func(refreshToken string, expiresIn time.Duration) *http.Cookie {
+		s := &sessionsapi.SessionState{User: "jdoe", AccessToken: "original", RefreshToken: refreshToken}
+		s.ExpiresIn(expiresIn)
+
+		rw := httptest.NewRecorder()
+		Expect(manager.Save(rw, httptest.NewRequest("GET", "/", nil), s)).To(Succeed())
+		cookies := rw.Result().Cookies()
+		Expect(cookies).To(HaveLen(1))
+		return cookies[0]
+	}
+
+	load := func(cookie *http.Cookie) *sessionsapi.SessionState {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(cookie)
+		s, err := manager.Load(req)
+		Expect(err).ToNot(HaveOccurred())
+		return s
+	}
+
+	refreshDue := func() {
+		for _, e := range refresher.dueEntries() {
+			refresher.refreshEntry(context.Background(), e)
+		}
+	}
+
+	It("refreshes sessions whose access token expires within the window", func() {
+		cookie := login("refresh", time.Minute)
+		refreshDue()
+
+		Expect(refreshes.Load()).To(BeEquivalentTo(1))
+		Expect(load(cookie).AccessToken).To(Equal("refreshed"))
+		Expect(testutil.ToFloat64(refresher.refreshes.WithLabelValues("success"))).To(BeEquivalentTo(1))
+	})
+
+	It("does not refresh sessions before they are due", func() {
+		login("refresh", time.Hour)
+		refreshDue()
+
+		Expect(refreshes.Load()).To(BeZero())
+		Expect(refresher.entries).To(HaveLen(1))
+	})
+
+	It("does not track sessions without a refresh token", func() {
+		login("", time.Minute)
+		Expect(refresher.entries).To(BeEmpty())
+	})
+
+	It("brings refreshes forward by up to the jitter", func() {
+		refresher.jitter = time.Hour
+		refresher.randomDelay = func(d time.Duration) time.Duration {
+			Expect(d).To(Equal(time.Hour))
+			return 56 * time.Minute
+		}
+		login("refresh", time.Hour)
+		refreshDue()
+
+		Expect(refreshes.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("refreshes each session once until it is used again", func() {
+		cookie := login("refresh", time.Minute)
+		refresh = func(_ context.Context, s *sessionsapi.SessionState) (bool, error) {
+			refreshes.Add(1)
+			s.ExpiresIn(2 * time.Minute)
+			return true, nil
+		}
+
+		refreshDue()
+		refreshDue()
+		Expect(refreshes.Load()).To(BeEquivalentTo(1))
+
+		load(cookie)
+		refreshDue()
+		Expect(refreshes.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("counts failed refreshes and keeps the session", func() {
+		cookie := login("refresh", time.Minute)
+		refresh = func(context.Context, *sessionsapi.SessionState) (bool, error) {
+			return false, errors.New("token endpoint unavailable")
+		}
+		refreshDue()
+
+		Expect(load(cookie).AccessToken).To(Equal("original"))
+		Expect(testutil.ToFloat64(refresher.refreshes.WithLabelValues("failure"))).To(BeEquivalentTo(1))
+	})
+
+	It("stops tracking cleared sessions", func() {
+		cookie := login("refresh", time.Minute)
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(cookie)
+		Expect(manager.Clear(httptest.NewRecorder(), req)).To(Succeed())
+
+		Expect(refresher.entries).To(BeEmpty())
+		Expect(testutil.ToFloat64(refresher.tracked)).To(BeZero())
+	})
+
+	It("refreshes due sessions while running", func() {
+		cookie := login("refresh", time.Minute)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			refresher.Run(ctx)
+		}()
+
+		Eventually(refreshes.Load).Should(BeEquivalentTo(1))
+		cancel()
+		Eventually(done).Should(BeClosed())
+		Expect(load(cookie).AccessToken).To(Equal("refreshed"))
+	})
+})
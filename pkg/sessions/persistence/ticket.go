@@ -71,6 +71,13 @@ func (t *ticket) encodeTicket() string {
 		base64.RawURLEncoding.EncodeToString(t.secret))
 }
 
+// isEncodedTicket checks whether the value has the format produced by
+// encodeTicket
+func isEncodedTicket(encTicket string) bool {
+	ticketParts := strings.Split(encTicket, ".")
+	return len(ticketParts) == 3 && ticketParts[0] == "v2"
+}
+
 // decodeTicketID Tickets are encoded with format: {encoding version}.{ticketID base64}.{ticketSecret base 64}.
 // Tickets from old oauth2-proxy versions do not have the same format, and this method tries
 // to decode the ticket ID part based on the encoding version, or lack of it.
@@ -146,7 +153,7 @@ func decodeTicketFromRequest(req *http.Request, cookieOpts *options.Cookie) (*ti
 	}
 
 	// An existing cookie exists, try to retrieve the ticket
-	val, _, ok := encryption.Validate(requestCookie, cookieOpts.Secret, cookieOpts.Expire)
+	val, _, _, ok := cookieOpts.Keyset().Validate(requestCookie, cookieOpts.Expire)
 	if !ok {
 		return nil, fmt.Errorf("session ticket cookie failed validation: %v", err)
 	}
@@ -155,14 +162,14 @@ func decodeTicketFromRequest(req *http.Request, cookieOpts *options.Cookie) (*ti
 	return decodeTicket(string(val), cookieOpts)
 }
 
-// saveSession encodes the SessionState with the ticket's secret and persists
-// it to disk via the passed saveFunc.
-func (t *ticket) saveSession(s *sessions.SessionState, saver saveFunc) error {
+// saveSession encodes the SessionState in the session format version with the
+// ticket's secret and persists it to disk via the passed saveFunc.
+func (t *ticket) saveSession(s *sessions.SessionState, version uint8, saver saveFunc) error {
 	c, err := t.makeCipher()
 	if err != nil {
 		return err
 	}
-	ciphertext, err := s.EncodeSessionState(c, false)
+	ciphertext, err := s.EncodeSessionState(c, false, version)
 	if err != nil {
 		return fmt.Errorf("failed to encode the session state with the ticket: %v", err)
 	}
@@ -231,7 +238,7 @@ func (t *ticket) clearCookie(rw http.ResponseWriter, req *http.Request) {
 func (t *ticket) makeCookie(req *http.Request, value string, expires time.Duration, now time.Time) (*http.Cookie, error) {
 	if value != "" {
 		var err error
-		value, err = encryption.SignedValue(t.options.Secret, t.options.Name, []byte(value), now)
+		value, err = t.options.Keyset().SignedValue(t.options.Name, []byte(value), now)
 		if err != nil {
 			return nil, err
 		}
@@ -70,7 +70,7 @@ var _ = Describe("Session Ticket Tests", func() {
 
 			ss := &sessions.SessionState{User: "foobar"}
 			store := map[string][]byte{}
-			err = t.saveSession(ss, func(k string, v []byte, e time.Duration) error {
+			err = t.saveSession(ss, sessions.CurrentSessionFormatVersion, func(k string, v []byte, e time.Duration) error {
 				store[k] = v
 				return nil
 			})
@@ -87,6 +87,7 @@ var _ = Describe("Session Ticket Tests", func() {
 
 			err = t.saveSession(
 				&sessions.SessionState{User: "foobar"},
+				sessions.LegacySessionFormatVersion,
 				func(k string, v []byte, e time.Duration) error {
 					return errors.New("save error")
 				})
@@ -108,7 +109,7 @@ var _ = Describe("Session Ticket Tests", func() {
 			}
 			loadedSession, err := t.loadSession(
 				func(k string) ([]byte, error) {
-					return ss.EncodeSessionState(c, false)
+					return ss.EncodeSessionState(c, false, sessions.LegacySessionFormatVersion)
 				},
 				func(k string) sessions.Lock {
 					return &sessions.NoOpLock{}
@@ -0,0 +1,81 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+)
+
+// Lock is a sessions.Lock held by the session plugin. Each Lock has a random
+// token which identifies it as the holder to the plugin.
+type Lock struct {
+	store  *SessionStore
+	key    string
+	token  string
+	locked bool
+}
+
+func newLock(store *SessionStore, key string) *Lock {
+	return &Lock{
+		store: store,
+		key:   key,
+	}
+}
+
+// Obtain obtains the lock from the plugin for the configured key
+func (l *Lock) Obtain(ctx context.Context, expiration time.Duration) error {
+	if l.token == "" {
+		nonce, err := encryption.Nonce(16)
+		if err != nil {
+			return err
+		}
+		l.token = base64.RawURLEncoding.EncodeToString(nonce)
+	}
+
+	err := l.store.do(ctx, http.MethodPost, obtainPath, l.key, LockRequest{
+		Token:        l.token,
+		ExpirationMs: toMillis(expiration),
+	}, nil)
+	if err != nil {
+		return err
+	}
+	l.locked = true
+	return nil
+}
+
+// Peek returns true if the lock is held by anyone
+func (l *Lock) Peek(ctx context.Context) (bool, error) {
+	var resp PeekResponse
+	if err := l.store.do(ctx, http.MethodGet, locksPath, l.key, nil, &resp); err != nil {
+		return false, err
+	}
+	return resp.Locked, nil
+}
+
+// Refresh extends the expiration of a lock held by this Lock
+func (l *Lock) Refresh(ctx context.Context, expiration time.Duration) error {
+	if !l.locked {
+		return sessions.ErrNotLocked
+	}
+	return l.store.do(ctx, http.MethodPost, refreshPath, l.key, LockRequest{
+		Token:        l.token,
+		ExpirationMs: toMillis(expiration),
+	}, nil)
+}
+
+// Release releases a lock held by this Lock
+func (l *Lock) Release(ctx context.Context) error {
+	if !l.locked {
+		return sessions.ErrNotLocked
+	}
+	err := l.store.do(ctx, http.MethodPost, releasePath, l.key, LockRequest{Token: l.token}, nil)
+	if err == nil || errors.Is(err, sessions.ErrNotLocked) {
+		l.locked = false
+	}
+	return err
+}
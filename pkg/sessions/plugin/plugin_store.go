@@ -0,0 +1,190 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/envelope"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+)
+
+// unixSocketHost is the host used in request URLs to plugins listening on a
+// unix socket. The connection is always made to the socket.
+const unixSocketHost = "session-plugin"
+
+// Ensure SessionStore implements the interface
+var _ persistence.Store = &SessionStore{}
+
+// SessionStore is an implementation of the persistence.Store interface that
+// stores sessions in an external plugin using the session plugin protocol
+type SessionStore struct {
+	client  *http.Client
+	baseURL *url.URL
+}
+
+// NewPluginSessionStore initialises a new instance of the SessionStore and
+// wraps it in a persistence.Manager
+func NewPluginSessionStore(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessions.SessionStore, error) {
+	envelopeCipher, err := envelope.NewCipher(opts.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("error initialising session envelope encryption: %v", err)
+	}
+
+	ps, err := NewStore(opts.Plugin)
+	if err != nil {
+		return nil, fmt.Errorf("error constructing session plugin client: %v", err)
+	}
+
+	manager := persistence.NewManager(ps, cookieOpts)
+	manager.Envelope = envelopeCipher
+	if opts.WriteVersion != 0 {
+		manager.WriteVersion = uint8(opts.WriteVersion)
+	}
+	return manager, nil
+}
+
+// NewStore creates a SessionStore for the plugin at the configured address.
+// The address is either a `unix://` socket path or an `http(s)://` URL.
+func NewStore(opts options.PluginStoreOptions) (*SessionStore, error) {
+	u, err := url.Parse(opts.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session plugin address: %v", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		if socket == "" {
+			return nil, errors.New("invalid session plugin address: missing unix socket path")
+		}
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		u = &url.URL{Scheme: "http", Host: unixSocketHost}
+	case "http", "https":
+		u.Path = strings.TrimSuffix(u.Path, "/")
+	default:
+		return nil, fmt.Errorf("invalid session plugin address: unsupported scheme %q", u.Scheme)
+	}
+
+	return &SessionStore{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   opts.Timeout,
+		},
+		baseURL: u,
+	}, nil
+}
+
+// Save sends the session to the plugin to be stored until it expires
+func (store *SessionStore) Save(ctx context.Context, key string, value []byte, exp time.Duration) error {
+	err := store.do(ctx, http.MethodPut, sessionsPath, key, SaveRequest{
+		Value:        value,
+		ExpirationMs: toMillis(exp),
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("error saving plugin session: %v", err)
+	}
+	return nil
+}
+
+// Load reads the session from the plugin
+func (store *SessionStore) Load(ctx context.Context, key string) ([]byte, error) {
+	var resp LoadResponse
+	if err := store.do(ctx, http.MethodGet, sessionsPath, key, nil, &resp); err != nil {
+		return nil, fmt.Errorf("error loading plugin session: %w", err)
+	}
+	return resp.Value, nil
+}
+
+// Clear removes the session from the plugin
+func (store *SessionStore) Clear(ctx context.Context, key string) error {
+	if err := store.do(ctx, http.MethodDelete, sessionsPath, key, nil, nil); err != nil {
+		return fmt.Errorf("error clearing the session from the plugin: %v", err)
+	}
+	return nil
+}
+
+// Lock creates a lock object for sessions.SessionState
+func (store *SessionStore) Lock(key string) sessions.Lock {
+	return newLock(store, key)
+}
+
+// VerifyConnection checks the plugin is reachable and speaks this version of
+// the session plugin protocol
+func (store *SessionStore) VerifyConnection(ctx context.Context) error {
+	var resp HealthResponse
+	if err := store.do(ctx, http.MethodGet, healthPath, "", nil, &resp); err != nil {
+		return fmt.Errorf("error checking session plugin health: %v", err)
+	}
+	if resp.ProtocolVersion != ProtocolVersion {
+		return fmt.Errorf("session plugin protocol version %q is not supported, expected %q", resp.ProtocolVersion, ProtocolVersion)
+	}
+	return nil
+}
+
+// do sends a request to the plugin endpoint for the key, encoding the body as
+// JSON and decoding a successful response into out. Error responses are
+// mapped back to the errors of the persistence.Store and sessions.Lock
+// interfaces where possible.
+func (store *SessionStore) do(ctx context.Context, method, path, key string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	u := *store.baseURL
+	u.RawPath = store.baseURL.Path + strings.Replace(path, "{key}", url.PathEscape(key), 1)
+	u.Path = store.baseURL.Path + strings.Replace(path, "{key}", key, 1)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := store.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && path == sessionsPath:
+		return sessions.ErrSessionNotFound
+	case resp.StatusCode == http.StatusConflict && path == obtainPath:
+		return sessions.ErrLockNotObtained
+	case resp.StatusCode == http.StatusConflict:
+		return sessions.ErrNotLocked
+	case resp.StatusCode >= 300:
+		var errResp ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil || errResp.Error == "" {
+			return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, errResp.Error)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,138 @@
+package plugin
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Plugin SessionStore Tests", func() {
+	var ms *tests.MockStore
+	var address string
+
+	BeforeEach(func() {
+		ms = tests.NewMockStore()
+
+		// Unix socket paths are limited in length, so avoid the long
+		// per-test temporary directories
+		dir, err := os.MkdirTemp("", "plugin")
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+
+		socket := filepath.Join(dir, "sessions.sock")
+		listener, err := net.Listen("unix", socket)
+		Expect(err).ToNot(HaveOccurred())
+
+		server := &http.Server{Handler: NewServer(ms), ReadHeaderTimeout: time.Second}
+		go server.Serve(listener) //nolint:errcheck
+		DeferCleanup(server.Close)
+
+		address = "unix://" + socket
+	})
+
+	tests.RunSessionStoreTests(
+		func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+			opts.Type = options.PluginSessionStoreType
+			opts.Plugin.Address = address
+			return NewPluginSessionStore(opts, cookieOpts)
+		},
+		func(d time.Duration) error {
+			ms.FastForward(d)
+			return nil
+		})
+
+	Context("with the plugin client", func() {
+		var store *SessionStore
+
+		BeforeEach(func() {
+			var err error
+			store, err = NewStore(options.PluginStoreOptions{Address: address, Timeout: time.Second})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("verifies the connection to the plugin", func() {
+			Expect(store.VerifyConnection(context.Background())).To(Succeed())
+		})
+
+		It("saves, loads and clears sessions with any key", func() {
+			ctx := context.Background()
+			key := "_oauth2_proxy-abc/def?ghi"
+			Expect(store.Save(ctx, key, []byte("session"), time.Hour)).To(Succeed())
+
+			value, err := store.Load(ctx, key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal([]byte("session")))
+
+			Expect(store.Clear(ctx, key)).To(Succeed())
+			_, err = store.Load(ctx, key)
+			Expect(err).To(MatchError("error loading plugin session: session not found"))
+			Expect(err).To(MatchError(sessionsapi.ErrSessionNotFound))
+		})
+
+		It("only allows the holder of a lock to refresh and release it", func() {
+			ctx := context.Background()
+			holder := store.Lock("key")
+			Expect(holder.Obtain(ctx, time.Minute)).To(Succeed())
+			Expect(holder.Peek(ctx)).To(BeTrue())
+
+			other := store.Lock("key")
+			Expect(other.Refresh(ctx, time.Minute)).To(MatchError(sessionsapi.ErrNotLocked))
+			Expect(other.Release(ctx)).To(MatchError(sessionsapi.ErrNotLocked))
+
+			// A lock obtained with a different token is not held by this Lock
+			other.(*Lock).token = "other"
+			other.(*Lock).locked = true
+			Expect(other.Release(ctx)).To(MatchError(sessionsapi.ErrNotLocked))
+
+			Expect(holder.Refresh(ctx, time.Minute)).To(Succeed())
+			Expect(holder.Release(ctx)).To(Succeed())
+			Expect(holder.Peek(ctx)).To(BeFalse())
+			Expect(holder.Release(ctx)).To(MatchError(sessionsapi.ErrNotLocked))
+		})
+	})
+
+	Context("with an HTTP plugin", func() {
+		It("rejects an unsupported protocol version", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+				writeJSON(rw, http.StatusOK, HealthResponse{ProtocolVersion: "v0"})
+			}))
+			defer server.Close()
+
+			store, err := NewStore(options.PluginStoreOptions{Address: server.URL})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(store.VerifyConnection(context.Background())).To(MatchError(
+				"session plugin protocol version \"v0\" is not supported, expected \"v1\""))
+		})
+
+		It("reports errors returned by the plugin", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+				writeJSON(rw, http.StatusServiceUnavailable, ErrorResponse{Error: "etcd unavailable"})
+			}))
+			defer server.Close()
+
+			store, err := NewStore(options.PluginStoreOptions{Address: server.URL + "/"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(store.Save(context.Background(), "key", []byte("session"), time.Hour)).To(MatchError(
+				"error saving plugin session: unexpected status code 503: etcd unavailable"))
+		})
+	})
+
+	DescribeTable("NewStore with an invalid address",
+		func(address, expected string) {
+			_, err := NewStore(options.PluginStoreOptions{Address: address})
+			Expect(err).To(MatchError(expected))
+		},
+		Entry("without a socket path", "unix://", "invalid session plugin address: missing unix socket path"),
+		Entry("with an unsupported scheme", "grpc://localhost:9000", "invalid session plugin address: unsupported scheme \"grpc\""),
+	)
+})
@@ -0,0 +1,61 @@
+package plugin
+
+import "time"
+
+// ProtocolVersion is the version of the session plugin protocol. It prefixes
+// the path of every request so that plugins can serve multiple versions.
+const ProtocolVersion = "v1"
+
+// Paths of the session plugin protocol endpoints, relative to the plugin's
+// address. `{key}` is the path escaped session or lock key.
+const (
+	healthPath   = "/" + ProtocolVersion + "/health"
+	sessionsPath = "/" + ProtocolVersion + "/sessions/{key}"
+	locksPath    = "/" + ProtocolVersion + "/locks/{key}"
+	obtainPath   = locksPath + "/obtain"
+	refreshPath  = locksPath + "/refresh"
+	releasePath  = locksPath + "/release"
+)
+
+// HealthResponse is returned by the health endpoint
+type HealthResponse struct {
+	ProtocolVersion string `json:"protocolVersion"`
+}
+
+// SaveRequest is the body of a request to save a session. The value is
+// already encrypted and is base64 encoded in JSON.
+type SaveRequest struct {
+	Value        []byte `json:"value"`
+	ExpirationMs int64  `json:"expirationMs"`
+}
+
+// LoadResponse is returned when a session is loaded
+type LoadResponse struct {
+	Value []byte `json:"value"`
+}
+
+// LockRequest is the body of a request to obtain, refresh or release a lock.
+// The token identifies the holder of the lock, only the holder may refresh
+// or release it.
+type LockRequest struct {
+	Token        string `json:"token"`
+	ExpirationMs int64  `json:"expirationMs,omitempty"`
+}
+
+// PeekResponse is returned when checking whether a lock is held
+type PeekResponse struct {
+	Locked bool `json:"locked"`
+}
+
+// ErrorResponse is returned by the plugin with any unsuccessful status code
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func toMillis(d time.Duration) int64 {
+	return d.Milliseconds()
+}
+
+func fromMillis(ms int64) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
@@ -0,0 +1,235 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+)
+
+// server is the reference implementation of the session plugin protocol
+type server struct {
+	store persistence.Store
+
+	// locks holds the lock obtained for each key by the holder's token
+	locks     map[string]heldLock
+	locksLock sync.Mutex
+}
+
+type heldLock struct {
+	token string
+	lock  sessions.Lock
+}
+
+// NewServer creates an http.Handler that serves the persistence.Store over
+// the session plugin protocol. It is the reference implementation of the
+// protocol and can be used to build plugins for stores written in Go.
+func NewServer(store persistence.Store) http.Handler {
+	s := &server{
+		store: store,
+		locks: make(map[string]heldLock),
+	}
+
+	r := mux.NewRouter()
+	r.UseEncodedPath()
+	r.HandleFunc(healthPath, s.health).Methods(http.MethodGet)
+	r.HandleFunc(sessionsPath, s.saveSession).Methods(http.MethodPut)
+	r.HandleFunc(sessionsPath, s.loadSession).Methods(http.MethodGet)
+	r.HandleFunc(sessionsPath, s.clearSession).Methods(http.MethodDelete)
+	r.HandleFunc(locksPath, s.peekLock).Methods(http.MethodGet)
+	r.HandleFunc(obtainPath, s.obtainLock).Methods(http.MethodPost)
+	r.HandleFunc(refreshPath, s.refreshLock).Methods(http.MethodPost)
+	r.HandleFunc(releasePath, s.releaseLock).Methods(http.MethodPost)
+	return r
+}
+
+func (s *server) health(rw http.ResponseWriter, req *http.Request) {
+	if err := s.store.VerifyConnection(req.Context()); err != nil {
+		writeError(rw, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(rw, http.StatusOK, HealthResponse{ProtocolVersion: ProtocolVersion})
+}
+
+func (s *server) saveSession(rw http.ResponseWriter, req *http.Request) {
+	key, ok := requestKey(rw, req)
+	if !ok {
+		return
+	}
+	var body SaveRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.store.Save(req.Context(), key, body.Value, fromMillis(body.ExpirationMs)); err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// loadSession returns the session, or 404 when the store fails to load it.
+// The persistence.Store interface does not distinguish missing sessions from
+// other errors.
+func (s *server) loadSession(rw http.ResponseWriter, req *http.Request) {
+	key, ok := requestKey(rw, req)
+	if !ok {
+		return
+	}
+	value, err := s.store.Load(req.Context(), key)
+	if err != nil {
+		writeError(rw, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(rw, http.StatusOK, LoadResponse{Value: value})
+}
+
+func (s *server) clearSession(rw http.ResponseWriter, req *http.Request) {
+	key, ok := requestKey(rw, req)
+	if !ok {
+		return
+	}
+	if err := s.store.Clear(req.Context(), key); err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) peekLock(rw http.ResponseWriter, req *http.Request) {
+	key, ok := requestKey(rw, req)
+	if !ok {
+		return
+	}
+	locked, err := s.store.Lock(key).Peek(req.Context())
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(rw, http.StatusOK, PeekResponse{Locked: locked})
+}
+
+func (s *server) obtainLock(rw http.ResponseWriter, req *http.Request) {
+	key, body, ok := lockRequest(rw, req)
+	if !ok {
+		return
+	}
+
+	lock := s.store.Lock(key)
+	if err := lock.Obtain(req.Context(), fromMillis(body.ExpirationMs)); err != nil {
+		writeLockError(rw, err)
+		return
+	}
+
+	// Any previous holder's lock has expired, so it is replaced
+	s.locksLock.Lock()
+	s.locks[key] = heldLock{token: body.Token, lock: lock}
+	s.locksLock.Unlock()
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) refreshLock(rw http.ResponseWriter, req *http.Request) {
+	key, body, ok := lockRequest(rw, req)
+	if !ok {
+		return
+	}
+	lock, held := s.heldLock(key, body.Token)
+	if !held {
+		writeLockError(rw, sessions.ErrNotLocked)
+		return
+	}
+	if err := lock.Refresh(req.Context(), fromMillis(body.ExpirationMs)); err != nil {
+		writeLockError(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) releaseLock(rw http.ResponseWriter, req *http.Request) {
+	key, body, ok := lockRequest(rw, req)
+	if !ok {
+		return
+	}
+	lock, held := s.heldLock(key, body.Token)
+	if !held {
+		writeLockError(rw, sessions.ErrNotLocked)
+		return
+	}
+
+	s.locksLock.Lock()
+	delete(s.locks, key)
+	s.locksLock.Unlock()
+
+	if err := lock.Release(req.Context()); err != nil {
+		writeLockError(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// heldLock returns the lock for the key if it is held by the token
+func (s *server) heldLock(key, token string) (sessions.Lock, bool) {
+	s.locksLock.Lock()
+	defer s.locksLock.Unlock()
+	held, ok := s.locks[key]
+	if !ok || held.token != token {
+		return nil, false
+	}
+	return held.lock, true
+}
+
+// requestKey reads the unescaped key from the request path
+func requestKey(rw http.ResponseWriter, req *http.Request) (string, bool) {
+	key, err := url.PathUnescape(mux.Vars(req)["key"])
+	if err != nil || key == "" {
+		writeError(rw, http.StatusBadRequest, errors.New("invalid key"))
+		return "", false
+	}
+	return key, true
+}
+
+// lockRequest reads the key and LockRequest of a lock request
+func lockRequest(rw http.ResponseWriter, req *http.Request) (string, LockRequest, bool) {
+	var body LockRequest
+	key, ok := requestKey(rw, req)
+	if !ok {
+		return "", body, false
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return "", body, false
+	}
+	if body.Token == "" {
+		writeError(rw, http.StatusBadRequest, errors.New("missing lock token"))
+		return "", body, false
+	}
+	return key, body, true
+}
+
+// writeLockError returns 409 for lock conflicts so that the client can
+// return the matching sessions.Lock error
+func writeLockError(rw http.ResponseWriter, err error) {
+	if errors.Is(err, sessions.ErrLockNotObtained) || errors.Is(err, sessions.ErrNotLocked) {
+		writeError(rw, http.StatusConflict, err)
+		return
+	}
+	writeError(rw, http.StatusInternalServerError, err)
+}
+
+func writeError(rw http.ResponseWriter, code int, err error) {
+	writeJSON(rw, code, ErrorResponse{Error: err.Error()})
+}
+
+func writeJSON(rw http.ResponseWriter, code int, body interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	if err := json.NewEncoder(rw).Encode(body); err != nil {
+		logger.Errorf("error writing session plugin response: %v", err)
+	}
+}
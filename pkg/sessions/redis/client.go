@@ -15,6 +15,11 @@ type Client interface {
 	Set(ctx context.Context, key string, value []byte, expiration time.Duration) error
 	Del(ctx context.Context, key string) error
 	Ping(ctx context.Context) error
+	Exists(ctx context.Context, key string) (bool, error)
+	Expire(ctx context.Context, key string, expiration time.Duration) error
+	Eval(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (interface{}, error)
+	ZRange(ctx context.Context, key string) ([]string, error)
+	ZRem(ctx context.Context, key string, members ...string) error
 }
 
 var _ Client = (*client)(nil)
@@ -49,6 +54,31 @@ func (c *client) Ping(ctx context.Context) error {
 	return c.Client.Ping(ctx).Err()
 }
 
+func (c *client) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := c.Client.Exists(ctx, key).Result()
+	return n > 0, err
+}
+
+func (c *client) Expire(ctx context.Context, key string, expiration time.Duration) error {
+	return c.Client.Expire(ctx, key, expiration).Err()
+}
+
+func (c *client) Eval(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (interface{}, error) {
+	return script.Run(ctx, c.Client, keys, args...).Result()
+}
+
+func (c *client) ZRange(ctx context.Context, key string) ([]string, error) {
+	return c.Client.ZRange(ctx, key, 0, -1).Result()
+}
+
+func (c *client) ZRem(ctx context.Context, key string, members ...string) error {
+	args := make([]interface{}, 0, len(members))
+	for _, member := range members {
+		args = append(args, member)
+	}
+	return c.Client.ZRem(ctx, key, args...).Err()
+}
+
 var _ Client = (*clusterClient)(nil)
 
 type clusterClient struct {
@@ -80,3 +110,28 @@ func (c *clusterClient) Lock(key string) sessions.Lock {
 func (c *clusterClient) Ping(ctx context.Context) error {
 	return c.ClusterClient.Ping(ctx).Err()
 }
+
+func (c *clusterClient) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := c.ClusterClient.Exists(ctx, key).Result()
+	return n > 0, err
+}
+
+func (c *clusterClient) Expire(ctx context.Context, key string, expiration time.Duration) error {
+	return c.ClusterClient.Expire(ctx, key, expiration).Err()
+}
+
+func (c *clusterClient) Eval(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (interface{}, error) {
+	return script.Run(ctx, c.ClusterClient, keys, args...).Result()
+}
+
+func (c *clusterClient) ZRange(ctx context.Context, key string) ([]string, error) {
+	return c.ClusterClient.ZRange(ctx, key, 0, -1).Result()
+}
+
+func (c *clusterClient) ZRem(ctx context.Context, key string, members ...string) error {
+	args := make([]interface{}, 0, len(members))
+	for _, member := range members {
+		args = append(args, member)
+	}
+	return c.ClusterClient.ZRem(ctx, key, args...).Err()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"os"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/envelope"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
 	"github.com/redis/go-redis/v9"
 )
@@ -24,6 +26,11 @@ type SessionStore struct {
 // NewRedisSessionStore initialises a new instance of the SessionStore and wraps
 // it in a persistence.Manager
 func NewRedisSessionStore(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessions.SessionStore, error) {
+	envelopeCipher, err := envelope.NewCipher(opts.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("error initialising session envelope encryption: %v", err)
+	}
+
 	client, err := NewRedisClient(opts.Redis)
 	if err != nil {
 		return nil, fmt.Errorf("error constructing redis client: %v", err)
@@ -32,7 +39,14 @@ func NewRedisSessionStore(opts *options.SessionOptions, cookieOpts *options.Cook
 	rs := &SessionStore{
 		Client: client,
 	}
-	return persistence.NewManager(rs, cookieOpts), nil
+	manager := persistence.NewManager(rs, cookieOpts)
+	manager.Envelope = envelopeCipher
+	if opts.WriteVersion != 0 {
+		manager.WriteVersion = uint8(opts.WriteVersion)
+	}
+	manager.SessionLimit = opts.MaxConcurrent
+	manager.SessionLimitPolicy = opts.ConcurrentLimitPolicy
+	return manager, nil
 }
 
 // Save takes a sessions.SessionState and stores the information from it
@@ -49,8 +63,11 @@ func (store *SessionStore) Save(ctx context.Context, key string, value []byte, e
 // cookie within the HTTP request object
 func (store *SessionStore) Load(ctx context.Context, key string) ([]byte, error) {
 	value, err := store.Client.Get(ctx, key)
+	if errors.Is(err, redis.Nil) {
+		err = sessions.ErrSessionNotFound
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error loading redis session: %v", err)
+		return nil, fmt.Errorf("error loading redis session: %w", err)
 	}
 	return value, nil
 }
@@ -76,6 +93,102 @@ func (store *SessionStore) VerifyConnection(ctx context.Context) error {
 	return store.Client.Ping(ctx)
 }
 
+// trackSessionScript adds a session to the index unless it is already
+// tracked, enforcing the session limit in the same step so that concurrent
+// logins on different replicas cannot exceed it. It returns the oldest
+// sessions it removed to make room, or nil when the limit rejects the session.
+//
+// KEYS[1] is the index; ARGV is the score, the session key, the limit,
+// whether to evict ("1") rather than reject and the index expiry in
+// milliseconds.
+var trackSessionScript = redis.NewScript(`
+local evicted = {}
+if not redis.call('ZSCORE', KEYS[1], ARGV[2]) then
+	local limit = tonumber(ARGV[3])
+	if limit > 0 then
+		local count = redis.call('ZCARD', KEYS[1])
+		if count >= limit then
+			if ARGV[4] ~= '1' then
+				return false
+			end
+			evicted = redis.call('ZRANGE', KEYS[1], 0, count - limit)
+			redis.call('ZREM', KEYS[1], unpack(evicted))
+		end
+	end
+	redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+end
+if tonumber(ARGV[5]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[5])
+end
+return evicted
+`)
+
+// TrackSession adds the session key to a sorted set scored by the session's
+// creation time, so that the index is shared by all replicas. The limit is
+// checked and the session added by a single script, so that the index never
+// holds more than limit sessions.
+func (store *SessionStore) TrackSession(ctx context.Context, index string, key string, createdAt time.Time, exp time.Duration, limit int, evict bool) ([]string, error) {
+	evictArg := "0"
+	if evict {
+		evictArg = "1"
+	}
+	result, err := store.Client.Eval(ctx, trackSessionScript, []string{index},
+		float64(createdAt.UnixNano()), key, limit, evictArg, exp.Milliseconds())
+	if errors.Is(err, redis.Nil) {
+		return nil, sessions.ErrSessionLimitExceeded
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error tracking the session in redis: %v", err)
+	}
+
+	members, _ := result.([]interface{})
+	evicted := make([]string, 0, len(members))
+	for _, member := range members {
+		if key, ok := member.(string); ok {
+			evicted = append(evicted, key)
+		}
+	}
+	return evicted, nil
+}
+
+// UntrackSession removes the session key from the index
+func (store *SessionStore) UntrackSession(ctx context.Context, index string, key string) error {
+	if err := store.Client.ZRem(ctx, index, key); err != nil {
+		return fmt.Errorf("error untracking the session in redis: %v", err)
+	}
+	return nil
+}
+
+// ActiveSessions returns the sessions in the index, oldest first. Sessions
+// that have expired or been cleared are removed from the index.
+func (store *SessionStore) ActiveSessions(ctx context.Context, index string) ([]string, error) {
+	keys, err := store.Client.ZRange(ctx, index)
+	if err != nil {
+		return nil, fmt.Errorf("error listing the sessions in redis: %v", err)
+	}
+
+	active := make([]string, 0, len(keys))
+	stale := []string{}
+	for _, key := range keys {
+		exists, err := store.Client.Exists(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("error checking the session in redis: %v", err)
+		}
+		if exists {
+			active = append(active, key)
+		} else {
+			stale = append(stale, key)
+		}
+	}
+
+	if len(stale) > 0 {
+		if err := store.Client.ZRem(ctx, index, stale...); err != nil {
+			return nil, fmt.Errorf("error untracking expired sessions in redis: %v", err)
+		}
+	}
+	return active, nil
+}
+
 // NewRedisClient makes a redis.Client (either standalone, sentinel aware, or
 // redis cluster)
 func NewRedisClient(opts options.RedisStoreOptions) (Client, error) {
@@ -232,3 +345,4 @@ func parseRedisURLs(urls []string) ([]string, *redis.Options, error) {
 }
 
 var _ persistence.Store = (*SessionStore)(nil)
+var _ persistence.SessionTracker = (*SessionStore)(nil)
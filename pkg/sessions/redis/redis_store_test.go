@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"context"
 	"time"
 
 	"github.com/Bose/minisentinel"
@@ -242,4 +243,67 @@ var _ = Describe("Redis SessionStore Tests", func() {
 			)
 		})
 	})
+	Context("tracking active sessions", func() {
+		var store *SessionStore
+
+		BeforeEach(func() {
+			var err error
+			ss, err = NewRedisSessionStore(&options.SessionOptions{
+				Redis: options.RedisStoreOptions{ConnectionURL: redisProtocol + mr.Addr()},
+			}, &options.Cookie{})
+			Expect(err).ToNot(HaveOccurred())
+			store = ss.(*persistence.Manager).Store.(*SessionStore)
+		})
+
+		It("reports keys missing from redis as not found", func() {
+			_, err := store.Load(context.Background(), "missing")
+			Expect(err).To(MatchError(sessionsapi.ErrSessionNotFound))
+		})
+
+		It("lists sessions oldest first and removes expired sessions", func() {
+			ctx := context.Background()
+			now := time.Now()
+			for i, key := range []string{"newest", "oldest", "expiring"} {
+				Expect(store.Save(ctx, key, []byte("session"), time.Hour)).To(Succeed())
+				Expect(store.TrackSession(ctx, "index", key, now.Add(-time.Duration(i)*time.Minute), 2*time.Hour, 0, false)).To(BeEmpty())
+			}
+			Expect(store.Save(ctx, "expiring", []byte("session"), time.Minute)).To(Succeed())
+
+			Expect(store.ActiveSessions(ctx, "index")).To(Equal([]string{"expiring", "oldest", "newest"}))
+
+			mr.FastForward(2 * time.Minute)
+			Expect(store.ActiveSessions(ctx, "index")).To(Equal([]string{"oldest", "newest"}))
+			Expect(mr.ZMembers("index")).To(ConsistOf("oldest", "newest"))
+
+			Expect(store.UntrackSession(ctx, "index", "oldest")).To(Succeed())
+			Expect(store.ActiveSessions(ctx, "index")).To(Equal([]string{"newest"}))
+
+			mr.FastForward(2 * time.Hour)
+			Expect(mr.Exists("index")).To(BeFalse())
+		})
+
+		It("rejects sessions over the limit", func() {
+			ctx := context.Background()
+			now := time.Now()
+			Expect(store.TrackSession(ctx, "index", "first", now, time.Hour, 1, false)).To(BeEmpty())
+
+			_, err := store.TrackSession(ctx, "index", "second", now, time.Hour, 1, false)
+			Expect(err).To(MatchError(sessionsapi.ErrSessionLimitExceeded))
+			Expect(mr.ZMembers("index")).To(ConsistOf("first"))
+
+			// Tracking a session again does not count towards the limit
+			Expect(store.TrackSession(ctx, "index", "first", now, time.Hour, 1, false)).To(BeEmpty())
+		})
+
+		It("evicts the oldest sessions over the limit", func() {
+			ctx := context.Background()
+			now := time.Now()
+			for i, key := range []string{"oldest", "older", "newer"} {
+				Expect(store.TrackSession(ctx, "index", key, now.Add(time.Duration(i)*time.Minute), time.Hour, 0, true)).To(BeEmpty())
+			}
+
+			Expect(store.TrackSession(ctx, "index", "newest", now.Add(time.Hour), time.Hour, 2, true)).To(Equal([]string{"oldest", "older"}))
+			Expect(mr.ZMembers("index")).To(Equal([]string{"newer", "newest"}))
+		})
+	})
 })
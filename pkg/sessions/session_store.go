@@ -6,6 +6,9 @@ import (
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/cookie"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/hybrid"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/plugin"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/redis"
 )
 
@@ -16,7 +19,54 @@ func NewSessionStore(opts *options.SessionOptions, cookieOpts *options.Cookie) (
 		return cookie.NewCookieSessionStore(opts, cookieOpts)
 	case options.RedisSessionStoreType:
 		return redis.NewRedisSessionStore(opts, cookieOpts)
+	case options.PluginSessionStoreType:
+		return plugin.NewPluginSessionStore(opts, cookieOpts)
+	case options.HybridSessionStoreType:
+		return newHybridSessionStore(opts, cookieOpts)
 	default:
 		return nil, fmt.Errorf("unknown session store type '%s'", opts.Type)
 	}
 }
+
+// newHybridSessionStore creates a hybrid SessionStore that keeps small
+// sessions in cookies and larger sessions in the configured persistent store
+func newHybridSessionStore(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessions.SessionStore, error) {
+	cookieStore, err := cookie.NewCookieSessionStore(opts, cookieOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	var persistent sessions.SessionStore
+	switch opts.Hybrid.Backend {
+	case options.RedisSessionStoreType:
+		persistent, err = redis.NewRedisSessionStore(opts, cookieOpts)
+	case options.PluginSessionStoreType:
+		persistent, err = plugin.NewPluginSessionStore(opts, cookieOpts)
+	default:
+		return nil, fmt.Errorf("unknown hybrid session store backend '%s'", opts.Hybrid.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	persistentStore, ok := persistent.(hybrid.PersistentStore)
+	if !ok {
+		return nil, fmt.Errorf("session store type '%s' cannot be used as a hybrid session store backend", opts.Hybrid.Backend)
+	}
+	return hybrid.NewHybridSessionStore(cookieStore.(hybrid.CookieStore), persistentStore, cookieOpts, opts.Hybrid.Threshold), nil
+}
+
+// SetRefresher sets the background Refresher on a SessionStore which persists
+// sessions server side. Cookie session stores cannot be refreshed in the
+// background and return an error.
+func SetRefresher(store sessions.SessionStore, refresher *persistence.Refresher) error {
+	switch s := store.(type) {
+	case *persistence.Manager:
+		s.Refresher = refresher
+		return nil
+	case *hybrid.SessionStore:
+		return SetRefresher(s.Persistent, refresher)
+	default:
+		return fmt.Errorf("session store %T does not persist sessions and cannot refresh them in the background", store)
+	}
+}
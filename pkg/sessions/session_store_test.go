@@ -10,10 +10,13 @@ import (
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions"
 	sessionscookie "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/cookie"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/hybrid"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/plugin"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/redis"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func TestSessionStore(t *testing.T) {
@@ -76,6 +79,43 @@ var _ = Describe("NewSessionStore", func() {
 		})
 	})
 
+	Context("with type 'plugin'", func() {
+		BeforeEach(func() {
+			opts.Type = options.PluginSessionStoreType
+			opts.Plugin.Address = "unix:///run/oauth2-proxy/sessions.sock"
+		})
+
+		It("creates a persistence.Manager that wraps a plugin.SessionStore", func() {
+			ss, err := sessions.NewSessionStore(opts, cookieOpts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ss).To(BeAssignableToTypeOf(&persistence.Manager{}))
+			Expect(ss.(*persistence.Manager).Store).To(BeAssignableToTypeOf(&plugin.SessionStore{}))
+		})
+	})
+
+	Context("with type 'hybrid'", func() {
+		BeforeEach(func() {
+			opts.Type = options.HybridSessionStoreType
+			opts.Hybrid.Backend = options.RedisSessionStoreType
+			opts.Redis.ConnectionURL = "redis://"
+		})
+
+		It("creates a hybrid.SessionStore with a redis backend", func() {
+			ss, err := sessions.NewSessionStore(opts, cookieOpts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ss).To(BeAssignableToTypeOf(&hybrid.SessionStore{}))
+			Expect(ss.(*hybrid.SessionStore).CookieStore).To(BeAssignableToTypeOf(&sessionscookie.SessionStore{}))
+			Expect(ss.(*hybrid.SessionStore).Persistent).To(BeAssignableToTypeOf(&persistence.Manager{}))
+		})
+
+		It("returns an error with an invalid backend", func() {
+			opts.Hybrid.Backend = options.CookieSessionStoreType
+			ss, err := sessions.NewSessionStore(opts, cookieOpts)
+			Expect(err).To(MatchError("unknown hybrid session store backend 'cookie'"))
+			Expect(ss).To(BeNil())
+		})
+	})
+
 	Context("with an invalid type", func() {
 		BeforeEach(func() {
 			opts.Type = "invalid-type"
@@ -88,4 +128,40 @@ var _ = Describe("NewSessionStore", func() {
 			Expect(ss).To(BeNil())
 		})
 	})
+
+	Context("SetRefresher", func() {
+		var refresher *persistence.Refresher
+
+		BeforeEach(func() {
+			refresher = persistence.NewRefresher(persistence.RefresherOptions{Registerer: prometheus.NewRegistry()})
+			opts.Redis.ConnectionURL = "redis://"
+			opts.Hybrid.Backend = options.RedisSessionStoreType
+		})
+
+		It("sets the refresher on a persistent store", func() {
+			opts.Type = options.RedisSessionStoreType
+			ss, err := sessions.NewSessionStore(opts, cookieOpts)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(sessions.SetRefresher(ss, refresher)).To(Succeed())
+			Expect(ss.(*persistence.Manager).Refresher).To(Equal(refresher))
+		})
+
+		It("sets the refresher on the backend of a hybrid store", func() {
+			opts.Type = options.HybridSessionStoreType
+			ss, err := sessions.NewSessionStore(opts, cookieOpts)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(sessions.SetRefresher(ss, refresher)).To(Succeed())
+			Expect(ss.(*hybrid.SessionStore).Persistent.(*persistence.Manager).Refresher).To(Equal(refresher))
+		})
+
+		It("returns an error for a cookie store", func() {
+			opts.Type = options.CookieSessionStoreType
+			ss, err := sessions.NewSessionStore(opts, cookieOpts)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(sessions.SetRefresher(ss, refresher)).To(MatchError(ContainSubstring("cannot refresh them in the background")))
+		})
+	})
 })
@@ -3,6 +3,7 @@ package tests
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
@@ -19,6 +20,7 @@ type entry struct {
 type MockStore struct {
 	cache     map[string]entry
 	lockCache map[string]*MockLock
+	indexes   map[string]map[string]time.Time
 	elapsed   time.Duration
 }
 
@@ -27,6 +29,7 @@ func NewMockStore() *MockStore {
 	return &MockStore{
 		cache:     map[string]entry{},
 		lockCache: map[string]*MockLock{},
+		indexes:   map[string]map[string]time.Time{},
 		elapsed:   0 * time.Second,
 	}
 }
@@ -45,7 +48,7 @@ func (s *MockStore) Load(_ context.Context, key string) ([]byte, error) {
 	entry, ok := s.cache[key]
 	if !ok || entry.expiration <= s.elapsed {
 		delete(s.cache, key)
-		return nil, fmt.Errorf("key not found: %s", key)
+		return nil, fmt.Errorf("%w: %s", sessions.ErrSessionNotFound, key)
 	}
 	return entry.data, nil
 }
@@ -69,6 +72,70 @@ func (s *MockStore) VerifyConnection(_ context.Context) error {
 	return nil
 }
 
+// TrackSession adds a session key to an index of active sessions, enforcing
+// the session limit
+func (s *MockStore) TrackSession(_ context.Context, index string, key string, createdAt time.Time, _ time.Duration, limit int, evict bool) ([]string, error) {
+	if s.indexes[index] == nil {
+		s.indexes[index] = map[string]time.Time{}
+	}
+	if _, ok := s.indexes[index][key]; ok {
+		return nil, nil
+	}
+
+	evicted := []string{}
+	if limit > 0 && len(s.indexes[index]) >= limit {
+		if !evict {
+			return nil, sessions.ErrSessionLimitExceeded
+		}
+		tracked := s.sortedIndex(index)
+		evicted = tracked[:len(tracked)-limit+1]
+		for _, oldest := range evicted {
+			delete(s.indexes[index], oldest)
+		}
+	}
+	s.indexes[index][key] = createdAt
+	return evicted, nil
+}
+
+// UntrackSession removes a session key from an index of active sessions
+func (s *MockStore) UntrackSession(_ context.Context, index string, key string) error {
+	delete(s.indexes[index], key)
+	return nil
+}
+
+// ActiveSessions returns the keys in an index that are still in the memory
+// cache, oldest first
+func (s *MockStore) ActiveSessions(ctx context.Context, index string) ([]string, error) {
+	for key := range s.indexes[index] {
+		if _, err := s.Load(ctx, key); err != nil {
+			delete(s.indexes[index], key)
+		}
+	}
+	return s.sortedIndex(index), nil
+}
+
+// sortedIndex returns the keys in an index, oldest first
+func (s *MockStore) sortedIndex(index string) []string {
+	keys := []string{}
+	for key := range s.indexes[index] {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return s.indexes[index][keys[i]].Before(s.indexes[index][keys[j]])
+	})
+	return keys
+}
+
+// Keys returns the keys of the sessions in the store, in sorted order
+func (s *MockStore) Keys() []string {
+	keys := []string{}
+	for key := range s.cache {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // FastForward simulates the flow of time to test expirations
 func (s *MockStore) FastForward(duration time.Duration) {
 	for _, mockLock := range s.lockCache {
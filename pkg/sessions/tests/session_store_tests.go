@@ -2,8 +2,11 @@ package tests
 
 import (
 	"crypto/rand"
+	"encoding/base64"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -133,6 +136,45 @@ func RunSessionStoreTests(newSS NewSessionStoreFunc, persistentFastForward Persi
 				PersistentSessionStoreInterfaceTests(&input)
 			}
 		})
+
+		Context("with envelope encryption", func() {
+			BeforeEach(func() {
+				kek := make([]byte, 32)
+				_, err := rand.Read(kek)
+				Expect(err).ToNot(HaveOccurred())
+
+				kekFile := filepath.Join(GinkgoT().TempDir(), "kek")
+				Expect(os.WriteFile(kekFile, []byte(base64.RawURLEncoding.EncodeToString(kek)), 0600)).To(Succeed())
+
+				opts.Encryption = options.SessionEncryptionOptions{
+					KeyProvider: options.FileKeyProvider,
+					KEKFile:     kekFile,
+				}
+
+				ss, err = newSS(opts, input.cookieOpts)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			SessionStoreInterfaceTests(&input)
+			if persistentFastForward != nil {
+				PersistentSessionStoreInterfaceTests(&input)
+			}
+
+			It("cannot be loaded without the key encryption key", func() {
+				Expect(ss.Save(input.response, input.request, input.session)).To(Succeed())
+				for _, cookie := range input.response.Result().Cookies() {
+					input.request.AddCookie(cookie)
+				}
+
+				var err error
+				ss, err = newSS(&options.SessionOptions{}, input.cookieOpts)
+				Expect(err).ToNot(HaveOccurred())
+
+				loadedSession, err := ss.Load(input.request)
+				Expect(err).To(MatchError(ContainSubstring("session is envelope encrypted but no session key provider is configured")))
+				Expect(loadedSession).To(BeNil())
+			})
+		})
 	})
 }
 
@@ -468,6 +510,54 @@ func SessionStoreInterfaceTests(in *testInput) {
 			})
 		})
 
+		Context("with a session cookie signed with a previous secret", func() {
+			var previousSecret string
+
+			BeforeEach(func() {
+				req := httptest.NewRequest("GET", "http://example.com/", nil)
+				resp := httptest.NewRecorder()
+				err := in.ss().Save(resp, req, in.session)
+				Expect(err).ToNot(HaveOccurred())
+				for _, cookie := range resp.Result().Cookies() {
+					in.request.AddCookie(cookie)
+				}
+
+				// Rotate the secret, keeping the current secret as a previous secret
+				newSecret := make([]byte, 32)
+				_, err = rand.Read(newSecret)
+				Expect(err).ToNot(HaveOccurred())
+
+				previousSecret = in.cookieOpts.Secret
+				in.cookieOpts.Secret = string(newSecret)
+				in.cookieOpts.PreviousSecrets = []string{previousSecret}
+			})
+
+			LoadSessionTests(in)
+
+			It("re-issues the cookie with the new secret when saved", func() {
+				loadedSession, err := in.ss().Load(in.request)
+				Expect(err).ToNot(HaveOccurred())
+
+				resp := httptest.NewRecorder()
+				Expect(in.ss().Save(resp, in.request, loadedSession)).To(Succeed())
+
+				cookies := resp.Result().Cookies()
+				Expect(cookies).ToNot(BeEmpty())
+				_, _, ok := encryption.Validate(cookies[0], in.cookieOpts.Secret, in.cookieOpts.Expire)
+				Expect(ok).To(BeTrue())
+				_, _, ok = encryption.Validate(cookies[0], previousSecret, in.cookieOpts.Expire)
+				Expect(ok).To(BeFalse())
+			})
+
+			It("cannot be loaded once the previous secret is removed", func() {
+				in.cookieOpts.PreviousSecrets = nil
+
+				loadedSession, err := in.ss().Load(in.request)
+				Expect(err).To(HaveOccurred())
+				Expect(loadedSession).To(BeNil())
+			})
+		})
+
 		Context("with no cookies in the request", func() {
 			var loadedSession *sessionsapi.SessionState
 			var loadErr error
@@ -0,0 +1,74 @@
+package upstream
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/justinas/alice"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/dpop"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+// newDPoPForwarder creates a middleware that passes the session's DPoP-bound
+// access token to the upstream along with a proof signed for the upstream request.
+func newDPoPForwarder(upstream options.Upstream, target *url.URL, errorHandler ProxyErrorHandler) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			scope := middleware.GetRequestScope(req)
+			// Sessions without a bound key are proxied as configured by the headers chain
+			if scope == nil || scope.Session == nil || scope.Session.AccessToken == "" || len(scope.Session.DPoPKey) == 0 {
+				next.ServeHTTP(rw, req)
+				return
+			}
+
+			key, err := dpop.ParseKey(scope.Session.DPoPKey)
+			if err != nil {
+				logger.Errorf("Error loading DPoP key for upstream %q: %v", upstream.ID, err)
+				errorHandler(rw, req, err)
+				return
+			}
+
+			proof, err := dpop.NewProof(key, req.Method, upstreamRequestURI(upstream, target, req), scope.Session.AccessToken, "")
+			if err != nil {
+				logger.Errorf("Error creating DPoP proof for upstream %q: %v", upstream.ID, err)
+				errorHandler(rw, req, err)
+				return
+			}
+
+			req.Header.Set("Authorization", dpop.TokenType+" "+scope.Session.AccessToken)
+			req.Header.Set(dpop.HeaderName, proof)
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
+
+// upstreamRequestURI is the URI the request will be proxied to. The proxy
+// director sends the request URI, as rewritten by any rewrite target, to the
+// target host. Unix socket upstreams are sent plain HTTP requests for the
+// request host.
+func upstreamRequestURI(upstream options.Upstream, target *url.URL, req *http.Request) string {
+	u := &url.URL{
+		Scheme:  target.Scheme,
+		Host:    target.Host,
+		Path:    req.URL.Path,
+		RawPath: req.URL.RawPath,
+	}
+	if reqURL, err := url.ParseRequestURI(req.RequestURI); err == nil {
+		u.Path = reqURL.Path
+		u.RawPath = reqURL.RawPath
+	}
+
+	if target.Scheme == unixScheme {
+		u.Scheme = httpScheme
+		u.Host = req.Host
+		if upstream.PassHostHeader != nil && !*upstream.PassHostHeader {
+			u.Host = target.Host
+		}
+		if u.Host == "" {
+			u.Host = "localhost"
+		}
+	}
+	return u.String()
+}
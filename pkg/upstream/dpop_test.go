@@ -0,0 +1,114 @@
+package upstream
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/golang-jwt/jwt/v5"
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/dpop"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DPoP Forwarder Suite", func() {
+	var errorHandlerCalled bool
+	var upstreamHeaders http.Header
+
+	target, _ := url.Parse("https://api.example.com/base")
+	upstream := options.Upstream{ID: "api", ForwardDPoP: true}
+
+	errorHandler := func(rw http.ResponseWriter, _ *http.Request, _ error) {
+		errorHandlerCalled = true
+		rw.WriteHeader(http.StatusBadGateway)
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		upstreamHeaders = req.Header.Clone()
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(session *sessionsapi.SessionState) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/items?page=2", nil)
+		req.Header.Set("Authorization", "Bearer original")
+		req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{Session: session})
+
+		rw := httptest.NewRecorder()
+		newDPoPForwarder(upstream, target, errorHandler)(next).ServeHTTP(rw, req)
+		return rw
+	}
+
+	BeforeEach(func() {
+		errorHandlerCalled = false
+		upstreamHeaders = nil
+	})
+
+	It("forwards the bound token with a fresh proof", func() {
+		key, err := dpop.GenerateKey()
+		Expect(err).ToNot(HaveOccurred())
+		der, err := dpop.MarshalKey(key)
+		Expect(err).ToNot(HaveOccurred())
+
+		rw := serve(&sessionsapi.SessionState{AccessToken: "bound", DPoPKey: der})
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(upstreamHeaders.Get("Authorization")).To(Equal("DPoP bound"))
+
+		claims := jwt.MapClaims{}
+		_, err = jwt.ParseWithClaims(upstreamHeaders.Get(dpop.HeaderName), claims, func(*jwt.Token) (interface{}, error) {
+			return &key.PublicKey, nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(claims["htm"]).To(Equal("POST"))
+		Expect(claims["htu"]).To(Equal("https://api.example.com/items"))
+		Expect(claims).To(HaveKey("ath"))
+	})
+
+	Context("upstreamRequestURI", func() {
+		newRequest := func(uri string) *http.Request {
+			req := httptest.NewRequest("GET", "http://app.example.com/items?page=2", nil)
+			req.RequestURI = uri
+			return req
+		}
+
+		It("uses the rewritten request path", func() {
+			req := newRequest("/v1/items?page=2")
+			Expect(upstreamRequestURI(upstream, target, req)).To(Equal("https://api.example.com/v1/items"))
+		})
+
+		It("keeps escaped characters of the request path", func() {
+			req := newRequest("/items/a%2Fb")
+			Expect(upstreamRequestURI(upstream, target, req)).To(Equal("https://api.example.com/items/a%2Fb"))
+		})
+
+		It("uses the request host for unix socket upstreams", func() {
+			unixTarget, _ := url.Parse("unix:///var/run/api.sock")
+			req := newRequest("/items?page=2")
+			Expect(upstreamRequestURI(upstream, unixTarget, req)).To(Equal("http://app.example.com/items"))
+		})
+
+		It("uses localhost for unix socket upstreams that do not pass the host header", func() {
+			passHostHeader := false
+			unixUpstream := options.Upstream{ID: "api", ForwardDPoP: true, PassHostHeader: &passHostHeader}
+			unixTarget, _ := url.Parse("unix:///var/run/api.sock")
+			req := newRequest("/items?page=2")
+			Expect(upstreamRequestURI(unixUpstream, unixTarget, req)).To(Equal("http://localhost/items"))
+		})
+	})
+
+	It("passes sessions without a DPoP key through untouched", func() {
+		rw := serve(&sessionsapi.SessionState{AccessToken: "unbound"})
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(upstreamHeaders.Get("Authorization")).To(Equal("Bearer original"))
+		Expect(upstreamHeaders.Get(dpop.HeaderName)).To(BeEmpty())
+	})
+
+	It("calls the error handler when the session key is invalid", func() {
+		rw := serve(&sessionsapi.SessionState{AccessToken: "bound", DPoPKey: []byte("invalid")})
+		Expect(rw.Code).To(Equal(http.StatusBadGateway))
+		Expect(errorHandlerCalled).To(BeTrue())
+		Expect(upstreamHeaders).To(BeNil())
+	})
+})
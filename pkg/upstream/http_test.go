@@ -485,7 +485,7 @@ var _ = Describe("HTTP Upstream Suite", func() {
 
 			handler := newHTTPUpstreamProxy(upstream, u, nil, nil)
 
-			proxyServer = httptest.NewServer(middleware.NewScope(false, "X-Request-Id")(handler))
+			proxyServer = httptest.NewServer(middleware.NewScope(false, "X-Request-Id", nil, "")(handler))
 		})
 
 		AfterEach(func() {
@@ -22,7 +22,9 @@ type ProxyErrorHandler func(http.ResponseWriter, *http.Request, error)
 
 // NewProxy creates a new multiUpstreamProxy that can serve requests directed to
 // multiple upstreams.
-func NewProxy(upstreams options.UpstreamConfig, sigData *options.SignatureData, writer pagewriter.Writer) (http.Handler, error) {
+// The exchanger is used for upstreams configured with a TokenExchange and may
+// be nil when no upstream requires one.
+func NewProxy(upstreams options.UpstreamConfig, sigData *options.SignatureData, writer pagewriter.Writer, exchanger TokenExchanger) (http.Handler, error) {
 	m := &multiUpstreamProxy{
 		serveMux: mux.NewRouter(),
 	}
@@ -49,7 +51,7 @@ func NewProxy(upstreams options.UpstreamConfig, sigData *options.SignatureData,
 				return nil, fmt.Errorf("could not register file upstream %q: %v", upstream.ID, err)
 			}
 		case httpScheme, httpsScheme, unixScheme:
-			if err := m.registerHTTPUpstreamProxy(upstream, u, sigData, writer); err != nil {
+			if err := m.registerHTTPUpstreamProxy(upstream, u, sigData, writer, exchanger); err != nil {
 				return nil, fmt.Errorf("could not register %s upstream %q: %v", u.Scheme, upstream.ID, err)
 			}
 		default:
@@ -85,9 +87,22 @@ func (m *multiUpstreamProxy) registerFileServer(upstream options.Upstream, u *ur
 }
 
 // registerHTTPUpstreamProxy registers a new httpUpstreamProxy based on the configuration given.
-func (m *multiUpstreamProxy) registerHTTPUpstreamProxy(upstream options.Upstream, u *url.URL, sigData *options.SignatureData, writer pagewriter.Writer) error {
+func (m *multiUpstreamProxy) registerHTTPUpstreamProxy(upstream options.Upstream, u *url.URL, sigData *options.SignatureData, writer pagewriter.Writer, exchanger TokenExchanger) error {
 	logger.Printf("mapping path %q => upstream %q", upstream.Path, upstream.URI)
-	return m.registerHandler(upstream, newHTTPUpstreamProxy(upstream, u, sigData, writer.ProxyErrorHandler), writer)
+	handler := newHTTPUpstreamProxy(upstream, u, sigData, writer.ProxyErrorHandler)
+
+	if upstream.TokenExchange != nil {
+		exchange, err := newTokenExchange(upstream, exchanger, writer.ProxyErrorHandler)
+		if err != nil {
+			return err
+		}
+		handler = alice.New(exchange).Then(handler)
+	}
+	if upstream.ForwardDPoP {
+		handler = alice.New(newDPoPForwarder(upstream, u, writer.ProxyErrorHandler)).Then(handler)
+	}
+
+	return m.registerHandler(upstream, handler, writer)
 }
 
 // registerHandler ensures the given handler is regiestered with the serveMux.
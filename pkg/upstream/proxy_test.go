@@ -111,7 +111,7 @@ var _ = Describe("Proxy Suite", func() {
 					}
 				}
 
-				upstreamServer, err := NewProxy(upstreams, sigData, writer)
+				upstreamServer, err := NewProxy(upstreams, sigData, writer, nil)
 				Expect(err).ToNot(HaveOccurred())
 
 				req := middlewareapi.AddRequestScope(
@@ -0,0 +1,82 @@
+package upstream
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+)
+
+// StepUpMatcher finds the step-up authentication requirements of the upstream
+// that would serve a request.
+type StepUpMatcher struct {
+	router   *mux.Router
+	requires map[string]*options.StepUp
+}
+
+// NewStepUpMatcher builds a StepUpMatcher from the upstream configuration.
+// Upstreams are matched with the same precedence as the upstream proxy.
+// If no upstream requires step-up authentication, nil is returned.
+func NewStepUpMatcher(upstreams options.UpstreamConfig) (*StepUpMatcher, error) {
+	m := &StepUpMatcher{
+		router:   mux.NewRouter(),
+		requires: make(map[string]*options.StepUp),
+	}
+
+	// Copy the upstreams so that sorting does not reorder the configuration
+	sorted := append([]options.Upstream(nil), upstreams.Upstreams...)
+	for _, upstream := range sortByPathLongest(sorted) {
+		if err := m.registerUpstream(upstream); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(m.requires) == 0 {
+		return nil, nil
+	}
+	return m, nil
+}
+
+// registerUpstream adds a route for the upstream. Every upstream is
+// registered, including those without step-up requirements, so that a more
+// specific upstream without requirements shadows a less specific one.
+func (m *StepUpMatcher) registerUpstream(upstream options.Upstream) error {
+	var route *mux.Route
+	switch {
+	case upstream.RewriteTarget != "":
+		rewriteRegExp, err := regexp.Compile(upstream.Path)
+		if err != nil {
+			return fmt.Errorf("invalid path %q for upstream: %v", upstream.Path, err)
+		}
+		route = m.router.MatcherFunc(func(req *http.Request, _ *mux.RouteMatch) bool {
+			return rewriteRegExp.MatchString(req.URL.Path)
+		})
+	case strings.HasSuffix(upstream.Path, "/"):
+		route = m.router.PathPrefix(upstream.Path)
+	default:
+		route = m.router.Path(upstream.Path)
+	}
+
+	route.Name(upstream.ID)
+	if upstream.StepUp != nil {
+		m.requires[upstream.ID] = upstream.StepUp
+	}
+	return nil
+}
+
+// Match returns the step-up requirements for the request, or nil if the
+// upstream serving the request has none.
+func (m *StepUpMatcher) Match(req *http.Request) *options.StepUp {
+	if m == nil {
+		return nil
+	}
+
+	match := &mux.RouteMatch{}
+	if !m.router.Match(req, match) || match.Route == nil {
+		return nil
+	}
+	return m.requires[match.Route.GetName()]
+}
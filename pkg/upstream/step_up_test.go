@@ -0,0 +1,77 @@
+package upstream
+
+import (
+	"net/http/httptest"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Step-up Matcher Suite", func() {
+	maxAuthAge := options.Duration(5 * time.Minute)
+	adminStepUp := &options.StepUp{ACRValues: []string{"mfa"}}
+	rewriteStepUp := &options.StepUp{MaxAuthAge: &maxAuthAge}
+
+	upstreams := options.UpstreamConfig{
+		Upstreams: []options.Upstream{
+			{
+				ID:   "root",
+				Path: "/",
+				URI:  "http://example.localhost",
+			},
+			{
+				ID:     "admin",
+				Path:   "/admin/",
+				URI:    "http://example.localhost",
+				StepUp: adminStepUp,
+			},
+			{
+				ID:   "admin-public",
+				Path: "/admin/public/",
+				URI:  "http://example.localhost",
+			},
+			{
+				ID:            "rewrite",
+				Path:          "^/billing/(.*)$",
+				RewriteTarget: "/$1",
+				URI:           "http://example.localhost",
+				StepUp:        rewriteStepUp,
+			},
+		},
+	}
+
+	It("returns nil when no upstream requires step-up", func() {
+		matcher, err := NewStepUpMatcher(options.UpstreamConfig{
+			Upstreams: []options.Upstream{{ID: "root", Path: "/", URI: "http://example.localhost"}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matcher).To(BeNil())
+		Expect(matcher.Match(httptest.NewRequest("GET", "/", nil))).To(BeNil())
+	})
+
+	It("does not reorder the upstream configuration", func() {
+		_, err := NewStepUpMatcher(upstreams)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(upstreams.Upstreams[0].ID).To(Equal("root"))
+	})
+
+	DescribeTable("Match",
+		func(path string, expected *options.StepUp) {
+			matcher, err := NewStepUpMatcher(upstreams)
+			Expect(err).ToNot(HaveOccurred())
+
+			stepUp := matcher.Match(httptest.NewRequest("GET", path, nil))
+			if expected == nil {
+				Expect(stepUp).To(BeNil())
+			} else {
+				Expect(stepUp).To(Equal(expected))
+			}
+		},
+		Entry("with an upstream without step-up", "/home", nil),
+		Entry("with an upstream requiring step-up", "/admin/users", adminStepUp),
+		Entry("with a more specific upstream without step-up", "/admin/public/logo.png", nil),
+		Entry("with a rewrite upstream requiring step-up", "/billing/invoices", rewriteStepUp),
+	)
+})
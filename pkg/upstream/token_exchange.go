@@ -0,0 +1,173 @@
+package upstream
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/justinas/alice"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cache"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/dpop"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/header"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"golang.org/x/oauth2"
+)
+
+// tokenExchangeExpiryDelta is how long before expiry a cached exchanged token
+// is considered stale so that upstreams never receive an expired token.
+const tokenExchangeExpiryDelta = 10 * time.Second
+
+// defaultTokenExchangeCacheSize is the number of exchanged tokens cached per
+// upstream when no cache size is configured.
+const defaultTokenExchangeCacheSize = 1000
+
+// TokenExchanger exchanges a subject token for a token scoped to an upstream
+// as described in RFC 8693.
+type TokenExchanger interface {
+	ExchangeToken(ctx context.Context, subjectToken string, exchange options.TokenExchange) (*oauth2.Token, error)
+}
+
+// defaultTokenExchangeHeaders passes the exchanged token as a bearer token.
+var defaultTokenExchangeHeaders = []options.Header{
+	{
+		Name: "Authorization",
+		Values: []options.HeaderValue{
+			{
+				ClaimSource: &options.ClaimSource{
+					Claim:  "access_token",
+					Prefix: "Bearer ",
+				},
+			},
+		},
+	},
+}
+
+// newTokenExchange creates a middleware that exchanges the session's access
+// token for one scoped to the upstream and injects it into the request headers.
+func newTokenExchange(upstream options.Upstream, exchanger TokenExchanger, errorHandler ProxyErrorHandler) (alice.Constructor, error) {
+	if exchanger == nil {
+		return nil, errors.New("token exchange configured but no token exchanger available")
+	}
+
+	headers := upstream.TokenExchange.InjectRequestHeaders
+	if len(headers) == 0 {
+		headers = defaultTokenExchangeHeaders
+	}
+	injector, err := header.NewInjector(headers, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error building token exchange header injector: %v", err)
+	}
+
+	headerNames := []string{}
+	for _, h := range headers {
+		headerNames = append(headerNames, h.Name)
+	}
+
+	cacheSize := defaultTokenExchangeCacheSize
+	if upstream.TokenExchange.CacheSize != nil {
+		cacheSize = *upstream.TokenExchange.CacheSize
+	}
+
+	t := &tokenExchange{
+		upstream:     upstream.ID,
+		headerNames:  headerNames,
+		exchange:     *upstream.TokenExchange,
+		exchanger:    exchanger,
+		injector:     injector,
+		errorHandler: errorHandler,
+		cache:        cache.NewLRU[string](cacheSize),
+	}
+	return t.middleware, nil
+}
+
+// tokenExchange performs the token exchange for a single upstream
+type tokenExchange struct {
+	upstream     string
+	headerNames  []string
+	exchange     options.TokenExchange
+	exchanger    TokenExchanger
+	injector     header.Injector
+	errorHandler ProxyErrorHandler
+	cache        *cache.LRU[string]
+}
+
+func (t *tokenExchange) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		scope := middleware.GetRequestScope(req)
+		// No session to exchange a token for, eg. a request to an allowed route
+		if scope == nil || scope.Session == nil || scope.Session.AccessToken == "" {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		token, err := t.getToken(req.Context(), scope.Session)
+		if err != nil {
+			logger.Errorf("Error exchanging token for upstream %q: %v", t.upstream, err)
+			t.errorHandler(rw, req, err)
+			return
+		}
+
+		// Replace any values set for these headers by the headers chain, then
+		// inject using a copy of the session so that only the upstream sees
+		// the exchanged token.
+		for _, name := range t.headerNames {
+			req.Header.Del(name)
+		}
+		t.injector.Inject(req.Header, &sessionsapi.SessionState{
+			CreatedAt:         scope.Session.CreatedAt,
+			ExpiresOn:         scope.Session.ExpiresOn,
+			AccessToken:       token,
+			IDToken:           scope.Session.IDToken,
+			Email:             scope.Session.Email,
+			User:              scope.Session.User,
+			Groups:            scope.Session.Groups,
+			PreferredUsername: scope.Session.PreferredUsername,
+		})
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// getToken returns the cached exchanged token for the session or performs a
+// new exchange if there is no valid token cached.
+func (t *tokenExchange) getToken(ctx context.Context, session *sessionsapi.SessionState) (string, error) {
+	key := tokenExchangeCacheKey(session.AccessToken)
+	if token, ok := t.cache.Get(key, time.Now().Add(tokenExchangeExpiryDelta)); ok {
+		return token, nil
+	}
+
+	// A DPoP-bound subject token is only accepted with a proof of possession
+	// of the session's key
+	ctx, err := dpop.ContextForSession(ctx, session)
+	if err != nil {
+		return "", err
+	}
+	token, err := t.exchanger.ExchangeToken(ctx, session.AccessToken, t.exchange)
+	if err != nil {
+		return "", err
+	}
+
+	// Tokens without an expiry are cached for the lifetime of the session
+	expires := token.Expiry
+	if expires.IsZero() && session.ExpiresOn != nil {
+		expires = *session.ExpiresOn
+	}
+	if !expires.IsZero() {
+		t.cache.Set(key, token.AccessToken, expires, time.Now())
+	}
+	return token.AccessToken, nil
+}
+
+// tokenExchangeCacheKey identifies a session by a hash of its access token
+// so that the subject token is not held in memory by the cache.
+// A refreshed session has a new access token and therefore a new exchange.
+func tokenExchangeCacheKey(subjectToken string) string {
+	sum := sha256.Sum256([]byte(subjectToken))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,198 @@
+package upstream
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/dpop"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/oauth2"
+)
+
+type fakeTokenExchanger struct {
+	calls  int
+	expiry time.Time
+	err    error
+	// dpopKey is the DPoP key of the last exchange's context
+	dpopKey *ecdsa.PrivateKey
+}
+
+func (f *fakeTokenExchanger) ExchangeToken(ctx context.Context, subjectToken string, exchange options.TokenExchange) (*oauth2.Token, error) {
+	f.calls++
+	f.dpopKey = dpop.KeyFromContext(ctx)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &oauth2.Token{
+		AccessToken: exchange.Audience + ":" + subjectToken,
+		Expiry:      f.expiry,
+	}, nil
+}
+
+var _ = Describe("Token Exchange Suite", func() {
+	var exchanger *fakeTokenExchanger
+	var upstream options.Upstream
+	var errorHandlerCalled bool
+	var upstreamHeaders http.Header
+
+	errorHandler := func(rw http.ResponseWriter, _ *http.Request, _ error) {
+		errorHandlerCalled = true
+		rw.WriteHeader(http.StatusBadGateway)
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		upstreamHeaders = req.Header.Clone()
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(session *sessionsapi.SessionState) *httptest.ResponseRecorder {
+		exchange, err := newTokenExchange(upstream, exchanger, errorHandler)
+		Expect(err).ToNot(HaveOccurred())
+
+		req := httptest.NewRequest("", "/", nil)
+		req.Header.Set("Authorization", "Bearer original")
+		req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{Session: session})
+
+		rw := httptest.NewRecorder()
+		exchange(next).ServeHTTP(rw, req)
+		return rw
+	}
+
+	BeforeEach(func() {
+		exchanger = &fakeTokenExchanger{expiry: time.Now().Add(time.Hour)}
+		errorHandlerCalled = false
+		upstreamHeaders = nil
+		upstream = options.Upstream{
+			ID: "api",
+			TokenExchange: &options.TokenExchange{
+				Audience: "api",
+			},
+		}
+	})
+
+	It("replaces the Authorization header with the exchanged token", func() {
+		rw := serve(&sessionsapi.SessionState{AccessToken: "original"})
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(upstreamHeaders.Values("Authorization")).To(ConsistOf("Bearer api:original"))
+	})
+
+	It("proves possession of the key a DPoP-bound subject token is bound to", func() {
+		key, err := dpop.GenerateKey()
+		Expect(err).ToNot(HaveOccurred())
+		der, err := dpop.MarshalKey(key)
+		Expect(err).ToNot(HaveOccurred())
+
+		rw := serve(&sessionsapi.SessionState{AccessToken: "original", DPoPKey: der})
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(exchanger.dpopKey).ToNot(BeNil())
+		Expect(exchanger.dpopKey.Equal(key)).To(BeTrue())
+		Expect(upstreamHeaders.Values("Authorization")).To(ConsistOf("Bearer api:original"))
+	})
+
+	It("does not send a DPoP proof for bearer subject tokens", func() {
+		rw := serve(&sessionsapi.SessionState{AccessToken: "original"})
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(exchanger.dpopKey).To(BeNil())
+	})
+
+	It("fails the request when the session's DPoP key is invalid", func() {
+		rw := serve(&sessionsapi.SessionState{AccessToken: "original", DPoPKey: []byte("invalid")})
+		Expect(rw.Code).To(Equal(http.StatusBadGateway))
+		Expect(errorHandlerCalled).To(BeTrue())
+		Expect(exchanger.calls).To(Equal(0))
+	})
+
+	It("injects the exchanged token into configured headers", func() {
+		upstream.TokenExchange.InjectRequestHeaders = []options.Header{
+			{
+				Name: "X-Forwarded-Access-Token",
+				Values: []options.HeaderValue{
+					{ClaimSource: &options.ClaimSource{Claim: "access_token"}},
+				},
+			},
+		}
+
+		rw := serve(&sessionsapi.SessionState{AccessToken: "original"})
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(upstreamHeaders.Get("X-Forwarded-Access-Token")).To(Equal("api:original"))
+		Expect(upstreamHeaders.Get("Authorization")).To(Equal("Bearer original"))
+	})
+
+	It("caches the exchanged token per session until it expires", func() {
+		exchange, err := newTokenExchange(upstream, exchanger, errorHandler)
+		Expect(err).ToNot(HaveOccurred())
+		handler := exchange(next)
+
+		for _, accessToken := range []string{"first", "first", "second", "first"} {
+			req := httptest.NewRequest("", "/", nil)
+			req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{
+				Session: &sessionsapi.SessionState{AccessToken: accessToken},
+			})
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			Expect(upstreamHeaders.Get("Authorization")).To(Equal("Bearer api:" + accessToken))
+		}
+		Expect(exchanger.calls).To(Equal(2))
+	})
+
+	It("does not cache tokens when the cache size is 0", func() {
+		cacheSize := 0
+		upstream.TokenExchange.CacheSize = &cacheSize
+		exchange, err := newTokenExchange(upstream, exchanger, errorHandler)
+		Expect(err).ToNot(HaveOccurred())
+		handler := exchange(next)
+
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest("", "/", nil)
+			req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{
+				Session: &sessionsapi.SessionState{AccessToken: "original"},
+			})
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		Expect(exchanger.calls).To(Equal(2))
+	})
+
+	It("does not reuse a token that is about to expire", func() {
+		exchanger.expiry = time.Now().Add(time.Second)
+		exchange, err := newTokenExchange(upstream, exchanger, errorHandler)
+		Expect(err).ToNot(HaveOccurred())
+		handler := exchange(next)
+
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest("", "/", nil)
+			req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{
+				Session: &sessionsapi.SessionState{AccessToken: "original"},
+			})
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		Expect(exchanger.calls).To(Equal(2))
+	})
+
+	It("passes requests without a session through untouched", func() {
+		rw := serve(nil)
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(exchanger.calls).To(Equal(0))
+		Expect(upstreamHeaders.Get("Authorization")).To(Equal("Bearer original"))
+	})
+
+	It("calls the error handler when the exchange fails", func() {
+		exchanger.err = errors.New("exchange failed")
+
+		rw := serve(&sessionsapi.SessionState{AccessToken: "original"})
+		Expect(rw.Code).To(Equal(http.StatusBadGateway))
+		Expect(errorHandlerCalled).To(BeTrue())
+		Expect(upstreamHeaders).To(BeNil())
+	})
+
+	It("errors when no exchanger is available", func() {
+		_, err := newTokenExchange(upstream, nil, errorHandler)
+		Expect(err).To(MatchError("token exchange configured but no token exchanger available"))
+	})
+})
@@ -13,12 +13,12 @@ import (
 func validateAllowlists(o *options.Options) []string {
 	msgs := []string{}
 
-	msgs = append(msgs, validateAuthRoutes(o)...)
-	msgs = append(msgs, validateAuthRegexes(o)...)
+	msgs = append(msgs, validateAllowlistRules(o)...)
 	msgs = append(msgs, validateTrustedIPs(o)...)
+	msgs = append(msgs, validateTrustedProxies(o)...)
 
-	if len(o.TrustedIPs) > 0 && o.ReverseProxy {
-		_, err := fmt.Fprintln(os.Stderr, "WARNING: mixing --trusted-ip with --reverse-proxy is a potential security vulnerability. An attacker can inject a trusted IP into an X-Real-IP or X-Forwarded-For header if they aren't properly protected outside of oauth2-proxy")
+	if len(o.TrustedIPs) > 0 && o.ReverseProxy && len(o.TrustedProxies) == 0 {
+		_, err := fmt.Fprintln(os.Stderr, "WARNING: mixing --trusted-ip with --reverse-proxy is a potential security vulnerability. An attacker can inject a trusted IP into an X-Real-IP or X-Forwarded-For header if they aren't properly protected outside of oauth2-proxy. Set --trusted-proxy to only accept these headers from your reverse proxies")
 		if err != nil {
 			panic(err)
 		}
@@ -27,30 +27,54 @@ func validateAllowlists(o *options.Options) []string {
 	return msgs
 }
 
-// validateAuthRoutes validates method=path routes passed with options.SkipAuthRoutes
-func validateAuthRoutes(o *options.Options) []string {
+// validateAllowlistRules validates the rules passed with options.AllowlistRules
+func validateAllowlistRules(o *options.Options) []string {
 	msgs := []string{}
-	for _, route := range o.SkipAuthRoutes {
-		var regex string
-		parts := strings.SplitN(route, "=", 2)
-		if len(parts) == 1 {
-			regex = parts[0]
-		} else {
-			regex = parts[1]
+	for i, rule := range o.AllowlistRules {
+		name := rule.ID
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
 		}
-		_, err := regexp.Compile(regex)
-		if err != nil {
-			msgs = append(msgs, fmt.Sprintf("error compiling regex /%s/: %v", regex, err))
+
+		switch rule.Policy {
+		case "", options.SkipAuthAllowlistPolicy, options.AnonymousAllowlistPolicy:
+		default:
+			msgs = append(msgs, fmt.Sprintf("allowlist rule %q has invalid policy %q: must be %q or %q", name, rule.Policy, options.SkipAuthAllowlistPolicy, options.AnonymousAllowlistPolicy))
+		}
+		for _, host := range rule.Hosts {
+			if host == "" {
+				msgs = append(msgs, fmt.Sprintf("allowlist rule %q has an empty host", name))
+			} else if domain := strings.TrimPrefix(host, "*."); domain == "" || strings.Contains(domain, "*") {
+				msgs = append(msgs, fmt.Sprintf("allowlist rule %q has invalid host %q: a wildcard may only be a leading \"*.\" before a domain", name, host))
+			}
+		}
+		for _, method := range rule.Methods {
+			if method == "" {
+				msgs = append(msgs, fmt.Sprintf("allowlist rule %q has an empty method", name))
+			}
+		}
+		if rule.Path != "" {
+			msgs = append(msgs, validateRegexes([]string{rule.Path})...)
+		} else if rule.NegatePath {
+			msgs = append(msgs, fmt.Sprintf("allowlist rule %q has negatePath without a path", name))
+		}
+		for _, cidr := range rule.SourceCIDRs {
+			if ip.ParseIPNet(cidr) == nil {
+				msgs = append(msgs, fmt.Sprintf("allowlist rule %q has source CIDR (%s) that could not be recognized", name, cidr))
+			}
+		}
+		for _, header := range rule.Headers {
+			if header.Name == "" {
+				msgs = append(msgs, fmt.Sprintf("allowlist rule %q has a header with an empty name", name))
+			}
+			if header.Value != "" {
+				msgs = append(msgs, validateRegexes([]string{header.Value})...)
+			}
 		}
 	}
 	return msgs
 }
 
-// validateAuthRegexes validates regex paths passed with options.SkipAuthRegex
-func validateAuthRegexes(o *options.Options) []string {
-	return validateRegexes(o.SkipAuthRegex)
-}
-
 // validateTrustedIPs validates IP/CIDRs for IP based allowlists
 func validateTrustedIPs(o *options.Options) []string {
 	msgs := []string{}
@@ -62,9 +86,39 @@ func validateTrustedIPs(o *options.Options) []string {
 	return msgs
 }
 
-// validateAPIRoutes validates regex paths passed with options.ApiRoutes
+// validateTrustedProxies validates IP/CIDRs of trusted reverse proxies
+func validateTrustedProxies(o *options.Options) []string {
+	msgs := []string{}
+	for i, ipStr := range o.TrustedProxies {
+		if nil == ip.ParseIPNet(ipStr) {
+			msgs = append(msgs, fmt.Sprintf("trusted_proxies[%d] (%s) could not be recognized", i, ipStr))
+		}
+	}
+	return msgs
+}
+
+// validateAPIRoutes validates regex paths passed with options.ApiRoutes and
+// the requirement=path routes passed with options.APIRouteScopes and
+// options.APIRouteAudiences
 func validateAPIRoutes(o *options.Options) []string {
-	return validateRegexes(o.APIRoutes)
+	msgs := validateRegexes(o.APIRoutes)
+	msgs = append(msgs, validateAPIRouteRequirements("api_route_scopes", o.APIRouteScopes)...)
+	msgs = append(msgs, validateAPIRouteRequirements("api_route_audiences", o.APIRouteAudiences)...)
+	return msgs
+}
+
+// validateAPIRouteRequirements validates values[ value...]=path routes
+func validateAPIRouteRequirements(name string, routes []string) []string {
+	msgs := []string{}
+	for i, route := range routes {
+		parts := strings.SplitN(route, "=", 2)
+		if len(parts) != 2 || len(strings.Fields(parts[0])) == 0 {
+			msgs = append(msgs, fmt.Sprintf("%s[%d] (%s) must be of the form value[ value...]=path_regex", name, i, route))
+			continue
+		}
+		msgs = append(msgs, validateRegexes([]string{parts[1]})...)
+	}
+	return msgs
 }
 
 // validateRegexes validates all regexes and returns a list of messages in case of error
@@ -8,13 +8,14 @@ import (
 )
 
 var _ = Describe("Allowlist", func() {
-	type validateRoutesTableInput struct {
-		routes     []string
+	type validateAllowlistRulesTableInput struct {
+		rules      []options.AllowlistRule
 		errStrings []string
 	}
 
-	type validateRegexesTableInput struct {
-		regexes    []string
+	type validateAPIRoutesTableInput struct {
+		scopes     []string
+		audiences  []string
 		errStrings []string
 	}
 
@@ -23,28 +24,38 @@ var _ = Describe("Allowlist", func() {
 		errStrings []string
 	}
 
-	DescribeTable("validateRoutes",
-		func(r *validateRoutesTableInput) {
+	DescribeTable("validateAllowlistRules",
+		func(r *validateAllowlistRulesTableInput) {
 			opts := &options.Options{
-				SkipAuthRoutes: r.routes,
+				AllowlistRules: r.rules,
 			}
-			Expect(validateAuthRoutes(opts)).To(ConsistOf(r.errStrings))
+			Expect(validateAllowlistRules(opts)).To(ConsistOf(r.errStrings))
 		},
-		Entry("Valid regex routes", &validateRoutesTableInput{
-			routes: []string{
-				"/foo",
-				"POST=/foo/bar",
-				"PUT=^/foo/bar$",
-				"DELETE=/crazy/(?:regex)?/[^/]+/stuff$",
+		Entry("Valid rules", &validateAllowlistRulesTableInput{
+			rules: []options.AllowlistRule{
+				{Path: "/foo"},
+				{Methods: []string{"POST"}, Path: "/foo/bar"},
+				{Methods: []string{"PUT"}, Path: "^/foo/bar$", NegatePath: true},
+				{Path: "/crazy/(?:regex)?/[^/]+/stuff$"},
+				{
+					ID:          "internal",
+					Policy:      options.AnonymousAllowlistPolicy,
+					Hosts:       []string{"internal.example.com", "*.example.org"},
+					SourceCIDRs: []string{"10.0.0.0/8", "::1"},
+					Headers: []options.AllowlistHeader{
+						{Name: "X-Internal"},
+						{Name: "X-Client", Value: "^(cli|ci)$"},
+					},
+				},
 			},
 			errStrings: []string{},
 		}),
-		Entry("Bad regexes do not compile", &validateRoutesTableInput{
-			routes: []string{
-				"POST=/(foo",
-				"OPTIONS=/foo/bar)",
-				"GET=^]/foo/bar[$",
-				"GET=^]/foo/bar[$",
+		Entry("Bad regexes do not compile", &validateAllowlistRulesTableInput{
+			rules: []options.AllowlistRule{
+				{Methods: []string{"POST"}, Path: "/(foo"},
+				{Methods: []string{"OPTIONS"}, Path: "/foo/bar)"},
+				{Path: "^]/foo/bar[$"},
+				{Headers: []options.AllowlistHeader{{Name: "X-Client", Value: "^]/foo/bar[$"}}},
 			},
 			errStrings: []string{
 				"error compiling regex //(foo/: error parsing regexp: missing closing ): `/(foo`",
@@ -53,36 +64,60 @@ var _ = Describe("Allowlist", func() {
 				"error compiling regex /^]/foo/bar[$/: error parsing regexp: missing closing ]: `[$`",
 			},
 		}),
+		Entry("Invalid conditions", &validateAllowlistRulesTableInput{
+			rules: []options.AllowlistRule{
+				{ID: "policy", Policy: "deny"},
+				{ID: "empty", Hosts: []string{""}, Methods: []string{""}},
+				{NegatePath: true},
+				{ID: "sources", SourceCIDRs: []string{"[::1]", "alkwlkbn/32"}},
+				{ID: "headers", Headers: []options.AllowlistHeader{{Value: "foo"}}},
+				{ID: "wildcards", Hosts: []string{"*example.com", "*.", "a.*.example.com"}},
+			},
+			errStrings: []string{
+				"allowlist rule \"policy\" has invalid policy \"deny\": must be \"skipAuth\" or \"anonymous\"",
+				"allowlist rule \"empty\" has an empty host",
+				"allowlist rule \"empty\" has an empty method",
+				"allowlist rule \"#2\" has negatePath without a path",
+				"allowlist rule \"sources\" has source CIDR ([::1]) that could not be recognized",
+				"allowlist rule \"sources\" has source CIDR (alkwlkbn/32) that could not be recognized",
+				"allowlist rule \"headers\" has a header with an empty name",
+				"allowlist rule \"wildcards\" has invalid host \"*example.com\": a wildcard may only be a leading \"*.\" before a domain",
+				"allowlist rule \"wildcards\" has invalid host \"*.\": a wildcard may only be a leading \"*.\" before a domain",
+				"allowlist rule \"wildcards\" has invalid host \"a.*.example.com\": a wildcard may only be a leading \"*.\" before a domain",
+			},
+		}),
 	)
 
-	DescribeTable("validateRegexes",
-		func(r *validateRegexesTableInput) {
+	DescribeTable("validateAPIRoutes",
+		func(r *validateAPIRoutesTableInput) {
 			opts := &options.Options{
-				SkipAuthRegex: r.regexes,
+				APIRouteScopes:    r.scopes,
+				APIRouteAudiences: r.audiences,
 			}
-			Expect(validateAuthRegexes(opts)).To(ConsistOf(r.errStrings))
+			Expect(validateAPIRoutes(opts)).To(ConsistOf(r.errStrings))
 		},
-		Entry("Valid regex routes", &validateRegexesTableInput{
-			regexes: []string{
-				"/foo",
-				"/foo/bar",
-				"^/foo/bar$",
-				"/crazy/(?:regex)?/[^/]+/stuff$",
+		Entry("Valid requirement routes", &validateAPIRoutesTableInput{
+			scopes: []string{
+				"read:users=^/api/users",
+				"read:users write:users=^/api/admin/.*$",
+			},
+			audiences: []string{
+				"https://api.example.com=^/api/",
 			},
 			errStrings: []string{},
 		}),
-		Entry("Bad regexes do not compile", &validateRegexesTableInput{
-			regexes: []string{
-				"/(foo",
-				"/foo/bar)",
-				"^]/foo/bar[$",
-				"^]/foo/bar[$",
+		Entry("Routes without requirements", &validateAPIRoutesTableInput{
+			scopes:    []string{"^/api/users"},
+			audiences: []string{" =^/api/"},
+			errStrings: []string{
+				"api_route_scopes[0] (^/api/users) must be of the form value[ value...]=path_regex",
+				"api_route_audiences[0] ( =^/api/) must be of the form value[ value...]=path_regex",
 			},
+		}),
+		Entry("Bad regexes do not compile", &validateAPIRoutesTableInput{
+			scopes: []string{"read=/(foo"},
 			errStrings: []string{
 				"error compiling regex //(foo/: error parsing regexp: missing closing ): `/(foo`",
-				"error compiling regex //foo/bar)/: error parsing regexp: unexpected ): `/foo/bar)`",
-				"error compiling regex /^]/foo/bar[$/: error parsing regexp: missing closing ]: `[$`",
-				"error compiling regex /^]/foo/bar[$/: error parsing regexp: missing closing ]: `[$`",
 			},
 		}),
 	)
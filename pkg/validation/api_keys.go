@@ -0,0 +1,26 @@
+package validation
+
+import (
+	"fmt"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/redis"
+)
+
+// validateAPIKeys validates the options of API key authentication
+func validateAPIKeys(o *options.Options) []string {
+	if !o.APIKeys.Enabled() {
+		return []string{}
+	}
+
+	msgs := []string{}
+	if o.APIKeys.Header == "" && o.APIKeys.QueryParam == "" {
+		msgs = append(msgs, "api-key-header or api-key-query-param is required to read API keys from requests")
+	}
+	if o.APIKeys.Redis {
+		if _, err := redis.NewRedisClient(o.Session.Redis); err != nil {
+			msgs = append(msgs, fmt.Sprintf("unable to initialize a redis client for api-keys-redis: %v", err))
+		}
+	}
+	return msgs
+}
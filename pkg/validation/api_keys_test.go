@@ -0,0 +1,43 @@
+package validation
+
+import (
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("API Keys", func() {
+	DescribeTable("validateAPIKeys",
+		func(o *options.Options, expectedMsgs []string) {
+			Expect(validateAPIKeys(o)).To(ConsistOf(expectedMsgs))
+		},
+		Entry("without API keys", &options.Options{
+			APIKeys: options.APIKeys{Header: ""},
+		}, []string{}),
+		Entry("with a keys file", &options.Options{
+			APIKeys: options.APIKeys{File: "/etc/oauth2-proxy/api-keys.yaml", Header: "X-API-Key"},
+		}, []string{}),
+		Entry("with a keys file read from the query only", &options.Options{
+			APIKeys: options.APIKeys{File: "/etc/oauth2-proxy/api-keys.yaml", QueryParam: "api_key"},
+		}, []string{}),
+		Entry("without a header or query param", &options.Options{
+			APIKeys: options.APIKeys{File: "/etc/oauth2-proxy/api-keys.yaml"},
+		}, []string{
+			"api-key-header or api-key-query-param is required to read API keys from requests",
+		}),
+		Entry("with redis keys", &options.Options{
+			APIKeys: options.APIKeys{Redis: true, Header: "X-API-Key"},
+			Session: options.SessionOptions{
+				Redis: options.RedisStoreOptions{ConnectionURL: "redis://localhost:6379"},
+			},
+		}, []string{}),
+		Entry("with redis keys and an invalid redis connection", &options.Options{
+			APIKeys: options.APIKeys{Redis: true, Header: "X-API-Key"},
+			Session: options.SessionOptions{
+				Redis: options.RedisStoreOptions{ConnectionURL: "http://localhost:6379"},
+			},
+		}, []string{
+			"unable to initialize a redis client for api-keys-redis: unable to parse redis url: redis: invalid URL scheme: http",
+		}),
+	)
+})
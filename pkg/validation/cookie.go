@@ -7,11 +7,11 @@ import (
 	"time"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
-	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cookies"
 )
 
 func validateCookie(o options.Cookie) []string {
-	msgs := validateCookieSecret(o.Secret)
+	msgs := validateCookieSecrets(o)
 
 	if o.Expire != time.Duration(0) && o.Refresh >= o.Expire {
 		msgs = append(msgs, fmt.Sprintf(
@@ -49,21 +49,47 @@ func validateCookieName(name string) []string {
 	return msgs
 }
 
+// validateCookieSecrets checks that exactly one source of cookie secrets is
+// configured and that every secret can be used to create a cipher.
+func validateCookieSecrets(o options.Cookie) []string {
+	if o.SecretKeysetFile == "" {
+		msgs := validateCookieSecret(o.Secret)
+		for _, secret := range o.PreviousSecrets {
+			msgs = append(msgs, prefixMessages("cookie_previous_secrets: ", validateCookieSecret(secret))...)
+		}
+		return msgs
+	}
+
+	if o.Secret != "" || len(o.PreviousSecrets) > 0 {
+		return []string{"cookie_secret_keyset_file cannot be combined with cookie_secret or cookie_previous_secrets"}
+	}
+	secrets, err := cookies.LoadKeysetFile(o.SecretKeysetFile)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	msgs := []string{}
+	for i, secret := range secrets {
+		msgs = append(msgs, prefixMessages(fmt.Sprintf("cookie_secret_keyset_file entry %d: ", i+1), validateCookieSecret(secret))...)
+	}
+	return msgs
+}
+
+func prefixMessages(prefix string, msgs []string) []string {
+	prefixed := []string{}
+	for _, msg := range msgs {
+		prefixed = append(prefixed, prefix+msg)
+	}
+	return prefixed
+}
+
 func validateCookieSecret(secret string) []string {
 	if secret == "" {
 		return []string{"missing setting: cookie-secret"}
 	}
 
-	secretBytes := encryption.SecretBytes(secret)
-	// Check if the secret is a valid length
-	switch len(secretBytes) {
-	case 16, 24, 32:
-		// Valid secret size found
-		return []string{}
-	}
-	// Invalid secret size found, return a message
-	return []string{fmt.Sprintf(
-		"cookie_secret must be 16, 24, or 32 bytes to create an AES cipher, but is %d bytes",
-		len(secretBytes)),
+	if err := cookies.ValidateSecret(secret); err != nil {
+		return []string{err.Error()}
 	}
+	return []string{}
 }
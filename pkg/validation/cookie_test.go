@@ -1,6 +1,8 @@
 package validation
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -36,6 +38,19 @@ func TestValidateCookie(t *testing.T) {
 	invalidBase64SecretMsg := "cookie_secret must be 16, 24, or 32 bytes to create an AES cipher, but is 10 bytes"
 	refreshLongerThanExpireMsg := "cookie_refresh (\"1h0m0s\") must be less than cookie_expire (\"15m0s\")"
 	invalidSameSiteMsg := "cookie_samesite (\"invalid\") must be one of ['', 'lax', 'strict', 'none']"
+	invalidPreviousSecretMsg := "cookie_previous_secrets: " + invalidSecretMsg
+	invalidKeysetSecretMsg := "cookie_secret_keyset_file entry 2: " + invalidSecretMsg
+	keysetAndSecretMsg := "cookie_secret_keyset_file cannot be combined with cookie_secret or cookie_previous_secrets"
+
+	keysetDir := t.TempDir()
+	validKeysetFile := filepath.Join(keysetDir, "valid")
+	invalidKeysetFile := filepath.Join(keysetDir, "invalid")
+	if err := os.WriteFile(validKeysetFile, []byte("# primary\n"+validSecret+"\n\n"+validBase64Secret+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(invalidKeysetFile, []byte(validSecret+"\n"+invalidSecret+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
 
 	testCases := []struct {
 		name       string
@@ -271,6 +286,46 @@ func TestValidateCookie(t *testing.T) {
 			},
 			errStrings: []string{},
 		},
+		{
+			name: "with previous secrets",
+			cookie: options.Cookie{
+				Name:            validName,
+				Secret:          validSecret,
+				PreviousSecrets: []string{validBase64Secret, invalidSecret},
+			},
+			errStrings: []string{
+				invalidPreviousSecretMsg,
+			},
+		},
+		{
+			name: "with a valid keyset file",
+			cookie: options.Cookie{
+				Name:             validName,
+				SecretKeysetFile: validKeysetFile,
+			},
+			errStrings: []string{},
+		},
+		{
+			name: "with an invalid secret in the keyset file",
+			cookie: options.Cookie{
+				Name:             validName,
+				SecretKeysetFile: invalidKeysetFile,
+			},
+			errStrings: []string{
+				invalidKeysetSecretMsg,
+			},
+		},
+		{
+			name: "with a keyset file and a secret",
+			cookie: options.Cookie{
+				Name:             validName,
+				Secret:           validSecret,
+				SecretKeysetFile: validKeysetFile,
+			},
+			errStrings: []string{
+				keysetAndSecretMsg,
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -40,10 +40,12 @@ func validateHeader(header options.Header, names map[string]struct{}) []string {
 
 func validateHeaderValue(_ string, value options.HeaderValue) []string {
 	switch {
-	case value.SecretSource != nil && value.ClaimSource == nil:
+	case value.SecretSource != nil && value.ClaimSource == nil && value.ProxyJWT == nil:
 		return []string{validateSecretSource(*value.SecretSource)}
-	case value.SecretSource == nil && value.ClaimSource != nil:
+	case value.SecretSource == nil && value.ClaimSource != nil && value.ProxyJWT == nil:
 		return validateHeaderValueClaimSource(*value.ClaimSource)
+	case value.SecretSource == nil && value.ClaimSource == nil && value.ProxyJWT != nil:
+		return validateHeaderValueProxyJWTSource(*value.ProxyJWT)
 	default:
 		return []string{"header value has multiple entries: only one entry per value is allowed"}
 	}
@@ -61,3 +63,14 @@ func validateHeaderValueClaimSource(claim options.ClaimSource) []string {
 	}
 	return msgs
 }
+
+func validateHeaderValueProxyJWTSource(source options.ProxyJWTSource) []string {
+	msgs := []string{}
+
+	for _, claim := range source.Claims {
+		if claim == "" {
+			msgs = append(msgs, "proxyJWT claims should not be empty")
+		}
+	}
+	return msgs
+}
@@ -0,0 +1,52 @@
+package validation
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+)
+
+// validateLDAP validates the options of the LDAP basic auth validator
+func validateLDAP(o *options.Options) []string {
+	if o.LDAP.URL == "" {
+		return []string{}
+	}
+
+	msgs := []string{}
+	u, err := url.Parse(o.LDAP.URL)
+	switch {
+	case err != nil:
+		msgs = append(msgs, fmt.Sprintf("invalid ldap-url %q: %v", o.LDAP.URL, err))
+	case u.Scheme != "ldap" && u.Scheme != "ldaps" && u.Scheme != "ldapi":
+		msgs = append(msgs, fmt.Sprintf("invalid ldap-url %q: scheme must be one of ldap, ldaps or ldapi", o.LDAP.URL))
+	case u.Scheme == "ldaps" && o.LDAP.StartTLS:
+		msgs = append(msgs, "ldap-start-tls cannot be used with an ldaps:// ldap-url")
+	}
+
+	if o.LDAP.Timeout <= 0 {
+		msgs = append(msgs, "ldap-timeout must be positive")
+	}
+	if o.LDAP.CacheTTL < 0 {
+		msgs = append(msgs, "ldap-cache-ttl must not be negative")
+	}
+	if o.LDAP.BindDN == "" && o.LDAP.BindPassword != "" {
+		msgs = append(msgs, "ldap-bind-password requires ldap-bind-dn to be set")
+	}
+	if o.LDAP.UserBaseDN == "" {
+		msgs = append(msgs, "ldap-user-base-dn is required when ldap-url is set")
+	}
+	if !strings.Contains(o.LDAP.UserFilter, "%s") {
+		msgs = append(msgs, fmt.Sprintf("ldap-user-filter %q must contain %%s for the username", o.LDAP.UserFilter))
+	}
+	if o.LDAP.GroupBaseDN != "" {
+		if !strings.Contains(o.LDAP.GroupFilter, "%s") {
+			msgs = append(msgs, fmt.Sprintf("ldap-group-filter %q must contain %%s for the user DN", o.LDAP.GroupFilter))
+		}
+		if o.LDAP.GroupNameAttribute == "" {
+			msgs = append(msgs, "ldap-group-name-attribute is required when ldap-group-base-dn is set")
+		}
+	}
+	return msgs
+}
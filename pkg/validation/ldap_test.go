@@ -0,0 +1,75 @@
+package validation
+
+import (
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LDAP", func() {
+	validLDAP := func() options.LDAP {
+		return options.LDAP{
+			URL:                "ldap://ldap.example.com",
+			Timeout:            10 * time.Second,
+			BindDN:             "cn=oauth2-proxy,dc=example,dc=com",
+			BindPassword:       "password",
+			UserBaseDN:         "ou=people,dc=example,dc=com",
+			UserFilter:         "(uid=%s)",
+			GroupBaseDN:        "ou=groups,dc=example,dc=com",
+			GroupFilter:        "(member=%s)",
+			GroupNameAttribute: "cn",
+		}
+	}
+
+	DescribeTable("validateLDAP",
+		func(modify func(*options.LDAP), expectedMsgs []string) {
+			o := &options.Options{LDAP: validLDAP()}
+			modify(&o.LDAP)
+			Expect(validateLDAP(o)).To(ConsistOf(expectedMsgs))
+		},
+		Entry("with valid options", func(*options.LDAP) {}, []string{}),
+		Entry("without an LDAP URL", func(l *options.LDAP) {
+			*l = options.LDAP{}
+		}, []string{}),
+		Entry("with an invalid scheme", func(l *options.LDAP) {
+			l.URL = "https://ldap.example.com"
+		}, []string{
+			"invalid ldap-url \"https://ldap.example.com\": scheme must be one of ldap, ldaps or ldapi",
+		}),
+		Entry("with StartTLS over ldaps", func(l *options.LDAP) {
+			l.URL = "ldaps://ldap.example.com"
+			l.StartTLS = true
+		}, []string{
+			"ldap-start-tls cannot be used with an ldaps:// ldap-url",
+		}),
+		Entry("with a bind password but no bind DN", func(l *options.LDAP) {
+			l.BindDN = ""
+		}, []string{
+			"ldap-bind-password requires ldap-bind-dn to be set",
+		}),
+		Entry("with a negative cache TTL", func(l *options.LDAP) {
+			l.CacheTTL = -time.Second
+		}, []string{
+			"ldap-cache-ttl must not be negative",
+		}),
+		Entry("with missing search options", func(l *options.LDAP) {
+			l.Timeout = 0
+			l.UserBaseDN = ""
+			l.UserFilter = "(uid=jdoe)"
+			l.GroupFilter = "(member=*)"
+			l.GroupNameAttribute = ""
+		}, []string{
+			"ldap-timeout must be positive",
+			"ldap-user-base-dn is required when ldap-url is set",
+			"ldap-user-filter \"(uid=jdoe)\" must contain %s for the username",
+			"ldap-group-filter \"(member=*)\" must contain %s for the user DN",
+			"ldap-group-name-attribute is required when ldap-group-base-dn is set",
+		}),
+		Entry("with an invalid group filter but no group base DN", func(l *options.LDAP) {
+			l.GroupBaseDN = ""
+			l.GroupFilter = ""
+		}, []string{}),
+	)
+})
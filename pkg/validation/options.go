@@ -22,9 +22,21 @@ import (
 func Validate(o *options.Options) error {
 	msgs := validateCookie(o.Cookie)
 	msgs = append(msgs, validateSessionCookieMinimal(o)...)
+	msgs = append(msgs, validateSessionLifetime(o)...)
+	msgs = append(msgs, validateSessionFormat(o)...)
+	msgs = append(msgs, validateSessionLimit(o)...)
+	msgs = append(msgs, validateSessionBackgroundRefresh(o)...)
+	msgs = append(msgs, validateSessionEncryption(o)...)
+	msgs = append(msgs, validateSessionBinding(o)...)
+	msgs = append(msgs, validateSessionEvents(o)...)
+	msgs = append(msgs, validateHybridSessionStore(o)...)
 	msgs = append(msgs, validateRedisSessionStore(o)...)
+	msgs = append(msgs, validatePluginSessionStore(o)...)
 	msgs = append(msgs, prefixValues("injectRequestHeaders: ", validateHeaders(o.InjectRequestHeaders)...)...)
 	msgs = append(msgs, prefixValues("injectResponseHeaders: ", validateHeaders(o.InjectResponseHeaders)...)...)
+	msgs = append(msgs, validateProxyJWT(o)...)
+	msgs = append(msgs, validateLDAP(o)...)
+	msgs = append(msgs, validateAPIKeys(o)...)
 	msgs = append(msgs, validateProviders(o)...)
 	msgs = append(msgs, validateAPIRoutes(o)...)
 	msgs = configureLogger(o.Logging, msgs)
@@ -46,11 +58,15 @@ func Validate(o *options.Options) error {
 		}
 	}
 
-	if o.AuthenticatedEmailsFile == "" && len(o.EmailDomains) == 0 && o.HtpasswdFile == "" {
+	if o.AuthenticatedEmailsFile == "" && len(o.EmailDomains) == 0 && o.HtpasswdFile == "" && o.LDAP.URL == "" {
 		msgs = append(msgs, "missing setting for email validation: email-domain or authenticated-emails-file required."+
 			"\n      use email-domain=* to authorize all email addresses")
 	}
 
+	if o.HtpasswdGroupsFile != "" && o.HtpasswdFile == "" {
+		msgs = append(msgs, "htpasswd-groups-file requires htpasswd-file to be set")
+	}
+
 	if o.SkipJwtBearerTokens {
 		// Configure extra issuers
 		if len(o.ExtraJwtIssuers) > 0 {
@@ -70,6 +86,10 @@ func Validate(o *options.Options) error {
 		}
 	}
 
+	if o.IntrospectionCacheSize < 0 {
+		msgs = append(msgs, "introspection_cache_size must not be negative")
+	}
+
 	var redirectURL *url.URL
 	redirectURL, msgs = parseURL(o.RawRedirectURL, "redirect", msgs)
 	o.SetRedirectURL(redirectURL)
@@ -80,7 +100,9 @@ func Validate(o *options.Options) error {
 	msgs = append(msgs, validateUpstreams(o.UpstreamServers)...)
 
 	if o.ReverseProxy {
-		parser, err := ip.GetRealClientIPParser(o.RealClientIPHeader)
+		// Invalid trusted proxies are reported by validateAllowlists
+		trustedProxies, _ := ip.ParseNetSet(o.TrustedProxies)
+		parser, err := ip.GetRealClientIPParser(o.RealClientIPHeader, trustedProxies)
 		if err != nil {
 			msgs = append(msgs, fmt.Sprintf("real_client_ip_header (%s) not accepted parameter value: %v", o.RealClientIPHeader, err))
 		}
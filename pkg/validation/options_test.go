@@ -158,6 +158,29 @@ func TestValidateSignatureKeyUnsupportedAlgorithm(t *testing.T) {
 		"  unsupported signature hash algorithm: "+o.SignatureKey)
 }
 
+func TestIntrospectionCacheSize(t *testing.T) {
+	o := testOptions()
+	o.IntrospectBearerTokens = true
+	o.IntrospectionCacheSize = 0
+	assert.Equal(t, nil, Validate(o))
+
+	o.IntrospectionCacheSize = -1
+	err := Validate(o)
+	assert.Equal(t, err.Error(), "invalid configuration:\n"+
+		"  introspection_cache_size must not be negative")
+}
+
+func TestHtpasswdGroupsFile(t *testing.T) {
+	o := testOptions()
+	o.HtpasswdGroupsFile = "/etc/oauth2-proxy/groups"
+	err := Validate(o)
+	assert.Equal(t, err.Error(), "invalid configuration:\n"+
+		"  htpasswd-groups-file requires htpasswd-file to be set")
+
+	o.HtpasswdFile = "/etc/oauth2-proxy/htpasswd"
+	assert.Equal(t, nil, Validate(o))
+}
+
 func TestGCPHealthcheck(t *testing.T) {
 	o := testOptions()
 	o.GCPHealthChecks = true
@@ -178,17 +201,24 @@ func TestRealClientIPHeader(t *testing.T) {
 	assert.Equal(t, nil, Validate(o))
 	assert.NotNil(t, o.GetRealClientIPParser())
 
-	// Ensure unknown header format process an error.
+	// Ensure the RFC 7239 Forwarded header works with trusted proxies.
 	o = testOptions()
 	o.ReverseProxy = true
 	o.RealClientIPHeader = "Forwarded"
+	o.TrustedProxies = []string{"10.0.0.0/8", "::1"}
+	assert.Equal(t, nil, Validate(o))
+	assert.NotNil(t, o.GetRealClientIPParser())
+
+	// Ensure invalid trusted proxies produce an error.
+	o = testOptions()
+	o.ReverseProxy = true
+	o.TrustedProxies = []string{"10.0.0.0/8", "alkwlkbn/32"}
 	err := Validate(o)
 	assert.NotEqual(t, nil, err)
 	expected := errorMsg([]string{
-		"real_client_ip_header (Forwarded) not accepted parameter value: the http header key (Forwarded) is either invalid or unsupported",
+		"trusted_proxies[1] (alkwlkbn/32) could not be recognized",
 	})
 	assert.Equal(t, expected, err.Error())
-	assert.Nil(t, o.GetRealClientIPParser())
 
 	// Ensure invalid header format produces an error.
 	o = testOptions()
@@ -2,6 +2,7 @@ package validation
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
@@ -60,10 +61,62 @@ func validateProvider(provider options.Provider, providerIDs map[string]struct{}
 	}
 
 	msgs = append(msgs, validateGoogleConfig(provider)...)
+	msgs = append(msgs, validateUserInfo(provider)...)
+	msgs = append(msgs, validateClaimsProviderIssuers(provider)...)
 
 	return msgs
 }
 
+// validateClaimsProviderIssuers checks the trusted claims provider issuers
+// are absolute URLs
+func validateClaimsProviderIssuers(provider options.Provider) []string {
+	msgs := []string{}
+	for _, issuer := range provider.OIDCConfig.ClaimsProviderIssuers {
+		u, err := url.Parse(issuer)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			msgs = append(msgs, fmt.Sprintf("invalid claimsProviderIssuers entry %q: must be an absolute http(s) URL", issuer))
+		}
+	}
+	return msgs
+}
+
+// validateUserInfo checks the precedence rules for merging userinfo claims
+func validateUserInfo(provider options.Provider) []string {
+	msgs := []string{}
+	userInfo := provider.OIDCConfig.UserInfo
+	if userInfo == nil {
+		return msgs
+	}
+
+	if provider.SkipClaimsFromProfileURL {
+		msgs = append(msgs, "userInfo enrichment cannot be used with skipClaimsFromProfileURL")
+	}
+	if !isValidClaimPrecedence(userInfo.Precedence, true) {
+		msgs = append(msgs, fmt.Sprintf("invalid userInfo precedence %q: must be one of idToken, userInfo or merge", userInfo.Precedence))
+	}
+	for _, rule := range userInfo.ClaimPrecedence {
+		if rule.Claim == "" {
+			msgs = append(msgs, "userInfo claimPrecedence has a rule with an empty claim")
+		}
+		if !isValidClaimPrecedence(rule.Precedence, false) {
+			msgs = append(msgs, fmt.Sprintf("invalid userInfo precedence %q for claim %q: must be one of idToken, userInfo or merge", rule.Precedence, rule.Claim))
+		}
+	}
+
+	return msgs
+}
+
+func isValidClaimPrecedence(precedence options.ClaimPrecedence, allowEmpty bool) bool {
+	switch precedence {
+	case options.IDTokenClaimPrecedence, options.UserInfoClaimPrecedence, options.MergeClaimPrecedence:
+		return true
+	case "":
+		return allowEmpty
+	default:
+		return false
+	}
+}
+
 func validateGoogleConfig(provider options.Provider) []string {
 	msgs := []string{}
 
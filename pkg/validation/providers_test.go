@@ -30,6 +30,18 @@ var _ = Describe("Providers", func() {
 		ClientSecret: "ClientSecret",
 	}
 
+	userInfoProvider := func(userInfo *options.UserInfoOptions) options.Provider {
+		provider := validProvider
+		provider.OIDCConfig.UserInfo = userInfo
+		return provider
+	}
+
+	claimsProvidersProvider := func(issuers ...string) options.Provider {
+		provider := validProvider
+		provider.OIDCConfig.ClaimsProviderIssuers = issuers
+		return provider
+	}
+
 	missingProvider := "at least one provider has to be defined"
 	emptyIDMsg := "provider has empty id: ids are required for all providers"
 	duplicateProviderIDMsg := "multiple providers found with id ProviderID: provider ids must be unique"
@@ -79,5 +91,47 @@ var _ = Describe("Providers", func() {
 			},
 			errStrings: []string{skipButtonAndMultipleProvidersMsg},
 		}),
+		Entry("with valid userInfo precedence rules", &validateProvidersTableInput{
+			options: &options.Options{
+				Providers: options.Providers{
+					userInfoProvider(&options.UserInfoOptions{
+						Precedence: options.UserInfoClaimPrecedence,
+						ClaimPrecedence: []options.ClaimPrecedenceRule{
+							{Claim: "groups", Precedence: options.MergeClaimPrecedence},
+						},
+					}),
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with invalid userInfo precedence rules", &validateProvidersTableInput{
+			options: &options.Options{
+				Providers: options.Providers{
+					userInfoProvider(&options.UserInfoOptions{
+						Precedence: "profile",
+						ClaimPrecedence: []options.ClaimPrecedenceRule{
+							{Precedence: options.MergeClaimPrecedence},
+							{Claim: "email"},
+						},
+					}),
+				},
+			},
+			errStrings: []string{
+				"invalid userInfo precedence \"profile\": must be one of idToken, userInfo or merge",
+				"userInfo claimPrecedence has a rule with an empty claim",
+				"invalid userInfo precedence \"\" for claim \"email\": must be one of idToken, userInfo or merge",
+			},
+		}),
+		Entry("with claims provider issuers", &validateProvidersTableInput{
+			options: &options.Options{
+				Providers: options.Providers{
+					claimsProvidersProvider("https://claims.example.com", "claims.example.com", "ftp://claims.example.com"),
+				},
+			},
+			errStrings: []string{
+				"invalid claimsProviderIssuers entry \"claims.example.com\": must be an absolute http(s) URL",
+				"invalid claimsProviderIssuers entry \"ftp://claims.example.com\": must be an absolute http(s) URL",
+			},
+		}),
 	)
 })
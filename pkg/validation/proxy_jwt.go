@@ -0,0 +1,38 @@
+package validation
+
+import (
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+)
+
+// validateProxyJWT validates the proxy JWT signing options and checks that
+// they are configured when a header is injected with a proxyJWT value.
+func validateProxyJWT(o *options.Options) []string {
+	if o.ProxyJWT == nil {
+		if usesProxyJWT(o.InjectRequestHeaders) || usesProxyJWT(o.InjectResponseHeaders) {
+			return []string{"proxyJWT: signing must be configured to inject headers with a proxyJWT value"}
+		}
+		return []string{}
+	}
+
+	msgs := []string{}
+	if o.ProxyJWT.SigningKey == nil {
+		msgs = append(msgs, "proxyJWT: signingKey is required")
+	} else if msg := validateSecretSource(*o.ProxyJWT.SigningKey); msg != "" {
+		msgs = append(msgs, "proxyJWT: invalid signingKey: "+msg)
+	}
+	if o.ProxyJWT.Lifetime != nil && o.ProxyJWT.Lifetime.Duration() <= 0 {
+		msgs = append(msgs, "proxyJWT: lifetime must be positive")
+	}
+	return msgs
+}
+
+func usesProxyJWT(headers []options.Header) bool {
+	for _, header := range headers {
+		for _, value := range header.Values {
+			if value.ProxyJWT != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
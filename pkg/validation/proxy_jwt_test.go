@@ -0,0 +1,49 @@
+package validation
+
+import (
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ProxyJWT", func() {
+	proxyJWTHeader := options.Header{
+		Name: "X-Proxy-JWT",
+		Values: []options.HeaderValue{
+			{
+				ProxyJWT: &options.ProxyJWTSource{
+					Audience: "upstream",
+				},
+			},
+		},
+	}
+	negativeLifetime := options.Duration(-time.Minute)
+
+	DescribeTable("validateProxyJWT",
+		func(o *options.Options, expectedMsgs []string) {
+			Expect(validateProxyJWT(o)).To(ConsistOf(expectedMsgs))
+		},
+		Entry("without proxy JWTs", &options.Options{}, []string{}),
+		Entry("with a valid signing key", &options.Options{
+			ProxyJWT: &options.ProxyJWT{
+				SigningKey: &options.SecretSource{Value: []byte("key")},
+			},
+			InjectRequestHeaders: []options.Header{proxyJWTHeader},
+		}, []string{}),
+		Entry("with a proxyJWT header value but no signing configuration", &options.Options{
+			InjectResponseHeaders: []options.Header{proxyJWTHeader},
+		}, []string{
+			"proxyJWT: signing must be configured to inject headers with a proxyJWT value",
+		}),
+		Entry("with invalid signing options", &options.Options{
+			ProxyJWT: &options.ProxyJWT{
+				Lifetime: &negativeLifetime,
+			},
+		}, []string{
+			"proxyJWT: signingKey is required",
+			"proxyJWT: lifetime must be positive",
+		}),
+	)
+})
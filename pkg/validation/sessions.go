@@ -4,10 +4,15 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/binding"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/envelope"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/plugin"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/redis"
 )
 
@@ -36,13 +41,181 @@ func validateSessionCookieMinimal(o *options.Options) []string {
 		msgs = append(msgs,
 			"cookie_refresh > 0 requires oauth tokens in sessions. session_cookie_minimal cannot be set")
 	}
+	if o.Session.RefreshSkew != time.Duration(0) {
+		msgs = append(msgs,
+			"session_refresh_skew > 0 requires oauth tokens in sessions. session_cookie_minimal cannot be set")
+	}
+	return msgs
+}
+
+// validateSessionLifetime ensures the session idle timeout, maximum age and
+// refresh skew options are consistent
+func validateSessionLifetime(o *options.Options) []string {
+	msgs := []string{}
+	if o.Session.IdleTimeout < 0 {
+		msgs = append(msgs, "session_idle_timeout must not be negative")
+	}
+	if o.Session.MaxAge < 0 {
+		msgs = append(msgs, "session_max_age must not be negative")
+	}
+	if o.Session.RefreshSkew < 0 {
+		msgs = append(msgs, "session_refresh_skew must not be negative")
+	}
+	if o.Session.IdleTimeout > 0 && o.Session.ActivityWriteInterval >= o.Session.IdleTimeout {
+		msgs = append(msgs, fmt.Sprintf(
+			"session_activity_write_interval (%s) must be less than session_idle_timeout (%s)",
+			o.Session.ActivityWriteInterval, o.Session.IdleTimeout))
+	}
+	return msgs
+}
+
+// validateSessionFormat ensures sessions are written in a session format
+// version this release supports
+func validateSessionFormat(o *options.Options) []string {
+	if o.Session.WriteVersion < int(sessionsapi.LegacySessionFormatVersion) || o.Session.WriteVersion > int(sessionsapi.CurrentSessionFormatVersion) {
+		return []string{fmt.Sprintf("session_write_version (%d) must be between %d and %d",
+			o.Session.WriteVersion, sessionsapi.LegacySessionFormatVersion, sessionsapi.CurrentSessionFormatVersion)}
+	}
+	return []string{}
+}
+
+// validateSessionLimit ensures the concurrent session limit is enforced by a
+// session store that can track sessions across replicas
+func validateSessionLimit(o *options.Options) []string {
+	msgs := []string{}
+	if o.Session.MaxConcurrent < 0 {
+		msgs = append(msgs, "session_max_concurrent must not be negative")
+	}
+	if o.Session.MaxConcurrent <= 0 {
+		return msgs
+	}
+	if o.Session.Type != options.RedisSessionStoreType {
+		msgs = append(msgs, "session_max_concurrent requires the redis session store")
+	}
+	switch o.Session.ConcurrentLimitPolicy {
+	case options.RejectSessionLimitPolicy, options.EvictOldestSessionLimitPolicy:
+	default:
+		msgs = append(msgs, fmt.Sprintf("invalid session_concurrent_limit_policy %q: must be %q or %q",
+			o.Session.ConcurrentLimitPolicy, options.EvictOldestSessionLimitPolicy, options.RejectSessionLimitPolicy))
+	}
+	return msgs
+}
+
+// validateSessionBackgroundRefresh ensures background refresh is used with a
+// session store that persists sessions and refreshes them before a request
+// would
+func validateSessionBackgroundRefresh(o *options.Options) []string {
+	msgs := []string{}
+	refresh := o.Session.BackgroundRefresh
+	if !refresh.Enabled {
+		return msgs
+	}
+	switch o.Session.Type {
+	case options.RedisSessionStoreType, options.HybridSessionStoreType, options.PluginSessionStoreType:
+	default:
+		msgs = append(msgs, "session_background_refresh requires the redis, hybrid or plugin session store")
+	}
+	if refresh.Window <= o.Session.RefreshSkew {
+		msgs = append(msgs, fmt.Sprintf(
+			"session_background_refresh_window (%s) must be greater than session_refresh_skew (%s)",
+			refresh.Window, o.Session.RefreshSkew))
+	}
+	if refresh.Jitter < 0 {
+		msgs = append(msgs, "session_background_refresh_jitter must not be negative")
+	}
+	if refresh.Interval <= 0 {
+		msgs = append(msgs, "session_background_refresh_interval must be positive")
+	}
+	if refresh.Concurrency < 1 {
+		msgs = append(msgs, "session_background_refresh_concurrency must be at least 1")
+	}
 	return msgs
 }
 
+// validateSessionEvents ensures the session event webhook can queue and
+// retry deliveries
+func validateSessionEvents(o *options.Options) []string {
+	msgs := []string{}
+	if o.SessionEvents.WebhookURL == "" {
+		return msgs
+	}
+	if _, err := url.ParseRequestURI(o.SessionEvents.WebhookURL); err != nil {
+		msgs = append(msgs, fmt.Sprintf("invalid session_events_webhook_url: %v", err))
+	}
+	if o.SessionEvents.WebhookQueueSize < 1 {
+		msgs = append(msgs, "session_events_webhook_queue_size must be at least 1")
+	}
+	if o.SessionEvents.WebhookMaxRetries < 0 {
+		msgs = append(msgs, "session_events_webhook_max_retries must not be negative")
+	}
+	return msgs
+}
+
+// validateSessionBinding ensures the session binding components and mismatch
+// action are known
+func validateSessionBinding(o *options.Options) []string {
+	if _, err := binding.NewBinder(o.Session.Binding, nil); err != nil {
+		return []string{fmt.Sprintf("invalid session binding: %v", err)}
+	}
+	return []string{}
+}
+
+// validateSessionEncryption ensures the configured session key provider can
+// be initialised
+func validateSessionEncryption(o *options.Options) []string {
+	if _, err := envelope.NewCipher(o.Session.Encryption); err != nil {
+		return []string{fmt.Sprintf("unable to initialise session envelope encryption: %v", err)}
+	}
+	return []string{}
+}
+
+// validateHybridSessionStore ensures the hybrid session store has a
+// threshold and a persistent backend it can move large sessions to
+func validateHybridSessionStore(o *options.Options) []string {
+	msgs := []string{}
+	if o.Session.Type != options.HybridSessionStoreType {
+		return msgs
+	}
+	if o.Session.Hybrid.Threshold <= 0 {
+		msgs = append(msgs, "session_hybrid_threshold must be positive")
+	}
+	switch o.Session.Hybrid.Backend {
+	case options.RedisSessionStoreType, options.PluginSessionStoreType:
+	default:
+		msgs = append(msgs, fmt.Sprintf("invalid session_hybrid_backend %q: must be %q or %q",
+			o.Session.Hybrid.Backend, options.RedisSessionStoreType, options.PluginSessionStoreType))
+	}
+	return msgs
+}
+
+// validatePluginSessionStore builds a client for the session plugin and
+// checks that the plugin is reachable and supports the protocol version
+func validatePluginSessionStore(o *options.Options) []string {
+	usesPlugin := o.Session.Type == options.PluginSessionStoreType ||
+		(o.Session.Type == options.HybridSessionStoreType && o.Session.Hybrid.Backend == options.PluginSessionStoreType)
+	if !usesPlugin {
+		return []string{}
+	}
+	if o.Session.Plugin.Address == "" {
+		return []string{"missing setting: session_plugin_address"}
+	}
+
+	store, err := plugin.NewStore(o.Session.Plugin)
+	if err != nil {
+		return []string{fmt.Sprintf("unable to initialize a session plugin client: %v", err)}
+	}
+	if err := store.VerifyConnection(context.Background()); err != nil {
+		return []string{fmt.Sprintf("unable to connect to the session plugin: %v", err)}
+	}
+	return []string{}
+}
+
 // validateRedisSessionStore builds a Redis Client from the options and
 // attempts to connect, Set, Get and Del a random health check key
 func validateRedisSessionStore(o *options.Options) []string {
-	if o.Session.Type != options.RedisSessionStoreType {
+	usesRedis := o.Session.Type == options.RedisSessionStoreType ||
+		(o.Session.Type == options.HybridSessionStoreType && o.Session.Hybrid.Backend == options.RedisSessionStoreType)
+	if !usesRedis {
 		return []string{}
 	}
 
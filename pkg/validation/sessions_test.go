@@ -1,11 +1,16 @@
 package validation
 
 import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/Bose/minisentinel"
 	"github.com/alicebob/miniredis/v2"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/plugin"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -15,6 +20,7 @@ var _ = Describe("Sessions", func() {
 		idTokenConflictMsg     = "id_token claim for header \"X-ID-Token\" requires oauth tokens in sessions. session_cookie_minimal cannot be set"
 		accessTokenConflictMsg = "access_token claim for header \"X-Access-Token\" requires oauth tokens in sessions. session_cookie_minimal cannot be set"
 		cookieRefreshMsg       = "cookie_refresh > 0 requires oauth tokens in sessions. session_cookie_minimal cannot be set"
+		refreshSkewMsg         = "session_refresh_skew > 0 requires oauth tokens in sessions. session_cookie_minimal cannot be set"
 	)
 
 	type cookieMinimalTableInput struct {
@@ -147,6 +153,17 @@ var _ = Describe("Sessions", func() {
 			},
 			errStrings: []string{cookieRefreshMsg},
 		}),
+		Entry("RefreshSkew conflict", &cookieMinimalTableInput{
+			opts: &options.Options{
+				Session: options.SessionOptions{
+					RefreshSkew: time.Minute,
+					Cookie: options.CookieStoreOptions{
+						Minimal: true,
+					},
+				},
+			},
+			errStrings: []string{refreshSkewMsg},
+		}),
 		Entry("Multiple conflicts", &cookieMinimalTableInput{
 			opts: &options.Options{
 				Session: options.SessionOptions{
@@ -207,6 +224,257 @@ var _ = Describe("Sessions", func() {
 		errStrings []string
 	}
 
+	DescribeTable("validateSessionLifetime",
+		func(session options.SessionOptions, errStrings []string) {
+			Expect(validateSessionLifetime(&options.Options{Session: session})).To(ConsistOf(errStrings))
+		},
+		Entry("with no limits", options.SessionOptions{
+			ActivityWriteInterval: time.Minute,
+		}, []string{}),
+		Entry("with valid limits", options.SessionOptions{
+			IdleTimeout:           time.Hour,
+			ActivityWriteInterval: time.Minute,
+			MaxAge:                8 * time.Hour,
+		}, []string{}),
+		Entry("with negative limits", options.SessionOptions{
+			IdleTimeout: -time.Hour,
+			MaxAge:      -time.Hour,
+			RefreshSkew: -time.Minute,
+		}, []string{
+			"session_idle_timeout must not be negative",
+			"session_max_age must not be negative",
+			"session_refresh_skew must not be negative",
+		}),
+		Entry("with an activity write interval longer than the idle timeout", options.SessionOptions{
+			IdleTimeout:           time.Minute,
+			ActivityWriteInterval: time.Hour,
+		}, []string{
+			"session_activity_write_interval (1h0m0s) must be less than session_idle_timeout (1m0s)",
+		}),
+	)
+
+	DescribeTable("validateSessionFormat",
+		func(writeVersion int, errStrings []string) {
+			Expect(validateSessionFormat(&options.Options{Session: options.SessionOptions{WriteVersion: writeVersion}})).To(ConsistOf(errStrings))
+		},
+		Entry("with the legacy format", 1, []string{}),
+		Entry("with the versioned format", 2, []string{}),
+		Entry("with an unset version", 0, []string{
+			"session_write_version (0) must be between 1 and 2",
+		}),
+		Entry("with an unsupported version", 3, []string{
+			"session_write_version (3) must be between 1 and 2",
+		}),
+	)
+
+	DescribeTable("validateSessionLimit",
+		func(session options.SessionOptions, errStrings []string) {
+			Expect(validateSessionLimit(&options.Options{Session: session})).To(ConsistOf(errStrings))
+		},
+		Entry("without a limit", options.SessionOptions{
+			Type: options.CookieSessionStoreType,
+		}, []string{}),
+		Entry("with a limit on the redis store", options.SessionOptions{
+			Type:                  options.RedisSessionStoreType,
+			MaxConcurrent:         2,
+			ConcurrentLimitPolicy: options.RejectSessionLimitPolicy,
+		}, []string{}),
+		Entry("with a negative limit", options.SessionOptions{
+			Type:          options.RedisSessionStoreType,
+			MaxConcurrent: -1,
+		}, []string{
+			"session_max_concurrent must not be negative",
+		}),
+		Entry("with a limit on the cookie store and an unknown policy", options.SessionOptions{
+			Type:                  options.CookieSessionStoreType,
+			MaxConcurrent:         2,
+			ConcurrentLimitPolicy: "evict-newest",
+		}, []string{
+			"session_max_concurrent requires the redis session store",
+			"invalid session_concurrent_limit_policy \"evict-newest\": must be \"evict-oldest\" or \"reject\"",
+		}),
+	)
+
+	DescribeTable("validateSessionBackgroundRefresh",
+		func(session options.SessionOptions, errStrings []string) {
+			Expect(validateSessionBackgroundRefresh(&options.Options{Session: session})).To(ConsistOf(errStrings))
+		},
+		Entry("when disabled", options.SessionOptions{
+			Type: options.CookieSessionStoreType,
+		}, []string{}),
+		Entry("with the redis store", options.SessionOptions{
+			Type:        options.RedisSessionStoreType,
+			RefreshSkew: time.Minute,
+			BackgroundRefresh: options.BackgroundRefreshOptions{
+				Enabled:     true,
+				Window:      5 * time.Minute,
+				Jitter:      time.Minute,
+				Interval:    30 * time.Second,
+				Concurrency: 4,
+			},
+		}, []string{}),
+		Entry("with the cookie store and invalid settings", options.SessionOptions{
+			Type:        options.CookieSessionStoreType,
+			RefreshSkew: time.Minute,
+			BackgroundRefresh: options.BackgroundRefreshOptions{
+				Enabled: true,
+				Window:  time.Minute,
+				Jitter:  -time.Second,
+			},
+		}, []string{
+			"session_background_refresh requires the redis, hybrid or plugin session store",
+			"session_background_refresh_window (1m0s) must be greater than session_refresh_skew (1m0s)",
+			"session_background_refresh_jitter must not be negative",
+			"session_background_refresh_interval must be positive",
+			"session_background_refresh_concurrency must be at least 1",
+		}),
+	)
+
+	DescribeTable("validateHybridSessionStore",
+		func(session options.SessionOptions, errStrings []string) {
+			Expect(validateHybridSessionStore(&options.Options{Session: session})).To(ConsistOf(errStrings))
+		},
+		Entry("with the cookie store", options.SessionOptions{
+			Type: options.CookieSessionStoreType,
+		}, []string{}),
+		Entry("with a redis backend", options.SessionOptions{
+			Type: options.HybridSessionStoreType,
+			Hybrid: options.HybridStoreOptions{
+				Threshold: 4000,
+				Backend:   options.RedisSessionStoreType,
+			},
+		}, []string{}),
+		Entry("with an invalid threshold and backend", options.SessionOptions{
+			Type: options.HybridSessionStoreType,
+			Hybrid: options.HybridStoreOptions{
+				Threshold: 0,
+				Backend:   options.CookieSessionStoreType,
+			},
+		}, []string{
+			"session_hybrid_threshold must be positive",
+			"invalid session_hybrid_backend \"cookie\": must be \"redis\" or \"plugin\"",
+		}),
+	)
+
+	DescribeTable("validateSessionBinding",
+		func(sessionBinding options.SessionBindingOptions, errStrings []string) {
+			Expect(validateSessionBinding(&options.Options{Session: options.SessionOptions{Binding: sessionBinding}})).To(ConsistOf(errStrings))
+		},
+		Entry("without binding", options.SessionBindingOptions{}, []string{}),
+		Entry("with valid binding", options.SessionBindingOptions{
+			Components:     []string{options.ClientIPSessionBinding, options.UserAgentSessionBinding},
+			IPv4Prefix:     24,
+			IPv6Prefix:     64,
+			MismatchAction: options.RevokeSessionBindingAction,
+		}, []string{}),
+		Entry("with an unknown component", options.SessionBindingOptions{
+			Components:     []string{"cookie"},
+			MismatchAction: options.DropSessionBindingAction,
+		}, []string{
+			"invalid session binding: unknown session binding \"cookie\"",
+		}),
+		Entry("with an invalid prefix length", options.SessionBindingOptions{
+			Components:     []string{options.ClientIPSessionBinding},
+			IPv4Prefix:     33,
+			MismatchAction: options.DropSessionBindingAction,
+		}, []string{
+			"invalid session binding: invalid IPv4 session binding prefix length 33",
+		}),
+		Entry("with an unknown mismatch action", options.SessionBindingOptions{
+			Components:     []string{options.UserAgentSessionBinding},
+			MismatchAction: "ignore",
+		}, []string{
+			"invalid session binding: unknown session binding mismatch action \"ignore\"",
+		}),
+	)
+
+	DescribeTable("validateSessionEvents",
+		func(sessionEvents options.SessionEvents, errStrings []string) {
+			Expect(validateSessionEvents(&options.Options{SessionEvents: sessionEvents})).To(ConsistOf(errStrings))
+		},
+		Entry("without a webhook", options.SessionEvents{}, []string{}),
+		Entry("with a valid webhook", options.SessionEvents{
+			WebhookURL:        "https://siem.example.com/events",
+			WebhookQueueSize:  1000,
+			WebhookMaxRetries: 5,
+		}, []string{}),
+		Entry("with an invalid webhook", options.SessionEvents{
+			WebhookURL:        "siem.example.com",
+			WebhookQueueSize:  0,
+			WebhookMaxRetries: -1,
+		}, []string{
+			"invalid session_events_webhook_url: parse \"siem.example.com\": invalid URI for request",
+			"session_events_webhook_queue_size must be at least 1",
+			"session_events_webhook_max_retries must not be negative",
+		}),
+	)
+
+	Context("validateSessionEncryption", func() {
+		var kekFile string
+
+		BeforeEach(func() {
+			kekFile = filepath.Join(GinkgoT().TempDir(), "kek")
+			Expect(os.WriteFile(kekFile, []byte("0123456789abcdefghijklmnopqrstuv"), 0600)).To(Succeed())
+		})
+
+		It("accepts no key provider", func() {
+			Expect(validateSessionEncryption(&options.Options{})).To(BeEmpty())
+		})
+
+		It("accepts a valid file key provider", func() {
+			opts := &options.Options{
+				Session: options.SessionOptions{
+					Encryption: options.SessionEncryptionOptions{
+						KeyProvider: options.FileKeyProvider,
+						KEKFile:     kekFile,
+					},
+				},
+			}
+			Expect(validateSessionEncryption(opts)).To(BeEmpty())
+		})
+
+		It("rejects a file key provider without a KEK file", func() {
+			opts := &options.Options{
+				Session: options.SessionOptions{
+					Encryption: options.SessionEncryptionOptions{
+						KeyProvider: options.FileKeyProvider,
+					},
+				},
+			}
+			Expect(validateSessionEncryption(opts)).To(ConsistOf(
+				"unable to initialise session envelope encryption: session_kek_file is required for the \"file\" session key provider",
+			))
+		})
+
+		It("rejects an invalid KEK", func() {
+			Expect(os.WriteFile(kekFile, []byte("too-short"), 0600)).To(Succeed())
+			opts := &options.Options{
+				Session: options.SessionOptions{
+					Encryption: options.SessionEncryptionOptions{
+						KeyProvider: options.FileKeyProvider,
+						KEKFile:     kekFile,
+					},
+				},
+			}
+			Expect(validateSessionEncryption(opts)).To(ConsistOf(
+				"unable to initialise session envelope encryption: invalid key encryption key: crypto/aes: invalid key size 9",
+			))
+		})
+
+		It("rejects an unknown key provider", func() {
+			opts := &options.Options{
+				Session: options.SessionOptions{
+					Encryption: options.SessionEncryptionOptions{
+						KeyProvider: "unknown",
+					},
+				},
+			}
+			Expect(validateSessionEncryption(opts)).To(ConsistOf(
+				"unable to initialise session envelope encryption: unknown session key provider \"unknown\"",
+			))
+		})
+	})
+
 	DescribeTable("validateRedisSessionStore",
 		func(o *redisStoreTableInput) {
 			mr, err := miniredis.Run()
@@ -251,6 +519,19 @@ var _ = Describe("Sessions", func() {
 			},
 			errStrings: []string{},
 		}),
+		Entry("connect successfully to redis as a hybrid backend", &redisStoreTableInput{
+			setAddr: true,
+
+			opts: &options.Options{
+				Session: options.SessionOptions{
+					Type: options.HybridSessionStoreType,
+					Hybrid: options.HybridStoreOptions{
+						Backend: options.RedisSessionStoreType,
+					},
+				},
+			},
+			errStrings: []string{},
+		}),
 		Entry("failed redis connection with wrong address", &redisStoreTableInput{
 			opts: &options.Options{
 				Session: options.SessionOptions{
@@ -404,4 +685,41 @@ var _ = Describe("Sessions", func() {
 			errStrings: []string{clusterAndSentinelMsg},
 		}),
 	)
+
+	Context("validatePluginSessionStore", func() {
+		var opts *options.Options
+
+		BeforeEach(func() {
+			opts = &options.Options{
+				Session: options.SessionOptions{
+					Type: options.PluginSessionStoreType,
+				},
+			}
+		})
+
+		It("skips other session stores", func() {
+			opts.Session.Type = options.RedisSessionStoreType
+			Expect(validatePluginSessionStore(opts)).To(BeEmpty())
+		})
+
+		It("requires an address", func() {
+			Expect(validatePluginSessionStore(opts)).To(ConsistOf("missing setting: session_plugin_address"))
+		})
+
+		It("connects to the plugin", func() {
+			server := httptest.NewServer(plugin.NewServer(tests.NewMockStore()))
+			defer server.Close()
+
+			opts.Session.Plugin.Address = server.URL
+			Expect(validatePluginSessionStore(opts)).To(BeEmpty())
+		})
+
+		It("fails when the plugin is unreachable", func() {
+			opts.Session.Type = options.HybridSessionStoreType
+			opts.Session.Hybrid.Backend = options.PluginSessionStoreType
+			opts.Session.Plugin.Address = "unix:///nonexistent/sessions.sock"
+			Expect(validatePluginSessionStore(opts)).To(ConsistOf(
+				ContainSubstring("unable to connect to the session plugin: error checking session plugin health:")))
+		})
+	})
 })
@@ -3,6 +3,7 @@ package validation
 import (
 	"fmt"
 	"net/url"
+	"strings"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 )
@@ -45,6 +46,9 @@ func validateUpstream(upstream options.Upstream, ids, paths map[string]struct{})
 
 	msgs = append(msgs, validateUpstreamURI(upstream)...)
 	msgs = append(msgs, validateStaticUpstream(upstream)...)
+	msgs = append(msgs, validateUpstreamTokenExchange(upstream)...)
+	msgs = append(msgs, validateUpstreamForwardDPoP(upstream)...)
+	msgs = append(msgs, validateUpstreamStepUp(upstream)...)
 	return msgs
 }
 
@@ -110,3 +114,66 @@ func validateUpstreamURI(upstream options.Upstream) []string {
 
 	return msgs
 }
+
+// validateUpstreamTokenExchange checks that a token exchange is only
+// configured for upstreams that proxy requests and that it requests a
+// specific audience, resource or scopes.
+func validateUpstreamTokenExchange(upstream options.Upstream) []string {
+	msgs := []string{}
+	if upstream.TokenExchange == nil {
+		return msgs
+	}
+
+	if upstream.Static || strings.HasPrefix(upstream.URI, "file:") {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has tokenExchange, but is not an HTTP upstream, this will have no effect.", upstream.ID))
+	}
+	exchange := upstream.TokenExchange
+	if exchange.Audience == "" && exchange.Resource == "" && len(exchange.Scopes) == 0 {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has tokenExchange without an audience, resource or scopes", upstream.ID))
+	}
+	if exchange.CacheSize != nil && *exchange.CacheSize < 0 {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has a negative tokenExchange cacheSize", upstream.ID))
+	}
+	msgs = append(msgs, validateHeaders(upstream.TokenExchange.InjectRequestHeaders)...)
+
+	return msgs
+}
+
+// validateUpstreamForwardDPoP checks that DPoP-bound tokens are only
+// forwarded to upstreams that proxy requests and are not also exchanged.
+// A token exchange proves possession of the session's key itself, and the
+// exchanged bearer token is forwarded in place of the session's token.
+func validateUpstreamForwardDPoP(upstream options.Upstream) []string {
+	msgs := []string{}
+	if !upstream.ForwardDPoP {
+		return msgs
+	}
+
+	if upstream.Static || strings.HasPrefix(upstream.URI, "file:") {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has forwardDPoP, but is not an HTTP upstream, this will have no effect.", upstream.ID))
+	}
+	if upstream.TokenExchange != nil {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has forwardDPoP and tokenExchange, only one of these may be set", upstream.ID))
+	}
+
+	return msgs
+}
+
+// validateUpstreamStepUp checks that step-up authentication requires an ACR
+// or a maximum authentication age, and that the age is positive.
+func validateUpstreamStepUp(upstream options.Upstream) []string {
+	msgs := []string{}
+	if upstream.StepUp == nil {
+		return msgs
+	}
+
+	stepUp := upstream.StepUp
+	if len(stepUp.ACRValues) == 0 && stepUp.MaxAuthAge == nil {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has stepUp without acrValues or maxAuthAge", upstream.ID))
+	}
+	if stepUp.MaxAuthAge != nil && stepUp.MaxAuthAge.Duration() <= 0 {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has stepUp with a non-positive maxAuthAge", upstream.ID))
+	}
+
+	return msgs
+}
@@ -16,6 +16,7 @@ var _ = Describe("Upstreams", func() {
 
 	flushInterval := options.Duration(5 * time.Second)
 	staticCode200 := 200
+	negativeCacheSize := -1
 	truth := true
 
 	validHTTPUpstream := options.Upstream{
@@ -47,6 +48,15 @@ var _ = Describe("Upstreams", func() {
 	multipleIDsMsg := "multiple upstreams found with id \"foo\": upstream ids must be unique"
 	multiplePathsMsg := "multiple upstreams found with path \"/foo\": upstream paths must be unique"
 	staticCodeMsg := "upstream \"foo\" has staticCode (200), but is not a static upstream, set 'static' for a static response"
+	tokenExchangeNotHTTPMsg := "upstream \"foo\" has tokenExchange, but is not an HTTP upstream, this will have no effect."
+	tokenExchangeNoTargetMsg := "upstream \"foo\" has tokenExchange without an audience, resource or scopes"
+	tokenExchangeCacheSizeMsg := "upstream \"foo\" has a negative tokenExchange cacheSize"
+	forwardDPoPNotHTTPMsg := "upstream \"foo\" has forwardDPoP, but is not an HTTP upstream, this will have no effect."
+	forwardDPoPWithTokenExchangeMsg := "upstream \"foo\" has forwardDPoP and tokenExchange, only one of these may be set"
+	maxAuthAge := options.Duration(5 * time.Minute)
+	zeroAuthAge := options.Duration(0)
+	stepUpEmptyMsg := "upstream \"foo\" has stepUp without acrValues or maxAuthAge"
+	stepUpMaxAuthAgeMsg := "upstream \"foo\" has stepUp with a non-positive maxAuthAge"
 
 	DescribeTable("validateUpstreams",
 		func(o *validateUpstreamTableInput) {
@@ -207,5 +217,135 @@ var _ = Describe("Upstreams", func() {
 			},
 			errStrings: []string{emptyURIMsg, staticCodeMsg},
 		}),
+		Entry("with a token exchange on an HTTP upstream", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:   "foo",
+						Path: "/foo",
+						URI:  "http://localhost:8080",
+						TokenExchange: &options.TokenExchange{
+							Audience: "foo-api",
+						},
+					},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with a token exchange on a file upstream without an audience", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:            "foo",
+						Path:          "/foo",
+						URI:           "file://var/lib/foo",
+						TokenExchange: &options.TokenExchange{},
+					},
+				},
+			},
+			errStrings: []string{tokenExchangeNotHTTPMsg, tokenExchangeNoTargetMsg},
+		}),
+		Entry("with a token exchange with a negative cache size", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:   "foo",
+						Path: "/foo",
+						URI:  "http://localhost:8080",
+						TokenExchange: &options.TokenExchange{
+							Audience:  "foo-api",
+							CacheSize: &negativeCacheSize,
+						},
+					},
+				},
+			},
+			errStrings: []string{tokenExchangeCacheSizeMsg},
+		}),
+		Entry("with forwardDPoP on an HTTP upstream", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:          "foo",
+						Path:        "/foo",
+						URI:         "http://foo",
+						ForwardDPoP: true,
+					},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with forwardDPoP on a static upstream", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:          "foo",
+						Path:        "/foo",
+						Static:      true,
+						ForwardDPoP: true,
+					},
+				},
+			},
+			errStrings: []string{forwardDPoPNotHTTPMsg},
+		}),
+		Entry("with forwardDPoP and a token exchange", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:          "foo",
+						Path:        "/foo",
+						URI:         "http://foo",
+						ForwardDPoP: true,
+						TokenExchange: &options.TokenExchange{
+							Audience: "foo",
+						},
+					},
+				},
+			},
+			errStrings: []string{forwardDPoPWithTokenExchangeMsg},
+		}),
+		Entry("with a valid stepUp", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:   "foo",
+						Path: "/foo",
+						URI:  "http://foo",
+						StepUp: &options.StepUp{
+							ACRValues:  []string{"urn:mace:incommon:iap:silver"},
+							MaxAuthAge: &maxAuthAge,
+						},
+					},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with an empty stepUp", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:     "foo",
+						Path:   "/foo",
+						URI:    "http://foo",
+						StepUp: &options.StepUp{},
+					},
+				},
+			},
+			errStrings: []string{stepUpEmptyMsg},
+		}),
+		Entry("with a non-positive stepUp maxAuthAge", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:   "foo",
+						Path: "/foo",
+						URI:  "http://foo",
+						StepUp: &options.StepUp{
+							MaxAuthAge: &zeroAuthAge,
+						},
+					},
+				},
+			},
+			errStrings: []string{stepUpMaxAuthAgeMsg},
+		}),
 	)
 })
@@ -264,9 +264,9 @@ func (p *AzureProvider) extractClaimsIntoSession(ctx context.Context, session *s
 	// due to above issues, id_token may not be signed by AAD
 	// in that case, we will fallback to access token
 	var err error
-	s, err = p.buildSessionFromClaims(session.IDToken, session.AccessToken)
+	s, err = p.buildSessionFromClaims(ctx, session.IDToken, session.AccessToken)
 	if err != nil || s.Email == "" {
-		s, err = p.buildSessionFromClaims(session.AccessToken, session.AccessToken)
+		s, err = p.buildSessionFromClaims(ctx, session.AccessToken, session.AccessToken)
 	}
 	if err != nil {
 		return fmt.Errorf("unable to get claims from token: %v", err)
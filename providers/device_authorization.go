@@ -0,0 +1,103 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+	"golang.org/x/oauth2"
+)
+
+// DeviceCodeGrantType is the grant type used to redeem a device code (RFC 8628 section 3.4)
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// ErrDeviceFlowNotConfigured is returned when a device authorization is
+// attempted against a provider without a device authorization endpoint.
+var ErrDeviceFlowNotConfigured = errors.New("device authorization endpoint is not configured")
+
+// DeviceAuthorization is the response of a device authorization request
+// as described in RFC 8628 section 3.2.
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval,omitempty"`
+}
+
+// DeviceFlowEnabled returns true when the provider has a device authorization endpoint
+func (p *ProviderData) DeviceFlowEnabled() bool {
+	return p.DeviceAuthURL != nil && p.DeviceAuthURL.String() != ""
+}
+
+// StartDeviceAuthorization requests a new device and user code from the
+// provider's device authorization endpoint.
+func (p *ProviderData) StartDeviceAuthorization(ctx context.Context) (*DeviceAuthorization, error) {
+	if !p.DeviceFlowEnabled() {
+		return nil, ErrDeviceFlowNotConfigured
+	}
+
+	params, err := p.clientParams()
+	if err != nil {
+		return nil, err
+	}
+	if p.Scope != "" {
+		params.Add("scope", p.Scope)
+	}
+
+	var auth DeviceAuthorization
+	err = requests.New(p.DeviceAuthURL.String()).
+		WithContext(ctx).
+		WithMethod("POST").
+		WithBody(bytes.NewBufferString(params.Encode())).
+		SetHeader("Content-Type", "application/x-www-form-urlencoded").
+		SetHeader(acceptHeader, acceptApplicationJSON).
+		Do().
+		UnmarshalInto(&auth)
+	if err != nil {
+		return nil, fmt.Errorf("device authorization request failed: %v", err)
+	}
+	if auth.DeviceCode == "" || auth.UserCode == "" || auth.VerificationURI == "" {
+		return nil, errors.New("device authorization response is missing required fields")
+	}
+	return &auth, nil
+}
+
+// RedeemDeviceCode polls the token endpoint once for the given device code.
+// While the user has not yet completed the authorization a *TokenError
+// is returned.
+func (p *ProviderData) RedeemDeviceCode(ctx context.Context, deviceCode string) (*sessions.SessionState, error) {
+	token, err := p.redeemDeviceCodeToken(ctx, deviceCode)
+	if err != nil {
+		return nil, err
+	}
+
+	ss := &sessions.SessionState{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+	}
+	ss.CreatedAtNow()
+	ss.SetExpiresOn(token.Expiry)
+	return ss, nil
+}
+
+// redeemDeviceCodeToken performs the device code token request and returns
+// the resulting token, including any extra fields such as the `id_token`.
+func (p *ProviderData) redeemDeviceCodeToken(ctx context.Context, deviceCode string) (*oauth2.Token, error) {
+	if deviceCode == "" {
+		return nil, ErrMissingCode
+	}
+
+	params, err := p.clientParams()
+	if err != nil {
+		return nil, err
+	}
+	params.Add("grant_type", DeviceCodeGrantType)
+	params.Add("device_code", deviceCode)
+
+	return p.postTokenRequest(ctx, params)
+}
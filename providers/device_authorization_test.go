@@ -0,0 +1,106 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func newDeviceTestProviderData(serverURL string) *ProviderData {
+	u, _ := url.Parse(serverURL)
+	return &ProviderData{
+		ClientID:      "client",
+		ClientSecret:  "secret",
+		Scope:         "openid email",
+		DeviceAuthURL: &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/device"},
+		RedeemURL:     &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/token"},
+	}
+}
+
+func TestProviderDataStartDeviceAuthorization(t *testing.T) {
+	g := NewWithT(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.ParseForm()).To(Succeed())
+		g.Expect(r.URL.Path).To(Equal("/device"))
+		g.Expect(r.PostForm.Get("client_id")).To(Equal("client"))
+		g.Expect(r.PostForm.Get("scope")).To(Equal("openid email"))
+		_, _ = w.Write([]byte(`{"device_code":"dc","user_code":"UC","verification_uri":"https://example.com/device","expires_in":600,"interval":5}`))
+	}))
+	defer server.Close()
+
+	auth, err := newDeviceTestProviderData(server.URL).StartDeviceAuthorization(context.Background())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(auth).To(Equal(&DeviceAuthorization{
+		DeviceCode:      "dc",
+		UserCode:        "UC",
+		VerificationURI: "https://example.com/device",
+		ExpiresIn:       600,
+		Interval:        5,
+	}))
+}
+
+func TestProviderDataStartDeviceAuthorizationNotConfigured(t *testing.T) {
+	g := NewWithT(t)
+	_, err := (&ProviderData{}).StartDeviceAuthorization(context.Background())
+	g.Expect(err).To(Equal(ErrDeviceFlowNotConfigured))
+}
+
+func TestProviderDataRedeemDeviceCode(t *testing.T) {
+	testCases := map[string]struct {
+		status        int
+		body          string
+		expectedError error
+		expectedToken string
+	}{
+		"authorization pending": {
+			status:        http.StatusBadRequest,
+			body:          `{"error":"authorization_pending"}`,
+			expectedError: &TokenError{Code: "authorization_pending"},
+		},
+		"access denied": {
+			status:        http.StatusBadRequest,
+			body:          `{"error":"access_denied","error_description":"user denied"}`,
+			expectedError: &TokenError{Code: "access_denied", Description: "user denied"},
+		},
+		"success": {
+			status:        http.StatusOK,
+			body:          `{"access_token":"at","refresh_token":"rt","expires_in":3600}`,
+			expectedToken: "at",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			g := NewWithT(t)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				g.Expect(r.ParseForm()).To(Succeed())
+				g.Expect(r.PostForm.Get("grant_type")).To(Equal(DeviceCodeGrantType))
+				g.Expect(r.PostForm.Get("device_code")).To(Equal("dc"))
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			ss, err := newDeviceTestProviderData(server.URL).RedeemDeviceCode(context.Background(), "dc")
+			if tc.expectedError != nil {
+				g.Expect(err).To(Equal(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ss.AccessToken).To(Equal(tc.expectedToken))
+			g.Expect(ss.RefreshToken).To(Equal("rt"))
+			g.Expect(ss.ExpiresOn).ToNot(BeNil())
+		})
+	}
+}
+
+func TestTokenErrorPending(t *testing.T) {
+	g := NewWithT(t)
+	g.Expect((&TokenError{Code: "authorization_pending"}).Pending()).To(BeTrue())
+	g.Expect((&TokenError{Code: "slow_down"}).Pending()).To(BeTrue())
+	g.Expect((&TokenError{Code: "expired_token"}).Pending()).To(BeFalse())
+}
@@ -0,0 +1,230 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cache"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+)
+
+// ErrIntrospectionNotConfigured is returned when a token is introspected
+// with a provider without an introspection endpoint.
+var ErrIntrospectionNotConfigured = errors.New("token introspection endpoint is not configured")
+
+// ErrTokenNotActive is returned when the introspection endpoint reports that
+// a token is not active, e.g. because it expired or was revoked.
+var ErrTokenNotActive = errors.New("token is not active")
+
+// IntrospectionResponse is the response of a token introspection request as
+// described in RFC 7662 section 2.2.
+type IntrospectionResponse struct {
+	Active    bool        `json:"active"`
+	Scope     string      `json:"scope,omitempty"`
+	Audience  interface{} `json:"aud,omitempty"`
+	ClientID  string      `json:"client_id,omitempty"`
+	Username  string      `json:"username,omitempty"`
+	Subject   string      `json:"sub,omitempty"`
+	Email     string      `json:"email,omitempty"`
+	Groups    interface{} `json:"groups,omitempty"`
+	ExpiresAt int64       `json:"exp,omitempty"`
+}
+
+// IntrospectionEnabled returns true when the provider has an introspection endpoint
+func (p *ProviderData) IntrospectionEnabled() bool {
+	return p.IntrospectionURL != nil && p.IntrospectionURL.String() != ""
+}
+
+// IntrospectToken asks the provider's introspection endpoint whether the
+// token is active, authenticating with the client credentials.
+func (p *ProviderData) IntrospectToken(ctx context.Context, token string) (*IntrospectionResponse, error) {
+	if !p.IntrospectionEnabled() {
+		return nil, ErrIntrospectionNotConfigured
+	}
+
+	params, err := p.clientParams()
+	if err != nil {
+		return nil, err
+	}
+	params.Add("token", token)
+	params.Add("token_type_hint", "access_token")
+
+	var resp IntrospectionResponse
+	err = requests.New(p.IntrospectionURL.String()).
+		WithContext(ctx).
+		WithMethod("POST").
+		WithBody(bytes.NewBufferString(params.Encode())).
+		SetHeader("Content-Type", "application/x-www-form-urlencoded").
+		SetHeader(acceptHeader, acceptApplicationJSON).
+		Do().
+		UnmarshalInto(&resp)
+	if err != nil {
+		return nil, fmt.Errorf("error introspecting token: %v", err)
+	}
+	return &resp, nil
+}
+
+// CreateSessionFromIntrospection introspects an opaque bearer token and
+// converts an active token issued for this client into a session.
+func (p *ProviderData) CreateSessionFromIntrospection(ctx context.Context, token string) (*sessions.SessionState, error) {
+	resp, err := p.IntrospectToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Active {
+		return nil, ErrTokenNotActive
+	}
+
+	audiences := introspectionAudiences(resp.Audience)
+	if !p.allowsIntrospectedAudience(audiences, resp.ClientID) {
+		return nil, fmt.Errorf("token audience %v and client id %q do not match the client id or any of the extra audiences %v",
+			audiences, resp.ClientID, p.ExtraAudiences)
+	}
+
+	groups, err := introspectionGroups(resp.Groups)
+	if err != nil {
+		return nil, err
+	}
+
+	ss := &sessions.SessionState{
+		User:              resp.Subject,
+		Email:             resp.Email,
+		PreferredUsername: resp.Username,
+		Groups:            groups,
+		Scopes:            strings.Fields(resp.Scope),
+		Audiences:         audiences,
+		AccessToken:       token,
+	}
+	if ss.User == "" {
+		ss.User = resp.Username
+	}
+	// Allow empty Email in Bearer case since we can't hit the ProfileURL
+	if ss.Email == "" {
+		ss.Email = ss.User
+	}
+	if ss.User == "" {
+		return nil, errors.New("introspection response did not identify the user")
+	}
+
+	ss.CreatedAtNow()
+	if resp.ExpiresAt > 0 {
+		ss.SetExpiresOn(time.Unix(resp.ExpiresAt, 0))
+	}
+	return ss, nil
+}
+
+// allowsIntrospectedAudience checks that an introspected token was issued for
+// this client, as the audience of JWT bearer tokens is verified: one of its
+// audiences, or the client it was issued to, must be the client ID or one of
+// the extra audiences.
+func (p *ProviderData) allowsIntrospectedAudience(audiences []string, clientID string) bool {
+	allowed := func(aud string) bool {
+		if aud == "" {
+			return false
+		}
+		if aud == p.ClientID {
+			return true
+		}
+		for _, extra := range p.ExtraAudiences {
+			if aud == extra {
+				return true
+			}
+		}
+		return false
+	}
+
+	if allowed(clientID) {
+		return true
+	}
+	for _, aud := range audiences {
+		if allowed(aud) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewIntrospectionSessionLoader returns a function that converts bearer
+// tokens into sessions using the provider's introspection endpoint.
+// Active tokens with an expiry are cached until they expire in a cache
+// holding at most cacheSize tokens, so that tokens are not introspected on
+// every request. A cacheSize of 0 disables caching.
+func NewIntrospectionSessionLoader(p *ProviderData, cacheSize int) middleware.TokenToSessionFunc {
+	sessionCache := cache.NewLRU[sessions.SessionState](cacheSize)
+	return func(ctx context.Context, token string) (*sessions.SessionState, error) {
+		key := introspectionCacheKey(token)
+		// Sessions are cached by value so that changes made while serving a
+		// request do not leak into other requests
+		if ss, ok := sessionCache.Get(key, time.Now()); ok {
+			return &ss, nil
+		}
+
+		ss, err := p.CreateSessionFromIntrospection(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		if ss.ExpiresOn != nil {
+			sessionCache.Set(key, *ss, *ss.ExpiresOn, time.Now())
+		}
+		return ss, nil
+	}
+}
+
+// introspectionCacheKey hashes the token so that the raw tokens are not kept
+// as cache keys
+func introspectionCacheKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// introspectionGroups coerces the groups of an introspection response, which
+// may be a single group or a list of groups, into a list of strings
+func introspectionGroups(rawGroups interface{}) ([]string, error) {
+	switch g := rawGroups.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		groups := make([]string, 0, len(g))
+		for _, rawGroup := range g {
+			group, err := formatGroup(rawGroup)
+			if err != nil {
+				return nil, fmt.Errorf("unable to format group in introspection response: %v", err)
+			}
+			groups = append(groups, group)
+		}
+		return groups, nil
+	default:
+		group, err := formatGroup(g)
+		if err != nil {
+			return nil, fmt.Errorf("unable to format group in introspection response: %v", err)
+		}
+		return []string{group}, nil
+	}
+}
+
+// introspectionAudiences reads the `aud` member of an introspection response,
+// which is either a single audience or a list of audiences.
+func introspectionAudiences(rawAudience interface{}) []string {
+	switch a := rawAudience.(type) {
+	case string:
+		return []string{a}
+	case []interface{}:
+		audiences := make([]string, 0, len(a))
+		for _, rawAud := range a {
+			if aud, ok := rawAud.(string); ok {
+				audiences = append(audiences, aud)
+			}
+		}
+		return audiences
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,138 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/gomega"
+)
+
+func newIntrospectionServer(g *WithT, responses map[string]string, calls *int32) (*httptest.Server, *ProviderData) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		g.Expect(r.ParseForm()).To(Succeed())
+		g.Expect(r.PostForm.Get("client_id")).To(Equal("client"))
+		g.Expect(r.PostForm.Get("client_secret")).To(Equal("secret"))
+		g.Expect(r.PostForm.Get("token_type_hint")).To(Equal("access_token"))
+
+		resp, ok := responses[r.PostForm.Get("token")]
+		if !ok {
+			resp = `{"active":false}`
+		}
+		_, _ = w.Write([]byte(resp))
+	}))
+
+	u, _ := url.Parse(server.URL)
+	return server, &ProviderData{
+		ClientID:         "client",
+		ClientSecret:     "secret",
+		IntrospectionURL: u,
+	}
+}
+
+func TestProviderDataCreateSessionFromIntrospection(t *testing.T) {
+	g := NewWithT(t)
+	exp := time.Now().Add(time.Hour).Unix()
+
+	var calls int32
+	server, p := newIntrospectionServer(g, map[string]string{
+		"active":     fmt.Sprintf(`{"active":true,"sub":"123","username":"jane","scope":"read write","aud":["api","other"],"groups":["admins",42],"exp":%d}`, exp),
+		"single":     `{"active":true,"username":"service","groups":"robots","aud":"client"}`,
+		"nouser":     `{"active":true,"scope":"read","client_id":"client"}`,
+		"clientid":   `{"active":true,"sub":"123","aud":"elsewhere","client_id":"client"}`,
+		"otheraud":   `{"active":true,"sub":"123","aud":["elsewhere"],"client_id":"other"}`,
+		"noaudience": `{"active":true,"sub":"123"}`,
+	}, &calls)
+	defer server.Close()
+	p.ExtraAudiences = []string{"api"}
+
+	ss, err := p.CreateSessionFromIntrospection(context.Background(), "active")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ss.User).To(Equal("123"))
+	g.Expect(ss.Email).To(Equal("123"))
+	g.Expect(ss.PreferredUsername).To(Equal("jane"))
+	g.Expect(ss.Groups).To(Equal([]string{"admins", "42"}))
+	g.Expect(ss.Scopes).To(Equal([]string{"read", "write"}))
+	g.Expect(ss.Audiences).To(Equal([]string{"api", "other"}))
+	g.Expect(ss.AccessToken).To(Equal("active"))
+	g.Expect(*ss.ExpiresOn).To(Equal(time.Unix(exp, 0)))
+
+	ss, err = p.CreateSessionFromIntrospection(context.Background(), "single")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ss.User).To(Equal("service"))
+	g.Expect(ss.Groups).To(Equal([]string{"robots"}))
+	g.Expect(ss.ExpiresOn).To(BeNil())
+
+	_, err = p.CreateSessionFromIntrospection(context.Background(), "nouser")
+	g.Expect(err).To(MatchError("introspection response did not identify the user"))
+
+	// Tokens must be issued for the client or one of the extra audiences
+	ss, err = p.CreateSessionFromIntrospection(context.Background(), "clientid")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ss.User).To(Equal("123"))
+
+	_, err = p.CreateSessionFromIntrospection(context.Background(), "otheraud")
+	g.Expect(err).To(MatchError(`token audience [elsewhere] and client id "other" do not match the client id or any of the extra audiences [api]`))
+
+	_, err = p.CreateSessionFromIntrospection(context.Background(), "noaudience")
+	g.Expect(err).To(MatchError(ContainSubstring("do not match the client id")))
+
+	_, err = p.CreateSessionFromIntrospection(context.Background(), "revoked")
+	g.Expect(err).To(Equal(ErrTokenNotActive))
+
+	_, err = (&ProviderData{}).CreateSessionFromIntrospection(context.Background(), "active")
+	g.Expect(err).To(Equal(ErrIntrospectionNotConfigured))
+}
+
+func TestNewIntrospectionSessionLoader(t *testing.T) {
+	g := NewWithT(t)
+	exp := time.Now().Add(time.Hour).Unix()
+
+	var calls int32
+	server, p := newIntrospectionServer(g, map[string]string{
+		"first":     fmt.Sprintf(`{"active":true,"sub":"first","client_id":"client","exp":%d}`, exp),
+		"second":    fmt.Sprintf(`{"active":true,"sub":"second","client_id":"client","exp":%d}`, exp),
+		"no-expiry": `{"active":true,"sub":"no-expiry","client_id":"client"}`,
+	}, &calls)
+	defer server.Close()
+
+	loader := NewIntrospectionSessionLoader(p, 1)
+	load := func(token string) *sessions.SessionState {
+		ss, err := loader(context.Background(), token)
+		g.Expect(err).ToNot(HaveOccurred())
+		return ss
+	}
+
+	// Active tokens are cached until they expire
+	g.Expect(load("first").User).To(Equal("first"))
+	g.Expect(load("first").User).To(Equal("first"))
+	g.Expect(atomic.LoadInt32(&calls)).To(Equal(int32(1)))
+
+	// Changes to a returned session do not change the cached session
+	load("first").User = "changed"
+	g.Expect(load("first").User).To(Equal("first"))
+
+	// The least recently used token is evicted once the cache is full
+	g.Expect(load("second").User).To(Equal("second"))
+	g.Expect(load("first").User).To(Equal("first"))
+	g.Expect(atomic.LoadInt32(&calls)).To(Equal(int32(3)))
+
+	// Tokens without an expiry are never cached
+	load("no-expiry")
+	load("no-expiry")
+	g.Expect(atomic.LoadInt32(&calls)).To(Equal(int32(5)))
+
+	// Inactive tokens are never cached
+	for i := 0; i < 2; i++ {
+		_, err := loader(context.Background(), "revoked")
+		g.Expect(err).To(Equal(ErrTokenNotActive))
+	}
+	g.Expect(atomic.LoadInt32(&calls)).To(Equal(int32(7)))
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
@@ -95,6 +96,17 @@ func (p *OIDCProvider) Redeem(ctx context.Context, redirectURL, code, codeVerifi
 	return p.createSession(ctx, token, false)
 }
 
+// RedeemDeviceCode exchanges a device code for tokens and builds the session
+// from the returned id_token (RFC 8628)
+func (p *OIDCProvider) RedeemDeviceCode(ctx context.Context, deviceCode string) (*sessions.SessionState, error) {
+	token, err := p.redeemDeviceCodeToken(ctx, deviceCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.createSession(ctx, token, false)
+}
+
 // EnrichSession is called after Redeem to allow providers to enrich session fields
 // such as User, Email, Groups with provider specific API calls.
 func (p *OIDCProvider) EnrichSession(_ context.Context, s *sessions.SessionState) error {
@@ -114,10 +126,13 @@ func (p *OIDCProvider) ValidateSession(ctx context.Context, s *sessions.SessionS
 		return false
 	}
 
-	if p.SkipNonce {
+	// Sessions from grants without an authorization request, such as the
+	// device authorization grant, have no nonce to check. Sessions from the
+	// authorization code flow always have the nonce of the CSRF cookie.
+	if p.SkipNonce || len(s.Nonce) == 0 {
 		return true
 	}
-	err = p.checkNonce(s)
+	err = p.checkNonce(ctx, s)
 	if err != nil {
 		logger.Errorf("nonce verification failed: %v", err)
 		return false
@@ -179,6 +194,24 @@ func (p *OIDCProvider) redeemRefreshToken(ctx context.Context, s *sessions.Sessi
 		s.User = newSession.User
 		s.Groups = newSession.Groups
 		s.PreferredUsername = newSession.PreferredUsername
+
+		// A refreshed ID token describes the original authentication, but
+		// some providers omit these claims on refresh
+		if newSession.ACR != "" {
+			s.ACR = newSession.ACR
+		}
+		if len(newSession.AMR) > 0 {
+			s.AMR = newSession.AMR
+		}
+		if newSession.AuthTime != nil {
+			s.AuthTime = newSession.AuthTime
+		}
+	}
+
+	// Keep the refresh token expiry when the provider returns the same
+	// refresh token without a new expiry
+	if newSession.RefreshExpiresOn != nil || newSession.RefreshToken != s.RefreshToken {
+		s.RefreshExpiresOn = newSession.RefreshExpiresOn
 	}
 
 	s.AccessToken = newSession.AccessToken
@@ -197,7 +230,7 @@ func (p *OIDCProvider) CreateSessionFromToken(ctx context.Context, token string)
 		return nil, err
 	}
 
-	ss, err := p.buildSessionFromClaims(token, "")
+	ss, err := p.buildSessionFromClaims(ctx, token, "")
 	if err != nil {
 		return nil, err
 	}
@@ -207,6 +240,16 @@ func (p *OIDCProvider) CreateSessionFromToken(ctx context.Context, token string)
 		ss.Email = ss.User
 	}
 
+	var scopeClaims struct {
+		Scope interface{} `json:"scope"`
+		Scp   interface{} `json:"scp"`
+	}
+	if err := idToken.Claims(&scopeClaims); err != nil {
+		return nil, fmt.Errorf("failed to parse bearer token claims: %v", err)
+	}
+	ss.Scopes = middleware.ScopesFromClaims(scopeClaims.Scope, scopeClaims.Scp)
+	ss.Audiences = idToken.Audience
+
 	ss.AccessToken = token
 	ss.IDToken = token
 	ss.RefreshToken = ""
@@ -234,13 +277,14 @@ func (p *OIDCProvider) createSession(ctx context.Context, token *oauth2.Token, r
 	}
 
 	rawIDToken := getIDToken(token)
-	ss, err := p.buildSessionFromClaims(rawIDToken, token.AccessToken)
+	ss, err := p.buildSessionFromClaims(ctx, rawIDToken, token.AccessToken)
 	if err != nil {
 		return nil, err
 	}
 
 	ss.AccessToken = token.AccessToken
 	ss.RefreshToken = token.RefreshToken
+	ss.RefreshExpiresOn = getRefreshTokenExpiry(token)
 	ss.IDToken = rawIDToken
 
 	ss.CreatedAtNow()
@@ -9,6 +9,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
@@ -19,11 +20,12 @@ import (
 )
 
 type redeemTokenResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	ExpiresIn    int64  `json:"expires_in"`
-	TokenType    string `json:"token_type"`
-	IDToken      string `json:"id_token,omitempty"`
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in,omitempty"`
+	TokenType        string `json:"token_type"`
+	IDToken          string `json:"id_token,omitempty"`
 }
 
 func newOIDCProvider(serverURL *url.URL, skipNonce bool) *OIDCProvider {
@@ -109,11 +111,12 @@ func TestOIDCProviderGetLoginURL(t *testing.T) {
 func TestOIDCProviderRedeem(t *testing.T) {
 	idToken, _ := newSignedTestIDToken(defaultIDToken)
 	body, _ := json.Marshal(redeemTokenResponse{
-		AccessToken:  accessToken,
-		ExpiresIn:    10,
-		TokenType:    "Bearer",
-		RefreshToken: refreshToken,
-		IDToken:      idToken,
+		AccessToken:      accessToken,
+		ExpiresIn:        10,
+		RefreshExpiresIn: 1800,
+		TokenType:        "Bearer",
+		RefreshToken:     refreshToken,
+		IDToken:          idToken,
 	})
 
 	server, provider := newTestOIDCSetup(body)
@@ -126,6 +129,8 @@ func TestOIDCProviderRedeem(t *testing.T) {
 	assert.Equal(t, idToken, session.IDToken)
 	assert.Equal(t, refreshToken, session.RefreshToken)
 	assert.Equal(t, "123456789", session.User)
+	assert.NotNil(t, session.RefreshExpiresOn)
+	assert.WithinDuration(t, time.Now().Add(30*time.Minute), *session.RefreshExpiresOn, time.Minute)
 }
 
 func TestOIDCProviderRedeem_custom_userid(t *testing.T) {
@@ -147,6 +152,43 @@ func TestOIDCProviderRedeem_custom_userid(t *testing.T) {
 	assert.Equal(t, defaultIDToken.Phone, session.Email)
 }
 
+func TestOIDCProviderValidateSession(t *testing.T) {
+	testCases := map[string]struct {
+		Nonce    []byte
+		IDToken  idTokenClaims
+		Expected bool
+	}{
+		"Nonces match": {
+			Nonce:    []byte(oidcNonce),
+			IDToken:  defaultIDToken,
+			Expected: true,
+		},
+		"Nonces do not match": {
+			Nonce:    []byte("WrongWrongWrong"),
+			IDToken:  defaultIDToken,
+			Expected: false,
+		},
+		"Session without a nonce from the device authorization grant": {
+			Nonce:    nil,
+			IDToken:  minimalIDToken,
+			Expected: true,
+		},
+	}
+	for testName, tc := range testCases {
+		t.Run(testName, func(t *testing.T) {
+			server, provider := newTestOIDCSetup([]byte(`{}`))
+			defer server.Close()
+			assert.False(t, provider.SkipNonce)
+
+			rawIDToken, err := newSignedTestIDToken(tc.IDToken)
+			assert.NoError(t, err)
+
+			session := &sessions.SessionState{IDToken: rawIDToken, Nonce: tc.Nonce}
+			assert.Equal(t, tc.Expected, provider.ValidateSession(context.Background(), session))
+		})
+	}
+}
+
 func TestOIDCProviderRefreshSessionIfNeededWithoutIdToken(t *testing.T) {
 
 	idToken, _ := newSignedTestIDToken(defaultIDToken)
@@ -170,9 +212,14 @@ func TestOIDCProviderRefreshSessionIfNeededWithoutIdToken(t *testing.T) {
 		User:         "11223344",
 	}
 
+	refreshExpiresOn := time.Now().Add(time.Hour)
+	existingSession.RefreshExpiresOn = &refreshExpiresOn
+
 	refreshed, err := provider.RefreshSession(context.Background(), existingSession)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, refreshed, true)
+	// The same refresh token was returned without a new expiry
+	assert.Equal(t, &refreshExpiresOn, existingSession.RefreshExpiresOn)
 	assert.Equal(t, "janedoe@example.com", existingSession.Email)
 	assert.Equal(t, accessToken, existingSession.AccessToken)
 	assert.Equal(t, idToken, existingSession.IDToken)
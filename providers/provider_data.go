@@ -9,6 +9,7 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
@@ -16,6 +17,7 @@ import (
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	internaloidc "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/providers/oidc"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/providers/util"
+	"github.com/spf13/cast"
 	"golang.org/x/oauth2"
 )
 
@@ -30,6 +32,9 @@ type ProviderData struct {
 	ProviderName      string
 	LoginURL          *url.URL
 	RedeemURL         *url.URL
+	DeviceAuthURL     *url.URL
+	IntrospectionURL  *url.URL
+	PARURL            *url.URL
 	ProfileURL        *url.URL
 	ProtectedResource *url.URL
 	ValidateURL       *url.URL
@@ -37,6 +42,8 @@ type ProviderData struct {
 	ClientSecret      string
 	ClientSecretFile  string
 	Scope             string
+	// Bind tokens to a per-session DPoP key pair (RFC 9449)
+	DPoP bool
 	// The picked CodeChallenge Method or empty if none.
 	CodeChallengeMethod string
 	// Code challenge methods supported by the Provider
@@ -49,6 +56,12 @@ type ProviderData struct {
 	GroupsClaim              string
 	Verifier                 internaloidc.IDTokenVerifier
 	SkipClaimsFromProfileURL bool
+	// ExtraAudiences are the audiences, besides the client ID, that tokens
+	// may be issued for
+	ExtraAudiences []string
+	// ClaimsProviderIssuers are the issuers trusted to sign aggregated and
+	// distributed claims
+	ClaimsProviderIssuers []string
 
 	// Universal Group authorization data structure
 	// any provider can set to consume
@@ -57,6 +70,8 @@ type ProviderData struct {
 	getAuthorizationHeaderFunc func(string) http.Header
 	loginURLParameterDefaults  url.Values
 	loginURLParameterOverrides map[string]*regexp.Regexp
+	requestObjectSigner        *requestObjectSigner
+	userInfoPrecedence         util.PrecedenceRules
 
 	BackendLogoutURL string
 }
@@ -238,14 +253,14 @@ func (p *ProviderData) verifyIDToken(ctx context.Context, token *oauth2.Token) (
 
 // buildSessionFromClaims uses IDToken claims to populate a fresh SessionState
 // with non-Token related fields.
-func (p *ProviderData) buildSessionFromClaims(rawIDToken, accessToken string) (*sessions.SessionState, error) {
+func (p *ProviderData) buildSessionFromClaims(ctx context.Context, rawIDToken, accessToken string) (*sessions.SessionState, error) {
 	ss := &sessions.SessionState{}
 
 	if rawIDToken == "" {
 		return ss, nil
 	}
 
-	extractor, err := p.getClaimExtractor(rawIDToken, accessToken)
+	extractor, err := p.getClaimExtractor(ctx, rawIDToken, accessToken)
 	if err != nil {
 		return nil, err
 	}
@@ -266,6 +281,10 @@ func (p *ProviderData) buildSessionFromClaims(rawIDToken, accessToken string) (*
 		}
 	}
 
+	if err := extractAuthenticationContext(ctx, rawIDToken, ss); err != nil {
+		return nil, err
+	}
+
 	// `email_verified` must be present and explicitly set to `false` to be
 	// considered unverified.
 	verifyEmail := (p.EmailClaim == options.OIDCEmailClaim) && !p.AllowUnverifiedEmail
@@ -285,13 +304,46 @@ func (p *ProviderData) buildSessionFromClaims(rawIDToken, accessToken string) (*
 	return ss, nil
 }
 
-func (p *ProviderData) getClaimExtractor(rawIDToken, accessToken string) (util.ClaimExtractor, error) {
+// extractAuthenticationContext records how and when the user authenticated
+// from the `acr`, `amr` and `auth_time` claims. These describe the
+// authentication event itself so they are only read from the ID Token.
+func extractAuthenticationContext(ctx context.Context, rawIDToken string, ss *sessions.SessionState) error {
+	extractor, err := util.NewClaimExtractor(ctx, rawIDToken, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := extractor.GetClaimInto("acr", &ss.ACR); err != nil {
+		return err
+	}
+	if _, err := extractor.GetClaimInto("amr", &ss.AMR); err != nil {
+		return err
+	}
+
+	authTime, exists, err := extractor.GetClaim("auth_time")
+	if err != nil || !exists {
+		return err
+	}
+	seconds, err := cast.ToInt64E(authTime)
+	if err != nil {
+		return fmt.Errorf("could not parse auth_time claim: %v", err)
+	}
+	t := time.Unix(seconds, 0)
+	ss.AuthTime = &t
+	return nil
+}
+
+func (p *ProviderData) getClaimExtractor(ctx context.Context, rawIDToken, accessToken string) (util.ClaimExtractor, error) {
+	if p.userInfoEnrichmentEnabled() && accessToken != "" {
+		return p.getUserInfoClaimExtractor(ctx, rawIDToken, accessToken)
+	}
+
 	profileURL := p.ProfileURL
 	if p.SkipClaimsFromProfileURL {
 		profileURL = &url.URL{}
 	}
 
-	extractor, err := util.NewClaimExtractor(context.TODO(), rawIDToken, profileURL, p.getAuthorizationHeader(accessToken))
+	extractor, err := util.NewClaimExtractor(ctx, rawIDToken, profileURL, p.getAuthorizationHeader(accessToken), p.ClaimsProviderIssuers)
 	if err != nil {
 		return nil, fmt.Errorf("could not initialise claim extractor: %v", err)
 	}
@@ -300,8 +352,8 @@ func (p *ProviderData) getClaimExtractor(rawIDToken, accessToken string) (util.C
 }
 
 // checkNonce compares the session's nonce with the IDToken's nonce claim
-func (p *ProviderData) checkNonce(s *sessions.SessionState) error {
-	extractor, err := p.getClaimExtractor(s.IDToken, "")
+func (p *ProviderData) checkNonce(ctx context.Context, s *sessions.SessionState) error {
+	extractor, err := p.getClaimExtractor(ctx, s.IDToken, "")
 	if err != nil {
 		return fmt.Errorf("id_token claims extraction failed: %v", err)
 	}
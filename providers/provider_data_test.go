@@ -120,6 +120,9 @@ type idTokenClaims struct {
 	Roles    interface{} `json:"roles,omitempty"`
 	Verified *bool       `json:"email_verified,omitempty"`
 	Nonce    string      `json:"nonce,omitempty"`
+	ACR      string      `json:"acr,omitempty"`
+	AMR      []string    `json:"amr,omitempty"`
+	AuthTime int64       `json:"auth_time,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -226,6 +229,12 @@ func TestProviderData_verifyIDToken(t *testing.T) {
 }
 
 func TestProviderData_buildSessionFromClaims(t *testing.T) {
+	authContextIDToken := defaultIDToken
+	authContextIDToken.ACR = "urn:mace:incommon:iap:silver"
+	authContextIDToken.AMR = []string{"pwd", "otp"}
+	authContextIDToken.AuthTime = 1700000000
+	authTime := time.Unix(1700000000, 0)
+
 	testCases := map[string]struct {
 		IDToken                  idTokenClaims
 		AllowUnverified          bool
@@ -251,6 +260,22 @@ func TestProviderData_buildSessionFromClaims(t *testing.T) {
 				PreferredUsername: "Jane Dobbs",
 			},
 		},
+		"Authentication Context": {
+			IDToken:         authContextIDToken,
+			AllowUnverified: false,
+			EmailClaim:      "email",
+			GroupsClaim:     "groups",
+			UserClaim:       "sub",
+			ExpectedSession: &sessions.SessionState{
+				User:              "123456789",
+				Email:             "janed@me.com",
+				Groups:            []string{"test:a", "test:b"},
+				PreferredUsername: "Jane Dobbs",
+				ACR:               "urn:mace:incommon:iap:silver",
+				AMR:               []string{"pwd", "otp"},
+				AuthTime:          &authTime,
+			},
+		},
 		"Unverified Denied": {
 			IDToken:         unverifiedIDToken,
 			AllowUnverified: false,
@@ -457,7 +482,7 @@ func TestProviderData_buildSessionFromClaims(t *testing.T) {
 			rawIDToken, err := newSignedTestIDToken(tc.IDToken)
 			g.Expect(err).ToNot(HaveOccurred())
 
-			ss, err := provider.buildSessionFromClaims(rawIDToken, "testtoken")
+			ss, err := provider.buildSessionFromClaims(context.Background(), rawIDToken, "testtoken")
 			if err != nil {
 				g.Expect(err).To(Equal(tc.ExpectedError))
 			}
@@ -520,7 +545,7 @@ func TestProviderData_checkNonce(t *testing.T) {
 				), verificationOptions),
 			}
 
-			if err := provider.checkNonce(tc.Session); err != nil {
+			if err := provider.checkNonce(context.Background(), tc.Session); err != nil {
 				g.Expect(err).To(Equal(tc.ExpectedError))
 			} else {
 				g.Expect(err).ToNot(HaveOccurred())
@@ -2,6 +2,7 @@ package providers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 
@@ -29,6 +30,8 @@ type Provider interface {
 	ValidateSession(ctx context.Context, s *sessions.SessionState) bool
 	RefreshSession(ctx context.Context, s *sessions.SessionState) (bool, error)
 	CreateSessionFromToken(ctx context.Context, token string) (*sessions.SessionState, error)
+	StartDeviceAuthorization(ctx context.Context) (*DeviceAuthorization, error)
+	RedeemDeviceCode(ctx context.Context, deviceCode string) (*sessions.SessionState, error)
 }
 
 func NewProvider(providerConfig options.Provider) (Provider, error) {
@@ -105,21 +108,41 @@ func newProviderDataFromConfig(providerConfig options.Provider) (*ProviderData,
 			providerConfig.LoginURL = endpoints.AuthURL
 			providerConfig.RedeemURL = endpoints.TokenURL
 			providerConfig.ProfileURL = endpoints.UserInfoURL
+			providerConfig.DeviceAuthURL = endpoints.DeviceAuthURL
+			providerConfig.PushedAuthorizationRequestURL = endpoints.PARURL
+			if pv.Provider().RequirePAR() {
+				providerConfig.PushedAuthorizationRequests = true
+			}
+			providerConfig.IntrospectionURL = endpoints.IntrospectionURL
 			providerConfig.OIDCConfig.JwksURL = endpoints.JWKsURL
 			p.SupportedCodeChallengeMethods = pkce.CodeChallengeAlgs
 		}
 	}
 
 	errs := []error{}
+
+	// The endpoint is only kept when pushed authorization requests are used,
+	// as the login parameters are pushed whenever it is set
+	parURL := ""
+	if providerConfig.PushedAuthorizationRequests {
+		parURL = providerConfig.PushedAuthorizationRequestURL
+		if parURL == "" {
+			errs = append(errs, errors.New("pushed authorization requests are enabled but the provider has no pushed authorization request endpoint"))
+		}
+	}
+
 	for name, u := range map[string]struct {
 		dst **url.URL
 		raw string
 	}{
-		"login":    {dst: &p.LoginURL, raw: providerConfig.LoginURL},
-		"redeem":   {dst: &p.RedeemURL, raw: providerConfig.RedeemURL},
-		"profile":  {dst: &p.ProfileURL, raw: providerConfig.ProfileURL},
-		"validate": {dst: &p.ValidateURL, raw: providerConfig.ValidateURL},
-		"resource": {dst: &p.ProtectedResource, raw: providerConfig.ProtectedResource},
+		"login":      {dst: &p.LoginURL, raw: providerConfig.LoginURL},
+		"redeem":     {dst: &p.RedeemURL, raw: providerConfig.RedeemURL},
+		"device":     {dst: &p.DeviceAuthURL, raw: providerConfig.DeviceAuthURL},
+		"par":        {dst: &p.PARURL, raw: parURL},
+		"introspect": {dst: &p.IntrospectionURL, raw: providerConfig.IntrospectionURL},
+		"profile":    {dst: &p.ProfileURL, raw: providerConfig.ProfileURL},
+		"validate":   {dst: &p.ValidateURL, raw: providerConfig.ValidateURL},
+		"resource":   {dst: &p.ProtectedResource, raw: providerConfig.ProtectedResource},
 	} {
 		var err error
 		*u.dst, err = url.Parse(u.raw)
@@ -130,6 +153,12 @@ func newProviderDataFromConfig(providerConfig options.Provider) (*ProviderData,
 	// handle LoginURLParameters
 	errs = append(errs, p.compileLoginParams(providerConfig.LoginURLParameters)...)
 
+	if providerConfig.RequestObject != nil {
+		if err := p.setRequestObjectSigner(*providerConfig.RequestObject, providerConfig.OIDCConfig.IssuerURL); err != nil {
+			errs = append(errs, fmt.Errorf("could not configure request object signing: %v", err))
+		}
+	}
+
 	if len(errs) > 0 {
 		return nil, k8serrors.NewAggregate(errs)
 	}
@@ -138,7 +167,10 @@ func newProviderDataFromConfig(providerConfig options.Provider) (*ProviderData,
 	p.AllowUnverifiedEmail = providerConfig.OIDCConfig.InsecureAllowUnverifiedEmail
 	p.EmailClaim = providerConfig.OIDCConfig.EmailClaim
 	p.GroupsClaim = providerConfig.OIDCConfig.GroupsClaim
+	p.ExtraAudiences = providerConfig.OIDCConfig.ExtraAudiences
+	p.ClaimsProviderIssuers = providerConfig.OIDCConfig.ClaimsProviderIssuers
 	p.SkipClaimsFromProfileURL = providerConfig.SkipClaimsFromProfileURL
+	p.setUserInfoEnrichment(providerConfig.OIDCConfig.UserInfo)
 
 	// Set PKCE enabled or disabled based on discovery and force options
 	p.CodeChallengeMethod = parseCodeChallengeMethod(providerConfig)
@@ -160,6 +192,7 @@ func newProviderDataFromConfig(providerConfig options.Provider) (*ProviderData,
 	p.setAllowedGroups(providerConfig.AllowedGroups)
 
 	p.BackendLogoutURL = providerConfig.BackendLogoutURL
+	p.DPoP = providerConfig.DPoP
 
 	return p, nil
 }
@@ -1,6 +1,9 @@
 package providers
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
@@ -17,6 +20,7 @@ const (
 	msKeysURL   = "https://login.microsoftonline.com/fabrikamb2c.onmicrosoft.com/discovery/v2.0/keys"
 	msAuthURL   = "https://login.microsoftonline.com/fabrikamb2c.onmicrosoft.com/oauth2/v2.0/authorize?p=b2c_1_sign_in"
 	msTokenURL  = "https://login.microsoftonline.com/fabrikamb2c.onmicrosoft.com/oauth2/v2.0/token?p=b2c_1_sign_in"
+	msParURL    = "https://login.microsoftonline.com/fabrikamb2c.onmicrosoft.com/oauth2/v2.0/par"
 )
 
 func TestClientSecretFileOptionFails(t *testing.T) {
@@ -120,6 +124,87 @@ func TestURLsCorrectlyParsed(t *testing.T) {
 	g.Expect(pd.RedeemURL.String()).To(Equal(msTokenURL))
 }
 
+func TestPushedAuthorizationRequestsOptIn(t *testing.T) {
+	g := NewWithT(t)
+
+	providerConfig := options.Provider{
+		ID:                            providerID,
+		Type:                          "oidc",
+		ClientID:                      clientID,
+		ClientSecretFile:              clientSecret,
+		LoginURL:                      msAuthURL,
+		RedeemURL:                     msTokenURL,
+		PushedAuthorizationRequestURL: msParURL,
+		OIDCConfig: options.OIDCOptions{
+			IssuerURL:     msIssuerURL,
+			SkipDiscovery: true,
+			JwksURL:       msKeysURL,
+		},
+	}
+
+	pd, err := newProviderDataFromConfig(providerConfig)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pd.PARRequired()).To(BeFalse())
+
+	providerConfig.PushedAuthorizationRequests = true
+	pd, err = newProviderDataFromConfig(providerConfig)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pd.PARRequired()).To(BeTrue())
+	g.Expect(pd.PARURL.String()).To(Equal(msParURL))
+
+	providerConfig.PushedAuthorizationRequestURL = ""
+	_, err = newProviderDataFromConfig(providerConfig)
+	g.Expect(err).To(MatchError(ContainSubstring("pushed authorization requests are enabled but the provider has no pushed authorization request endpoint")))
+}
+
+func TestPushedAuthorizationRequestsFromDiscovery(t *testing.T) {
+	testCases := map[string]struct {
+		requirePAR  bool
+		expectedPAR bool
+	}{
+		"advertised endpoint only": {
+			requirePAR:  false,
+			expectedPAR: false,
+		},
+		"required by the provider": {
+			requirePAR:  true,
+			expectedPAR: true,
+		},
+	}
+	for testName, tc := range testCases {
+		t.Run(testName, func(t *testing.T) {
+			g := NewWithT(t)
+
+			var issuer string
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+				rw.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+					"issuer":                                issuer,
+					"authorization_endpoint":                issuer + "/authorize",
+					"token_endpoint":                        issuer + "/token",
+					"jwks_uri":                              issuer + "/keys",
+					"pushed_authorization_request_endpoint": issuer + "/par",
+					"require_pushed_authorization_requests": tc.requirePAR,
+				})
+			}))
+			defer server.Close()
+			issuer = server.URL
+
+			pd, err := newProviderDataFromConfig(options.Provider{
+				ID:               providerID,
+				Type:             "oidc",
+				ClientID:         clientID,
+				ClientSecretFile: clientSecret,
+				OIDCConfig: options.OIDCOptions{
+					IssuerURL: issuer,
+				},
+			})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(pd.PARRequired()).To(Equal(tc.expectedPAR))
+		})
+	}
+}
+
 func TestScope(t *testing.T) {
 	g := NewWithT(t)
 
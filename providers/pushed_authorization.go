@@ -0,0 +1,188 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"crypto/elliptic"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options/util"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+)
+
+// requestObjectLifetime is how long a signed request object is valid for
+const requestObjectLifetime = 5 * time.Minute
+
+// requestObjectSigner signs authorization request objects (RFC 9101)
+type requestObjectSigner struct {
+	key      interface{}
+	method   jwt.SigningMethod
+	keyID    string
+	audience string
+}
+
+// setRequestObjectSigner loads the request object signing key.
+// The audience of request objects is the issuer of the provider.
+func (p *ProviderData) setRequestObjectSigner(opts options.RequestObject, issuerURL string) error {
+	if opts.SigningKey == nil {
+		return errors.New("signing key is required")
+	}
+	keyData, err := util.GetSecretValue(opts.SigningKey)
+	if err != nil {
+		return fmt.Errorf("could not load signing key: %v", err)
+	}
+
+	signer := &requestObjectSigner{
+		keyID:    opts.KeyID,
+		audience: issuerURL,
+	}
+	if rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM(keyData); err == nil {
+		signer.key = rsaKey
+		signer.method = jwt.SigningMethodRS256
+	} else if ecKey, err := jwt.ParseECPrivateKeyFromPEM(keyData); err == nil {
+		if ecKey.Curve != elliptic.P256() {
+			return errors.New("only P-256 ECDSA keys are supported")
+		}
+		signer.key = ecKey
+		signer.method = jwt.SigningMethodES256
+	} else {
+		return errors.New("signing key must be a PEM encoded RSA or ECDSA private key")
+	}
+
+	p.requestObjectSigner = signer
+	return nil
+}
+
+// sign creates a request object containing the authorization request
+// parameters as claims.
+func (s *requestObjectSigner) sign(clientID string, loginURL *url.URL, params url.Values) (string, error) {
+	jti, err := encryption.Nonce(32)
+	if err != nil {
+		return "", err
+	}
+
+	audience := s.audience
+	if audience == "" {
+		audience = (&url.URL{Scheme: loginURL.Scheme, Host: loginURL.Host}).String()
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for key, values := range params {
+		if len(values) == 1 {
+			claims[key] = values[0]
+		} else {
+			claims[key] = values
+		}
+	}
+	claims["iss"] = clientID
+	claims["aud"] = audience
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(requestObjectLifetime).Unix()
+	claims["jti"] = fmt.Sprintf("%x", jti)
+
+	token := jwt.NewWithClaims(s.method, claims)
+	if s.keyID != "" {
+		token.Header["kid"] = s.keyID
+	}
+	return token.SignedString(s.key)
+}
+
+// PARRequired returns true when login parameters should be pushed to the
+// provider before redirecting the user (RFC 9126)
+func (p *ProviderData) PARRequired() bool {
+	return p.PARURL != nil && p.PARURL.String() != ""
+}
+
+// PrepareLoginURL moves the parameters of a login URL built by GetLoginURL
+// out of the front channel when the provider supports it.
+// With a request object signer the parameters are sent as a signed request
+// object (RFC 9101). With a pushed authorization request endpoint they are
+// pushed to the provider and only the `request_uri` is kept in the URL (RFC 9126).
+// Otherwise the login URL is returned unchanged.
+func (p *ProviderData) PrepareLoginURL(ctx context.Context, loginURL string) (string, error) {
+	if !p.PARRequired() && p.requestObjectSigner == nil {
+		return loginURL, nil
+	}
+
+	u, err := url.Parse(loginURL)
+	if err != nil {
+		return "", fmt.Errorf("could not parse login URL: %v", err)
+	}
+	params := u.Query()
+
+	if p.requestObjectSigner != nil {
+		requestObject, err := p.requestObjectSigner.sign(p.ClientID, u, params)
+		if err != nil {
+			return "", fmt.Errorf("could not sign request object: %v", err)
+		}
+		params = url.Values{}
+		params.Set("client_id", p.ClientID)
+		params.Set("request", requestObject)
+	}
+
+	if p.PARRequired() {
+		requestURI, err := p.pushAuthorizationRequest(ctx, params)
+		if err != nil {
+			return "", err
+		}
+		params = url.Values{}
+		params.Set("client_id", p.ClientID)
+		params.Set("request_uri", requestURI)
+	}
+
+	u.RawQuery = params.Encode()
+	return u.String(), nil
+}
+
+// pushAuthorizationRequest sends the authorization request parameters to the
+// pushed authorization request endpoint and returns the `request_uri`.
+func (p *ProviderData) pushAuthorizationRequest(ctx context.Context, params url.Values) (string, error) {
+	body, err := p.clientParams()
+	if err != nil {
+		return "", err
+	}
+	for key, values := range params {
+		if key == "client_id" {
+			continue
+		}
+		for _, value := range values {
+			body.Add(key, value)
+		}
+	}
+
+	result := requests.New(p.PARURL.String()).
+		WithContext(ctx).
+		WithMethod("POST").
+		WithBody(bytes.NewBufferString(body.Encode())).
+		SetHeader("Content-Type", "application/x-www-form-urlencoded").
+		SetHeader(acceptHeader, acceptApplicationJSON).
+		Do()
+	if result.Error() != nil {
+		return "", result.Error()
+	}
+	if result.StatusCode() != http.StatusCreated && result.StatusCode() != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d from pushed authorization request endpoint: %s", result.StatusCode(), result.Body())
+	}
+
+	var response struct {
+		RequestURI string `json:"request_uri"`
+		ExpiresIn  int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(result.Body(), &response); err != nil {
+		return "", fmt.Errorf("error unmarshalling pushed authorization response: %v", err)
+	}
+	if response.RequestURI == "" {
+		return "", errors.New("pushed authorization response did not contain a request_uri")
+	}
+	return response.RequestURI, nil
+}
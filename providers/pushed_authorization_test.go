@@ -0,0 +1,159 @@
+package providers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/gomega"
+)
+
+const testLoginURL = "https://idp.example.com/authorize?client_id=client&redirect_uri=https%3A%2F%2Fapp.example.com%2Foauth2%2Fcallback&response_type=code&scope=openid&state=abc"
+
+func newPARTestServer(g *WithT, expectedParams url.Values) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.ParseForm()).To(Succeed())
+		for key := range expectedParams {
+			g.Expect(r.PostForm.Get(key)).To(Equal(expectedParams.Get(key)), key)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"request_uri":"urn:ietf:params:oauth:request_uri:abc123","expires_in":60}`))
+	}))
+}
+
+func TestPrepareLoginURLUnchanged(t *testing.T) {
+	g := NewWithT(t)
+	p := &ProviderData{ClientID: "client"}
+
+	loginURL, err := p.PrepareLoginURL(context.Background(), testLoginURL)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(loginURL).To(Equal(testLoginURL))
+}
+
+func TestPrepareLoginURLPushedAuthorizationRequest(t *testing.T) {
+	g := NewWithT(t)
+	server := newPARTestServer(g, url.Values{
+		"client_id":     []string{"client"},
+		"client_secret": []string{"secret"},
+		"redirect_uri":  []string{"https://app.example.com/oauth2/callback"},
+		"response_type": []string{"code"},
+		"scope":         []string{"openid"},
+		"state":         []string{"abc"},
+	})
+	defer server.Close()
+
+	parURL, _ := url.Parse(server.URL)
+	p := &ProviderData{ClientID: "client", ClientSecret: "secret", PARURL: parURL}
+
+	loginURL, err := p.PrepareLoginURL(context.Background(), testLoginURL)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(loginURL).To(Equal("https://idp.example.com/authorize?client_id=client&request_uri=urn%3Aietf%3Aparams%3Aoauth%3Arequest_uri%3Aabc123"))
+}
+
+func TestPrepareLoginURLPushedAuthorizationRequestError(t *testing.T) {
+	g := NewWithT(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_request"}`))
+	}))
+	defer server.Close()
+
+	parURL, _ := url.Parse(server.URL)
+	p := &ProviderData{ClientID: "client", PARURL: parURL}
+
+	_, err := p.PrepareLoginURL(context.Background(), testLoginURL)
+	g.Expect(err).To(MatchError(`unexpected status 400 from pushed authorization request endpoint: {"error":"invalid_request"}`))
+}
+
+func TestPrepareLoginURLRequestObject(t *testing.T) {
+	g := NewWithT(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	g.Expect(err).ToNot(HaveOccurred())
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	p := &ProviderData{ClientID: "client"}
+	g.Expect(p.setRequestObjectSigner(options.RequestObject{
+		SigningKey: &options.SecretSource{Value: keyPEM},
+		KeyID:      "key-1",
+	}, "https://idp.example.com")).To(Succeed())
+
+	loginURL, err := p.PrepareLoginURL(context.Background(), testLoginURL)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	u, err := url.Parse(loginURL)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(u.Query()).To(HaveLen(2))
+	g.Expect(u.Query().Get("client_id")).To(Equal("client"))
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(u.Query().Get("request"), claims, func(_ *jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithAudience("https://idp.example.com"), jwt.WithIssuer("client"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(token.Header["kid"]).To(Equal("key-1"))
+	g.Expect(claims["redirect_uri"]).To(Equal("https://app.example.com/oauth2/callback"))
+	g.Expect(claims["state"]).To(Equal("abc"))
+	g.Expect(claims["client_id"]).To(Equal("client"))
+}
+
+func TestPrepareLoginURLRequestObjectWithPushedAuthorizationRequest(t *testing.T) {
+	g := NewWithT(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	g.Expect(err).ToNot(HaveOccurred())
+	der, err := x509.MarshalECPrivateKey(key)
+	g.Expect(err).ToNot(HaveOccurred())
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	var pushedRequest string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.ParseForm()).To(Succeed())
+		g.Expect(r.PostForm.Get("state")).To(BeEmpty())
+		pushedRequest = r.PostForm.Get("request")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"request_uri":"urn:ietf:params:oauth:request_uri:abc123","expires_in":60}`))
+	}))
+	defer server.Close()
+
+	parURL, _ := url.Parse(server.URL)
+	p := &ProviderData{ClientID: "client", PARURL: parURL}
+	g.Expect(p.setRequestObjectSigner(options.RequestObject{
+		SigningKey: &options.SecretSource{Value: keyPEM},
+	}, "")).To(Succeed())
+
+	loginURL, err := p.PrepareLoginURL(context.Background(), testLoginURL)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(loginURL).To(Equal("https://idp.example.com/authorize?client_id=client&request_uri=urn%3Aietf%3Aparams%3Aoauth%3Arequest_uri%3Aabc123"))
+
+	_, err = jwt.Parse(pushedRequest, func(_ *jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"ES256"}), jwt.WithAudience("https://idp.example.com"))
+	g.Expect(err).ToNot(HaveOccurred())
+}
+
+func TestSetRequestObjectSignerErrors(t *testing.T) {
+	g := NewWithT(t)
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	g.Expect(err).ToNot(HaveOccurred())
+	der, err := x509.MarshalECPrivateKey(key)
+	g.Expect(err).ToNot(HaveOccurred())
+	p384PEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	p := &ProviderData{}
+	g.Expect(p.setRequestObjectSigner(options.RequestObject{}, "")).To(MatchError("signing key is required"))
+	g.Expect(p.setRequestObjectSigner(options.RequestObject{
+		SigningKey: &options.SecretSource{Value: []byte("not a key")},
+	}, "")).To(MatchError("signing key must be a PEM encoded RSA or ECDSA private key"))
+	g.Expect(p.setRequestObjectSigner(options.RequestObject{
+		SigningKey: &options.SecretSource{Value: p384PEM},
+	}, "")).To(MatchError("only P-256 ECDSA keys are supported"))
+}
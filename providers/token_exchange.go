@@ -0,0 +1,42 @@
+package providers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// TokenExchangeGrantType is the grant type used for a token exchange (RFC 8693 section 2.1)
+	TokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// AccessTokenType identifies an OAuth 2.0 access token (RFC 8693 section 3)
+	AccessTokenType = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// ExchangeToken exchanges the subject access token for a new access token
+// scoped to the given audience, resource and scopes using the provider's
+// token endpoint.
+func (p *ProviderData) ExchangeToken(ctx context.Context, subjectToken string, exchange options.TokenExchange) (*oauth2.Token, error) {
+	params, err := p.clientParams()
+	if err != nil {
+		return nil, err
+	}
+	params.Add("grant_type", TokenExchangeGrantType)
+	params.Add("subject_token", subjectToken)
+	params.Add("subject_token_type", AccessTokenType)
+	params.Add("requested_token_type", AccessTokenType)
+	if exchange.Audience != "" {
+		params.Add("audience", exchange.Audience)
+	}
+	if exchange.Resource != "" {
+		params.Add("resource", exchange.Resource)
+	}
+	if len(exchange.Scopes) > 0 {
+		params.Add("scope", strings.Join(exchange.Scopes, " "))
+	}
+
+	return p.postTokenRequest(ctx, params)
+}
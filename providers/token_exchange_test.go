@@ -0,0 +1,84 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/dpop"
+	. "github.com/onsi/gomega"
+)
+
+func TestProviderDataExchangeToken(t *testing.T) {
+	g := NewWithT(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.ParseForm()).To(Succeed())
+		g.Expect(r.PostForm).To(Equal(url.Values{
+			"client_id":            []string{"client"},
+			"client_secret":        []string{"secret"},
+			"grant_type":           []string{TokenExchangeGrantType},
+			"subject_token":        []string{"subject"},
+			"subject_token_type":   []string{AccessTokenType},
+			"requested_token_type": []string{AccessTokenType},
+			"audience":             []string{"api"},
+			"resource":             []string{"https://api.example.com"},
+			"scope":                []string{"read write"},
+		}))
+		_, _ = w.Write([]byte(`{"access_token":"exchanged","issued_token_type":"urn:ietf:params:oauth:token-type:access_token","token_type":"Bearer","expires_in":300}`))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	p := &ProviderData{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedeemURL:    u,
+	}
+
+	token, err := p.ExchangeToken(context.Background(), "subject", options.TokenExchange{
+		Audience: "api",
+		Resource: "https://api.example.com",
+		Scopes:   []string{"read", "write"},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(token.AccessToken).To(Equal("exchanged"))
+	g.Expect(token.Expiry.IsZero()).To(BeFalse())
+}
+
+func TestProviderDataExchangeTokenError(t *testing.T) {
+	g := NewWithT(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_target"}`))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	p := &ProviderData{ClientID: "client", RedeemURL: u}
+
+	_, err := p.ExchangeToken(context.Background(), "subject", options.TokenExchange{Audience: "unknown"})
+	g.Expect(err).To(Equal(&TokenError{Code: "invalid_target"}))
+}
+
+func TestProviderDataExchangeDPoPBoundToken(t *testing.T) {
+	g := NewWithT(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The subject token is bound to the key of the proof
+		g.Expect(r.Header.Get(dpop.HeaderName)).ToNot(BeEmpty())
+		_, _ = w.Write([]byte(`{"access_token":"exchanged","issued_token_type":"urn:ietf:params:oauth:token-type:access_token","token_type":"Bearer","expires_in":300}`))
+	}))
+	defer server.Close()
+
+	key, err := dpop.GenerateKey()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	u, _ := url.Parse(server.URL)
+	p := &ProviderData{ClientID: "client", ClientSecret: "secret", RedeemURL: u}
+
+	token, err := p.ExchangeToken(dpop.NewContext(context.Background(), key), "subject", options.TokenExchange{Audience: "api"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(token.AccessToken).To(Equal("exchanged"))
+}
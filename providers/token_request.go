@@ -0,0 +1,101 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+	"golang.org/x/oauth2"
+)
+
+// TokenError is an error response returned by the token endpoint as described
+// in RFC 6749 section 5.2, and extended by RFC 8628 section 3.5 for device codes.
+type TokenError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// Error implements the error interface
+func (e *TokenError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("token endpoint error %q: %s", e.Code, e.Description)
+	}
+	return fmt.Sprintf("token endpoint error %q", e.Code)
+}
+
+// Pending returns true when a device client should keep polling the token endpoint.
+func (e *TokenError) Pending() bool {
+	return e.Code == "authorization_pending" || e.Code == "slow_down"
+}
+
+// clientParams builds the client authentication parameters sent with
+// requests to the provider's token and device authorization endpoints.
+func (p *ProviderData) clientParams() (url.Values, error) {
+	params := url.Values{}
+	params.Add("client_id", p.ClientID)
+
+	clientSecret, err := p.GetClientSecret()
+	if err != nil {
+		return nil, err
+	}
+	if clientSecret != "" {
+		params.Add("client_secret", clientSecret)
+	}
+	return params, nil
+}
+
+// postTokenRequest sends the given parameters to the token endpoint and
+// returns the resulting token, including any extra fields such as the
+// `id_token`. OAuth 2.0 error responses are returned as a *TokenError.
+func (p *ProviderData) postTokenRequest(ctx context.Context, params url.Values) (*oauth2.Token, error) {
+	result := requests.New(p.RedeemURL.String()).
+		WithContext(ctx).
+		WithMethod("POST").
+		WithBody(bytes.NewBufferString(params.Encode())).
+		SetHeader("Content-Type", "application/x-www-form-urlencoded").
+		SetHeader(acceptHeader, acceptApplicationJSON).
+		Do()
+	if result.Error() != nil {
+		return nil, result.Error()
+	}
+
+	if result.StatusCode() != http.StatusOK {
+		tokenErr := &TokenError{}
+		if err := json.Unmarshal(result.Body(), tokenErr); err != nil || tokenErr.Code == "" {
+			return nil, fmt.Errorf("unexpected status %d from token endpoint: %s", result.StatusCode(), result.Body())
+		}
+		return nil, tokenErr
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(result.Body(), &raw); err != nil {
+		return nil, fmt.Errorf("error unmarshalling token response: %v", err)
+	}
+	var jsonResponse struct {
+		AccessToken  string      `json:"access_token"`
+		TokenType    string      `json:"token_type"`
+		RefreshToken string      `json:"refresh_token"`
+		ExpiresIn    json.Number `json:"expires_in"`
+	}
+	if err := json.Unmarshal(result.Body(), &jsonResponse); err != nil {
+		return nil, fmt.Errorf("error unmarshalling token response: %v", err)
+	}
+	if jsonResponse.AccessToken == "" {
+		return nil, fmt.Errorf("no access token found %s", result.Body())
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  jsonResponse.AccessToken,
+		TokenType:    jsonResponse.TokenType,
+		RefreshToken: jsonResponse.RefreshToken,
+	}
+	if expiresIn, err := jsonResponse.ExpiresIn.Int64(); err == nil && expiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	}
+	return token.WithExtra(raw), nil
+}
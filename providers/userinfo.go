@@ -0,0 +1,58 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/providers/util"
+)
+
+// setUserInfoEnrichment configures the precedence rules used to merge
+// userinfo claims into sessions. Enrichment is disabled when opts is nil.
+func (p *ProviderData) setUserInfoEnrichment(opts *options.UserInfoOptions) {
+	if opts == nil {
+		p.userInfoPrecedence = nil
+		return
+	}
+
+	defaultPrecedence := toUtilPrecedence(opts.Precedence)
+	claimPrecedence := make(map[string]util.Precedence, len(opts.ClaimPrecedence))
+	for _, rule := range opts.ClaimPrecedence {
+		claimPrecedence[rule.Claim] = toUtilPrecedence(rule.Precedence)
+	}
+
+	p.userInfoPrecedence = func(claim string) util.Precedence {
+		if precedence, ok := claimPrecedence[claim]; ok {
+			return precedence
+		}
+		return defaultPrecedence
+	}
+}
+
+// userInfoEnrichmentEnabled returns true when sessions should be enriched
+// with the claims of the userinfo endpoint.
+func (p *ProviderData) userInfoEnrichmentEnabled() bool {
+	return p.userInfoPrecedence != nil && p.ProfileURL != nil && p.ProfileURL.String() != ""
+}
+
+// getUserInfoClaimExtractor builds a claim extractor that merges the
+// userinfo claims with the ID Token claims.
+func (p *ProviderData) getUserInfoClaimExtractor(ctx context.Context, rawIDToken, accessToken string) (util.ClaimExtractor, error) {
+	extractor, err := util.NewUserInfoClaimExtractor(ctx, rawIDToken, p.ProfileURL, p.getAuthorizationHeader(accessToken), p.userInfoPrecedence, p.ClaimsProviderIssuers)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialise userinfo claim extractor: %v", err)
+	}
+	return extractor, nil
+}
+
+func toUtilPrecedence(precedence options.ClaimPrecedence) util.Precedence {
+	switch precedence {
+	case options.UserInfoClaimPrecedence:
+		return util.PreferUserInfo
+	case options.MergeClaimPrecedence:
+		return util.MergeValues
+	default:
+		return util.PreferIDToken
+	}
+}
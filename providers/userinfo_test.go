@@ -0,0 +1,105 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/gomega"
+)
+
+func TestProviderDataUserInfoEnrichment(t *testing.T) {
+	userInfoHandler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer testtoken" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{
+			"sub": "123456789",
+			"email": "jane.dobbs@example.com",
+			"preferred_username": "jdobbs",
+			"groups": ["test:b", "userinfo:a"]
+		}`))
+	}
+
+	testCases := map[string]struct {
+		userInfo          *options.UserInfoOptions
+		accessToken       string
+		expectedEmail     string
+		expectedUsername  string
+		expectedGroups    []string
+		expectUserInfoHit bool
+	}{
+		"Without enrichment": {
+			accessToken:      "testtoken",
+			expectedEmail:    "janed@me.com",
+			expectedUsername: "Jane Dobbs",
+			expectedGroups:   []string{"test:a", "test:b"},
+		},
+		"ID token precedence": {
+			userInfo:          &options.UserInfoOptions{},
+			accessToken:       "testtoken",
+			expectedEmail:     "janed@me.com",
+			expectedUsername:  "Jane Dobbs",
+			expectedGroups:    []string{"test:a", "test:b"},
+			expectUserInfoHit: true,
+		},
+		"UserInfo precedence with per claim rules": {
+			userInfo: &options.UserInfoOptions{
+				Precedence: options.UserInfoClaimPrecedence,
+				ClaimPrecedence: []options.ClaimPrecedenceRule{
+					{Claim: "email", Precedence: options.IDTokenClaimPrecedence},
+					{Claim: "groups", Precedence: options.MergeClaimPrecedence},
+				},
+			},
+			accessToken:       "testtoken",
+			expectedEmail:     "janed@me.com",
+			expectedUsername:  "jdobbs",
+			expectedGroups:    []string{"test:a", "test:b", "userinfo:a"},
+			expectUserInfoHit: true,
+		},
+		"Without an access token": {
+			userInfo: &options.UserInfoOptions{
+				Precedence: options.UserInfoClaimPrecedence,
+			},
+			expectedEmail:    "janed@me.com",
+			expectedUsername: "Jane Dobbs",
+			expectedGroups:   []string{"test:a", "test:b"},
+		},
+	}
+	for testName, tc := range testCases {
+		t.Run(testName, func(t *testing.T) {
+			g := NewWithT(t)
+
+			var userInfoHit bool
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userInfoHit = true
+				userInfoHandler(w, r)
+			}))
+			defer server.Close()
+			profileURL, err := url.Parse(server.URL)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			provider := &ProviderData{
+				ProfileURL:                 profileURL,
+				EmailClaim:                 "email",
+				GroupsClaim:                "groups",
+				getAuthorizationHeaderFunc: makeOIDCHeader,
+			}
+			provider.setUserInfoEnrichment(tc.userInfo)
+
+			rawIDToken, err := newSignedTestIDToken(defaultIDToken)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			ss, err := provider.buildSessionFromClaims(context.Background(), rawIDToken, tc.accessToken)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ss.Email).To(Equal(tc.expectedEmail))
+			g.Expect(ss.PreferredUsername).To(Equal(tc.expectedUsername))
+			g.Expect(ss.Groups).To(Equal(tc.expectedGroups))
+			g.Expect(userInfoHit).To(Equal(tc.expectUserInfoHit))
+		})
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
+	"github.com/spf13/cast"
 	"golang.org/x/oauth2"
 )
 
@@ -61,6 +63,18 @@ func getIDToken(token *oauth2.Token) string {
 	return idToken
 }
 
+// getRefreshTokenExpiry returns when the refresh token of an oauth2.Token
+// expires, from the non-standard `refresh_expires_in` field some providers
+// (e.g. Keycloak) return. It returns nil if the expiry is not known.
+func getRefreshTokenExpiry(token *oauth2.Token) *time.Time {
+	expiresIn, err := cast.ToInt64E(token.Extra("refresh_expires_in"))
+	if err != nil || expiresIn <= 0 {
+		return nil
+	}
+	expiry := time.Now().Add(time.Duration(expiresIn) * time.Second)
+	return &expiry
+}
+
 // formatGroup coerces an OIDC groups claim into a string
 // If it is non-string, marshal it into JSON.
 func formatGroup(rawGroup interface{}) (string, error) {
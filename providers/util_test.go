@@ -3,6 +3,7 @@ package providers
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	"golang.org/x/oauth2"
@@ -79,6 +80,28 @@ func Test_getIDToken(t *testing.T) {
 	g.Expect(getIDToken(extraToken)).To(Equal(idToken))
 }
 
+func Test_getRefreshTokenExpiry(t *testing.T) {
+	g := NewWithT(t)
+
+	token := &oauth2.Token{}
+	g.Expect(getRefreshTokenExpiry(token)).To(BeNil())
+
+	for _, expiresIn := range []interface{}{float64(600), "600"} {
+		extraToken := token.WithExtra(map[string]interface{}{
+			"refresh_expires_in": expiresIn,
+		})
+		expiry := getRefreshTokenExpiry(extraToken)
+		g.Expect(expiry).ToNot(BeNil())
+		g.Expect(*expiry).To(BeTemporally("~", time.Now().Add(10*time.Minute), time.Second))
+	}
+
+	// Keycloak returns 0 for offline tokens which do not expire
+	zeroToken := token.WithExtra(map[string]interface{}{
+		"refresh_expires_in": float64(0),
+	})
+	g.Expect(getRefreshTokenExpiry(zeroToken)).To(BeNil())
+}
+
 func Test_formatGroup(t *testing.T) {
 	testCases := map[string]struct {
 		rawGroup interface{}